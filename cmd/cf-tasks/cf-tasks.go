@@ -45,6 +45,11 @@ var (
 	yubiID         = app.Flag("yubiID", "Yubi client ID if otp is set to yubikey.").Default("").String()
 	yubiSecret     = app.Flag("yubiSecret", "Yubi secret key if otp is set to yubikey").Default("").String()
 	yubiAllowedIds = app.Flag("yubiAllowedIds", "A list of IDs of yubikeys which are accepted as source for OTPs.").Default("").Strings()
+	historyFile    = app.Flag("history", "BoltDB file which stores the job history (empty disables the job history).").Default("jobhistory.db").String()
+	distribution   = app.Flag("distribution", "JSON file which configures the exchange of jobs with other proxies (job distribution).").Default("").String()
+	staging        = app.Flag("staging", "JSON file which configures the quotas and the cleanup of the staging area.").Default("").String()
+	metricsAuth    = app.Flag("metricsAuth", "Protection of /metrics: empty for the same as all other requests, \"none\", or a shared secret (sent as bearer token).").Default("").String()
+	maxArrayTasks  = app.Flag("maxArrayTasks", "Largest amount of tasks of a job array (0 is unlimited).").Default("10000").Int()
 )
 
 func main() {
@@ -65,8 +70,36 @@ func main() {
 	sc.YubiID = *yubiID
 	sc.YubiSecret = *yubiSecret
 	sc.YubiAllowedIDs = *yubiAllowedIds
+	sc.MetricsAuth = *metricsAuth
+	proxy.MaxArrayTasks = *maxArrayTasks
 
-	var ps persistency.DummyPersistency
+	ps, err := persistency.NewPersistency(*historyFile)
+	if err != nil {
+		fmt.Printf("Error during opening the job history: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *distribution != "" {
+		dc, err := proxy.ReadDistributionConfig(*distribution)
+		if err == nil {
+			_, err = proxy.EnableJobDistribution(cf, dc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling job distribution: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *staging != "" {
+		stc, err := proxy.ReadStagingConfig(*staging)
+		if err == nil {
+			_, err = proxy.EnableStagingGovernance(cf, stc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling staging governance: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, &ps, cf)
+	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, ps, cf)
 }
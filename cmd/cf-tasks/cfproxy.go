@@ -1,8 +1,8 @@
 package main
 
 import (
-	"errors"
 	"github.com/dgruber/go-cfclient"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 	"log"
 )
@@ -28,7 +28,7 @@ func New() (*CFProxy, error) {
 
 func (cp *CFProxy) RunJob(template types.JobTemplate) (jobid string, err error) {
 	if template.JobCategory == "" {
-		return "", errors.New("No jobcategory (app name) requested!")
+		return "", proxy.Errorf(types.ErrorCodeInvalidRequest, "No jobcategory (app name) requested!")
 	}
 	return cp.runTask(template)
 }
@@ -36,9 +36,9 @@ func (cp *CFProxy) RunJob(template types.JobTemplate) (jobid string, err error)
 func (cp *CFProxy) JobOperation(jobsessionname, operation, jobid string) (out string, err error) {
 	switch operation {
 	case "suspend":
-		err = errors.New("Unsupported operation: \"suspend\"")
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unsupported operation: \"suspend\"")
 	case "resume":
-		err = errors.New("Unsupported operation: \"resume\"")
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unsupported operation: \"resume\"")
 	case "terminate":
 		err = cp.client.TerminateTask(jobid)
 		if err != nil {
@@ -47,7 +47,7 @@ func (cp *CFProxy) JobOperation(jobsessionname, operation, jobid string) (out st
 		return "Terminated job", nil
 	default:
 		log.Printf("JobOperation unknown operation: %s", operation)
-		err = errors.New("Unknown operation: " + operation)
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unknown operation: %s", operation)
 	}
 	return out, err
 }
@@ -83,7 +83,3 @@ func (cp *CFProxy) DRMSVersion() string {
 func (cp *CFProxy) DRMSName() string {
 	return "Cloud Foundry Tasks"
 }
-
-func (cp *CFProxy) DRMSLoad() float64 {
-	return 0.5
-}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/dgruber/go-cfclient"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"log"
+)
+
+// orgMemory returns the memory limit (in MB) of the quotas of all orgs
+// the user has access to and the memory used by the apps of the orgs.
+// unlimited is set when an org has no memory limit.
+func (cp *CFProxy) orgMemory() (limit, used int, unlimited bool, err error) {
+	orgs, err := cp.client.ListOrgs()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	for i := range orgs {
+		quota, err := orgs[i].Quota()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if quota == nil || quota.MemoryLimit <= 0 {
+			unlimited = true
+			continue
+		}
+		summary, err := orgs[i].Summary()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		for _, space := range summary.Spaces {
+			used += space.MemDevTotal + space.MemProdTotal
+		}
+		limit += quota.MemoryLimit
+	}
+	return limit, used, unlimited, nil
+}
+
+// QuotaLoad returns the load (see proxy.ClusterLoad) of the org quota
+// with the memory limit in MB. The used slots are the memory of the apps
+// and of the running tasks, the queued work is the memory of the
+// pending tasks.
+func QuotaLoad(limit, appMemory int, tasks []cfclient.Task) float64 {
+	used, pending := float64(appMemory), 0.0
+	for _, task := range tasks {
+		switch task.State {
+		case "RUNNING":
+			used += float64(task.MemoryInMb)
+		case "PENDING":
+			pending += float64(task.MemoryInMb)
+		}
+	}
+	return proxy.ClusterLoad(used, pending, float64(limit))
+}
+
+// DRMSLoad returns the load of the org quotas. Without a memory limit
+// the load is 0. If the quotas or tasks can't be requested the cluster
+// is reported as full.
+func (cp *CFProxy) DRMSLoad() float64 {
+	limit, used, unlimited, err := cp.orgMemory()
+	if err != nil {
+		log.Printf("Can not get org quota: %s", err)
+		return 1.0
+	}
+	if unlimited {
+		return 0.0
+	}
+	tasks, err := cp.client.ListTasks()
+	if err != nil {
+		log.Printf("Can not list tasks: %s", err)
+		return 1.0
+	}
+	return QuotaLoad(limit, used, tasks)
+}
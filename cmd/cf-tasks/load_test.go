@@ -0,0 +1,24 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/go-cfclient"
+)
+
+var _ = Describe("Load", func() {
+
+	It("should use the memory of apps and tasks in the org quota", func() {
+		tasks := []cfclient.Task{
+			{State: "RUNNING", MemoryInMb: 256},
+			{State: "SUCCEEDED", MemoryInMb: 1024},
+			{State: "PENDING", MemoryInMb: 1024},
+		}
+		Ω(QuotaLoad(1024, 0, nil)).Should(BeNumerically("==", 0))
+		Ω(QuotaLoad(1024, 256, tasks[:2])).Should(BeNumerically("~", 0.35))
+		Ω(QuotaLoad(1024, 768, tasks)).Should(BeNumerically("~", 0.85))
+		Ω(QuotaLoad(0, 0, tasks)).Should(BeNumerically("==", 1))
+	})
+
+})
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"github.com/dgruber/go-cfclient"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 	"strings"
 )
@@ -38,7 +38,7 @@ func createTaskRequest(jt types.JobTemplate, guid string) (tr cfclient.TaskReque
 
 func (cp *CFProxy) runTask(jt types.JobTemplate) (string, error) {
 	if jt.JobCategory == "" {
-		return "", errors.New("No job category (app) requested.")
+		return "", proxy.Errorf(types.ErrorCodeInvalidRequest, "No job category (app) requested.")
 	}
 	guid, errGUID := cp.findAppGUID(jt.JobCategory)
 	if errGUID != nil {
@@ -19,7 +19,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"github.com/dgruber/drmaa"
 	"github.com/dgruber/ubercluster/pkg/persistency"
@@ -28,7 +27,9 @@ import (
 	"gopkg.in/alecthomas/kingpin.v1"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"sync"
 )
 
 var verbose = false
@@ -41,17 +42,55 @@ func init() {
 
 // Standard set of CLI parameters.
 var (
-	app        = kingpin.New("d1proxy", "A proxy server for DRMAA1 compatible cluster schedulers (like Univa Grid Engine).")
-	cliVerbose = app.Flag("verbose", "Enables enhanced logging for debugging.").Bool()
-	cliPort    = app.Flag("port", "Sets address and port on which proxy is listening.").Default(":8888").String()
-	certFile   = app.Flag("certFile", "Path to certification file for secure connections (TLS).").Default("").String()
-	keyFile    = app.Flag("keyFile", "Path to key file for secure connections (TLS).").Default("").String()
-	otp        = app.Flag("otp", "One time password settings (\"yubikey\") or a fixed shared secret.").Default("").String()
+	app           = kingpin.New("d1proxy", "A proxy server for DRMAA1 compatible cluster schedulers (like Univa Grid Engine).")
+	cliVerbose    = app.Flag("verbose", "Enables enhanced logging for debugging.").Bool()
+	cliPort       = app.Flag("port", "Sets address and port on which proxy is listening.").Default(":8888").String()
+	certFile      = app.Flag("certFile", "Path to certification file for secure connections (TLS).").Default("").String()
+	keyFile       = app.Flag("keyFile", "Path to key file for secure connections (TLS).").Default("").String()
+	otp           = app.Flag("otp", "One time password settings (\"yubikey\") or a fixed shared secret.").Default("").String()
+	historyFile   = app.Flag("history", "BoltDB file which stores the job history (empty disables the job history).").Default("jobhistory.db").String()
+	distribution  = app.Flag("distribution", "JSON file which configures the exchange of jobs with other proxies (job distribution).").Default("").String()
+	staging       = app.Flag("staging", "JSON file which configures the quotas and the cleanup of the staging area.").Default("").String()
+	metricsAuth   = app.Flag("metricsAuth", "Protection of /metrics: empty for the same as all other requests, \"none\", or a shared secret (sent as bearer token).").Default("").String()
+	maxArrayTasks = app.Flag("maxArrayTasks", "Largest amount of tasks of a job array (0 is unlimited).").Default("10000").Int()
+	slots         = app.Flag("slots", "Amount of slots of the cluster used for calculating the load (not available in DRMAA1).").Default("0").Int()
 )
 
 // drmaa1Proxy is our internal DRMAA1 DRMS implementation.
 type drmaa1Proxy struct {
 	Session drmaa.Session
+	// slots is the capacity of the cluster for the load calculation
+	slots     int
+	submitted *submittedJobs
+}
+
+// submittedJobs contains the ids of the unfinished jobs submitted
+// through the proxy since DRMAA1 can't list the jobs of the cluster.
+type submittedJobs struct {
+	sync.Mutex
+	ids map[string]bool
+}
+
+func (sj *submittedJobs) add(jobid string) {
+	sj.Lock()
+	defer sj.Unlock()
+	sj.ids[jobid] = true
+}
+
+func (sj *submittedJobs) remove(jobid string) {
+	sj.Lock()
+	defer sj.Unlock()
+	delete(sj.ids, jobid)
+}
+
+func (sj *submittedJobs) list() []string {
+	sj.Lock()
+	defer sj.Unlock()
+	ids := make([]string, 0, len(sj.ids))
+	for id := range sj.ids {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // convertDRMAAJobTemplate transforms a DRMAA2 job template (from ubercluster package)
@@ -71,6 +110,11 @@ func convertDRMAAJobTemplate(s drmaa.Session, jt types.JobTemplate) (*drmaa.JobT
 	if err := djt.SetArgs(jt.Args); err != nil {
 		log.Println("Error during SetArgs: ", err)
 	}
+	if jt.SubmitAsHold {
+		if err := djt.SetJobSubmissionState(drmaa.HoldState); err != nil {
+			log.Println("Error during SetJobSubmissionState: ", err)
+		}
+	}
 	// TODO we have more parameters
 	return &djt, nil
 }
@@ -90,12 +134,13 @@ func (dp *drmaa1Proxy) RunJob(template types.JobTemplate) (jobid string, err err
 	}
 	if jt, convErr := convertDRMAAJobTemplate(dp.Session, template); convErr != nil {
 		log.Println("Error during job template conversion: ", convErr)
-		err = convErr
+		err = proxy.Errorf(types.ErrorCodeInvalidRequest, "invalid job template: %s", convErr)
 	} else {
-		if id, runErr := dp.Session.RunJob(jt); err != nil {
-			err = runErr
+		if id, runErr := dp.Session.RunJob(jt); runErr != nil {
+			err = proxy.Errorf(types.ErrorCodeInvalidRequest, "can not run job: %s", runErr)
 		} else {
 			jobid = id
+			dp.submitted.add(id)
 		}
 	}
 	return jobid, err
@@ -124,10 +169,21 @@ func (dp *drmaa1Proxy) JobOperation(jobsessionname, operation, jobid string) (ou
 		} else {
 			out = "Terminated Job"
 		}
-		// TODO adding hold and resume
+	case "hold":
+		if opErr := dp.Session.HoldJob(jobid); opErr != nil {
+			err = opErr
+		} else {
+			out = "Held Job"
+		}
+	case "release":
+		if opErr := dp.Session.ReleaseJob(jobid); opErr != nil {
+			err = opErr
+		} else {
+			out = "Released Job"
+		}
 	default:
 		log.Println("JobOperation unknown operation ", operation)
-		err = errors.New("Unknown operation: " + operation)
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unknown operation: %s", operation)
 	}
 	return out, err
 }
@@ -255,17 +311,41 @@ func (dp *drmaa1Proxy) DRMSName() string {
 	return sys
 }
 
-// DRMSLoad returns the load of the DRMAA1 cluster.
+// DRMSLoad returns the load of the DRMAA1 cluster (see proxy.ClusterLoad)
+// based on the states of the jobs submitted through the proxy, since
+// DRMAA1 can't list all jobs of the cluster. The capacity is set with
+// --slots. Without it the cluster counts as full when jobs are queued.
 func (dp *drmaa1Proxy) DRMSLoad() float64 {
-	// TODO some ratio about pending / running jobs respecting the
-	// throughput
-	return 0.5
+	var used, queued float64
+	for _, jobid := range dp.submitted.list() {
+		state, err := dp.Session.JobPs(jobid)
+		if err != nil {
+			dp.submitted.remove(jobid)
+			continue
+		}
+		switch convertDRMAAState(state) {
+		case types.Running:
+			used++
+		case types.Queued:
+			queued++
+		case types.Done, types.Failed:
+			dp.submitted.remove(jobid)
+		}
+	}
+	capacity := float64(dp.slots)
+	if capacity <= 0 {
+		capacity = used + 1
+		if queued > 0 {
+			capacity = math.Max(used, 1)
+		}
+	}
+	return proxy.ClusterLoad(used, queued, capacity)
 }
 
 // initDRMAA opens a DRMAA session which is going to be used
 // by the callbacks.
 func initDRMAA() (drmaa1Proxy, error) {
-	var d1p drmaa1Proxy
+	d1p := drmaa1Proxy{submitted: &submittedJobs{ids: make(map[string]bool)}}
 	s, err := drmaa.MakeSession()
 	if err != nil {
 		log.Panic(err)
@@ -291,11 +371,40 @@ func main() {
 		fmt.Println("Error during initialization of DRMAA: ", err)
 		os.Exit(1)
 	}
+	d1.slots = *slots
 
 	var sc proxy.SecConfig
 	sc.OTP = *otp
-	var ps persistency.DummyPersistency
+	sc.MetricsAuth = *metricsAuth
+	proxy.MaxArrayTasks = *maxArrayTasks
+	ps, err := persistency.NewPersistency(*historyFile)
+	if err != nil {
+		fmt.Printf("Error during opening the job history: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *distribution != "" {
+		dc, err := proxy.ReadDistributionConfig(*distribution)
+		if err == nil {
+			_, err = proxy.EnableJobDistribution(&d1, dc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling job distribution: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *staging != "" {
+		stc, err := proxy.ReadStagingConfig(*staging)
+		if err == nil {
+			_, err = proxy.EnableStagingGovernance(&d1, stc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling staging governance: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, &ps, &d1)
+	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, ps, &d1)
 	defer d1.Session.Exit()
 }
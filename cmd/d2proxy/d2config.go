@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/spf13/viper"
 )
 
@@ -16,11 +17,45 @@ type ProxyConfig struct {
 	YubiID         string   // For yubikey support -> you get this from https://upgrade.yubico.com/getapikey/
 	YubiSecret     string   // For yubikey support -> register your service above
 	YubiAllowedIds []string // For yubikey support -> list of IDs of yubikeys which are allowed
+	MetricsAuth    string   // Protection of /metrics: empty like all other requests, "none", or a shared secret
 	// section for enhanced multi-clustering (exchange of jobs between clusters)
-	DistributeTo         []string // Active job distribution: List of clusters to distribute
-	DistributeAcceptFrom []string // Active job distributeion: List of clusters which can accept jobs
-	FetchFrom            []string // Active fetching for jobs: List of clusters which are queried
-	FetchAcceptFrom      []string // Active fetching for jobs: List of clusters which are allowed to serve when they are actively requesing jobs
+	DistributionID       string       // Id of this proxy which is sent to the other proxies
+	DistributionState    string       // BoltDB file of the exchanged jobs (kept in memory only when empty)
+	DistributeTo         []proxy.Peer // Active job distribution: List of clusters to distribute
+	DistributeAcceptFrom []proxy.Peer // Active job distributeion: List of clusters which can accept jobs
+	FetchFrom            []proxy.Peer // Active fetching for jobs: List of clusters which are queried
+	FetchAcceptFrom      []proxy.Peer // Active fetching for jobs: List of clusters which are allowed to serve when they are actively requesing jobs
+	HighLoad             float64      // Load above which jobs are distributed
+	LowLoad              float64      // Load below which jobs are fetched
+	FetchInterval        string       // How often jobs are fetched (like "30s")
+	// quotas and cleanup of the staging area
+	Staging proxy.StagingConfig
+}
+
+// DistributionConfig returns the configuration of the job exchange
+// with other clusters. The certificate and shared secret of the proxy
+// are used for authenticating at the other proxies.
+func (c ProxyConfig) DistributionConfig() proxy.DistributionConfig {
+	return proxy.DistributionConfig{
+		ID:                   c.DistributionID,
+		DistributeTo:         c.DistributeTo,
+		DistributeAcceptFrom: c.DistributeAcceptFrom,
+		FetchFrom:            c.FetchFrom,
+		FetchAcceptFrom:      c.FetchAcceptFrom,
+		HighLoad:             c.HighLoad,
+		LowLoad:              c.LowLoad,
+		FetchInterval:        c.FetchInterval,
+		StateFile:            c.DistributionState,
+		OTP:                  c.OTP,
+		CertFile:             c.CertFile,
+		KeyFile:              c.KeyFile,
+	}
+}
+
+// distributesJobs returns true if jobs are exchanged with other clusters.
+func (c ProxyConfig) distributesJobs() bool {
+	return len(c.DistributeTo) > 0 || len(c.DistributeAcceptFrom) > 0 ||
+		len(c.FetchFrom) > 0 || len(c.FetchAcceptFrom) > 0
 }
 
 func (c ProxyConfig) String() string {
@@ -266,3 +266,34 @@ func copyMap(in map[string]string) map[string]string {
 	}
 	return out
 }
+
+func ConvertUCReservationTemplate(u types.ReservationTemplate) (rt drmaa2.ReservationTemplate) {
+	rt.Name = u.Name
+	rt.StartTime = u.StartTime
+	rt.EndTime = u.EndTime
+	rt.Duration = u.Duration
+	rt.MinSlots = u.MinSlots
+	rt.MaxSlots = u.MaxSlots
+	rt.JobCategory = u.JobCategory
+	rt.UsersACL = make([]string, len(u.UsersACL), len(u.UsersACL))
+	copy(rt.UsersACL, u.UsersACL)
+	rt.CandidateMachines = make([]string, len(u.CandidateMachines), len(u.CandidateMachines))
+	copy(rt.CandidateMachines, u.CandidateMachines)
+	rt.MinPhysMemory = u.MinPhysMemory
+	rt.MachineOs = u.MachineOs
+	rt.MachineArch = u.MachineArch
+	return rt
+}
+
+func ConvertD2ReservationInfo(ri drmaa2.ReservationInfo) (uc types.ReservationInfo) {
+	uc.ReservationId = ri.ReservationId
+	uc.ReservationName = ri.ReservationName
+	uc.ReservationStartTime = ri.ReservationStartTime
+	uc.ReservationEndTime = ri.ReservationEndTime
+	uc.ACL = make([]string, len(ri.ACL), len(ri.ACL))
+	copy(uc.ACL, ri.ACL)
+	uc.ReservedSlots = ri.ReservedSlots
+	uc.ReservedMachines = make([]string, len(ri.ReservedMachines), len(ri.ReservedMachines))
+	copy(uc.ReservedMachines, ri.ReservedMachines)
+	return uc
+}
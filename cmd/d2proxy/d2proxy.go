@@ -17,7 +17,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"github.com/dgruber/drmaa2"
 	"github.com/dgruber/ubercluster/pkg/persistency"
@@ -27,6 +26,9 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 var verbose bool = false
@@ -48,12 +50,18 @@ var (
 	yubiID         = app.Flag("yubiID", "Yubi client ID if otp is set to yubikey.").Default("").String()
 	yubiSecret     = app.Flag("yubiSecret", "Yubi secret key if otp is set to yubikey").Default("").String()
 	yubiAllowedIds = app.Flag("yubiAllowedIds", "A list of IDs of yubikeys which are accepted as source for OTPs.").Default("").Strings()
+	metricsAuth    = app.Flag("metricsAuth", "Protection of /metrics: empty for the same as all other requests, \"none\", or a shared secret (sent as bearer token).").Default("").String()
+	maxArrayTasks  = app.Flag("maxArrayTasks", "Largest amount of tasks of a job array (0 is unlimited).").Default("10000").Int()
+	historyFile    = app.Flag("history", "BoltDB file which stores the job history (empty disables the job history).").Default("jobhistory.db").String()
 )
 
 type drmaa2proxy struct {
 	sm drmaa2.SessionManager
 	ms *drmaa2.MonitoringSession
 	js *drmaa2.JobSession
+	// reservation sessions opened on demand
+	rsLock    sync.Mutex
+	rsessions map[string]*drmaa2.ReservationSession
 }
 
 // implement neccessary methods to fulfill the ProxyImplementer interface
@@ -136,14 +144,17 @@ func (d2p *drmaa2proxy) DRMSName() string {
 // DRMSLoad calculates the load situation of the
 // DRMAA2 compatible cluster. 0 means "give me
 // all jobs you have" and 1 means "I won't accept
-// any jobs". 0.5 is the default load situation.
+// any jobs". The slots of the running and pending
+// jobs are set in relation to the slots of the
+// available machines (see proxy.ClusterLoad).
 func (d2p *drmaa2proxy) DRMSLoad() float64 {
-	//var sm drmaa2.SessionManager
-	//d2p.ms.GetAllJobs(nil)
-	//d2p.ms.GetAllMachines(nil)
-	// calculate ration of pending vs running and
-	// use avg. runtime (and probably the machine count)
-	return 0.5
+	machines, err := d2p.GetAllMachines(nil)
+	if err != nil {
+		log.Println("Error during GetAllMachines(): ", err)
+		return 1.0
+	}
+	used, queued := proxy.JobSlots(d2p.GetJobInfosByFilter(false, types.JobInfo{}))
+	return proxy.ClusterLoad(used, queued, proxy.MachineSlots(machines))
 }
 
 // RunJob submits a job through the DRMAA2 API into a Univa Grid Engine
@@ -153,6 +164,17 @@ func (d2p *drmaa2proxy) DRMSLoad() float64 {
 // path.
 func (d2p *drmaa2proxy) RunJob(template types.JobTemplate) (string, error) {
 	jt := ConvertUCJobTemplate(template)
+	useStagedFile(&jt)
+	if job, err := d2p.js.RunJob(jt); err != nil {
+		return "", proxy.Errorf(types.ErrorCodeInvalidRequest, "can not run job: %s", err)
+	} else {
+		return job.GetId(), nil
+	}
+}
+
+// useStagedFile sets the absolute path of the command when it is
+// found in the file staging area.
+func useStagedFile(jt *drmaa2.JobTemplate) {
 	// workaround: if file is in staging area exexcute it otherwise
 	// the one in standard path
 	localFile := jt.WorkingDirectory + "/" + jt.RemoteCommand
@@ -163,11 +185,61 @@ func (d2p *drmaa2proxy) RunJob(template types.JobTemplate) (string, error) {
 			jt.RemoteCommand = localFile
 		}
 	}
-	if job, err := d2p.js.RunJob(jt); err != nil {
+}
+
+// RunBulkJobs submits a job array through the DRMAA2 API. Grid Engine
+// sets the task index in SGE_TASK_ID which is handed over to the tasks
+// as proxy.TaskIDEnvironmentVariable by a shell wrapper.
+func (d2p *drmaa2proxy) RunBulkJobs(template types.JobTemplate, begin, end, step, maxParallel int) (string, error) {
+	jt := ConvertUCJobTemplate(template)
+	useStagedFile(&jt)
+	wrapper := fmt.Sprintf("%s=$SGE_TASK_ID; export %s; exec \"$0\" \"$@\"",
+		proxy.TaskIDEnvironmentVariable, proxy.TaskIDEnvironmentVariable)
+	jt.Args = append([]string{"-c", wrapper, jt.RemoteCommand}, jt.Args...)
+	jt.RemoteCommand = "/bin/sh"
+	aj, err := d2p.js.RunBulkJobs(jt, begin, end, step, maxParallel)
+	if err != nil {
 		return "", err
-	} else {
-		return job.GetId(), nil
 	}
+	return aj.GetID(), nil
+}
+
+// GetArrayJobInfo returns the job infos of all tasks of a job array.
+func (d2p *drmaa2proxy) GetArrayJobInfo(arrayjobid string) *types.ArrayJobInfo {
+	aj, err := d2p.js.GetJobArray(arrayjobid)
+	if err != nil {
+		log.Println("Error during GetJobArray(): ", err)
+		return nil
+	}
+	aji := types.ArrayJobInfo{Id: aj.GetID(), Step: 1}
+	for _, job := range aj.GetJobs() {
+		jobinfo, err := job.GetJobInfo()
+		if err != nil {
+			log.Println("Error during GetJobInfo(): ", err)
+			continue
+		}
+		ji := ConvertD2JobInfo(*jobinfo)
+		aji.Tasks = append(aji.Tasks, types.ArrayTaskInfo{Index: taskIndex(ji.Id), JobInfo: ji})
+	}
+	if len(aji.Tasks) > 0 {
+		aji.Begin = aji.Tasks[0].Index
+		aji.End = aji.Tasks[len(aji.Tasks)-1].Index
+	}
+	if len(aji.Tasks) > 1 {
+		aji.Step = aji.Tasks[1].Index - aji.Tasks[0].Index
+	}
+	return &aji
+}
+
+// taskIndex returns the task index of a task job id
+// in the form arrayjobid.index.
+func taskIndex(jobid string) int {
+	if dot := strings.LastIndex(jobid, "."); dot >= 0 {
+		if index, err := strconv.Atoi(jobid[dot+1:]); err == nil {
+			return index
+		}
+	}
+	return 0
 }
 
 func (d2p *drmaa2proxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
@@ -202,12 +274,24 @@ func (d2p *drmaa2proxy) JobOperation(jobsessionname, operation, jobid string) (s
 				} else {
 					return "success", nil
 				}
+			case "hold":
+				if err := job.Hold(); err != nil {
+					return "", err
+				} else {
+					return "success", nil
+				}
+			case "release":
+				if err := job.Release(); err != nil {
+					return "", err
+				} else {
+					return "success", nil
+				}
 			default:
-				return "", errors.New("unsupported operation")
+				return "", proxy.ErrUnsupportedOperation
 			}
 		}
 	}
-	return "", errors.New("job not found")
+	return "", proxy.ErrJobNotFound
 }
 
 func main() {
@@ -248,6 +332,9 @@ func main() {
 		if *yubiAllowedIds == nil {
 			*yubiAllowedIds = cfg.YubiAllowedIds
 		}
+		if *metricsAuth == "" {
+			*metricsAuth = cfg.MetricsAuth
+		}
 	}
 
 	// Open MonitoringSession and create a JobSession with the given name
@@ -261,8 +348,29 @@ func main() {
 	sc.YubiID = *yubiID
 	sc.YubiSecret = *yubiSecret
 	sc.YubiAllowedIDs = *yubiAllowedIds
+	sc.MetricsAuth = *metricsAuth
+	proxy.MaxArrayTasks = *maxArrayTasks
+
+	pi, err := persistency.NewPersistency(*historyFile)
+	if err != nil {
+		fmt.Printf("Error during opening the job history: %s\n", err)
+		os.Exit(1)
+	}
 
-	var pi persistency.DummyPersistency
+	// exchange of jobs with other clusters
+	if cfg != nil && cfg.distributesJobs() {
+		if _, err := proxy.EnableJobDistribution(&p, cfg.DistributionConfig()); err != nil {
+			fmt.Printf("Error during enabling job distribution: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cfg != nil {
+		if _, err := proxy.EnableStagingGovernance(&p, cfg.Staging); err != nil {
+			fmt.Printf("Error during enabling staging governance: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, &pi, &p)
+	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, pi, &p)
 }
@@ -0,0 +1,136 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/dgruber/drmaa2"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"log"
+)
+
+// errNoReservation is returned when the DRMAA2 library does not
+// return a reservation (reservation sessions are optional in DRMAA2).
+var errNoReservation = proxy.Errorf(types.ErrorCodeNotImplemented,
+	"DRMAA2 library does not support advance reservations")
+
+// reservationSession returns the DRMAA2 reservation session with the
+// given name. It is created or opened when it is used the first time
+// and kept open until the proxy exits.
+func (d2p *drmaa2proxy) reservationSession(name string) (*drmaa2.ReservationSession, error) {
+	d2p.rsLock.Lock()
+	defer d2p.rsLock.Unlock()
+	if rs, exists := d2p.rsessions[name]; exists {
+		return rs, nil
+	}
+	rs, err := d2p.sm.CreateReservationSession(name, "")
+	if err != nil || rs == nil {
+		log.Println("(proxy): Reservation session ", name, " exists already. Reopen it.")
+		opened, errOpen := d2p.sm.OpenReservationSession(name)
+		if errOpen != nil {
+			return nil, errOpen
+		}
+		rs = &opened
+	}
+	if d2p.rsessions == nil {
+		d2p.rsessions = make(map[string]*drmaa2.ReservationSession)
+	}
+	d2p.rsessions[name] = rs
+	return rs, nil
+}
+
+// reservationInfo returns the converted reservation info of a DRMAA2
+// reservation.
+func reservationInfo(r *drmaa2.Reservation) (types.ReservationInfo, error) {
+	if r == nil {
+		return types.ReservationInfo{}, errNoReservation
+	}
+	ri, err := r.GetInfo()
+	if err != nil {
+		return types.ReservationInfo{}, err
+	}
+	if ri == nil {
+		return types.ReservationInfo{}, errNoReservation
+	}
+	return ConvertD2ReservationInfo(*ri), nil
+}
+
+// RequestReservation implements the proxy.ReservationImplementer interface
+// by requesting an advance reservation in a DRMAA2 reservation session.
+func (d2p *drmaa2proxy) RequestReservation(rsession string, template types.ReservationTemplate) (types.ReservationInfo, error) {
+	rs, err := d2p.reservationSession(rsession)
+	if err != nil {
+		return types.ReservationInfo{}, err
+	}
+	r, err := rs.RequestReservation(ConvertUCReservationTemplate(template))
+	if err != nil {
+		return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeConflict, "reservation not granted: %s", err)
+	}
+	return reservationInfo(r)
+}
+
+// GetReservations implements the proxy.ReservationImplementer interface.
+func (d2p *drmaa2proxy) GetReservations(rsession string) ([]types.ReservationInfo, error) {
+	rs, err := d2p.reservationSession(rsession)
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := rs.GetReservations()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]types.ReservationInfo, 0, len(reservations))
+	for i := range reservations {
+		info, err := reservationInfo(&reservations[i])
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// reservation returns the DRMAA2 reservation with the given id.
+func (d2p *drmaa2proxy) reservation(rsession, reservationid string) (*drmaa2.Reservation, error) {
+	rs, err := d2p.reservationSession(rsession)
+	if err != nil {
+		return nil, err
+	}
+	r, err := rs.GetReservation(reservationid)
+	if err != nil || r == nil {
+		return nil, proxy.Errorf(types.ErrorCodeNotFound, "reservation %s not found", reservationid)
+	}
+	return r, nil
+}
+
+// GetReservation implements the proxy.ReservationImplementer interface.
+func (d2p *drmaa2proxy) GetReservation(rsession, reservationid string) (types.ReservationInfo, error) {
+	r, err := d2p.reservation(rsession, reservationid)
+	if err != nil {
+		return types.ReservationInfo{}, err
+	}
+	return reservationInfo(r)
+}
+
+// TerminateReservation implements the proxy.ReservationImplementer interface.
+func (d2p *drmaa2proxy) TerminateReservation(rsession, reservationid string) error {
+	r, err := d2p.reservation(rsession, reservationid)
+	if err != nil {
+		return err
+	}
+	return r.Terminate()
+}
@@ -19,6 +19,7 @@ type DockerInterface interface {
 	ContainerStop(containerID string, timeout *time.Duration) error
 	ContainerList(options dtypes.ContainerListOptions) ([]dtypes.Container, error)
 	ContainerInspect(containerID string) (dtypes.ContainerJSON, error)
+	ContainerLogs(containerID string, options dtypes.ContainerLogsOptions) (io.ReadCloser, error)
 	ImageList(dtypes.ImageListOptions) ([]dtypes.ImageSummary, error)
 	ImagePull(refStr string, options dtypes.ImagePullOptions) (io.ReadCloser, error)
 	ClientVersion() string
@@ -57,6 +58,10 @@ func (d *Docker) ContainerInspect(containerID string) (dtypes.ContainerJSON, err
 	return d.cli.ContainerInspect(d.ctx, containerID)
 }
 
+func (d *Docker) ContainerLogs(containerID string, options dtypes.ContainerLogsOptions) (io.ReadCloser, error) {
+	return d.cli.ContainerLogs(d.ctx, containerID, options)
+}
+
 func (d *Docker) ImagePull(refStr string, options dtypes.ImagePullOptions) (io.ReadCloser, error) {
 	return d.cli.ImagePull(d.ctx, refStr, options)
 }
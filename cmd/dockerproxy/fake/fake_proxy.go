@@ -1,10 +1,12 @@
 package fake
 
 import (
+	"bytes"
 	dtypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"io"
+	"io/ioutil"
 	"time"
 )
 
@@ -48,6 +50,10 @@ func (f *FakeDocker) ContainerInspect(containerID string) (dtypes.ContainerJSON,
 	return dtypes.ContainerJSON{}, nil
 }
 
+func (f *FakeDocker) ContainerLogs(containerID string, options dtypes.ContainerLogsOptions) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(nil)), nil
+}
+
 func (f *FakeDocker) ImageList(dtypes.ImageListOptions) ([]dtypes.ImageSummary, error) {
 	return []dtypes.ImageSummary{
 		dtypes.ImageSummary{RepoDigests: []string{"golang/latest"}},
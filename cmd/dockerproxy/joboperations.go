@@ -2,13 +2,24 @@ package main
 
 import (
 	"fmt"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/docker/docker/client"
 )
 
+// containerError returns proxy.ErrJobNotFound when Docker does
+// not know the container, otherwise the error with description.
+func containerError(description string, err error) error {
+	if client.IsErrNotFound(err) {
+		return proxy.ErrJobNotFound
+	}
+	return fmt.Errorf("%s: %s", description, err.Error())
+}
+
 func (p *Proxy) stopContainer(id string) error {
 	err := p.client.ContainerStop(id, nil)
 	p.client.ContainerPause(id)
 	if err != nil {
-		return fmt.Errorf("Can not stop container: %s", err.Error())
+		return containerError("Can not stop container", err)
 	}
 	return nil
 }
@@ -16,7 +27,7 @@ func (p *Proxy) stopContainer(id string) error {
 func (p *Proxy) pauseContainer(id string) error {
 	err := p.client.ContainerPause(id)
 	if err != nil {
-		return fmt.Errorf("Can not pause container: %s", err.Error())
+		return containerError("Can not pause container", err)
 	}
 	return nil
 }
@@ -24,7 +35,7 @@ func (p *Proxy) pauseContainer(id string) error {
 func (p *Proxy) unpauseContainer(id string) error {
 	err := p.client.ContainerUnpause(id)
 	if err != nil {
-		return fmt.Errorf("Can not unpause container: %s", err.Error())
+		return containerError("Can not unpause container", err)
 	}
 	return nil
 }
@@ -7,6 +7,8 @@ import (
 	"os"
 )
 
+// LocalhostToMachine describes the host running the containers. The
+// memory is converted from bytes into KiB like required by DRMAA2.
 func LocalhostToMachine() types.Machine {
 	v, _ := mem.VirtualMemory()
 	l, _ := load.Avg()
@@ -23,8 +25,8 @@ func LocalhostToMachine() types.Machine {
 		CoresPerSocket: 1,
 		ThreadsPerCore: 1,
 		Load:           l.Load1,
-		PhysicalMemory: int64(v.Total),
-		VirtualMemory:  int64(v.Total),
+		PhysicalMemory: int64(v.Total / 1024),
+		VirtualMemory:  int64(v.Total / 1024),
 		Architecture:   types.X64,
 		OS:             types.OtherOS,
 		OSVersion:      osVersion,
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"io"
+	"io/ioutil"
+)
+
+// JobOutput implements the proxy.JobOutputProvider interface by
+// returning the logs of the container. The logs stream of Docker
+// multiplexes stdout and stderr hence it is demultiplexed here.
+func (p *Proxy) JobOutput(ctx context.Context, jobid, stream string, follow bool) (io.ReadCloser, error) {
+	jobid = p.held.JobID(jobid)
+	logs, err := p.client.ContainerLogs(jobid, dtypes.ContainerLogsOptions{
+		ShowStdout: stream == "stdout",
+		ShowStderr: stream == "stderr",
+		Follow:     follow,
+	})
+	if err != nil {
+		return nil, containerError("Can not get logs of container", err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer logs.Close()
+		var err error
+		if stream == "stderr" {
+			_, err = stdcopy.StdCopy(ioutil.Discard, pw, logs)
+		} else {
+			_, err = stdcopy.StdCopy(pw, ioutil.Discard, logs)
+		}
+		pw.CloseWithError(err)
+	}()
+	go func() {
+		// stop following when the client is gone
+		<-ctx.Done()
+		logs.Close()
+	}()
+	return pr, nil
+}
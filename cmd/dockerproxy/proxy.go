@@ -1,7 +1,7 @@
 package main
 
 import (
-	"errors"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 	"golang.org/x/net/context"
 	"log"
@@ -12,6 +12,9 @@ type Proxy struct {
 	client DockerInterface
 	ctx    context.Context
 	config *DockerConfig
+	// held contains the jobs submitted with SubmitAsHold since
+	// containers are started immediately.
+	held *proxy.HoldEmulator
 }
 
 func New() (*Proxy, error) {
@@ -31,17 +34,25 @@ func NewProxy(client DockerInterface, config *DockerConfig) *Proxy {
 		client: client,
 		ctx:    context.Background(),
 		config: config,
+		held:   proxy.NewHoldEmulator(),
 	}
 }
 
 func (p *Proxy) RunJob(template types.JobTemplate) (jobid string, err error) {
 	if template.JobCategory == "" {
-		return "", errors.New("No jobcategory (docker image name) requested!")
+		return "", proxy.Errorf(types.ErrorCodeInvalidRequest, "No jobcategory (docker image name) requested!")
+	}
+	if template.SubmitAsHold {
+		return p.held.Hold(template), nil
 	}
 	return p.runTask(template)
 }
 
 func (p *Proxy) JobOperation(jobsessionname, operation, jobid string) (out string, err error) {
+	if out, held, err := p.held.JobOperation(operation, jobid, p.runTask); held {
+		return out, err
+	}
+	jobid = p.held.JobID(jobid)
 	switch operation {
 	case "suspend":
 		err := p.pauseContainer(jobid)
@@ -61,19 +72,32 @@ func (p *Proxy) JobOperation(jobsessionname, operation, jobid string) (out strin
 			return out, err
 		}
 		return "Terminated job", nil
+	case "hold", "release":
+		// started containers can't be held
+		if p.getJobInfo(jobid) == nil {
+			return "", proxy.ErrJobNotFound
+		}
+		return "", proxy.ErrInvalidState
 	default:
 		log.Printf("JobOperation unknown operation: %s", operation)
-		err = errors.New("Unknown operation: " + operation)
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unknown operation: %s", operation)
 	}
 	return out, err
 }
 
 func (p *Proxy) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
-	return p.getJobInfos(filtered, filter)
+	jobinfos := p.getJobInfos(filtered, filter)
+	if jobinfos == nil {
+		return nil
+	}
+	return append(jobinfos, p.held.JobInfos()...)
 }
 
 func (p *Proxy) GetJobInfo(jobid string) *types.JobInfo {
-	return p.getJobInfo(jobid)
+	if ji := p.held.JobInfo(jobid); ji != nil {
+		return ji
+	}
+	return p.getJobInfo(p.held.JobID(jobid))
 }
 
 func (p *Proxy) GetAllMachines(machines []string) ([]types.Machine, error) {
@@ -100,6 +124,14 @@ func (p *Proxy) DRMSName() string {
 	return "Docker"
 }
 
+// DRMSLoad returns the load of the host (see proxy.HostLoad) based on
+// the running containers and the load average of the host. When the
+// containers can't be listed the host is reported as full.
 func (p *Proxy) DRMSLoad() float64 {
-	return 0.5
+	containers, err := getAllContainers(p.client, p.ctx)
+	if err != nil {
+		log.Println(err)
+		return 1.0
+	}
+	return proxy.HostLoad(float64(len(containers)))
 }
@@ -1,11 +1,15 @@
 package main_test
 
 import (
+	"context"
 	. "github.com/dgruber/ubercluster/cmd/dockerproxy"
 	"github.com/dgruber/ubercluster/cmd/dockerproxy/fake"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/shirou/gopsutil/mem"
+	"io/ioutil"
 )
 
 var _ = Describe("Proxy", func() {
@@ -28,7 +32,18 @@ var _ = Describe("Proxy", func() {
 			p := NewProxy(f, config)
 			Ω(p.DRMSVersion()).Should(Equal("1.0.0"))
 			Ω(p.DRMSName()).Should(Equal("Docker"))
-			Ω(p.DRMSLoad()).Should(BeNumerically("==", 0.5))
+			// no running containers, only the load of the host
+			Ω(p.DRMSLoad()).Should(BeNumerically(">=", 0.0))
+			Ω(p.DRMSLoad()).Should(BeNumerically("<=", proxy.UtilizationWeight))
+		})
+
+		It("must report the memory of the host in KiB", func() {
+			v, err := mem.VirtualMemory()
+			Ω(err).Should(BeNil())
+			m, err := NewProxy(f, config).GetAllMachines(nil)
+			Ω(err).Should(BeNil())
+			Ω(m).Should(HaveLen(1))
+			Ω(m[0].PhysicalMemory).Should(Equal(int64(v.Total / 1024)))
 		})
 
 		It("must show machines, queues, sessions", func() {
@@ -87,6 +102,31 @@ var _ = Describe("Proxy", func() {
 			Ω(err).ShouldNot(BeNil())
 		})
 
+		It("should start held jobs when they are released", func() {
+			p := NewProxy(f, config)
+			id, err := p.RunJob(types.JobTemplate{JobCategory: "notExisting", SubmitAsHold: true})
+			Ω(err).Should(BeNil())
+			ji := p.GetJobInfo(id)
+			Ω(ji).ShouldNot(BeNil())
+			Ω(ji.State).Should(Equal(types.QueuedHeld))
+
+			out, err := p.JobOperation("", "release", id)
+			Ω(err).Should(BeNil())
+			Ω(out).Should(Equal("Released Job"))
+			_, err = p.JobOperation("", "release", id)
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("should provide the output of a job", func() {
+			var p proxy.JobOutputProvider = NewProxy(f, config)
+			out, err := p.JobOutput(context.Background(), "id", "stdout", false)
+			Ω(err).Should(BeNil())
+			content, err := ioutil.ReadAll(out)
+			Ω(err).Should(BeNil())
+			Ω(content).Should(BeEmpty())
+			Ω(out.Close()).Should(BeNil())
+		})
+
 	})
 
 })
@@ -42,7 +42,7 @@ func pullImage(client DockerInterface, image string) error {
 func imageExists(client DockerInterface, image string) (bool, error) {
 	summary, err := client.ImageList(dtypes.ImageListOptions{})
 	if err != nil {
-		return false, fmt.Errorf("Error during listing images: %s", summary)
+		return false, fmt.Errorf("Error during listing images: %s", err)
 	}
 	for _, i := range summary {
 		for _, tag := range i.RepoTags {
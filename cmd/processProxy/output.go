@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// jobOutput stores the files the output of a job is written to.
+type jobOutput struct {
+	stdout string
+	stderr string
+}
+
+// jobOutputs remembers the output files of all jobs submitted
+// since the proxy was started.
+type jobOutputs struct {
+	sync.Mutex
+	files map[string]jobOutput
+}
+
+func newJobOutputs() *jobOutputs {
+	return &jobOutputs{files: make(map[string]jobOutput)}
+}
+
+func (jo *jobOutputs) add(jobid string, output jobOutput) {
+	jo.Lock()
+	defer jo.Unlock()
+	jo.files[jobid] = output
+}
+
+func (jo *jobOutputs) get(jobid string) (jobOutput, bool) {
+	jo.Lock()
+	defer jo.Unlock()
+	output, exists := jo.files[jobid]
+	return output, exists
+}
+
+// setOutputPaths lets the output of the job be written into a new
+// directory below dir when the job template does not specify where
+// the output should go to.
+func setOutputPaths(dir string, template *types.JobTemplate) error {
+	if dir == "" || (template.OutputPath != "" && template.ErrorPath != "") {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("can not create output directory: %s", err)
+	}
+	jobDir, err := ioutil.TempDir(dir, "job")
+	if err != nil {
+		return fmt.Errorf("can not create output directory for job: %s", err)
+	}
+	if template.OutputPath == "" {
+		template.OutputPath = filepath.Join(jobDir, "stdout")
+	}
+	if template.ErrorPath == "" {
+		template.ErrorPath = filepath.Join(jobDir, "stderr")
+	}
+	return nil
+}
+
+// JobOutput implements the proxy.JobOutputProvider interface by
+// reading the files the output of the process is redirected to.
+func (p *Proxy) JobOutput(ctx context.Context, jobid, stream string, follow bool) (io.ReadCloser, error) {
+	jobid = p.held.JobID(jobid)
+	output, exists := p.outputs.get(jobid)
+	if !exists {
+		return nil, proxy.Errorf(types.ErrorCodeNotFound, "no output known for job %s", jobid)
+	}
+	filename := output.stdout
+	if stream == "stderr" {
+		filename = output.stderr
+	}
+	if filename == "" {
+		return nil, proxy.Errorf(types.ErrorCodeNotFound, "%s of job %s is not stored", stream, jobid)
+	}
+	if !follow {
+		return os.Open(filename)
+	}
+	return proxy.FollowFile(ctx, filename, func() bool {
+		ji := p.GetJobInfo(jobid)
+		return ji == nil || ji.State == types.Done || ji.State == types.Failed
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -29,6 +30,13 @@ var (
 	keyFile            = app.Flag("key", "Path to key file for secure connections (TLS).").Default("").String()
 	otp                = app.Flag("otp", "One time password settings (\"yubikey\") or a fixed shared secret.").Default("").String()
 	trustedClientCerts = app.Flag("clientCerts", "Path to directory where trusted client certificates are stored.").Default("").String()
+	clientAuth         = app.Flag("clientAuth", "Client certificates with TLS (\"require\", \"optional\", \"none\"). Default is \"require\" with --clientCerts, \"none\" without.").Default("").String()
+	outputDir          = app.Flag("outputDir", "Directory where the output of jobs is stored.").Default("joboutput").String()
+	historyFile        = app.Flag("history", "BoltDB file which stores the job history (empty disables the job history).").Default("jobhistory.db").String()
+	distribution       = app.Flag("distribution", "JSON file which configures the exchange of jobs with other proxies (job distribution).").Default("").String()
+	staging            = app.Flag("staging", "JSON file which configures the quotas and the cleanup of the staging area.").Default("").String()
+	metricsAuth        = app.Flag("metricsAuth", "Protection of /metrics: empty for the same as all other requests, \"none\", or a shared secret (sent as bearer token).").Default("").String()
+	maxArrayTasks      = app.Flag("maxArrayTasks", "Largest amount of tasks of a job array (0 is unlimited).").Default("10000").Int()
 )
 
 func main() {
@@ -39,11 +47,41 @@ func main() {
 	}
 
 	processProxy := NewProxy()
+	processProxy.OutputDir = *outputDir
 	sc := proxy.SecConfig{
 		OTP:                  *otp,
 		TrustedClientCertDir: *trustedClientCerts,
+		ClientAuth:           *clientAuth,
+		MetricsAuth:          *metricsAuth,
+	}
+	proxy.MaxArrayTasks = *maxArrayTasks
+	ps, err := persistency.NewPersistency(*historyFile)
+	if err != nil {
+		fmt.Printf("Error during opening the job history: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *distribution != "" {
+		dc, err := proxy.ReadDistributionConfig(*distribution)
+		if err == nil {
+			_, err = proxy.EnableJobDistribution(&processProxy, dc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling job distribution: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *staging != "" {
+		stc, err := proxy.ReadStagingConfig(*staging)
+		if err == nil {
+			_, err = proxy.EnableStagingGovernance(&processProxy, stc)
+		}
+		if err != nil {
+			fmt.Printf("Error during enabling staging governance: %s\n", err)
+			os.Exit(1)
+		}
 	}
-	var ps persistency.DummyPersistency
 
-	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, &ps, &processProxy)
+	proxy.ProxyListenAndServe(*cliPort, *certFile, *keyFile, sc, ps, &processProxy)
 }
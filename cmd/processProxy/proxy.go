@@ -1,19 +1,34 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/dgruber/drmaa2interface"
 	"github.com/dgruber/drmaa2os"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 )
 
+// Proxy runs jobs as processes of the host. It does not implement the
+// proxy.BulkJobRunner interface: job arrays are submitted task by task
+// through RunJob by proxy.RunBulkJobs since the RunBulkJobs of drmaa2os
+// starts all tasks at once with the same job template, hence the tasks
+// get neither their task index nor their own output files and
+// maxParallel is ignored.
 type Proxy struct {
 	SessionManager *drmaa2os.SessionManager
 	JobSession     drmaa2interface.JobSession
+	// OutputDir is the directory where the output of jobs is
+	// stored which don't have an output path set.
+	OutputDir    string
+	outputs      *jobOutputs
+	reservations *reservations
+	// held contains the jobs submitted with SubmitAsHold since
+	// processes can't be held.
+	held *proxy.HoldEmulator
 }
 
 func NewProxy() Proxy {
@@ -34,11 +49,19 @@ func NewProxy() Proxy {
 	return Proxy{
 		SessionManager: sm,
 		JobSession:     js,
+		outputs:        newJobOutputs(),
+		reservations:   newReservations(),
+		held:           proxy.NewHoldEmulator(),
 	}
 }
 
-// RunJob creates a process.
+// RunJob creates a process. Jobs submitted with SubmitAsHold are
+// started when they get released.
 func (p *Proxy) RunJob(template types.JobTemplate) (string, error) {
+	if template.SubmitAsHold {
+		return p.held.Hold(template), nil
+	}
+
 	// file path fix when the app is uploaded
 	localFile := template.WorkingDirectory + "/" + template.RemoteCommand
 	log.Println("Local file: ", localFile)
@@ -50,11 +73,26 @@ func (p *Proxy) RunJob(template types.JobTemplate) (string, error) {
 		}
 	}
 
+	if template.ReservationId != "" {
+		if err := p.reservations.checkActive(template.ReservationId, time.Now()); err != nil {
+			return "", err
+		}
+	}
+
+	if err := setOutputPaths(p.OutputDir, &template); err != nil {
+		return "", err
+	}
+
 	job, err := p.JobSession.RunJob(ConvertJobTemplate(template))
 	if err != nil {
-		return "", err
+		// like a command which can't be executed
+		return "", proxy.Errorf(types.ErrorCodeInvalidRequest, "can not run job: %s", err)
 	}
 
+	p.outputs.add(job.GetID(), jobOutput{
+		stdout: template.OutputPath,
+		stderr: template.ErrorPath,
+	})
 	return job.GetID(), nil
 }
 
@@ -66,14 +104,17 @@ func jobByID(p *Proxy, jobid string) (drmaa2interface.Job, error) {
 		return nil, err
 	}
 	if len(jobs) < 1 {
-		return nil, errors.New("couldn't fetch job (job list length 0)")
+		return nil, proxy.ErrJobNotFound
 	}
 	return jobs[0], nil
 }
 
 // JobOperation changes the state of a job in the system.
 func (p *Proxy) JobOperation(jobsessionname, operation, jobid string) (out string, err error) {
-	job, err := jobByID(p, jobid)
+	if out, held, err := p.held.JobOperation(operation, jobid, p.RunJob); held {
+		return out, err
+	}
+	job, err := jobByID(p, p.held.JobID(jobid))
 	if err != nil {
 		return "", err
 	}
@@ -97,38 +138,59 @@ func (p *Proxy) JobOperation(jobsessionname, operation, jobid string) (out strin
 		} else {
 			out = "Terminated Job"
 		}
-		// hold and resume not supported for processes
+	case "hold", "release":
+		// started processes can't be held
+		err = proxy.ErrInvalidState
 	default:
 		log.Println("JobOperation unknown operation ", operation)
-		err = errors.New("Unknown operation: " + operation)
+		err = proxy.Errorf(types.ErrorCodeNotImplemented, "Unknown operation: %s", operation)
 	}
 	return out, err
 }
 
-// GetJobInfosByFilter
+// GetJobInfosByFilter returns the job infos of all jobs of the job
+// session. When filtered is set only jobs matching the state and the
+// owner of the filter (if set) are returned.
 func (p *Proxy) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
-	if filtered == false {
-		jobs, err := p.JobSession.GetJobs(drmaa2interface.CreateJobInfo())
-		if err != nil {
-			fmt.Printf("GetJobInfosByFilter(): %s\n", err.Error())
-			return nil
+	jobs, err := p.JobSession.GetJobs(drmaa2interface.CreateJobInfo())
+	if err != nil {
+		fmt.Printf("GetJobInfosByFilter(): %s\n", err.Error())
+		return nil
+	}
+	jobInfos := make([]types.JobInfo, 0, len(jobs))
+	for _, job := range jobs {
+		j := p.GetJobInfo(job.GetID())
+		if j == nil {
+			continue
 		}
-		jobInfos := make([]types.JobInfo, len(jobs))
-		for _, job := range jobs {
-			j := p.GetJobInfo(job.GetID())
-			if j != nil {
-				jobInfos = append(jobInfos, *j)
+		if filtered {
+			if filter.State != types.Unset && filter.State != j.State {
+				continue
+			}
+			if filter.JobOwner != "" && filter.JobOwner != j.JobOwner {
+				continue
 			}
 		}
-		return jobInfos
+		jobInfos = append(jobInfos, *j)
 	}
-	fmt.Println("GetJobInfosByFilter() with filter not implemented")
-	return nil
+	for _, j := range p.held.JobInfos() {
+		if filtered && filter.State != types.Unset && filter.State != j.State {
+			continue
+		}
+		if filtered && filter.JobOwner != "" && filter.JobOwner != j.JobOwner {
+			continue
+		}
+		jobInfos = append(jobInfos, j)
+	}
+	return jobInfos
 }
 
 // GetJobInfo returns information about a job.
 func (p *Proxy) GetJobInfo(jobid string) *types.JobInfo {
-	job, err := jobByID(p, jobid)
+	if ji := p.held.JobInfo(jobid); ji != nil {
+		return ji
+	}
+	job, err := jobByID(p, p.held.JobID(jobid))
 	if err != nil {
 		fmt.Printf("GetJobInfo(): %s\n", err.Error())
 		return nil
@@ -211,7 +273,9 @@ func (p *Proxy) DRMSName() string {
 	return name
 }
 
-// DRMSLoad returns the load of the host.
+// DRMSLoad returns the load of the host (see proxy.HostLoad) based on
+// the running processes and the load average of the host.
 func (p *Proxy) DRMSLoad() float64 {
-	return 0.5
+	used, _ := proxy.JobSlots(p.GetJobInfosByFilter(true, types.JobInfo{State: types.Running}))
+	return proxy.HostLoad(used)
 }
@@ -6,6 +6,13 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	ucproxy "github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 )
 
@@ -27,6 +34,12 @@ var _ = Describe("Proxy", func() {
 			Ω(jobid).Should(Equal("1"))
 		})
 
+		It("should reject jobs which can't be run as invalid requests", func() {
+			_, err := proxy.RunJob(types.JobTemplate{RemoteCommand: "/does/not/exist"})
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.(*ucproxy.Error).Code).Should(Equal(types.ErrorCodeInvalidRequest))
+		})
+
 		It("should be possible to do a JobOperation()", func() {
 			jobid, err := proxy.RunJob(jtemplate)
 			Ω(err).Should(BeNil())
@@ -36,6 +49,29 @@ var _ = Describe("Proxy", func() {
 			Ω(errOp).Should(BeNil())
 		})
 
+		It("should start held jobs when they are released", func() {
+			held := jtemplate
+			held.SubmitAsHold = true
+			jobid, err := proxy.RunJob(held)
+			Ω(err).Should(BeNil())
+			ji := proxy.GetJobInfo(jobid)
+			Ω(ji).ShouldNot(BeNil())
+			Ω(ji.State).Should(Equal(types.QueuedHeld))
+			jis := proxy.GetJobInfosByFilter(true, types.JobInfo{State: types.QueuedHeld})
+			Ω(jis).Should(HaveLen(1))
+
+			_, errOp := proxy.JobOperation(SESSION_NAME, "suspend", jobid)
+			Ω(errOp).Should(Equal(ucproxy.ErrInvalidState))
+			_, errOp = proxy.JobOperation(SESSION_NAME, "release", jobid)
+			Ω(errOp).Should(BeNil())
+			ji = proxy.GetJobInfo(jobid)
+			Ω(ji).ShouldNot(BeNil())
+			Ω(ji.State).ShouldNot(Equal(types.QueuedHeld))
+
+			_, errOp = proxy.JobOperation(SESSION_NAME, "hold", jobid)
+			Ω(errOp).Should(Equal(ucproxy.ErrInvalidState))
+		})
+
 		It("should be possible to GetJobInfosByFilter()", func() {
 			jis := proxy.GetJobInfosByFilter(false, types.JobInfo{})
 			Ω(jis).ShouldNot(BeNil())
@@ -109,6 +145,76 @@ var _ = Describe("Proxy", func() {
 			Ω(name).ShouldNot(Equal(""))
 		})
 
+		It("should be possible to get the JobOutput() of a job", func() {
+			outputDir, err := ioutil.TempDir("", "processproxy")
+			Ω(err).Should(BeNil())
+			defer os.RemoveAll(outputDir)
+			proxy.OutputDir = outputDir
+
+			jobid, err := proxy.RunJob(types.JobTemplate{RemoteCommand: "echo", Args: []string{"hello"}})
+			Ω(err).Should(BeNil())
+			out, err := proxy.JobOutput(context.Background(), jobid, "stdout", true)
+			Ω(err).Should(BeNil())
+			defer out.Close()
+			content, err := ioutil.ReadAll(out)
+			Ω(err).Should(BeNil())
+			Ω(string(content)).Should(Equal("hello\n"))
+
+			_, err = proxy.JobOutput(context.Background(), "unknown", "stdout", false)
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("should be possible to run a job array", func() {
+			outputDir, err := ioutil.TempDir("", "processproxy")
+			Ω(err).Should(BeNil())
+			defer os.RemoveAll(outputDir)
+			proxy.OutputDir = outputDir
+
+			task := types.JobTemplate{RemoteCommand: "/bin/sh", Args: []string{"-c", "echo $UC_TASK_ID"}}
+			arrayjobid, err := ucproxy.RunBulkJobs(&proxy, task, 1, 3, 2, 0, nil)
+			Ω(err).Should(BeNil())
+			aji := ucproxy.GetArrayJobInfo(&proxy, arrayjobid)
+			Ω(aji).ShouldNot(BeNil())
+			Ω(aji.Tasks).Should(HaveLen(2))
+			Ω(aji.Tasks[1].Index).Should(Equal(3))
+
+			out, err := proxy.JobOutput(context.Background(), aji.Tasks[1].JobInfo.Id, "stdout", true)
+			Ω(err).Should(BeNil())
+			defer out.Close()
+			content, err := ioutil.ReadAll(out)
+			Ω(err).Should(BeNil())
+			Ω(string(content)).Should(Equal("3\n"))
+		})
+
+		It("should be possible to reserve slots and run a job in the reservation", func() {
+			info, err := proxy.RequestReservation("demo", types.ReservationTemplate{
+				Name: "demo", Duration: time.Hour, MinSlots: 1,
+			})
+			Ω(err).Should(BeNil())
+			Ω(info.ReservedSlots).Should(BeNumerically("==", 1))
+			Ω(info.ReservationEndTime.Sub(info.ReservationStartTime)).Should(Equal(time.Hour))
+
+			_, err = proxy.RequestReservation("demo", types.ReservationTemplate{
+				Duration: time.Hour, MinSlots: int64(runtime.NumCPU()),
+			})
+			Ω(err).ShouldNot(BeNil())
+
+			infos, err := proxy.GetReservations("demo")
+			Ω(err).Should(BeNil())
+			Ω(infos).Should(HaveLen(1))
+
+			_, err = proxy.RunJob(types.JobTemplate{RemoteCommand: "sleep", Args: []string{"0"},
+				ReservationId: info.ReservationId})
+			Ω(err).Should(BeNil())
+
+			Ω(proxy.TerminateReservation("demo", info.ReservationId)).Should(BeNil())
+			_, err = proxy.GetReservation("demo", info.ReservationId)
+			Ω(err).ShouldNot(BeNil())
+			_, err = proxy.RunJob(types.JobTemplate{RemoteCommand: "sleep", Args: []string{"0"},
+				ReservationId: info.ReservationId})
+			Ω(err).ShouldNot(BeNil())
+		})
+
 		It("should be possible to get DRMSLoad()", func() {
 			load := proxy.DRMSLoad()
 			Ω(load).ShouldNot(BeNumerically("==", 0.0))
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// reservation is an advance reservation granted by the processProxy.
+type reservation struct {
+	session string
+	info    types.ReservationInfo
+}
+
+// reservations contains all reservations which are not expired. The
+// reservation session of drmaa2os is not implemented, hence the
+// processProxy books the reservations itself. A reservation is granted
+// when the slots of the host (its CPUs) are not reserved by another
+// reservation at an overlapping time. Processes are not limited, so
+// reservations are only a booking which jobs refer to.
+type reservations struct {
+	sync.Mutex
+	lastID int
+	slots  int64
+	all    map[string]reservation
+}
+
+func newReservations() *reservations {
+	return &reservations{
+		slots: int64(runtime.NumCPU()),
+		all:   make(map[string]reservation),
+	}
+}
+
+// removeExpired forgets reservations which ended before now.
+// The lock must be held.
+func (rs *reservations) removeExpired(now time.Time) {
+	for id, r := range rs.all {
+		if r.info.ReservationEndTime.Before(now) {
+			delete(rs.all, id)
+		}
+	}
+}
+
+// reservedSlots returns the amount of slots reserved at some point
+// in time between start and end. The lock must be held.
+func (rs *reservations) reservedSlots(start, end time.Time) int64 {
+	var reserved int64
+	for _, r := range rs.all {
+		if r.info.ReservationStartTime.Before(end) && r.info.ReservationEndTime.After(start) {
+			reserved += r.info.ReservedSlots
+		}
+	}
+	return reserved
+}
+
+// isCandidateMachine returns true if the host is in the list of
+// candidate machines.
+func isCandidateMachine(hostname string, candidates []string) bool {
+	for _, machine := range candidates {
+		if machine == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// request grants the reservation if enough slots are free.
+func (rs *reservations) request(session string, rt types.ReservationTemplate, now time.Time) (types.ReservationInfo, error) {
+	start := rt.StartTime
+	if start.IsZero() {
+		start = now
+	}
+	end := rt.EndTime
+	if end.IsZero() {
+		if rt.Duration == 0 {
+			return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeInvalidRequest,
+				"reservation requires an end time or a duration")
+		}
+		end = start.Add(rt.Duration)
+	}
+	if !end.After(now) {
+		return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeInvalidRequest,
+			"reservation ends in the past")
+	}
+	slots := rt.MinSlots
+	if slots == 0 {
+		slots = 1
+	}
+	hostname, _ := os.Hostname()
+	if len(rt.CandidateMachines) > 0 && !isCandidateMachine(hostname, rt.CandidateMachines) {
+		return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeConflict,
+			"host %s is not a candidate machine of the reservation", hostname)
+	}
+	acl := rt.UsersACL
+	if len(acl) == 0 {
+		if u, err := user.Current(); err == nil {
+			acl = []string{u.Username}
+		}
+	}
+
+	rs.Lock()
+	defer rs.Unlock()
+	rs.removeExpired(now)
+	if free := rs.slots - rs.reservedSlots(start, end); free < slots {
+		return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeConflict,
+			"only %d of %d requested slots are free in the time range", free, slots)
+	}
+	rs.lastID++
+	info := types.ReservationInfo{
+		ReservationId:        fmt.Sprintf("%d", rs.lastID),
+		ReservationName:      rt.Name,
+		ReservationStartTime: start,
+		ReservationEndTime:   end,
+		ACL:                  acl,
+		ReservedSlots:        slots,
+		ReservedMachines:     []string{hostname},
+	}
+	rs.all[info.ReservationId] = reservation{session: session, info: info}
+	return info, nil
+}
+
+// list returns all reservations of the reservation session.
+func (rs *reservations) list(session string, now time.Time) []types.ReservationInfo {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.removeExpired(now)
+	infos := make([]types.ReservationInfo, 0, len(rs.all))
+	for _, r := range rs.all {
+		if r.session == session {
+			infos = append(infos, r.info)
+		}
+	}
+	return infos
+}
+
+// get returns a reservation of the reservation session.
+func (rs *reservations) get(session, id string, now time.Time) (types.ReservationInfo, error) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.removeExpired(now)
+	r, exists := rs.all[id]
+	if !exists || r.session != session {
+		return types.ReservationInfo{}, proxy.Errorf(types.ErrorCodeNotFound, "reservation %s not found", id)
+	}
+	return r.info, nil
+}
+
+// terminate removes a reservation of the reservation session.
+func (rs *reservations) terminate(session, id string) error {
+	rs.Lock()
+	defer rs.Unlock()
+	r, exists := rs.all[id]
+	if !exists || r.session != session {
+		return proxy.Errorf(types.ErrorCodeNotFound, "reservation %s not found", id)
+	}
+	delete(rs.all, id)
+	return nil
+}
+
+// checkActive returns an error when the reservation does not exist
+// or is not active at the given time.
+func (rs *reservations) checkActive(id string, now time.Time) error {
+	rs.Lock()
+	defer rs.Unlock()
+	r, exists := rs.all[id]
+	if !exists {
+		return proxy.Errorf(types.ErrorCodeInvalidRequest, "reservation %s not found", id)
+	}
+	if now.Before(r.info.ReservationStartTime) || !now.Before(r.info.ReservationEndTime) {
+		return proxy.Errorf(types.ErrorCodeConflict, "reservation %s is not active (%s - %s)", id,
+			r.info.ReservationStartTime.Format(time.RFC3339), r.info.ReservationEndTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// RequestReservation implements the proxy.ReservationImplementer interface.
+func (p *Proxy) RequestReservation(rsession string, template types.ReservationTemplate) (types.ReservationInfo, error) {
+	return p.reservations.request(rsession, template, time.Now())
+}
+
+// GetReservations implements the proxy.ReservationImplementer interface.
+func (p *Proxy) GetReservations(rsession string) ([]types.ReservationInfo, error) {
+	return p.reservations.list(rsession, time.Now()), nil
+}
+
+// GetReservation implements the proxy.ReservationImplementer interface.
+func (p *Proxy) GetReservation(rsession, reservationid string) (types.ReservationInfo, error) {
+	return p.reservations.get(rsession, reservationid, time.Now())
+}
+
+// TerminateReservation implements the proxy.ReservationImplementer interface.
+func (p *Proxy) TerminateReservation(rsession, reservationid string) error {
+	return p.reservations.terminate(rsession, reservationid)
+}
@@ -0,0 +1,185 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+)
+
+// Default settings for collecting results from the child clusters
+// in inception mode.
+const (
+	DefaultClusterTimeout = 10 * time.Second // deadline of a request to a child cluster
+	DefaultCacheTTL       = 5 * time.Second  // how long collected results are reused
+)
+
+// clusterResult is the answer of one child cluster.
+type clusterResult struct {
+	cluster string
+	value   interface{}
+}
+
+// aggregationCache keeps the results collected from the child clusters
+// for a short time so that frequent requests don't hit all clusters.
+type aggregationCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	results     []clusterResult
+	unreachable []string
+	expires     time.Time
+}
+
+func newAggregationCache(ttl time.Duration) *aggregationCache {
+	return &aggregationCache{ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// get returns the cached results when they are not expired.
+func (ac *aggregationCache) get(key string, now time.Time) (cacheEntry, bool) {
+	ac.Lock()
+	defer ac.Unlock()
+	entry, exists := ac.entries[key]
+	if !exists || now.After(entry.expires) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// put stores results in the cache. With a ttl of 0 nothing is cached.
+func (ac *aggregationCache) put(key string, results []clusterResult, unreachable []string, now time.Time) {
+	if ac.ttl <= 0 {
+		return
+	}
+	ac.Lock()
+	defer ac.Unlock()
+	ac.entries[key] = cacheEntry{
+		results:     results,
+		unreachable: unreachable,
+		expires:     now.Add(ac.ttl),
+	}
+}
+
+// SetAggregation sets the deadline of requests to the child clusters
+// and how long results collected from all child clusters are reused.
+// A ttl of 0 disables the cache.
+func (i *Inception) SetAggregation(timeout, ttl time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("timeout must be positive (is %s)", timeout)
+	}
+	i.timeout = timeout
+	i.cache = newAggregationCache(ttl)
+	return nil
+}
+
+// fanOut sends a request to all child clusters concurrently, each with
+// its own deadline (see requestTimeout). The results are returned in
+// the order of the configuration together with the names of the
+// clusters which did not answer. For child inception proxies with a
+// partial result the paths of their unreachable clusters are added
+// (like "europe/berlin").
+func (i *Inception) fanOut(request func(ctx context.Context, pc *client.Client) (interface{}, error)) ([]clusterResult, []string) {
+	clusters := i.childClusters()
+	results := make([]*clusterResult, len(clusters))
+	failures := make([][]string, len(clusters))
+	var wg sync.WaitGroup
+	wg.Add(len(clusters))
+	for n, c := range clusters {
+		go func(n int, c ClusterConfig) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.RequestTimeout(i.timeout))
+			defer cancel()
+			pc, err := i.request.proxyClient(fmt.Sprintf("%s%s", c.Address, c.ProtocolVersion))
+			var value interface{}
+			if err == nil {
+				value, err = request(ctx, pc)
+			}
+			if e, ok := err.(*client.PartialResultError); ok {
+				for _, unreachable := range e.Unreachable {
+					failures[n] = append(failures[n], fmt.Sprintf("%s/%s", c.Name, unreachable))
+				}
+			} else if err != nil {
+				log.Printf("Error while requesting cluster %s: %s\n", c.Name, err)
+				failures[n] = []string{c.Name}
+				return
+			}
+			results[n] = &clusterResult{cluster: c.Name, value: value}
+		}(n, c)
+	}
+	wg.Wait()
+
+	answered := make([]clusterResult, 0, len(clusters))
+	unreachable := make([]string, 0)
+	for n := range clusters {
+		if results[n] != nil {
+			answered = append(answered, *results[n])
+		}
+		unreachable = append(unreachable, failures[n]...)
+	}
+	return answered, unreachable
+}
+
+// collect returns the cached results of the request with the given
+// key or sends the request to all child clusters.
+func (i *Inception) collect(key string, request func(ctx context.Context, pc *client.Client) (interface{}, error)) ([]clusterResult, []string) {
+	now := time.Now()
+	if entry, cached := i.cache.get(key, now); cached {
+		return entry.results, entry.unreachable
+	}
+	results, unreachable := i.fanOut(request)
+	i.cache.put(key, results, unreachable, now)
+	return results, unreachable
+}
+
+// partialResultError returns a proxy.PartialResultError when there
+// are unreachable clusters.
+func partialResultError(unreachable []string) error {
+	if len(unreachable) == 0 {
+		return nil
+	}
+	return &proxy.PartialResultError{Unreachable: unreachable}
+}
+
+// tag extends the name of a machine, queue, job category, or job by
+// the name of the cluster it belongs to (name@cluster).
+func tag(name, cluster string) string {
+	return fmt.Sprintf("%s@%s", name, cluster)
+}
+
+// matchesNames returns true if no names are requested or if one of
+// the names is either the name itself (in any cluster) or the name
+// tagged with the cluster.
+func matchesNames(names []string, name, cluster string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name || n == tag(name, cluster) {
+			return true
+		}
+	}
+	return false
+}
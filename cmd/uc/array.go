@@ -0,0 +1,51 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseTaskRange parses the task range of a job array given in the
+// form begin-end[:step] (like "1-1000:1"). A single number is a job
+// array with just one task. The step defaults to 1.
+func ParseTaskRange(taskRange string) (begin, end, step int, err error) {
+	step = 1
+	rangePart := taskRange
+	if colon := strings.Index(taskRange, ":"); colon >= 0 {
+		rangePart = taskRange[:colon]
+		if step, err = strconv.Atoi(taskRange[colon+1:]); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid step in task range %s", taskRange)
+		}
+	}
+	bounds := strings.SplitN(rangePart, "-", 2)
+	if begin, err = strconv.Atoi(bounds[0]); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid begin of task range %s", taskRange)
+	}
+	end = begin
+	if len(bounds) == 2 {
+		if end, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid end of task range %s", taskRange)
+		}
+	}
+	if begin < 1 || end < begin || step < 1 {
+		return 0, 0, 0, fmt.Errorf("invalid task range %s (expected begin-end:step with 1 <= begin <= end and step >= 1)", taskRange)
+	}
+	return begin, end, step, nil
+}
@@ -0,0 +1,38 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Array", func() {
+
+	Context("When parsing task ranges", func() {
+
+		It("must parse begin, end, and step", func() {
+			begin, end, step, err := ParseTaskRange("1-1000:10")
+			Ω(err).Should(BeNil())
+			Ω([]int{begin, end, step}).Should(Equal([]int{1, 1000, 10}))
+		})
+
+		It("must use defaults for step and end", func() {
+			begin, end, step, err := ParseTaskRange("2-4")
+			Ω(err).Should(BeNil())
+			Ω([]int{begin, end, step}).Should(Equal([]int{2, 4, 1}))
+			begin, end, step, err = ParseTaskRange("7")
+			Ω(err).Should(BeNil())
+			Ω([]int{begin, end, step}).Should(Equal([]int{7, 7, 1}))
+		})
+
+		It("must reject invalid task ranges", func() {
+			for _, r := range []string{"", "a-3", "1-b", "1-3:x", "0-3", "5-3", "1-3:0"} {
+				_, _, _, err := ParseTaskRange(r)
+				Ω(err).ShouldNot(BeNil(), r)
+			}
+		})
+
+	})
+
+})
@@ -0,0 +1,149 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+)
+
+// ClusterAuth creates the clients for accessing the proxies of the
+// configured clusters. A cluster with own TLS settings gets its own
+// http client and a cluster with a credential its own shared secret.
+// All other clusters are accessed with the defaults (given by the
+// --cert, --key, and --otp flags).
+type ClusterAuth struct {
+	client *http.Client // default http client
+	otp    *string      // default shared secret
+
+	// Yubikey reads a one time password for clusters with the
+	// credential "yubikey". When not set such clusters can't be
+	// accessed (like in inception mode which is not interactive).
+	Yubikey func() (string, error)
+
+	sync.Mutex
+	clients map[client.TLSConfig]*http.Client
+	secrets map[string]string // resolved credentials
+}
+
+// NewClusterAuth creates a ClusterAuth with the default http client
+// and shared secret. When httpClient is nil the http.DefaultClient is
+// used.
+func NewClusterAuth(httpClient *http.Client, otp *string) *ClusterAuth {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &ClusterAuth{
+		client:  httpClient,
+		otp:     otp,
+		clients: make(map[client.TLSConfig]*http.Client),
+		secrets: make(map[string]string),
+	}
+}
+
+// HTTPClient returns the http client for the proxy of the cluster.
+// Clusters with the same TLS settings share the client.
+func (a *ClusterAuth) HTTPClient(cc ClusterConfig) (*http.Client, error) {
+	if !cc.HasTLSSettings() {
+		return a.client, nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	if hc, exists := a.clients[cc.TLS()]; exists {
+		return hc, nil
+	}
+	hc, err := client.NewTLSHTTPClient(cc.TLS())
+	if err != nil {
+		return nil, fmt.Errorf("TLS settings of cluster %s: %s", cc.Name, err)
+	}
+	a.clients[cc.TLS()] = hc
+	return hc, nil
+}
+
+// Secret returns the shared secret for the proxy of the cluster. For
+// clusters with the credential "yubikey" a new one time password is
+// read from the key.
+func (a *ClusterAuth) Secret(cc ClusterConfig) (string, error) {
+	switch cc.Credential {
+	case "":
+		if a.otp == nil {
+			return "", nil
+		}
+		return *a.otp, nil
+	case "yubikey":
+		if a.Yubikey == nil {
+			return "", fmt.Errorf("credential of cluster %s: yubikey can not be used non-interactively", cc.Name)
+		}
+		return a.Yubikey()
+	}
+	a.Lock()
+	defer a.Unlock()
+	if secret, exists := a.secrets[cc.Credential]; exists {
+		return secret, nil
+	}
+	secret, err := ResolveCredential(cc.Credential)
+	if err != nil {
+		return "", fmt.Errorf("credential of cluster %s: %s", cc.Name, err)
+	}
+	a.secrets[cc.Credential] = secret
+	return secret, nil
+}
+
+// ProxyClient creates a client for the proxy of the cluster with the
+// http client and the shared secret of the cluster.
+func (a *ClusterAuth) ProxyClient(cc ClusterConfig) (*client.Client, error) {
+	hc, err := a.HTTPClient(cc)
+	if err != nil {
+		return nil, err
+	}
+	pc := client.New(fmt.Sprintf("%s%s", cc.Address, cc.ProtocolVersion), hc)
+	if cc.Credential == "yubikey" {
+		// each request needs its own one time password
+		pc.SetOTPFunc(func() (string, error) { return a.Secret(cc) })
+		return pc, nil
+	}
+	secret, err := a.Secret(cc)
+	if err != nil {
+		return nil, err
+	}
+	pc.SetOTP(secret)
+	return pc, nil
+}
+
+// Check creates the http clients and resolves the credentials of all
+// clusters of the configuration so that errors are found before the
+// clusters are accessed.
+func (a *ClusterAuth) Check(conf Config) error {
+	for _, cc := range conf.Cluster {
+		if _, err := a.HTTPClient(cc); err != nil {
+			return err
+		}
+		if cc.Credential == "yubikey" {
+			if a.Yubikey == nil {
+				return fmt.Errorf("credential of cluster %s: yubikey can not be used non-interactively", cc.Name)
+			}
+			continue
+		}
+		if _, err := a.Secret(cc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
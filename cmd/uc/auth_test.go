@@ -0,0 +1,130 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+)
+
+var _ = Describe("ClusterAuth", func() {
+
+	var (
+		first, second   *childProxy
+		firstS, secondS *httptest.Server
+		dir             string
+	)
+
+	BeforeEach(func() {
+		first, second = newChildProxy("first.q"), newChildProxy("second.q")
+		firstS = httptest.NewServer(proxy.NewProxyRouter(first, proxy.SecConfig{OTP: "s3cret"}, nil))
+		secondS = httptest.NewTLSServer(proxy.NewProxyRouter(second, proxy.SecConfig{OTP: "t0ken"}, nil))
+		var err error
+		dir, err = ioutil.TempDir("", "ucauth")
+		Ω(err).Should(BeNil())
+		os.Setenv("UC_TEST_SECOND_SECRET", "t0ken")
+	})
+
+	AfterEach(func() {
+		firstS.Close()
+		secondS.Close()
+		os.RemoveAll(dir)
+		os.RemoveAll("uploads")
+		os.Unsetenv("UC_TEST_SECOND_SECRET")
+	})
+
+	// writeCA stores the certificate of the TLS server as CA bundle.
+	writeCA := func(server *httptest.Server) string {
+		path := filepath.Join(dir, "ca.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		Ω(ioutil.WriteFile(path, cert, 0600)).Should(BeNil())
+		return path
+	}
+
+	It("should access child clusters of the inception proxy with their own secrets", func() {
+		incept := NewInception("", "", "other", Config{Cluster: []ClusterConfig{
+			{Name: "first", Address: firstS.URL + "/", ProtocolVersion: "v1", Credential: "secret:s3cret"},
+			{Name: "second", Address: secondS.URL + "/", ProtocolVersion: "v1", Credential: "env:UC_TEST_SECOND_SECRET",
+				CAFile: writeCA(secondS), ServerName: "example.com"},
+		}}, "", nil)
+		Ω(incept.CheckClusterAuth()).Should(BeNil())
+		queues, err := incept.GetAllQueues(nil)
+		Ω(err).Should(BeNil())
+		Ω(queues).Should(HaveLen(2))
+	})
+
+	It("should not access clusters with unusable credentials with the default secret", func() {
+		incept := NewInception("", "", "s3cret", Config{Cluster: []ClusterConfig{
+			{Name: "first", Address: firstS.URL + "/", ProtocolVersion: "v1", Credential: "env:UC_TEST_UNSET"},
+			{Name: "second", Address: secondS.URL + "/", ProtocolVersion: "v1", Credential: "env:UC_TEST_SECOND_SECRET",
+				CAFile: writeCA(secondS), ServerName: "example.com"},
+		}}, "", nil)
+		queues, err := incept.GetAllQueues(nil)
+		Ω(err).ShouldNot(BeNil())
+		Ω(queues).Should(HaveLen(1))
+		Ω(queues[0].Name).Should(Equal("second.q@second"))
+	})
+
+	It("should verify the proxy certificate with the CA bundle of the cluster", func() {
+		auth := NewClusterAuth(nil, nil)
+		cc := ClusterConfig{Name: "second", Address: secondS.URL + "/", ProtocolVersion: "v1",
+			Credential: "secret:t0ken", CAFile: writeCA(secondS), ServerName: "example.com"}
+		pc, err := auth.ProxyClient(cc)
+		Ω(err).Should(BeNil())
+		_, err = pc.GetQueues(context.Background(), "")
+		Ω(err).Should(BeNil())
+
+		// the certificate is not issued for that name
+		cc.ServerName = "proxy.example.org"
+		pc, err = NewClusterAuth(nil, nil).ProxyClient(cc)
+		Ω(err).Should(BeNil())
+		_, err = pc.GetQueues(context.Background(), "")
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("should use the default secret for clusters without credential", func() {
+		secret := "s3cret"
+		pc, err := NewClusterAuth(nil, &secret).ProxyClient(ClusterConfig{Name: "first", Address: firstS.URL + "/", ProtocolVersion: "v1"})
+		Ω(err).Should(BeNil())
+		_, err = pc.GetQueues(context.Background(), "")
+		Ω(err).Should(BeNil())
+	})
+
+	It("should apply the timeout of the selected cluster only to its requests", func() {
+		otp := ""
+		r, err := NewTLSRequest(client.TLSConfig{}, &otp)
+		Ω(err).Should(BeNil())
+		selected := ClusterConfig{Name: "a", Timeout: "5s"}
+		_, err = r.UseClusterSettings(selected, true)
+		Ω(err).Should(BeNil())
+
+		hc, err := r.HTTPClient(selected)
+		Ω(err).Should(BeNil())
+		Ω(hc.Transport.(*http.Transport).ResponseHeaderTimeout).Should(Equal(5 * time.Second))
+		hc, err = r.HTTPClient(ClusterConfig{Name: "b"})
+		Ω(err).Should(BeNil())
+		Ω(hc.Transport.(*http.Transport).ResponseHeaderTimeout).Should(BeZero())
+	})
+
+	It("should reject credentials and TLS settings which can't be used", func() {
+		auth := NewClusterAuth(nil, nil)
+		Ω(auth.Check(Config{Cluster: []ClusterConfig{{Name: "a", Credential: "yubikey"}}})).ShouldNot(BeNil())
+		Ω(auth.Check(Config{Cluster: []ClusterConfig{{Name: "a", Credential: "env:UC_TEST_UNSET"}}})).ShouldNot(BeNil())
+		Ω(auth.Check(Config{Cluster: []ClusterConfig{{Name: "a", CAFile: filepath.Join(dir, "missing.pem")}}})).ShouldNot(BeNil())
+		auth.Yubikey = func() (string, error) { return "otp", nil }
+		Ω(auth.Check(Config{Cluster: []ClusterConfig{{Name: "a", Credential: "yubikey"}}})).Should(BeNil())
+	})
+
+})
@@ -17,13 +17,18 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
 	"github.com/spf13/viper"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config contains configuration for proxies of compute clusters which can be queried.
@@ -40,15 +45,145 @@ type ClusterConfig struct {
 	Name            string
 	Address         string // like http://localhost:8888
 	ProtocolVersion string // the protocol the proxy speaks "v1"
+
+	Description     string   `json:",omitempty" toml:",omitempty"`
+	Tags            []string `json:",omitempty" toml:",omitempty"` // for grouping clusters (uc config list --tag)
+	DefaultQueue    string   `json:",omitempty" toml:",omitempty"` // queue of submitted jobs if none is requested
+	DefaultCategory string   `json:",omitempty" toml:",omitempty"` // job category of submitted jobs if none is requested
+	Timeout         string   `json:",omitempty" toml:",omitempty"` // how long to wait for the answer of the proxy (like "30s")
+	// Credential references the shared secret of the proxy: "secret:VALUE"
+	// (the secret itself), "env:NAME" (environment variable), "file:PATH"
+	// (first line of a file), or "yubikey". The --otp flag replaces it
+	// for the cluster the command works on.
+	Credential string `json:",omitempty" toml:",omitempty"`
+	// TLS settings of the connection to the proxy. When not set the
+	// --cert and --key flags are used.
+	CertFile   string `json:",omitempty" toml:",omitempty"` // PEM encoded client certificate
+	KeyFile    string `json:",omitempty" toml:",omitempty"` // PEM encoded private key of the client certificate
+	CAFile     string `json:",omitempty" toml:",omitempty"` // PEM encoded CA bundle for verifying the proxy
+	ServerName string `json:",omitempty" toml:",omitempty"` // name in the proxy certificate (if not the host of Address)
+	Verify     string `json:",omitempty" toml:",omitempty"` // verification of the proxy certificate: "ca" (default), "tofu", or "insecure"
 }
 
 func (c ClusterConfig) String() string {
-	return fmt.Sprintf("Name: %s\nAddress: %s\nProtocolVersion: %s\n", c.Name, c.Address, c.ProtocolVersion)
+	s := fmt.Sprintf("Name: %s\nAddress: %s\nProtocolVersion: %s\n", c.Name, c.Address, c.ProtocolVersion)
+	if c.Description != "" {
+		s += fmt.Sprintf("Description: %s\n", c.Description)
+	}
+	if len(c.Tags) > 0 {
+		s += fmt.Sprintf("Tags: %s\n", strings.Join(c.Tags, ", "))
+	}
+	if c.DefaultQueue != "" {
+		s += fmt.Sprintf("DefaultQueue: %s\n", c.DefaultQueue)
+	}
+	if c.DefaultCategory != "" {
+		s += fmt.Sprintf("DefaultCategory: %s\n", c.DefaultCategory)
+	}
+	if c.Timeout != "" {
+		s += fmt.Sprintf("Timeout: %s\n", c.Timeout)
+	}
+	if c.Credential != "" {
+		s += fmt.Sprintf("Credential: %s\n", maskCredential(c.Credential))
+	}
+	if c.CertFile != "" {
+		s += fmt.Sprintf("CertFile: %s\nKeyFile: %s\n", c.CertFile, c.KeyFile)
+	}
+	if c.CAFile != "" {
+		s += fmt.Sprintf("CAFile: %s\n", c.CAFile)
+	}
+	if c.ServerName != "" {
+		s += fmt.Sprintf("ServerName: %s\n", c.ServerName)
+	}
+	if c.Verify != "" {
+		s += fmt.Sprintf("Verify: %s\n", c.Verify)
+	}
+	return s
+}
+
+// maskCredential hides a secret given directly in the credential
+// reference so that only its type is shown.
+func maskCredential(credential string) string {
+	if strings.HasPrefix(credential, "secret:") {
+		return "secret:***"
+	}
+	return credential
+}
+
+// Info returns the cluster as it is printed by the output formaters.
+// Secrets given directly in the configuration are masked.
+func (c ClusterConfig) Info(isDefault bool) types.ClusterInfo {
+	return types.ClusterInfo{
+		Name:            c.Name,
+		Address:         c.Address,
+		ProtocolVersion: c.ProtocolVersion,
+		Default:         isDefault,
+		Description:     c.Description,
+		Tags:            c.Tags,
+		DefaultQueue:    c.DefaultQueue,
+		DefaultCategory: c.DefaultCategory,
+		Timeout:         c.Timeout,
+		Credential:      maskCredential(c.Credential),
+		CertFile:        c.CertFile,
+		KeyFile:         c.KeyFile,
+		CAFile:          c.CAFile,
+		ServerName:      c.ServerName,
+		Verify:          c.Verify,
+	}
+}
+
+// HasTLSSettings returns true if the cluster has its own TLS settings.
+func (c ClusterConfig) HasTLSSettings() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.CAFile != "" || c.ServerName != "" || c.Verify != ""
+}
+
+// TLS returns the TLS settings of the connection to the proxy.
+func (c ClusterConfig) TLS() client.TLSConfig {
+	return client.TLSConfig{
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+		CAFile:     c.CAFile,
+		ServerName: c.ServerName,
+		Verify:     c.Verify,
+	}
+}
+
+// HasTag returns true if the cluster is tagged with the given tag.
+func (c ClusterConfig) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestTimeout returns how long to wait for the answer of the proxy
+// of the cluster or the given default when the cluster has no valid
+// timeout.
+func (c ClusterConfig) RequestTimeout(def time.Duration) time.Duration {
+	if timeout, err := time.ParseDuration(c.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return def
+}
+
+// ApplyDefaults sets the default queue and the default job category
+// of the cluster in the job template if they are not set.
+func (c ClusterConfig) ApplyDefaults(jt *types.JobTemplate) {
+	if jt.QueueName == "" {
+		jt.QueueName = c.DefaultQueue
+	}
+	if jt.JobCategory == "" {
+		jt.JobCategory = c.DefaultCategory
+	}
 }
 
 // Config contains the complete configuration for all clusters. The
 // configuration is intended to be read out from a config file.
 type Config struct {
+	// Default is the name of the cluster used when no cluster is
+	// explicitly referenced. If not set it is the cluster "default".
+	Default string `json:",omitempty" toml:",omitempty"`
 	// Multiple endpoints of proxies can be defined
 	Cluster []ClusterConfig
 }
@@ -59,67 +194,230 @@ type GlobalConfig struct {
 	OTP string
 }
 
-// saveDummyConfig creates a file dummyconfig.json in order
-// to help the user to create a configuration file (config.json)
-// in the right JSON format. "default" and "cluster1" are
-// user defined names for the cluster, while the address is
-// the endpoint of the proxy.
-func saveDummyConfig() {
-	if file, err := os.Create("dummyconfig.json"); err == nil {
-		encoder := json.NewEncoder(file)
-		var config Config
-		config.Cluster = make([]ClusterConfig, 0)
-		var def, cluster ClusterConfig
-		def.Name = "default"
-		def.Address = "http://localhost:8888/"
-		def.ProtocolVersion = "v1"
-		cluster.Name = "cluster1"
-		cluster.Address = "http://localhost:8282/"
-		cluster.ProtocolVersion = "v1"
-		config.Cluster = append(config.Cluster, def)
-		config.Cluster = append(config.Cluster, cluster)
-		encoder.Encode(config)
-		file.Close()
+// DefaultConfig returns the configuration created by "uc config init"
+// which contains the cluster "default" at the given address.
+func DefaultConfig(address string) Config {
+	return Config{Cluster: []ClusterConfig{
+		{Name: "default", Address: address, ProtocolVersion: "v1"},
+	}}
+}
+
+// index returns the position of the cluster in the configuration or -1.
+func (c *Config) index(name string) int {
+	for i := range c.Cluster {
+		if c.Cluster[i].Name == name {
+			return i
+		}
 	}
+	return -1
 }
 
-func ReadConfig() Config {
-	viper.SetConfigName("config")
+// defaultCluster returns the name of the default cluster.
+func (c *Config) defaultCluster() string {
+	if c.Default == "" {
+		return "default"
+	}
+	return c.Default
+}
+
+// FindCluster returns the configuration of the cluster. The name
+// "default" refers to the default cluster.
+func (c *Config) FindCluster(name string) (ClusterConfig, bool) {
+	if name == "default" && c.Default != "" {
+		name = c.Default
+	}
+	if i := c.index(name); i >= 0 {
+		return c.Cluster[i], true
+	}
+	return ClusterConfig{}, false
+}
+
+// AddCluster adds a cluster to the configuration. The protocol version
+// is "v1" if not set.
+func (c *Config) AddCluster(cc ClusterConfig) error {
+	if cc.Name == "" || cc.Address == "" {
+		return errors.New("name and address of the cluster are required")
+	}
+	if c.index(cc.Name) >= 0 {
+		return fmt.Errorf("cluster %s already exists", cc.Name)
+	}
+	if cc.ProtocolVersion == "" {
+		cc.ProtocolVersion = "v1"
+	}
+	c.Cluster = append(c.Cluster, cc)
+	return nil
+}
+
+// RemoveCluster removes a cluster from the configuration. When it was
+// the default cluster the configuration has no default afterwards.
+func (c *Config) RemoveCluster(name string) error {
+	i := c.index(name)
+	if i < 0 {
+		return fmt.Errorf("cluster %s not found in configuration", name)
+	}
+	c.Cluster = append(c.Cluster[:i], c.Cluster[i+1:]...)
+	if c.Default == name {
+		c.Default = ""
+	}
+	return nil
+}
+
+// SetDefault makes the cluster the default cluster.
+func (c *Config) SetDefault(name string) error {
+	if c.index(name) < 0 {
+		return fmt.Errorf("cluster %s not found in configuration", name)
+	}
+	c.Default = name
+	return nil
+}
+
+// RenameCluster changes the name of a cluster.
+func (c *Config) RenameCluster(oldName, newName string) error {
+	i := c.index(oldName)
+	if i < 0 {
+		return fmt.Errorf("cluster %s not found in configuration", oldName)
+	}
+	if newName == "" {
+		return errors.New("new name of the cluster is required")
+	}
+	if c.index(newName) >= 0 {
+		return fmt.Errorf("cluster %s already exists", newName)
+	}
+	c.Cluster[i].Name = newName
+	if c.Default == oldName {
+		c.Default = newName
+	}
+	return nil
+}
+
+// Validate checks the configuration and returns all problems found.
+func (c *Config) Validate() []error {
+	var problems []error
+	seen := make(map[string]bool)
+	for _, cc := range c.Cluster {
+		if cc.Name == "" {
+			problems = append(problems, fmt.Errorf("cluster with address %q has no name", cc.Address))
+		} else if seen[cc.Name] {
+			problems = append(problems, fmt.Errorf("cluster %s is configured more than once", cc.Name))
+		}
+		seen[cc.Name] = true
+		if u, err := url.Parse(cc.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("cluster %s: address %q is not a http(s) URL", cc.Name, cc.Address))
+		}
+		if cc.ProtocolVersion == "" {
+			problems = append(problems, fmt.Errorf("cluster %s: protocol version is missing", cc.Name))
+		}
+		if cc.Timeout != "" {
+			if timeout, err := time.ParseDuration(cc.Timeout); err != nil || timeout <= 0 {
+				problems = append(problems, fmt.Errorf("cluster %s: timeout %q is not a positive duration", cc.Name, cc.Timeout))
+			}
+		}
+		if cc.Credential != "" {
+			if err := checkCredentialReference(cc.Credential); err != nil {
+				problems = append(problems, fmt.Errorf("cluster %s: %s", cc.Name, err))
+			}
+		}
+		switch cc.Verify {
+		case "", client.VerifyCA, client.VerifyTOFU, client.VerifyNone:
+		default:
+			problems = append(problems, fmt.Errorf("cluster %s: unknown verification %q", cc.Name, cc.Verify))
+		}
+		if (cc.CertFile == "") != (cc.KeyFile == "") {
+			problems = append(problems, fmt.Errorf("cluster %s: client certificate and key must be set together", cc.Name))
+		}
+		for _, file := range []string{cc.CertFile, cc.KeyFile, cc.CAFile} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				problems = append(problems, fmt.Errorf("cluster %s: %s", cc.Name, err))
+			}
+		}
+	}
+	if c.Default != "" && !seen[c.Default] {
+		problems = append(problems, fmt.Errorf("default cluster %s is not configured", c.Default))
+	}
+	if c.Default == "" && !seen["default"] {
+		problems = append(problems, errors.New("no default cluster (set one with \"uc config set-default\")"))
+	}
+	return problems
+}
+
+// checkCredentialReference checks the syntax of a credential reference.
+func checkCredentialReference(ref string) error {
+	if ref == "yubikey" || strings.HasPrefix(ref, "secret:") || strings.HasPrefix(ref, "env:") ||
+		strings.HasPrefix(ref, "file:") {
+		return nil
+	}
+	return fmt.Errorf("credential %q is neither \"secret:VALUE\", \"env:NAME\", \"file:PATH\", nor \"yubikey\"", ref)
+}
+
+// ResolveCredential returns the shared secret a credential reference
+// points to. For "yubikey" the same string is returned since the one
+// time password needs to be read from the key.
+func ResolveCredential(ref string) (string, error) {
+	if err := checkCredentialReference(ref); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(ref, "secret:"):
+		return strings.TrimPrefix(ref, "secret:"), nil
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		secret, exists := os.LookupEnv(name)
+		if !exists {
+			return "", fmt.Errorf("environment variable %s of credential is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(ref, "file:"):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("reading credential: %s", err)
+		}
+		return strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0]), nil
+	}
+	return ref, nil
+}
+
+// newConfigReader returns a viper instance which searches the file
+// config.json (or .yaml, .yml, .toml) in the current directory, in
+// $HOME/.ubercluster/, and finally in /etc/ubercluster/.
+func newConfigReader() *viper.Viper {
+	v := viper.New()
+	v.SetConfigName("config")
 	// check local directory first
-	viper.AddConfigPath("./")
+	v.AddConfigPath("./")
 	// then home directory
-	viper.AddConfigPath("$HOME/.ubercluster/")
+	v.AddConfigPath("$HOME/.ubercluster/")
 	// finally /etc
-	viper.AddConfigPath("/etc/ubercluster/")
+	v.AddConfigPath("/etc/ubercluster/")
+	return v
+}
 
-	if err := viper.ReadInConfig(); err != nil {
+// ReadConfig reads in the configuration file and stores it as the
+// configuration of uc. It exits when no configuration is found.
+func ReadConfig() Config {
+	v := newConfigReader()
+	if err := v.ReadInConfig(); err != nil {
 		fmt.Printf("Error reading in config file: %s\n", err)
 		os.Exit(1)
 	}
 
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		fmt.Printf("Internal error parsing config file: %s\n", err)
 		os.Exit(1)
 	}
 	return config
 }
 
-func listConfig(clusteraddress string) {
-	for _, cc := range config.Cluster {
-		fmt.Println(cc)
-	}
-}
-
 // GetClusterAddress searches the address of the cluster to contact to
-// in the configuration ("default" point to default cluster)
+// in the configuration ("default" point to default cluster). It returns
+// the address and the name of the cluster.
 func GetClusterAddress(cluster string) (string, string, error) {
 	var clusteraddress string
-	for i := range config.Cluster {
-		if cluster == config.Cluster[i].Name {
-			clusteraddress = config.Cluster[i].Address
-			clusteraddress = fmt.Sprintf("%s%s", clusteraddress, config.Cluster[i].ProtocolVersion)
-			break
-		}
+	if cc, exists := config.FindCluster(cluster); exists {
+		clusteraddress = fmt.Sprintf("%s%s", cc.Address, cc.ProtocolVersion)
+		cluster = cc.Name
 	}
 	if clusteraddress == "" {
 		text := fmt.Sprintf("Cluster %s not found in configuration", cluster)
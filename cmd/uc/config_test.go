@@ -5,6 +5,13 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
 )
 
 var _ = Describe("Config", func() {
@@ -19,7 +26,7 @@ var _ = Describe("Config", func() {
 			Ω(config.Cluster[1].Address).To(Equal("http://localhost:1212/"))
 			Ω(config.Cluster[1].ProtocolVersion).To(Equal("v1"))
 			Ω(config.Cluster[0].Name).To(Equal("default"))
-			Ω(config.Cluster[0].Address).To(Equal("http://localhost:8888/"))
+			Ω(config.Cluster[0].Address).To(Equal("https://localhost:8888/"))
 			Ω(config.Cluster[0].ProtocolVersion).To(Equal("v1"))
 		})
 		It("must select the right address", func() {
@@ -31,4 +38,115 @@ var _ = Describe("Config", func() {
 			Ω(err2).NotTo(BeNil())
 		})
 	})
+
+	Context("When the config file is managed", func() {
+
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+			tmpdir, err = ioutil.TempDir("", "ucconfig")
+			Ω(err).Should(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpdir)
+		})
+
+		It("must write and read JSON, YAML, and TOML files", func() {
+			for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+				path := filepath.Join(tmpdir, "sub", name)
+				Ω(InitConfigFile(path, "http://localhost:8888/", false)).Should(BeNil())
+				Ω(InitConfigFile(path, "http://localhost:8888/", false)).ShouldNot(BeNil())
+				Ω(UpdateConfigFile(path, func(c *Config) error {
+					return c.AddCluster(ClusterConfig{Name: "gpu", Address: "https://gpu:8888/",
+						Description: "GPU cluster", Tags: []string{"gpu", "eu"}, DefaultQueue: "gpu.q",
+						DefaultCategory: "cuda", Timeout: "30s", Credential: "env:GPU_SECRET"})
+				})).Should(BeNil())
+
+				c, err := LoadConfigFile(path)
+				Ω(err).Should(BeNil())
+				Ω(c.Cluster).Should(HaveLen(2))
+				Ω(c.Cluster[0]).Should(Equal(ClusterConfig{Name: "default", Address: "http://localhost:8888/", ProtocolVersion: "v1"}))
+				Ω(c.Cluster[1].ProtocolVersion).Should(Equal("v1"))
+				Ω(c.Cluster[1].Tags).Should(Equal([]string{"gpu", "eu"}))
+				Ω(c.Cluster[1].DefaultQueue).Should(Equal("gpu.q"))
+				Ω(c.Cluster[1].DefaultCategory).Should(Equal("cuda"))
+				Ω(c.Cluster[1].Description).Should(Equal("GPU cluster"))
+				Ω(c.Cluster[1].RequestTimeout(time.Second)).Should(Equal(30 * time.Second))
+				Ω(c.Cluster[1].Credential).Should(Equal("env:GPU_SECRET"))
+				Ω(c.Validate()).Should(BeEmpty())
+
+				fi, err := os.Stat(path)
+				Ω(err).Should(BeNil())
+				Ω(fi.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+			}
+			files, err := ioutil.ReadDir(filepath.Join(tmpdir, "sub"))
+			Ω(err).Should(BeNil())
+			Ω(files).Should(HaveLen(4))
+			Ω(SaveConfigFile(filepath.Join(tmpdir, "config.ini"), Config{})).ShouldNot(BeNil())
+		})
+
+		It("must remove, rename, and set the default cluster", func() {
+			c := DefaultConfig("http://localhost:8888/")
+			Ω(c.AddCluster(ClusterConfig{Name: "linux", Address: "http://localhost:1212/"})).Should(BeNil())
+			Ω(c.AddCluster(ClusterConfig{Name: "linux", Address: "http://localhost:1313/"})).ShouldNot(BeNil())
+
+			Ω(c.SetDefault("unknown")).ShouldNot(BeNil())
+			Ω(c.SetDefault("linux")).Should(BeNil())
+			cc, exists := c.FindCluster("default")
+			Ω(exists).Should(BeTrue())
+			Ω(cc.Name).Should(Equal("linux"))
+
+			Ω(c.RenameCluster("linux", "default")).ShouldNot(BeNil())
+			Ω(c.RenameCluster("linux", "penguin")).Should(BeNil())
+			Ω(c.Default).Should(Equal("penguin"))
+
+			Ω(c.RemoveCluster("penguin")).Should(BeNil())
+			Ω(c.RemoveCluster("penguin")).ShouldNot(BeNil())
+			Ω(c.Default).Should(Equal(""))
+			cc, exists = c.FindCluster("default")
+			Ω(exists).Should(BeTrue())
+			Ω(cc.Name).Should(Equal("default"))
+		})
+
+		It("must report invalid settings", func() {
+			c := Config{Default: "gone", Cluster: []ClusterConfig{
+				{Name: "a", Address: "localhost:8888", ProtocolVersion: "v1"},
+				{Name: "a", Address: "http://b/", Timeout: "soon", Credential: "secret"},
+				{Name: "c", Address: "https://c/", ProtocolVersion: "v1", CertFile: filepath.Join(tmpdir, "missing.pem")},
+			}}
+			Ω(c.Validate()).Should(HaveLen(8))
+		})
+
+		It("must not print secrets given in the configuration", func() {
+			cc := ClusterConfig{Name: "a", Address: "http://a/", ProtocolVersion: "v1", Credential: "secret:s3cret"}
+			Ω(cc.String()).ShouldNot(ContainSubstring("s3cret"))
+			Ω(cc.String()).Should(ContainSubstring("Credential: secret:***"))
+			Ω(cc.Info(false).Credential).Should(Equal("secret:***"))
+			cc.Credential = "env:UC_SECRET"
+			Ω(cc.String()).Should(ContainSubstring("Credential: env:UC_SECRET"))
+		})
+
+		It("must resolve credentials and apply cluster defaults", func() {
+			os.Setenv("UC_TEST_SECRET", "s3cret")
+			defer os.Unsetenv("UC_TEST_SECRET")
+			Ω(ResolveCredential("env:UC_TEST_SECRET")).Should(Equal("s3cret"))
+			Ω(ResolveCredential("secret:s3cret")).Should(Equal("s3cret"))
+			_, err := ResolveCredential("env:UC_TEST_UNSET")
+			Ω(err).ShouldNot(BeNil())
+
+			secretFile := filepath.Join(tmpdir, "secret")
+			Ω(ioutil.WriteFile(secretFile, []byte("t0ken\n"), 0600)).Should(BeNil())
+			Ω(ResolveCredential("file:" + secretFile)).Should(Equal("t0ken"))
+			_, err = ResolveCredential("t0ken")
+			Ω(err).ShouldNot(BeNil())
+
+			jt := types.JobTemplate{JobCategory: "shell"}
+			ClusterConfig{DefaultQueue: "all.q", DefaultCategory: "cuda"}.ApplyDefaults(&jt)
+			Ω(jt.QueueName).Should(Equal("all.q"))
+			Ω(jt.JobCategory).Should(Equal("shell"))
+		})
+
+	})
 })
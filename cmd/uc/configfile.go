@@ -0,0 +1,270 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/ghodss/yaml"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+)
+
+// DefaultConfigFile returns the file created by "uc config init" when
+// no file is given ($HOME/.ubercluster/config.json).
+func DefaultConfigFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".ubercluster", "config.json")
+}
+
+// FindConfigFile returns the path of the configuration file uc reads.
+func FindConfigFile() (string, error) {
+	v := newConfigReader()
+	if err := v.ReadInConfig(); err != nil {
+		return "", err
+	}
+	return v.ConfigFileUsed(), nil
+}
+
+// LoadConfigFile reads the configuration from a JSON, YAML, or TOML
+// file. The format is detected by the file extension.
+func LoadConfigFile(path string) (Config, error) {
+	var c Config
+	if _, err := configFormat(path); err != nil {
+		return c, err
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return c, fmt.Errorf("reading config file %s: %s", path, err)
+	}
+	if err := v.Unmarshal(&c); err != nil {
+		return c, fmt.Errorf("parsing config file %s: %s", path, err)
+	}
+	return c, nil
+}
+
+// configFormat returns the format of the configuration file which is
+// given by its extension (json, yaml, yml, or toml).
+func configFormat(path string) (string, error) {
+	switch format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); format {
+	case "json", "yaml", "yml", "toml":
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported format of config file %s (use .json, .yaml, .yml, or .toml)", path)
+}
+
+// encodeConfig encodes the configuration in the format of the file.
+func encodeConfig(path string, c Config) ([]byte, error) {
+	format, err := configFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case "yaml", "yml":
+		return yaml.Marshal(c)
+	case "toml":
+		return toml.Marshal(c)
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	return append(data, '\n'), err
+}
+
+// SaveConfigFile writes the configuration atomically: it is written to
+// a temporary file in the same directory which replaces the file when
+// it is complete. The permissions of an existing file are kept, new
+// files are only accessible by the user.
+func SaveConfigFile(path string, c Config) error {
+	data, err := encodeConfig(path, c)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// configFileOrExit returns the given configuration file or the one uc
+// reads when no file is given.
+func configFileOrExit(file string) string {
+	if file != "" {
+		return file
+	}
+	path, err := FindConfigFile()
+	if err != nil {
+		fmt.Printf("No configuration file found (create one with \"uc config init\"): %s\n", err)
+		os.Exit(1)
+	}
+	return path
+}
+
+// UpdateConfigFile applies the change to the configuration in the
+// file and writes it back when the change succeeded.
+func UpdateConfigFile(path string, change func(c *Config) error) error {
+	c, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if err := change(&c); err != nil {
+		return err
+	}
+	return SaveConfigFile(path, c)
+}
+
+// InitConfigFile creates a configuration file with the cluster
+// "default". An existing file is only replaced when force is set.
+func InitConfigFile(path, address string, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("config file %s already exists", path)
+	}
+	return SaveConfigFile(path, DefaultConfig(address))
+}
+
+// configCommand executes a "uc config" command on the configuration
+// file.
+func configCommand(command string) {
+	var err error
+	of := MakeOutputFormater(*outformat, "")
+	switch command {
+	case cfgInit.FullCommand():
+		path := *cfgFile
+		if path == "" {
+			path = DefaultConfigFile()
+		}
+		if err = InitConfigFile(path, *cfgInitAddress, *cfgInitForce); err == nil {
+			fmt.Printf("Created %s\n", path)
+		}
+	case cfgList.FullCommand():
+		var c Config
+		if c, err = LoadConfigFile(configFileOrExit(*cfgFile)); err == nil {
+			def := c.defaultCluster()
+			clusters := []types.ClusterInfo{}
+			for _, cc := range c.Cluster {
+				if *cfgListTag == "" || cc.HasTag(*cfgListTag) {
+					clusters = append(clusters, cc.Info(cc.Name == def))
+				}
+			}
+			of.PrintClusters(clusters)
+		}
+	case cfgShow.FullCommand():
+		err = showConfig(configFileOrExit(*cfgFile), *cfgShowName, of)
+	case cfgValidate.FullCommand():
+		path := configFileOrExit(*cfgFile)
+		var c Config
+		if c, err = LoadConfigFile(path); err == nil {
+			problems := c.Validate()
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				os.Exit(1)
+			}
+			fmt.Printf("%s is valid\n", path)
+		}
+	case cfgAdd.FullCommand():
+		cc := ClusterConfig{
+			Name:            *cfgAddName,
+			Address:         *cfgAddAddress,
+			ProtocolVersion: *cfgAddVersion,
+			Description:     *cfgAddDescription,
+			Tags:            *cfgAddTags,
+			DefaultQueue:    *cfgAddQueue,
+			DefaultCategory: *cfgAddCategory,
+			Timeout:         *cfgAddTimeout,
+			Credential:      *cfgAddCredential,
+			CertFile:        *cfgAddCertFile,
+			KeyFile:         *cfgAddKeyFile,
+			CAFile:          *cfgAddCAFile,
+			ServerName:      *cfgAddServerName,
+			Verify:          *cfgAddVerify,
+		}
+		err = UpdateConfigFile(configFileOrExit(*cfgFile), func(c *Config) error {
+			return c.AddCluster(cc)
+		})
+	case cfgRemove.FullCommand():
+		err = UpdateConfigFile(configFileOrExit(*cfgFile), func(c *Config) error {
+			return c.RemoveCluster(*cfgRemoveName)
+		})
+	case cfgSetDefault.FullCommand():
+		err = UpdateConfigFile(configFileOrExit(*cfgFile), func(c *Config) error {
+			return c.SetDefault(*cfgSetDefaultName)
+		})
+	case cfgRename.FullCommand():
+		err = UpdateConfigFile(configFileOrExit(*cfgFile), func(c *Config) error {
+			return c.RenameCluster(*cfgRenameOld, *cfgRenameNew)
+		})
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+}
+
+// showConfig prints the configuration of a cluster or the file and
+// its default cluster when no cluster is given.
+func showConfig(path, name string, of output.OutputFormater) error {
+	c, err := LoadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	def := c.defaultCluster()
+	if name != "" {
+		cc, exists := c.FindCluster(name)
+		if !exists {
+			return fmt.Errorf("cluster %s not found in configuration", name)
+		}
+		of.PrintClusters([]types.ClusterInfo{cc.Info(cc.Name == def)})
+		return nil
+	}
+	info := types.ConfigInfo{File: path, Default: def, Clusters: make([]types.ClusterInfo, 0, len(c.Cluster))}
+	for _, cc := range c.Cluster {
+		info.Clusters = append(info.Clusters, cc.Info(cc.Name == def))
+	}
+	of.PrintConfig(info)
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// ParseHistoryTime parses a point in time given either in RFC 3339
+// format (like "2018-03-01T10:00:00Z") or as duration before now
+// (like "24h"). An empty string is the zero time.
+func ParseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s (expected RFC 3339 time or duration like 24h)", value)
+	}
+	return t, nil
+}
+
+// FormatMigration returns the lineage of a migrated job (like
+// " (from 12@cluster1)" or " (-> 7@cluster2)") for the history output.
+func FormatMigration(entry types.JobHistoryEntry) string {
+	lineage := ""
+	if entry.MigratedFrom != "" {
+		lineage += " (from " + entry.MigratedFrom + ")"
+	}
+	if entry.MigratedTo != "" {
+		lineage += " (-> " + entry.MigratedTo + ")"
+	}
+	return lineage
+}
+
+// ShowJobHistory prints the jobs stored in the job history of the
+// proxy which ran in the given time range and belong to owner.
+func (r *Request) ShowJobHistory(clusteraddress, since, until, owner string, of output.OutputFormater) {
+	now := time.Now()
+	sinceTime, err := ParseHistoryTime(since, now)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	untilTime, err := ParseHistoryTime(until, now)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	entries, err := c.GetJobHistory(context.Background(), sinceTime, untilTime, owner)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	jis := make([]types.JobInfo, 0, len(entries))
+	for _, entry := range entries {
+		if *outformat == "default" {
+			state, finished := "running", "-"
+			if entry.JobInfo != nil && !entry.FinishedAt.IsZero() {
+				state = entry.JobInfo.State.String()
+				finished = entry.FinishedAt.Format(time.RFC3339)
+			}
+			if entry.MigratedTo != "" {
+				state = "migrated"
+			}
+			fmt.Printf("%s %s %s %s %s%s\n", entry.JobId, entry.SubmittedAt.Format(time.RFC3339),
+				finished, state, entry.JobTemplate.RemoteCommand, FormatMigration(entry))
+			continue
+		}
+		ji := types.JobInfo{Id: entry.JobId, State: types.Undetermined, SubmissionTime: entry.SubmittedAt}
+		if entry.JobInfo != nil {
+			ji = *entry.JobInfo
+		}
+		jis = append(jis, ji)
+	}
+	if *outformat != "default" {
+		of.PrintJobs(jis)
+	} else if len(entries) == 0 {
+		fmt.Println("No job found in job history.")
+	}
+}
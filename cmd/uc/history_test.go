@@ -0,0 +1,32 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("History", func() {
+
+	It("must parse RFC 3339 times and durations", func() {
+		now := time.Date(2018, 3, 2, 10, 0, 0, 0, time.UTC)
+		t, err := ParseHistoryTime("24h", now)
+		Ω(err).Should(BeNil())
+		Ω(t).Should(Equal(now.Add(-24 * time.Hour)))
+
+		t, err = ParseHistoryTime("2018-03-01T08:00:00Z", now)
+		Ω(err).Should(BeNil())
+		Ω(t.Day()).Should(Equal(1))
+
+		t, err = ParseHistoryTime("", now)
+		Ω(err).Should(BeNil())
+		Ω(t.IsZero()).Should(BeTrue())
+
+		_, err = ParseHistoryTime("yesterday", now)
+		Ω(err).ShouldNot(BeNil())
+	})
+
+})
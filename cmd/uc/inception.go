@@ -19,167 +19,407 @@ package main
 // Run uc as proxy itself. Allows to stack clusters of cluster recursively.
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"github.com/dgruber/ubercluster/pkg/client"
 	"github.com/dgruber/ubercluster/pkg/persistency"
 	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
+	"io"
 	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Inception struct {
 	inceptionAddress string // address of uc itself
 	config           Config // uc configuration object
 	request          *Request
+	alg              string        // cluster selection for submitted jobs
+	routes           *RoutingTable // routes of submitted jobs (optional)
+	proxyID          string        // id of uc in the visited path of forwarded requests
+	maxDepth         int           // max. amount of proxies a request passes
+	timeout          time.Duration // deadline of requests to child clusters
+	cache            *aggregationCache
 }
 
-func NewInception(certFile, keyFile string, otp string, config Config) *Inception {
+// DefaultMaxDepth is the default maximum amount of inception proxies
+// a request may pass.
+const DefaultMaxDepth = 8
+
+// NewInception creates the ProxyImplementer of the inception mode. Jobs
+// are submitted in the cluster selected by the scheduler given by alg
+// ("rand", "prob", "load"); without alg the "default" cluster is used.
+// When a routing table is given the routes of submitted jobs are stored
+// in it. Child clusters are accessed with their own credentials and TLS
+// settings; the others with the certificate, key, and otp of uc.
+func NewInception(certFile, keyFile string, otp string, config Config, alg string, routes *RoutingTable) *Inception {
+	request := NewRequest(certFile, keyFile, &otp)
+	request.clusters = config
 	return &Inception{
-		config:  config, // configuration contains all connected clusters,
-		request: NewRequest(certFile, keyFile, &otp),
+		config:   config, // configuration contains all connected clusters,
+		request:  request,
+		alg:      alg,
+		routes:   routes,
+		proxyID:  defaultProxyID(""),
+		maxDepth: DefaultMaxDepth,
+		timeout:  DefaultClusterTimeout,
+		cache:    newAggregationCache(DefaultCacheTTL),
 	}
 }
 
-// Implements the ProxyImplementer interface
+// SetTLS sets the TLS settings for the child clusters which have no
+// own TLS settings.
+func (i *Inception) SetTLS(tc client.TLSConfig) error {
+	request, err := NewTLSRequest(tc, i.request.otp)
+	if err != nil {
+		return err
+	}
+	request.clusters = i.config
+	i.request = request
+	return nil
+}
 
-// collects jobinfos from all clusters in parallel
-type jiProtected struct {
-	sync.Mutex
-	sync.WaitGroup
-	jobinfos []types.JobInfo
+// CheckClusterAuth checks the credentials and TLS settings of all
+// child clusters. Credentials which require interactivity (yubikey)
+// are not supported.
+func (i *Inception) CheckClusterAuth() error {
+	return i.request.auth.Check(i.config)
 }
 
-// requestJobInfos requests job infos of jobs in the
-// given state from a cluster given by the address
-func requestJobInfos(i *Inception, ji *jiProtected, state string, address string) {
-	log.Println("Requesting from: ", address)
-	jis := i.request.GetJobs(address, state, "")
-	log.Println("Got following jobinfos: ", jis)
-	if jis != nil {
-		ji.Lock()
-		ji.jobinfos = append(ji.jobinfos, jis...)
-		ji.Unlock()
+// defaultProxyID creates the id of the inception proxy out of the
+// host name and the address it listens on.
+func defaultProxyID(address string) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
 	}
-	ji.Done()
+	if _, port, err := net.SplitHostPort(address); err == nil {
+		return fmt.Sprintf("%s:%s", hostname, port)
+	}
+	return hostname
 }
 
-func (i *Inception) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
-	var jip jiProtected
-	jip.jobinfos = make([]types.JobInfo, 0, 0)
-	jip.Add(len(i.config.Cluster))
-	// request clusters in parallel and wait for all of them
+// SetLoopDetection sets the id the inception proxy adds to the visited
+// path of the requests it forwards and the maximum amount of proxies
+// a request may pass. Requests which already visited the proxy are
+// rejected.
+func (i *Inception) SetLoopDetection(proxyID string, maxDepth int) error {
+	if proxyID == "" || strings.ContainsAny(proxyID, ", ") {
+		return fmt.Errorf("invalid proxy id %q", proxyID)
+	}
+	if maxDepth < 1 {
+		return fmt.Errorf("maximum depth must be at least 1 (is %d)", maxDepth)
+	}
+	i.proxyID = proxyID
+	i.maxDepth = maxDepth
+	return nil
+}
+
+// ForRequest implements the proxy.RequestForwarder interface. When the
+// request was already forwarded by this inception proxy (a loop in the
+// tree of clusters) or it passed too many proxies it is rejected.
+// Otherwise an Inception is returned which sends the request id and the
+// visited path including this proxy to the child clusters.
+func (i *Inception) ForRequest(hops types.Hops) (proxy.ProxyImplementer, error) {
+	for n, id := range hops.Visited {
+		if id == i.proxyID {
+			cycle := append(append([]string{}, hops.Visited[n:]...), i.proxyID)
+			return nil, proxy.Errorf(types.ErrorCodeLoopDetected, "request loop detected: %s",
+				strings.Join(cycle, " -> "))
+		}
+	}
+	if len(hops.Visited) >= i.maxDepth {
+		path := append(append([]string{}, hops.Visited...), i.proxyID)
+		return nil, proxy.Errorf(types.ErrorCodeLoopDetected, "maximum depth of %d proxies exceeded: %s",
+			i.maxDepth, strings.Join(path, " -> "))
+	}
+	forwarding := *i
+	request := *i.request
+	request.hops = &types.Hops{
+		RequestID: hops.RequestID,
+		Visited:   append(append([]string{}, hops.Visited...), i.proxyID),
+	}
+	forwarding.request = &request
+	return &forwarding, nil
+}
+
+// isOwnAddress returns true if the cluster address refers to the
+// address the inception proxy listens on.
+func (i *Inception) isOwnAddress(address string) bool {
+	if i.inceptionAddress == "" {
+		return false
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(i.inceptionAddress)
+	if err != nil || u.Port() != port {
+		return false
+	}
+	switch u.Hostname() {
+	case host, "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	hostname, _ := os.Hostname()
+	return u.Hostname() == hostname
+}
+
+// childClusters returns all configured clusters except the inception
+// proxy itself. Clusters which are configured more than once (with
+// different names) are returned only once.
+func (i *Inception) childClusters() []ClusterConfig {
+	clusters := make([]ClusterConfig, 0, len(i.config.Cluster))
+	addresses := make(map[string]bool)
 	for _, c := range i.config.Cluster {
-		if addr := fmt.Sprintf("%s/", c.Address); addr == i.inceptionAddress {
+		if i.isOwnAddress(c.Address) {
 			log.Println("Skipping own address ", c.Address)
-			jip.Done()
 			continue
 		}
-		go requestJobInfos(i, &jip, "all", fmt.Sprintf("%s/v1", c.Address))
+		address := fmt.Sprintf("%s%s", c.Address, c.ProtocolVersion)
+		if addresses[address] {
+			continue
+		}
+		addresses[address] = true
+		clusters = append(clusters, c)
+	}
+	return clusters
+}
+
+// requestTimeout returns the deadline of requests to the child cluster
+// (its timeout in the configuration or the timeout of the inception
+// proxy).
+func (i *Inception) requestTimeout(cluster string) time.Duration {
+	for _, c := range i.config.Cluster {
+		if c.Name == cluster {
+			return c.RequestTimeout(i.timeout)
+		}
 	}
-	// wait until we got all job infos from all cluster
-	jip.Wait()
+	return i.timeout
+}
 
-	return jip.jobinfos
+// childError converts the error answer of a child cluster so that the
+// inception proxy answers with the same error code.
+func childError(cluster string, err error) error {
+	if e, ok := err.(*client.Error); ok && e.Code != "" {
+		return proxy.Errorf(e.Code, "%s (cluster %s)", e.Message, cluster)
+	}
+	return proxy.Errorf(types.ErrorCodeInternal, "request to cluster %s failed: %s", cluster, err)
 }
 
-func getJobFromCluster(i *Inception, clustername string, jobid string) (*types.JobInfo, error) {
-	// check if cluster name is known
-	address := ""
-	version := "v1"
+// route returns the child cluster and the job id in the child cluster
+// of a job id in the form jobid@cluster. Jobs which are not in the
+// routing table are searched in the configured cluster with the name
+// of the suffix or in the "default" cluster when there is no suffix.
+func (i *Inception) route(jobid string) (JobRoute, error) {
+	if i.routes != nil {
+		if route, err := i.routes.Lookup(jobid); err == nil {
+			return route, nil
+		}
+	}
+	id, clustername := splitJobID(jobid)
+	if clustername == "" {
+		clustername = "default"
+	}
 	for _, c := range i.config.Cluster {
 		if c.Name == clustername {
-			address = c.Address
-			version = c.ProtocolVersion
-			break
+			return JobRoute{
+				JobId:           id,
+				Cluster:         c.Name,
+				Address:         c.Address,
+				ProtocolVersion: c.ProtocolVersion,
+			}, nil
 		}
 	}
-	if address != "" {
-		request := fmt.Sprintf("%s%s", address, version)
-		log.Println("GetJobFromCluster request", request)
-		job, err := i.request.GetJob(request, jobid)
-		if err == nil {
-			return &job, nil
-		}
-		log.Println("error during requesting job: ", err)
-		return nil, err
+	return JobRoute{}, proxy.Errorf(types.ErrorCodeNotFound, "Couldn't find clustername in config: %s", clustername)
+}
+
+// Implements the ProxyImplementer interface
 
+// GetJobInfosByFilter returns the job infos of all child clusters. The
+// job ids are extended by the cluster name (jobid@cluster). Clusters
+// which don't answer in time are skipped.
+func (i *Inception) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
+	results, unreachable := i.fanOut(func(ctx context.Context, pc *client.Client) (interface{}, error) {
+		return pc.GetJobInfos(ctx, "all", "")
+	})
+	if len(unreachable) > 0 {
+		log.Println("Job infos incomplete, unreachable clusters: ", unreachable)
+	}
+	jobinfos := make([]types.JobInfo, 0)
+	for _, r := range results {
+		for _, ji := range r.value.([]types.JobInfo) {
+			if filtered && filter.State != types.Unset && filter.State != ji.State {
+				continue
+			}
+			if filtered && filter.JobOwner != "" && filter.JobOwner != ji.JobOwner {
+				continue
+			}
+			ji.Id = tag(ji.Id, r.cluster)
+			jobinfos = append(jobinfos, ji)
+		}
 	}
-	return nil, errors.New("Couldn't find clustername in config: " + clustername)
+	return jobinfos
 }
 
+// GetJobInfo requests the job info from the cluster referenced by the
+// job id (like 1301@mybiggridenginecluster) or from the default cluster
+// when the job id has no cluster name.
 func (i *Inception) GetJobInfo(jobid string) *types.JobInfo {
-	// search job id in all connected clusters
-	// if it has a postfix - only in that cluster
-	// 1301@mybiggridenginecluster search 1301 in the given cluster
-	if strings.Contains(jobid, "@") {
-		// get cluster name
-		jobAtCluster := strings.Split(jobid, "@")
-		if len(jobAtCluster) == 2 {
-			job, _ := getJobFromCluster(i, jobAtCluster[1], jobAtCluster[0])
-			return job
-		}
-		log.Println("Wrong job identifier (expected jobid@cluster or jobid) but is ", jobid)
-	} else {
-		// request default cluster for the given job identifier
-		job, _ := getJobFromCluster(i, "default", jobid)
-		return job
+	route, err := i.route(jobid)
+	if err != nil {
+		log.Println("Wrong job identifier: ", err)
+		return nil
 	}
-	return nil
+	job, err := i.request.GetJob(route.ClusterAddress(), route.JobId)
+	if err != nil {
+		log.Println("error during requesting job: ", err)
+		return nil
+	}
+	job.Id = fmt.Sprintf("%s@%s", job.Id, route.Cluster)
+	return &job
 }
 
-func (i *Inception) GetAllMachines(machines []string) ([]types.Machine, error) {
-	allmachines := make([]types.Machine, 0, 0)
+// splitJobID splits a job identifier in the form jobid@cluster into
+// the job id and the cluster name. The job id itself can contain
+// further @ when the cluster is an inception proxy.
+func splitJobID(jobid string) (string, string) {
+	at := strings.LastIndex(jobid, "@")
+	if at < 0 {
+		return jobid, ""
+	}
+	return jobid[:at], jobid[at+1:]
+}
+
+// WatchJobInfos implements the proxy.JobInfoWatcher interface. It opens
+// the job state streams of all connected clusters (or of the cluster
+// referenced in jobid@cluster) and merges them. The job ids are extended
+// by the cluster name.
+func (i *Inception) WatchJobInfos(ctx context.Context, jobid string) (<-chan types.JobInfo, error) {
+	id, clustername := splitJobID(jobid)
+	clusters := make([]ClusterConfig, 0, len(i.config.Cluster))
 	for _, c := range i.config.Cluster {
-		log.Println("Requesting from: ", c.Address)
-		// we don't request our own address...
-		if addr := fmt.Sprintf("%s/", c.Address); addr == i.inceptionAddress {
+		if i.isOwnAddress(c.Address) {
+			log.Println("Skipping own address ", c.Address)
 			continue
 		}
-		address, _, err := GetClusterAddress(c.Name)
-		if err != nil {
-			log.Panicln(err.Error())
-			return nil, err
+		if clustername == "" || clustername == c.Name {
+			clusters = append(clusters, c)
 		}
-		if ms, err := i.request.GetMachines(address, "all"); err == nil {
-			allmachines = append(allmachines, ms...)
-			log.Println("Appending: ", allmachines)
-		} else {
-			log.Println("Error while requesting machines from ", c.Name, err)
+	}
+	if len(clusters) == 0 {
+		return nil, proxy.Errorf(types.ErrorCodeNotFound, "Couldn't find clustername in config: %s", clustername)
+	}
+
+	events := make(chan types.JobInfo)
+	var wg sync.WaitGroup
+	wg.Add(len(clusters))
+	for _, c := range clusters {
+		go func(c ClusterConfig) {
+			defer wg.Done()
+			pc, err := i.request.proxyClient(fmt.Sprintf("%s%s", c.Address, c.ProtocolVersion))
+			if err != nil {
+				log.Println("Error while watching jobs of ", c.Name, err)
+				return
+			}
+			err = pc.WatchJobInfos(ctx, id, func(ji types.JobInfo) error {
+				ji.Id = fmt.Sprintf("%s@%s", ji.Id, c.Name)
+				select {
+				case events <- ji:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Println("Error while watching jobs of ", c.Name, err)
+			}
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events, nil
+}
+
+// JobOutput implements the proxy.JobOutputProvider interface. The
+// output is forwarded from the cluster referenced in jobid@cluster
+// or from the default cluster.
+func (i *Inception) JobOutput(ctx context.Context, jobid, stream string, follow bool) (io.ReadCloser, error) {
+	route, err := i.route(jobid)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := i.request.proxyClient(route.ClusterAddress())
+	if err != nil {
+		return nil, childError(route.Cluster, err)
+	}
+	output, err := pc.JobOutput(ctx, proxy.DefaultJobSession, route.JobId, stream, follow)
+	if err != nil {
+		return nil, childError(route.Cluster, err)
+	}
+	return output, nil
+}
+
+// GetAllMachines returns the machines of all child clusters. The names
+// are extended by the cluster name (host@cluster). The requested
+// machines can be given with or without cluster name. When clusters
+// don't answer the machines of the other clusters are returned with
+// a proxy.PartialResultError.
+func (i *Inception) GetAllMachines(machines []string) ([]types.Machine, error) {
+	results, unreachable := i.collect("machines", func(ctx context.Context, pc *client.Client) (interface{}, error) {
+		return pc.GetMachines(ctx, "all")
+	})
+	allmachines := make([]types.Machine, 0)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, m := range r.value.([]types.Machine) {
+			if !matchesNames(machines, m.Name, r.cluster) {
+				continue
+			}
+			if m.Name = tag(m.Name, r.cluster); !seen[m.Name] {
+				seen[m.Name] = true
+				allmachines = append(allmachines, m)
+			}
 		}
-		// TODO filter according request
-		// TODO remove duplicates
 	}
-	return allmachines, nil
+	return allmachines, partialResultError(unreachable)
 }
 
-// GetAllQueues returns all queue names from all clusters which are
-// connected to the uc tool.
+// requestQueues requests all queues of a child cluster.
+func requestQueues(ctx context.Context, pc *client.Client) (interface{}, error) {
+	return pc.GetQueues(ctx, "all")
+}
+
+// GetAllQueues returns the queues of all child clusters. The names are
+// extended by the cluster name (queue@cluster) so that they can be used
+// for submitting jobs in that cluster. The requested queues can be
+// given with or without cluster name. When clusters don't answer the
+// queues of the other clusters are returned with a
+// proxy.PartialResultError.
 func (i *Inception) GetAllQueues(queues []string) ([]types.Queue, error) {
-	allqueues := make([]types.Queue, 0, 0)
-	// TODO go functions of course
-	for _, c := range i.config.Cluster {
-		log.Println("Requesting from: ", c.Address)
-		// we don't request our own address...
-		if addr := fmt.Sprintf("%s/", c.Address); addr == i.inceptionAddress {
-			continue
+	results, unreachable := i.collect("queues", requestQueues)
+	allqueues := make([]types.Queue, 0)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, q := range r.value.([]types.Queue) {
+			if !matchesNames(queues, q.Name, r.cluster) {
+				continue
+			}
+			if q.Name = tag(q.Name, r.cluster); !seen[q.Name] {
+				seen[q.Name] = true
+				allqueues = append(allqueues, q)
+			}
 		}
-		address, _, err := GetClusterAddress(c.Name)
-		if err != nil {
-			log.Panicln(err.Error())
-			return nil, err
-		}
-		if qs, err := i.request.GetQueues(address, "all"); err == nil {
-			allqueues = append(allqueues, qs...)
-			log.Println("Appending: ", allqueues)
-		} else {
-			log.Println("Error while requesting queues from ", c.Name, err)
-		}
-		// TODO filter according request
-		// TODO remove duplicates
 	}
-	return allqueues, nil
+	return allqueues, partialResultError(unreachable)
 }
 
 func (i *Inception) GetAllSessions(session []string) ([]string, error) {
@@ -189,22 +429,25 @@ func (i *Inception) GetAllSessions(session []string) ([]string, error) {
 	return allsessions, nil
 }
 
+// GetAllCategories returns the job categories of all child clusters
+// extended by the cluster name (category@cluster). When clusters don't
+// answer the categories of the other clusters are returned with a
+// proxy.PartialResultError.
 func (i *Inception) GetAllCategories() ([]string, error) {
-	cat := make([]string, 0, 0)
-	for _, c := range i.config.Cluster {
-		log.Println("Requesting from: ", c.Address)
-		if addr := fmt.Sprintf("%s/", c.Address); addr == i.inceptionAddress {
-			log.Println("Skipping own address")
-			continue
-		}
-		address, _, err := GetClusterAddress(c.Name)
-		if err != nil {
-			log.Panicln(err.Error())
-			return nil, err
+	results, unreachable := i.collect("categories", func(ctx context.Context, pc *client.Client) (interface{}, error) {
+		return pc.GetJobCategories(ctx, proxy.DefaultJobSession)
+	})
+	categories := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		for _, category := range r.value.([]string) {
+			if category = tag(category, r.cluster); !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
 		}
-		cat = append(cat, i.request.GetJobCategories(address, "ubercluster", "all")...)
 	}
-	return cat, nil
+	return categories, partialResultError(unreachable)
 }
 
 func (i *Inception) DRMSVersion() string {
@@ -215,25 +458,223 @@ func (i *Inception) DRMSName() string {
 	return "ubercluster"
 }
 
+// childLoad is the load of a child cluster and its capacity in slots.
+type childLoad struct {
+	load     float64
+	capacity float64
+}
+
+// DRMSLoad returns the average load of the reachable child clusters
+// weighted by their capacity, which are the slots of their machines
+// (see proxy.MachineSlots). A cluster without machine information
+// counts as one slot. When no child cluster answers the load is 1.
 func (i *Inception) DRMSLoad() float64 {
-	return 0.5
+	results, _ := i.collect("load", func(ctx context.Context, pc *client.Client) (interface{}, error) {
+		load, err := pc.DRMSLoad(ctx)
+		if err != nil {
+			return nil, err
+		}
+		machines, err := pc.GetMachines(ctx, "all")
+		if err != nil && !client.IsPartialResult(err) {
+			log.Println("Can not get machines for the capacity of the cluster: ", err)
+		}
+		return childLoad{load: load, capacity: math.Max(proxy.MachineSlots(machines), 1)}, nil
+	})
+	var weighted, capacity float64
+	for _, r := range results {
+		cl := r.value.(childLoad)
+		weighted += cl.load * cl.capacity
+		capacity += cl.capacity
+	}
+	if capacity == 0 {
+		return 1.0
+	}
+	return weighted / capacity
+}
+
+// clustersWithQueue returns the clusters which offer the queue.
+func (i *Inception) clustersWithQueue(clusters []ClusterConfig, queue string) []ClusterConfig {
+	results, _ := i.collect("queues", requestQueues)
+	offering := make([]ClusterConfig, 0, len(clusters))
+	for _, c := range clusters {
+		for _, r := range results {
+			if r.cluster != c.Name {
+				continue
+			}
+			for _, q := range r.value.([]types.Queue) {
+				if q.Name == queue {
+					offering = append(offering, c)
+					break
+				}
+			}
+		}
+	}
+	return offering
+}
+
+// selectCluster selects the child cluster a job is submitted to. A
+// queue name or job category in the form name@cluster (or @cluster)
+// selects the cluster explicitly and the name is reduced accordingly.
+// Otherwise the scheduler chooses out of the clusters offering the
+// requested queue. Without scheduler the "default" cluster is taken
+// if it is one of them.
+func (i *Inception) selectCluster(jt *types.JobTemplate) (ClusterConfig, error) {
+	candidates := i.childClusters()
+	if category, clustername := splitJobID(jt.JobCategory); clustername != "" {
+		for _, c := range candidates {
+			if c.Name == clustername {
+				jt.JobCategory = category
+				if queue, qcluster := splitJobID(jt.QueueName); qcluster == clustername {
+					jt.QueueName = queue
+				}
+				return c, nil
+			}
+		}
+	}
+	if queue, clustername := splitJobID(jt.QueueName); clustername != "" {
+		for _, c := range candidates {
+			if c.Name == clustername {
+				jt.QueueName = queue
+				return c, nil
+			}
+		}
+		// like a queue instance (all.q@host) in Grid Engine
+		log.Println("No cluster found for queue ", jt.QueueName)
+	}
+	if jt.QueueName != "" {
+		candidates = i.clustersWithQueue(candidates, jt.QueueName)
+	}
+	if len(candidates) == 0 {
+		return ClusterConfig{}, proxy.Errorf(types.ErrorCodeInvalidRequest,
+			"no cluster found which offers the queue %q", jt.QueueName)
+	}
+	selected := "default"
+	if st, exists := SchedulerTypes[i.alg]; exists {
+		scheduler := MakeNewScheduler(st, Config{Cluster: candidates}, hopClients{i.request}).Impl
+		if matcher, ok := scheduler.(JobMatcher); ok {
+			var err error
+			if selected, err = matcher.SelectClusterFor(*jt); err != nil {
+				return ClusterConfig{}, proxy.Errorf(types.ErrorCodeInvalidRequest, "%s", err)
+			}
+		} else {
+			selected = scheduler.SelectCluster()
+		}
+	}
+	for _, c := range candidates {
+		if c.Name == selected {
+			return c, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// hopClients creates the clients for the schedulers of the inception
+// proxy so that their requests carry the hops of the forwarded request.
+type hopClients struct {
+	request *Request
+}
+
+func (h hopClients) ProxyClient(cc ClusterConfig) (*client.Client, error) {
+	return h.request.proxyClient(fmt.Sprintf("%s%s", cc.Address, cc.ProtocolVersion))
 }
 
+// RunJob submits the job in a child cluster (see selectCluster) and
+// returns the job id in the form jobid@cluster.
 func (i *Inception) RunJob(template types.JobTemplate) (string, error) {
-	return "", nil
+	// the child cluster sets the working directory to its staging area
+	template.WorkingDirectory = ""
+	c, err := i.selectCluster(&template)
+	if err != nil {
+		return "", err
+	}
+	route := JobRoute{
+		Cluster:         c.Name,
+		Address:         c.Address,
+		ProtocolVersion: c.ProtocolVersion,
+	}
+	pc, err := i.request.proxyClient(route.ClusterAddress())
+	if err != nil {
+		return "", childError(c.Name, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.RequestTimeout(i.timeout))
+	defer cancel()
+	id, err := pc.RunJob(ctx, proxy.DefaultJobSession, template)
+	if err != nil {
+		return "", childError(c.Name, err)
+	}
+	route.JobId = id
+	route.SubmittedAt = time.Now()
+	jobid := fmt.Sprintf("%s@%s", id, c.Name)
+	if i.routes != nil {
+		if err := i.routes.Add(jobid, route); err != nil {
+			log.Printf("Error during storing route of job %s: %s\n", jobid, err)
+		}
+	}
+	log.Printf("Submitted job %s in cluster %s\n", id, c.Name)
+	return jobid, nil
 }
 
+// JobOperation forwards the job operation to the cluster referenced by
+// the job id (jobid@cluster).
 func (i *Inception) JobOperation(jobsessionname, operation, jobid string) (string, error) {
-	return "", nil
+	route, err := i.route(jobid)
+	if err != nil {
+		return "", err
+	}
+	pc, err := i.request.proxyClient(route.ClusterAddress())
+	if err != nil {
+		return "", childError(route.Cluster, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), i.requestTimeout(route.Cluster))
+	defer cancel()
+	out, err := pc.JobOperation(ctx, proxy.DefaultJobSession, operation, route.JobId)
+	if err != nil {
+		return "", childError(route.Cluster, err)
+	}
+	return out, nil
 }
 
 // start uc as proxy
-func inceptionMode(certFile, keyFile, otp, address string) {
-	incept := NewInception(certFile, keyFile, otp, config)
+func inceptionMode(tc client.TLSConfig, otp, address, alg, routesFile, proxyID string, maxDepth int, timeout, cacheTTL time.Duration, metricsAuth string) {
+	if _, exists := SchedulerTypes[alg]; alg != "" && !exists {
+		fmt.Println("Unkown scheduler selection algorithm: ", alg)
+		os.Exit(2)
+	}
+	routes, err := NewRoutingTable(routesFile)
+	if err != nil {
+		fmt.Printf("Error opening routing table %s: %s\n", routesFile, err)
+		os.Exit(1)
+	}
+	defer routes.Close()
+	incept := NewInception("", "", otp, config, alg, routes)
+	if err := incept.SetTLS(tc); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	incept.inceptionAddress = address
+	if proxyID == "" {
+		proxyID = defaultProxyID(address)
+	}
+	if err := incept.SetLoopDetection(proxyID, maxDepth); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if err := incept.SetAggregation(timeout, cacheTTL); err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if err := incept.CheckClusterAuth(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	fmt.Println("Starting uc in inception mode as proxy listening at address: ", address)
+	// reachability and latency of the child clusters
+	proxy.RegisterGauges(incept, incept.ChildGauges)
+
 	var sc proxy.SecConfig
 	sc.OTP = otp
+	sc.MetricsAuth = metricsAuth
 	var pi persistency.DummyPersistency
 	// yubikey not supported since it would require interactivity
 	proxy.ProxyListenAndServe(address, "", "", sc, &pi, incept)
@@ -0,0 +1,75 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/proxy"
+)
+
+// ChildGauges returns whether the child clusters are reachable and
+// how long they took to answer, which is exposed in the metrics of
+// the inception proxy. Each child cluster is asked for its DRMS name
+// with the deadline of the cluster. The latency of unreachable
+// clusters is the time until the request failed.
+func (i *Inception) ChildGauges() []proxy.GaugeValue {
+	clusters := i.childClusters()
+	up := make([]float64, len(clusters))
+	latency := make([]float64, len(clusters))
+	var wg sync.WaitGroup
+	wg.Add(len(clusters))
+	for n, c := range clusters {
+		go func(n int, c ClusterConfig) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.RequestTimeout(i.timeout))
+			defer cancel()
+			start := time.Now()
+			pc, err := i.request.proxyClient(fmt.Sprintf("%s%s", c.Address, c.ProtocolVersion))
+			if err == nil {
+				_, err = pc.DRMSName(ctx)
+			}
+			latency[n] = time.Since(start).Seconds()
+			if err == nil {
+				up[n] = 1
+			}
+		}(n, c)
+	}
+	wg.Wait()
+
+	gauges := make([]proxy.GaugeValue, 0, 2*len(clusters))
+	for n, c := range clusters {
+		gauges = append(gauges, proxy.GaugeValue{
+			Name:   "uc_inception_child_up",
+			Help:   "1 if the child cluster answered, 0 otherwise.",
+			Labels: map[string]string{"cluster": c.Name},
+			Value:  up[n],
+		})
+	}
+	for n, c := range clusters {
+		gauges = append(gauges, proxy.GaugeValue{
+			Name:   "uc_inception_child_latency_seconds",
+			Help:   "Time the child cluster took to answer.",
+			Labels: map[string]string{"cluster": c.Name},
+			Value:  latency[n],
+		})
+	}
+	return gauges
+}
@@ -0,0 +1,335 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// childProxy is a ProxyImplementer of a child cluster of the inception
+// proxy which offers one queue.
+type childProxy struct {
+	sync.Mutex
+	queue      string
+	queueCalls int
+	lastID     int
+	jobs       map[string]types.JobTemplate
+	operations []string
+}
+
+func newChildProxy(queue string) *childProxy {
+	return &childProxy{queue: queue, jobs: make(map[string]types.JobTemplate)}
+}
+
+func (cp *childProxy) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
+	cp.Lock()
+	defer cp.Unlock()
+	jis := make([]types.JobInfo, 0, len(cp.jobs))
+	for id := range cp.jobs {
+		jis = append(jis, types.JobInfo{Id: id, State: types.Running})
+	}
+	return jis
+}
+
+func (cp *childProxy) GetJobInfo(jobid string) *types.JobInfo {
+	cp.Lock()
+	defer cp.Unlock()
+	if jt, exists := cp.jobs[jobid]; exists {
+		return &types.JobInfo{Id: jobid, State: types.Running, QueueName: jt.QueueName}
+	}
+	return nil
+}
+
+func (cp *childProxy) GetAllMachines(machines []string) ([]types.Machine, error) { return nil, nil }
+func (cp *childProxy) GetAllQueues(queues []string) ([]types.Queue, error) {
+	cp.Lock()
+	defer cp.Unlock()
+	cp.queueCalls++
+	return []types.Queue{{Name: cp.queue}}, nil
+}
+func (cp *childProxy) GetAllCategories() ([]string, error)               { return nil, nil }
+func (cp *childProxy) GetAllSessions(session []string) ([]string, error) { return nil, nil }
+func (cp *childProxy) DRMSVersion() string                               { return "" }
+func (cp *childProxy) DRMSName() string                                  { return "child" }
+func (cp *childProxy) DRMSLoad() float64                                 { return 0.0 }
+
+func (cp *childProxy) RunJob(template types.JobTemplate) (string, error) {
+	cp.Lock()
+	defer cp.Unlock()
+	cp.lastID++
+	jobid := fmt.Sprintf("%d", cp.lastID)
+	cp.jobs[jobid] = template
+	return jobid, nil
+}
+
+func (cp *childProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	cp.Lock()
+	defer cp.Unlock()
+	if _, exists := cp.jobs[jobid]; !exists {
+		return "", proxy.ErrJobNotFound
+	}
+	cp.operations = append(cp.operations, operation+" "+jobid)
+	return "done", nil
+}
+
+var _ = Describe("Inception", func() {
+
+	var (
+		tmpdir        string
+		routes        *RoutingTable
+		small, big    *childProxy
+		smallS, bigS  *httptest.Server
+		clusterConfig Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "inception")
+		Ω(err).Should(BeNil())
+		routes, err = NewRoutingTable(filepath.Join(tmpdir, "routes.db"))
+		Ω(err).Should(BeNil())
+
+		small, big = newChildProxy("all.q"), newChildProxy("big.q")
+		smallS = httptest.NewServer(proxy.NewProxyRouter(small, proxy.SecConfig{}, nil))
+		bigS = httptest.NewServer(proxy.NewProxyRouter(big, proxy.SecConfig{}, nil))
+		clusterConfig = Config{Cluster: []ClusterConfig{
+			{Name: "default", Address: smallS.URL + "/", ProtocolVersion: "v1"},
+			{Name: "big", Address: bigS.URL + "/", ProtocolVersion: "v1"},
+		}}
+	})
+
+	AfterEach(func() {
+		smallS.Close()
+		bigS.Close()
+		routes.Close()
+		os.RemoveAll(tmpdir)
+		os.RemoveAll("uploads")
+	})
+
+	It("must store and look up job routes", func() {
+		_, err := routes.Lookup("1@big")
+		Ω(err).Should(Equal(ErrRouteNotFound))
+		Ω(routes.Add("1@big", JobRoute{JobId: "1", Cluster: "big", Address: "http://big/", ProtocolVersion: "v1"})).Should(BeNil())
+		route, err := routes.Lookup("1@big")
+		Ω(err).Should(BeNil())
+		Ω(route.JobId).Should(Equal("1"))
+		Ω(route.ClusterAddress()).Should(Equal("http://big/v1"))
+	})
+
+	It("must forward jobs to the default cluster or the selected one", func() {
+		incept := NewInception("", "", "", clusterConfig, "", routes)
+
+		jobid, err := incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+		Ω(jobid).Should(Equal("1@default"))
+		Ω(small.jobs).Should(HaveLen(1))
+
+		jobid, err = incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "@big"})
+		Ω(err).Should(BeNil())
+		Ω(jobid).Should(Equal("1@big"))
+		Ω(big.jobs["1"].QueueName).Should(Equal(""))
+
+		jobid, err = incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "big.q"})
+		Ω(err).Should(BeNil())
+		Ω(jobid).Should(Equal("2@big"))
+
+		_, err = incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "unknown.q"})
+		Ω(err).ShouldNot(BeNil())
+
+		route, err := routes.Lookup("2@big")
+		Ω(err).Should(BeNil())
+		Ω(route.Cluster).Should(Equal("big"))
+		Ω(route.JobId).Should(Equal("2"))
+	})
+
+	It("must route job infos and operations to the cluster of the job", func() {
+		incept := NewInception("", "", "", clusterConfig, "", routes)
+		jobid, err := incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "big.q"})
+		Ω(err).Should(BeNil())
+
+		ji := incept.GetJobInfo(jobid)
+		Ω(ji).ShouldNot(BeNil())
+		Ω(ji.Id).Should(Equal(jobid))
+		Ω(ji.QueueName).Should(Equal("big.q"))
+
+		_, err = incept.JobOperation(proxy.DefaultJobSession, "suspend", jobid)
+		Ω(err).Should(BeNil())
+		Ω(big.operations).Should(Equal([]string{"suspend 1"}))
+
+		_, err = incept.JobOperation(proxy.DefaultJobSession, "suspend", "7@big")
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*proxy.Error).Code).Should(Equal(types.ErrorCodeNotFound))
+		_, err = incept.JobOperation(proxy.DefaultJobSession, "suspend", "1@unknown")
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("must not wait longer than the timeout of the cluster for submissions and operations", func() {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Second)
+		}))
+		defer slow.Close()
+		clusterConfig.Cluster = append(clusterConfig.Cluster,
+			ClusterConfig{Name: "slow", Address: slow.URL + "/", ProtocolVersion: "v1", Timeout: "100ms"})
+		incept := NewInception("", "", "", clusterConfig, "", nil)
+
+		start := time.Now()
+		_, err := incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "@slow"})
+		Ω(err).ShouldNot(BeNil())
+		_, err = incept.JobOperation(proxy.DefaultJobSession, "suspend", "1@slow")
+		Ω(err).ShouldNot(BeNil())
+		Ω(time.Since(start)).Should(BeNumerically("<", time.Second))
+	})
+
+	It("must reject requests which already visited the proxy", func() {
+		incept := NewInception("", "", "", clusterConfig, "", routes)
+		Ω(incept.SetLoopDetection("a", 3)).Should(BeNil())
+
+		_, err := incept.ForRequest(types.Hops{RequestID: "1", Visited: []string{"b"}})
+		Ω(err).Should(BeNil())
+
+		_, err = incept.ForRequest(types.Hops{RequestID: "1", Visited: []string{"x", "a", "b"}})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*proxy.Error).Code).Should(Equal(types.ErrorCodeLoopDetected))
+		Ω(err.Error()).Should(ContainSubstring("a -> b -> a"))
+
+		_, err = incept.ForRequest(types.Hops{RequestID: "1", Visited: []string{"b", "c", "d"}})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("maximum depth of 3"))
+
+		Ω(incept.SetLoopDetection("a,b", 3)).ShouldNot(BeNil())
+		Ω(incept.SetLoopDetection("a", 0)).ShouldNot(BeNil())
+	})
+
+	It("must stop requests between inception proxies listing each other", func() {
+		aS, bS := httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)
+		a := NewInception("", "", "", Config{Cluster: []ClusterConfig{
+			{Name: "b", Address: "http://" + bS.Listener.Addr().String() + "/", ProtocolVersion: "v1"},
+		}}, "", nil)
+		Ω(a.SetLoopDetection("a", DefaultMaxDepth)).Should(BeNil())
+		b := NewInception("", "", "", Config{Cluster: []ClusterConfig{
+			{Name: "a", Address: "http://" + aS.Listener.Addr().String() + "/", ProtocolVersion: "v1"},
+		}}, "", nil)
+		Ω(b.SetLoopDetection("b", DefaultMaxDepth)).Should(BeNil())
+		aS.Config.Handler = proxy.NewProxyRouter(a, proxy.SecConfig{}, nil)
+		bS.Config.Handler = proxy.NewProxyRouter(b, proxy.SecConfig{}, nil)
+		aS.Start()
+		defer aS.Close()
+		bS.Start()
+		defer bS.Close()
+
+		done := make(chan error)
+		go func() {
+			_, err := a.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", QueueName: "@b"})
+			done <- err
+		}()
+		var err error
+		Eventually(done, 5).Should(Receive(&err))
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*proxy.Error).Code).Should(Equal(types.ErrorCodeLoopDetected))
+	})
+
+	It("must send the hops of the request with the load requests of the scheduler", func() {
+		var visited []string
+		var mutex sync.Mutex
+		router := proxy.NewProxyRouter(newChildProxy("all.q"), proxy.SecConfig{}, nil)
+		childS := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/msession/drmsload" {
+				mutex.Lock()
+				visited = append(visited, r.Header.Get(types.VisitedHeader))
+				mutex.Unlock()
+			}
+			router.ServeHTTP(w, r)
+		}))
+		defer childS.Close()
+
+		incept := NewInception("", "", "", Config{Cluster: []ClusterConfig{
+			{Name: "child", Address: childS.URL + "/", ProtocolVersion: "v1"},
+		}}, "load", nil)
+		Ω(incept.SetLoopDetection("a", DefaultMaxDepth)).Should(BeNil())
+		forwarding, err := incept.ForRequest(types.Hops{RequestID: "1", Visited: []string{"root"}})
+		Ω(err).Should(BeNil())
+		_, err = forwarding.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+		mutex.Lock()
+		defer mutex.Unlock()
+		Ω(visited).Should(Equal([]string{"root,a"}))
+	})
+
+	It("must collect, tag, and filter the queues of all clusters", func() {
+		clusterConfig.Cluster = append(clusterConfig.Cluster,
+			ClusterConfig{Name: "big2", Address: bigS.URL + "/", ProtocolVersion: "v1"})
+		incept := NewInception("", "", "", clusterConfig, "", nil)
+
+		queues, err := incept.GetAllQueues(nil)
+		Ω(err).Should(BeNil())
+		Ω(queues).Should(Equal([]types.Queue{{Name: "all.q@default"}, {Name: "big.q@big"}}))
+
+		queues, err = incept.GetAllQueues([]string{"big.q"})
+		Ω(err).Should(BeNil())
+		Ω(queues).Should(Equal([]types.Queue{{Name: "big.q@big"}}))
+		queues, err = incept.GetAllQueues([]string{"big.q@default"})
+		Ω(err).Should(BeNil())
+		Ω(queues).Should(BeEmpty())
+
+		// the queues are cached
+		Ω(big.queueCalls).Should(Equal(1))
+		Ω(incept.SetAggregation(time.Second, 0)).Should(BeNil())
+		_, err = incept.GetAllQueues(nil)
+		Ω(err).Should(BeNil())
+		Ω(big.queueCalls).Should(Equal(2))
+	})
+
+	It("must return partial results when clusters are not reachable", func() {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Second)
+		}))
+		defer slow.Close()
+		bigS.Close()
+		clusterConfig.Cluster = append(clusterConfig.Cluster,
+			ClusterConfig{Name: "slow", Address: slow.URL + "/", ProtocolVersion: "v1"})
+		incept := NewInception("", "", "", clusterConfig, "", nil)
+		Ω(incept.SetAggregation(100*time.Millisecond, time.Minute)).Should(BeNil())
+
+		queues, err := incept.GetAllQueues(nil)
+		Ω(queues).Should(Equal([]types.Queue{{Name: "all.q@default"}}))
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*proxy.PartialResultError).Unreachable).Should(Equal([]string{"big", "slow"}))
+
+		server := httptest.NewServer(proxy.NewProxyRouter(incept, proxy.SecConfig{}, nil))
+		defer server.Close()
+		queues, err = client.New(server.URL+"/v1", nil).GetQueues(context.Background(), "all")
+		Ω(queues).Should(Equal([]types.Queue{{Name: "all.q@default"}}))
+		Ω(client.IsPartialResult(err)).Should(BeTrue())
+		Ω(err.(*client.PartialResultError).Unreachable).Should(Equal([]string{"big", "slow"}))
+	})
+
+	It("must expose the reachability of the child clusters as gauges", func() {
+		bigS.Close()
+		incept := NewInception("", "", "", clusterConfig, "", nil)
+		gauges := incept.ChildGauges()
+		up := make(map[string]float64)
+		for _, g := range gauges {
+			if g.Name == "uc_inception_child_up" {
+				up[g.Labels["cluster"]] = g.Value
+			}
+		}
+		Ω(up).Should(Equal(map[string]float64{"default": 1, "big": 0}))
+		Ω(gauges).Should(HaveLen(4))
+	})
+
+})
@@ -0,0 +1,246 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// matchTimeout is the deadline for requesting the capabilities of
+// one cluster.
+var matchTimeout = 10 * time.Second
+
+// JobMatcher is implemented by schedulers which select the cluster
+// based on the requirements of the job.
+type JobMatcher interface {
+	SelectClusterFor(jt types.JobTemplate) (string, error)
+}
+
+// Rejection is the reason why a cluster can't run a job.
+type Rejection struct {
+	Cluster string
+	Reason  string
+}
+
+// NoMatchError is returned when no cluster is able to run a job. It
+// contains the reason for each cluster.
+type NoMatchError struct {
+	Rejections []Rejection
+}
+
+func (e *NoMatchError) Error() string {
+	reasons := make([]string, 0, len(e.Rejections))
+	for _, r := range e.Rejections {
+		reasons = append(reasons, fmt.Sprintf("  %s: %s", r.Cluster, r.Reason))
+	}
+	return fmt.Sprintf("no cluster is able to run the job:\n%s", strings.Join(reasons, "\n"))
+}
+
+// MatchSched selects the cluster with the lowest load out of the
+// clusters which offer the job category and the queue of the job and
+// which have a machine fulfilling the machine requirements of the job
+// (MinPhysMemory, MachineArch, MachineOs, and CandidateMachines).
+type MatchSched struct {
+	conf    Config
+	clients ProxyClients
+}
+
+// SelectCluster selects the cluster with the lowest load which is
+// reachable. If no cluster is reachable "default" is returned.
+func (ms *MatchSched) SelectCluster() string {
+	cluster, err := ms.SelectClusterFor(types.JobTemplate{})
+	if err != nil {
+		log.Println(err)
+		return "default"
+	}
+	return cluster
+}
+
+// SelectClusterFor returns the name of the least loaded cluster which
+// is able to run the job. When no cluster matches a *NoMatchError
+// explains why each cluster was rejected.
+func (ms *MatchSched) SelectClusterFor(jt types.JobTemplate) (string, error) {
+	reasons := make([]string, len(ms.conf.Cluster))
+	var wg sync.WaitGroup
+	wg.Add(len(ms.conf.Cluster))
+	for i, c := range ms.conf.Cluster {
+		go func(i int, c ClusterConfig) {
+			defer wg.Done()
+			pc, err := ms.clients.ProxyClient(c)
+			if err != nil {
+				reasons[i] = err.Error()
+				return
+			}
+			reasons[i] = rejectionReason(pc, jt)
+		}(i, c)
+	}
+	wg.Wait()
+
+	matching := Config{Cluster: make([]ClusterConfig, 0, len(ms.conf.Cluster))}
+	rejections := make([]Rejection, 0)
+	for i, c := range ms.conf.Cluster {
+		if reasons[i] != "" {
+			log.Printf("Cluster %s rejected: %s\n", c.Name, reasons[i])
+			rejections = append(rejections, Rejection{Cluster: c.Name, Reason: reasons[i]})
+			continue
+		}
+		matching.Cluster = append(matching.Cluster, c)
+	}
+	if len(matching.Cluster) == 0 {
+		return "", &NoMatchError{Rejections: rejections}
+	}
+	selected := matching.Cluster[minLoad(getAllLoadValues(matching, ms.clients))].Name
+	log.Printf("Selected cluster %s out of %d matching clusters.\n", selected, len(matching.Cluster))
+	return selected, nil
+}
+
+// rejectionReason requests the job categories, queues, and machines of
+// the cluster which are required by the job. It returns why the cluster
+// can not run the job or an empty string when the job matches.
+func rejectionReason(pc *client.Client, jt types.JobTemplate) string {
+	ctx, cancel := context.WithTimeout(context.Background(), matchTimeout)
+	defer cancel()
+
+	if jt.JobCategory != "" {
+		categories, err := pc.GetJobCategories(ctx, proxy.DefaultJobSession)
+		if err != nil && !client.IsPartialResult(err) {
+			return fmt.Sprintf("can not get job categories: %s", err)
+		}
+		if !containsString(categories, jt.JobCategory) {
+			return fmt.Sprintf("job category %q is not offered", jt.JobCategory)
+		}
+	}
+	if jt.QueueName != "" {
+		queues, err := pc.GetQueues(ctx, "")
+		if err != nil && !client.IsPartialResult(err) {
+			return fmt.Sprintf("can not get queues: %s", err)
+		}
+		names := make([]string, 0, len(queues))
+		for _, q := range queues {
+			names = append(names, q.Name)
+		}
+		if !containsString(names, jt.QueueName) {
+			return fmt.Sprintf("queue %q does not exist", jt.QueueName)
+		}
+	}
+	if !hasMachineRequirements(jt) {
+		if _, err := pc.DRMSLoad(ctx); err != nil {
+			return fmt.Sprintf("not reachable: %s", err)
+		}
+		return ""
+	}
+	machines, err := pc.GetMachines(ctx, "")
+	if err != nil && !client.IsPartialResult(err) {
+		return fmt.Sprintf("can not get machines: %s", err)
+	}
+	if len(machines) == 0 {
+		return "no machines"
+	}
+	// report the first machine of each requirement which is not
+	// fulfilled together with the amount of the other machines
+	requirements := make([]string, 0)
+	first := make(map[string]string)
+	count := make(map[string]int)
+	for _, m := range machines {
+		requirement, reason := machineMismatch(m, jt)
+		if requirement == "" {
+			return ""
+		}
+		if count[requirement] == 0 {
+			requirements = append(requirements, requirement)
+			first[requirement] = fmt.Sprintf("%s has %s", m.Name, reason)
+		}
+		count[requirement]++
+	}
+	reasons := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		switch more := count[requirement] - 1; more {
+		case 0:
+			reasons = append(reasons, first[requirement])
+		case 1:
+			reasons = append(reasons, first[requirement]+" and 1 more machine")
+		default:
+			reasons = append(reasons, fmt.Sprintf("%s and %d more machines", first[requirement], more))
+		}
+	}
+	return fmt.Sprintf("no matching machine (%s)", strings.Join(reasons, "; "))
+}
+
+// hasMachineRequirements returns true if the job template restricts
+// the machines the job can run on.
+func hasMachineRequirements(jt types.JobTemplate) bool {
+	return jt.MinPhysMemory > 0 || jt.MachineArch != "" || jt.MachineOs != "" || len(jt.CandidateMachines) > 0
+}
+
+// machineMismatch returns the requirement of the job template the
+// machine does not fulfill and why, or empty strings when the job can
+// run on the machine. Memory is compared in KiB (the DRMAA2 unit of the
+// job template and the machines).
+func machineMismatch(m types.Machine, jt types.JobTemplate) (string, string) {
+	if len(jt.CandidateMachines) > 0 && !isCandidate(jt.CandidateMachines, m.Name) {
+		return "candidateMachines", "a name which is not in the candidate machines"
+	}
+	if m.PhysicalMemory < jt.MinPhysMemory {
+		return "minPhysMemory", fmt.Sprintf("physical memory %d < %d", m.PhysicalMemory, jt.MinPhysMemory)
+	}
+	if jt.MachineArch != "" && !strings.EqualFold(m.Architecture.String(), jt.MachineArch) {
+		return "machineArch", fmt.Sprintf("architecture %s", m.Architecture)
+	}
+	if jt.MachineOs != "" && !strings.EqualFold(m.OS.String(), jt.MachineOs) {
+		return "machineOs", fmt.Sprintf("OS %s", m.OS)
+	}
+	return "", ""
+}
+
+// isCandidate returns true if the machine is one of the candidate
+// machines. Child clusters which are inception proxies tag the names
+// of their machines with the cluster (name@cluster), so the untagged
+// name is compared as well.
+func isCandidate(candidates []string, name string) bool {
+	if at := strings.Index(name, "@"); at >= 0 && containsString(candidates, name[:at]) {
+		return true
+	}
+	return containsString(candidates, name)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchClusterAddress selects the cluster for the job with the
+// matching scheduler and returns its address and name.
+func (r *Request) MatchClusterAddress(jt types.JobTemplate) (string, string, error) {
+	name, err := (&MatchSched{conf: config, clients: r.auth}).SelectClusterFor(jt)
+	if err != nil {
+		return "", "", err
+	}
+	return GetClusterAddress(name)
+}
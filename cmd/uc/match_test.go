@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// capableProxy is a childProxy which offers job categories and
+// machines and which has a fixed load.
+type capableProxy struct {
+	*childProxy
+	categories []string
+	machines   []types.Machine
+	load       float64
+}
+
+func (cp *capableProxy) GetAllCategories() ([]string, error) { return cp.categories, nil }
+func (cp *capableProxy) GetAllMachines(machines []string) ([]types.Machine, error) {
+	return cp.machines, nil
+}
+func (cp *capableProxy) DRMSLoad() float64 { return cp.load }
+
+var _ = Describe("Match", func() {
+
+	var (
+		small, big    *capableProxy
+		smallS, bigS  *httptest.Server
+		clusterConfig Config
+		matcher       JobMatcher
+	)
+
+	BeforeEach(func() {
+		small = &capableProxy{childProxy: newChildProxy("all.q"), load: 0.1,
+			categories: []string{"shell"},
+			machines:   []types.Machine{{Name: "s1", Available: true, PhysicalMemory: 1024, Architecture: types.X64, OS: types.Linux}}}
+		big = &capableProxy{childProxy: newChildProxy("big.q"), load: 0.7,
+			categories: []string{"shell", "gpu"},
+			machines: []types.Machine{
+				{Name: "b1", Available: true, PhysicalMemory: 1024, Architecture: types.X64, OS: types.Linux},
+				{Name: "b2", Available: true, PhysicalMemory: 65536, Architecture: types.ARM64, OS: types.Linux}}}
+		smallS = httptest.NewServer(proxy.NewProxyRouter(small, proxy.SecConfig{}, nil))
+		bigS = httptest.NewServer(proxy.NewProxyRouter(big, proxy.SecConfig{}, nil))
+		clusterConfig = Config{Cluster: []ClusterConfig{
+			{Name: "small", Address: smallS.URL + "/", ProtocolVersion: "v1"},
+			{Name: "big", Address: bigS.URL + "/", ProtocolVersion: "v1"},
+		}}
+		var ok bool
+		matcher, ok = MakeNewScheduler(SchedulerTypes["match"], clusterConfig, NewClusterAuth(http.DefaultClient, nil)).Impl.(JobMatcher)
+		Ω(ok).Should(BeTrue())
+	})
+
+	AfterEach(func() {
+		smallS.Close()
+		bigS.Close()
+		os.RemoveAll("uploads")
+	})
+
+	It("should select the cluster with the lowest load when the job has no requirements", func() {
+		Ω(matcher.SelectClusterFor(types.JobTemplate{RemoteCommand: "/bin/sleep"})).Should(Equal("small"))
+	})
+
+	It("should select the cluster with the lowest load with the load scheduler", func() {
+		small.load = 0.9
+		Ω(MakeNewScheduler(SchedulerTypes["load"], clusterConfig, NewClusterAuth(http.DefaultClient, nil)).Impl.SelectCluster()).Should(Equal("big"))
+		smallS.Close()
+		small.load = 0.0
+		Ω(MakeNewScheduler(SchedulerTypes["load"], clusterConfig, NewClusterAuth(http.DefaultClient, nil)).Impl.SelectCluster()).Should(Equal("big"))
+	})
+
+	It("should weight the load of the child clusters by their capacity in the inception proxy", func() {
+		incept := NewInception("", "", "", clusterConfig, "", nil)
+		// small has 1 slot with load 0.1, big has 2 slots with load 0.7
+		Ω(incept.DRMSLoad()).Should(BeNumerically("~", 0.5))
+	})
+
+	It("should select the cluster offering the job category and the queue", func() {
+		Ω(matcher.SelectClusterFor(types.JobTemplate{JobCategory: "gpu"})).Should(Equal("big"))
+		Ω(matcher.SelectClusterFor(types.JobTemplate{QueueName: "big.q"})).Should(Equal("big"))
+	})
+
+	It("should select the cluster with a machine fulfilling the requirements", func() {
+		Ω(matcher.SelectClusterFor(types.JobTemplate{MinPhysMemory: 4096})).Should(Equal("big"))
+		Ω(matcher.SelectClusterFor(types.JobTemplate{MachineArch: "arm64"})).Should(Equal("big"))
+		Ω(matcher.SelectClusterFor(types.JobTemplate{MachineOs: "Linux"})).Should(Equal("small"))
+		Ω(matcher.SelectClusterFor(types.JobTemplate{CandidateMachines: []string{"b1"}})).Should(Equal("big"))
+	})
+
+	It("should match candidate machines of child inception proxies without their cluster tag", func() {
+		big.machines = []types.Machine{{Name: "b1@leaf", Available: true, PhysicalMemory: 1024}}
+		Ω(matcher.SelectClusterFor(types.JobTemplate{CandidateMachines: []string{"b1"}})).Should(Equal("big"))
+		Ω(matcher.SelectClusterFor(types.JobTemplate{CandidateMachines: []string{"b1@leaf"}})).Should(Equal("big"))
+	})
+
+	It("should compare the memory of the machines in KiB", func() {
+		// a laptop with 16 GB like reported by the dockerproxy
+		small.machines = []types.Machine{{Name: "laptop", Available: true, PhysicalMemory: 16 * 1024 * 1024}}
+		big.machines = []types.Machine{{Name: "server", Available: true, PhysicalMemory: 128 * 1024 * 1024}}
+		Ω(matcher.SelectClusterFor(types.JobTemplate{MinPhysMemory: 64 * 1024 * 1024})).Should(Equal("big"))
+		big.machines = nil
+		_, err := matcher.SelectClusterFor(types.JobTemplate{MinPhysMemory: 64 * 1024 * 1024})
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("should report the first machine of each requirement which is not fulfilled", func() {
+		big.machines = append(big.machines,
+			types.Machine{Name: "b3", Available: true, PhysicalMemory: 2048, Architecture: types.X64, OS: types.Linux},
+			types.Machine{Name: "b4", Available: true, PhysicalMemory: 512, Architecture: types.X64, OS: types.Linux})
+		_, err := matcher.SelectClusterFor(types.JobTemplate{JobCategory: "gpu", MinPhysMemory: 4096, MachineArch: types.X64.String()})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*NoMatchError).Rejections[1].Reason).Should(Equal(
+			"no matching machine (b1 has physical memory 1024 < 4096 and 2 more machines; b2 has architecture " +
+				types.ARM64.String() + ")"))
+	})
+
+	It("should explain why no cluster matches", func() {
+		_, err := matcher.SelectClusterFor(types.JobTemplate{JobCategory: "gpu", MinPhysMemory: 131072})
+		Ω(err).ShouldNot(BeNil())
+		noMatch, ok := err.(*NoMatchError)
+		Ω(ok).Should(BeTrue())
+		Ω(noMatch.Rejections).Should(Equal([]Rejection{
+			{Cluster: "small", Reason: `job category "gpu" is not offered`},
+			{Cluster: "big", Reason: "no matching machine (b1 has physical memory 1024 < 131072 and 1 more machine)"},
+		}))
+	})
+
+	It("should reject jobs in the inception proxy when no cluster matches", func() {
+		incept := NewInception("", "", "", clusterConfig, "match", nil)
+		_, err := incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", JobCategory: "gpu"})
+		Ω(err).Should(BeNil())
+		Ω(big.jobs).Should(HaveLen(1))
+
+		_, err = incept.RunJob(types.JobTemplate{RemoteCommand: "/bin/sleep", MinPhysMemory: 131072})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("physical memory 1024 < 131072 and 1 more machine"))
+	})
+
+})
@@ -0,0 +1,216 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// migratable returns true if the job is in a state in which it can be
+// moved to another cluster, i.e. it was not started yet.
+func migratable(state types.JobState) bool {
+	switch state {
+	case types.Queued, types.QueuedHeld, types.Requeued, types.RequeuedHeld:
+		return true
+	}
+	return false
+}
+
+// stagedInputFiles returns the files of the staging area which are
+// used by the job template (as command, argument, input file, or
+// file to stage in).
+func stagedInputFiles(jt types.JobTemplate, files []types.FileInfo) []types.FileInfo {
+	used := map[string]bool{
+		filepath.Base(jt.RemoteCommand): true,
+		filepath.Base(jt.InputPath):     true,
+	}
+	for _, arg := range jt.Args {
+		used[filepath.Base(arg)] = true
+	}
+	for source := range jt.StageInFiles {
+		used[filepath.Base(source)] = true
+	}
+	staged := make([]types.FileInfo, 0, len(files))
+	for _, file := range files {
+		if used[file.Filename] {
+			staged = append(staged, file)
+		}
+	}
+	return staged
+}
+
+// copyStagedFiles copies files from the staging area of the job
+// session in the source cluster to the staging area of the job
+// session in the target cluster.
+func copyStagedFiles(ctx context.Context, src, dst *client.Client, jsession string, files []types.FileInfo) error {
+	if len(files) == 0 {
+		return nil
+	}
+	dir, err := ioutil.TempDir("", "ucmigrate")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range files {
+		path := filepath.Join(dir, file.Filename)
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		_, err = src.DownloadFile(ctx, jsession, file.Filename, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("downloading staged file %s: %s", file.Filename, err)
+		}
+		if err := dst.UploadFile(ctx, jsession, path, file.Executable); err != nil {
+			return fmt.Errorf("uploading staged file %s: %s", file.Filename, err)
+		}
+		log.Printf("Copied staged file %s (%d bytes)\n", file.Filename, file.Bytes)
+	}
+	return nil
+}
+
+// MigrateJob moves a job which was not started yet from the source
+// cluster to the target cluster. The job template stored in the job
+// history of the source proxy is submitted in the target cluster
+// together with the staged input files of the job. After the new job
+// is found in the target cluster the original job is terminated when
+// it is still not started. If it can't be terminated the new job is
+// terminated instead. The migration is recorded in the job history of
+// both proxies once the original job is terminated. It returns the id
+// of the new job.
+func MigrateJob(src, dst *client.Client, srcName, dstName, jsession, jobid string) (string, error) {
+	ctx := context.Background()
+
+	ji, err := src.GetJobInfo(ctx, jobid)
+	if err != nil {
+		return "", fmt.Errorf("job %s not found in cluster %s: %s", jobid, srcName, err)
+	}
+	if !migratable(ji.State) {
+		return "", fmt.Errorf("job %s is %s (only queued or held jobs can be migrated)", jobid, ji.State)
+	}
+	jt, err := src.GetJobTemplate(ctx, jobid)
+	if err != nil {
+		return "", fmt.Errorf("job template of job %s not available: %s", jobid, err)
+	}
+
+	files, err := src.ListFiles(ctx, jsession)
+	if err != nil {
+		return "", fmt.Errorf("listing staged files in cluster %s: %s", srcName, err)
+	}
+	if err := copyStagedFiles(ctx, src, dst, jsession, stagedInputFiles(jt, files)); err != nil {
+		return "", err
+	}
+
+	// the working directory is set by the target proxy
+	jt.WorkingDirectory = ""
+	jt.SubmitAsHold = ji.State == types.QueuedHeld || ji.State == types.RequeuedHeld
+	newid, err := dst.RunJob(ctx, jsession, jt)
+	if err != nil {
+		return "", fmt.Errorf("job submission in cluster %s failed: %s", dstName, err)
+	}
+	if _, err := dst.GetJobInfo(ctx, newid); err != nil {
+		return "", fmt.Errorf("migrated job %s not found in cluster %s (original job %s is kept): %s",
+			newid, dstName, jobid, err)
+	}
+
+	// the original job could have been started in the meantime
+	ji, err = src.GetJobInfo(ctx, jobid)
+	if err == nil && !migratable(ji.State) {
+		err = fmt.Errorf("job %s is %s now", jobid, ji.State)
+	}
+	if err == nil {
+		_, err = src.JobOperation(ctx, jsession, "terminate", jobid)
+	}
+	if err != nil {
+		if _, terr := dst.JobOperation(ctx, jsession, "terminate", newid); terr != nil {
+			return "", fmt.Errorf("original job %s can not be terminated (%s) and terminating the new job %s in cluster %s failed: %s",
+				jobid, err, newid, dstName, terr)
+		}
+		return "", fmt.Errorf("original job %s is kept since it can not be terminated: %s", jobid, err)
+	}
+
+	from, to := tag(jobid, srcName), tag(newid, dstName)
+	if err := src.SaveJobMigration(ctx, jobid, types.JobMigration{MigratedTo: to}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record migration in cluster %s: %s\n", srcName, err)
+	}
+	if err := dst.SaveJobMigration(ctx, newid, types.JobMigration{MigratedFrom: from}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not record migration in cluster %s: %s\n", dstName, err)
+	}
+	return newid, nil
+}
+
+// SelectMigrationTarget returns the name of the cluster a job of the
+// source cluster is migrated to. When no target is given the cluster
+// with the lowest load (except the source cluster) is selected.
+func (r *Request) SelectMigrationTarget(source, target string) (string, error) {
+	if target != "" {
+		if target == source {
+			return "", fmt.Errorf("job is already in cluster %s", source)
+		}
+		return target, nil
+	}
+	candidates := make([]ClusterConfig, 0, len(config.Cluster))
+	for _, c := range config.Cluster {
+		if c.Name != source {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no other cluster configured to migrate the job to")
+	}
+	return MakeNewScheduler(LoadBasedSchedulerType, Config{Cluster: candidates}, r.auth).Impl.SelectCluster(), nil
+}
+
+// MigrateJobRequest migrates a job from the source cluster to the
+// target cluster and prints the new job id.
+func (r *Request) MigrateJobRequest(srcAddress, srcName, target, jsession, jobid string, of output.OutputFormater) {
+	dstName, err := r.SelectMigrationTarget(srcName, target)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	dstAddress, _, err := GetClusterAddress(dstName)
+	if err != nil {
+		os.Exit(1)
+	}
+	src, err := r.proxyClient(srcAddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	dst, err := r.proxyClient(dstAddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	newid, err := MigrateJob(src, dst, srcName, dstName, jsession, jobid)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintJobSubmission(types.RunJobResult{JobId: newid, Cluster: dstName})
+}
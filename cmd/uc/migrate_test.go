@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// queuedProxy is a childProxy whose jobs are queued until they are
+// terminated. When terminateErr is set terminating jobs fails.
+type queuedProxy struct {
+	*childProxy
+	state        types.JobState
+	terminateErr error
+}
+
+func (qp *queuedProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	if operation == "terminate" && qp.terminateErr != nil {
+		return "", qp.terminateErr
+	}
+	return qp.childProxy.JobOperation(jobsessionname, operation, jobid)
+}
+
+func (qp *queuedProxy) GetJobInfo(jobid string) *types.JobInfo {
+	ji := qp.childProxy.GetJobInfo(jobid)
+	if ji != nil {
+		ji.State = qp.state
+	}
+	return ji
+}
+
+var _ = Describe("Migrate", func() {
+
+	var (
+		tmpdir       string
+		history      *persistency.BoltPersistency
+		src, dst     *queuedProxy
+		srcS, dstS   *httptest.Server
+		srcC, dstC   *client.Client
+		stagedScript string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpdir, err = ioutil.TempDir("", "migrate")
+		Ω(err).Should(BeNil())
+		history, err = persistency.NewBoltPersistency(filepath.Join(tmpdir, "history.db"))
+		Ω(err).Should(BeNil())
+
+		src = &queuedProxy{childProxy: newChildProxy("all.q"), state: types.QueuedHeld}
+		dst = &queuedProxy{childProxy: newChildProxy("all.q"), state: types.QueuedHeld}
+		srcS = httptest.NewServer(proxy.NewProxyRouter(src, proxy.SecConfig{}, history))
+		dstS = httptest.NewServer(proxy.NewProxyRouter(dst, proxy.SecConfig{}, nil))
+		srcC, dstC = client.New(srcS.URL+"/v1", nil), client.New(dstS.URL+"/v1", nil)
+
+		stagedScript = filepath.Join(tmpdir, "job.sh")
+		Ω(ioutil.WriteFile(stagedScript, []byte("#!/bin/sh\necho hello\n"), 0700)).Should(BeNil())
+		Ω(srcC.UploadFile(context.Background(), proxy.DefaultJobSession, stagedScript, true)).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		srcS.Close()
+		dstS.Close()
+		history.Close()
+		os.RemoveAll(tmpdir)
+		os.RemoveAll("uploads")
+	})
+
+	It("should move a held job to another cluster", func() {
+		jobid, err := srcC.RunJob(context.Background(), proxy.DefaultJobSession,
+			types.JobTemplate{RemoteCommand: "job.sh", QueueName: "all.q", SubmitAsHold: true})
+		Ω(err).Should(BeNil())
+
+		newid, err := MigrateJob(srcC, dstC, "small", "big", proxy.DefaultJobSession, jobid)
+		Ω(err).Should(BeNil())
+		Ω(newid).Should(Equal("1"))
+
+		Ω(dst.jobs["1"].RemoteCommand).Should(Equal("job.sh"))
+		Ω(dst.jobs["1"].QueueName).Should(Equal("all.q"))
+		Ω(dst.jobs["1"].SubmitAsHold).Should(BeTrue())
+		Ω(src.operations).Should(Equal([]string{"terminate " + jobid}))
+
+		files, err := dstC.ListFiles(context.Background(), proxy.DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(ContainElement(types.FileInfo{Filename: "job.sh", Bytes: 21, Executable: true, Owner: "host:127.0.0.1"}))
+
+		entries, err := srcC.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].MigratedTo).Should(Equal("1@big"))
+		Ω(FormatMigration(entries[0])).Should(Equal(" (-> 1@big)"))
+	})
+
+	It("should not move running jobs", func() {
+		jobid, err := srcC.RunJob(context.Background(), proxy.DefaultJobSession,
+			types.JobTemplate{RemoteCommand: "job.sh"})
+		Ω(err).Should(BeNil())
+		src.state = types.Running
+
+		_, err = MigrateJob(srcC, dstC, "small", "big", proxy.DefaultJobSession, jobid)
+		Ω(err).ShouldNot(BeNil())
+		Ω(dst.jobs).Should(BeEmpty())
+		Ω(src.operations).Should(BeEmpty())
+	})
+
+	It("should terminate the new job when the original job can't be terminated", func() {
+		jobid, err := srcC.RunJob(context.Background(), proxy.DefaultJobSession,
+			types.JobTemplate{RemoteCommand: "job.sh"})
+		Ω(err).Should(BeNil())
+		src.terminateErr = proxy.ErrInvalidState
+
+		_, err = MigrateJob(srcC, dstC, "small", "big", proxy.DefaultJobSession, jobid)
+		Ω(err).ShouldNot(BeNil())
+		Ω(dst.operations).Should(Equal([]string{"terminate 1"}))
+
+		entries, err := srcC.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].MigratedTo).Should(BeEmpty())
+	})
+
+	It("should not move jobs without stored job template", func() {
+		jobid, err := dstC.RunJob(context.Background(), proxy.DefaultJobSession,
+			types.JobTemplate{RemoteCommand: "job.sh"})
+		Ω(err).Should(BeNil())
+
+		_, err = MigrateJob(dstC, srcC, "big", "small", proxy.DefaultJobSession, jobid)
+		Ω(err).ShouldNot(BeNil())
+		Ω(src.jobs).Should(BeEmpty())
+		Ω(dst.operations).Should(BeEmpty())
+	})
+
+})
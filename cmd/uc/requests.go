@@ -17,116 +17,201 @@
 package main
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/dgruber/ubercluster/pkg/http_helper"
+	"github.com/dgruber/ubercluster/pkg/client"
 	"github.com/dgruber/ubercluster/pkg/output"
 	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/types"
 
-	"crypto/x509"
-	"io/ioutil"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 type Request struct {
-	otp    *string
-	client *http.Client
+	otp      *string
+	auth     *ClusterAuth
+	clusters Config      // clusters the requests are sent to
+	selected string      // cluster the settings are applied to (UseClusterSettings)
+	hops     *types.Hops // hops of a request forwarded in inception mode
+	// http client of the selected cluster which waits the timeout
+	// of the cluster for the answer of its proxy
+	selectedClient *http.Client
 }
 
 func NewRequest(certFile string, keyFile string, oneTimePassword *string) *Request {
-	var config tls.Config
+	r, err := NewTLSRequest(client.TLSConfig{CertFile: certFile, KeyFile: keyFile}, oneTimePassword)
+	if err != nil {
+		log.Panicln(err.Error())
+	}
+	return r
+}
 
-	if certFile != "" && keyFile != "" {
-		fmt.Println("Using certificates")
+// NewTLSRequest creates a Request which accesses the clusters without
+// own TLS settings with the given settings.
+func NewTLSRequest(tc client.TLSConfig, oneTimePassword *string) (*Request, error) {
+	if tc.CertFile != "" && tc.KeyFile != "" {
+		log.Println("Using certificates")
+	} else {
+		log.Println("unsecure client")
+	}
+	httpClient, err := client.NewTLSHTTPClient(tc)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		otp:      oneTimePassword,
+		auth:     NewClusterAuth(httpClient, oneTimePassword),
+		clusters: config,
+	}, nil
+}
 
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-		if err != nil {
-			log.Panicln(err.Error())
-		}
+// UseClusterSettings applies the settings of the cluster the command
+// works on to the requests: its TLS settings, the shared secret of its
+// credential (when otpGiven is not set, i.e. no --otp flag is used),
+// and how long to wait for the answer of its proxy. It returns true if
+// the one time password was read from a yubikey.
+func (r *Request) UseClusterSettings(cc ClusterConfig, otpGiven bool) (bool, error) {
+	hc, err := r.auth.HTTPClient(cc)
+	if err != nil {
+		return false, err
+	}
+	r.selected, r.selectedClient = cc.Name, withResponseTimeout(hc, cc.RequestTimeout(0))
+	if otpGiven {
+		return false, nil
+	}
+	*r.otp = ""
+	if cc.Credential == "" {
+		return false, nil
+	}
+	secret, err := ResolveCredential(cc.Credential)
+	if err != nil {
+		return false, fmt.Errorf("credential of cluster %s: %s", cc.Name, err)
+	}
+	if secret == "yubikey" {
+		*r.otp = GetYubiKeyOrExit()
+		return true, nil
+	}
+	*r.otp = secret
+	return false, nil
+}
 
-		certs := []tls.Certificate{cert}
+// withResponseTimeout returns a copy of the http client which waits
+// at most timeout for the answer of the proxy. The transport of the
+// http client is copied since it can be shared by other clusters.
+func withResponseTimeout(hc *http.Client, timeout time.Duration) *http.Client {
+	transport := hc.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	tr, ok := transport.(*http.Transport)
+	if !ok {
+		return hc
+	}
+	tr = tr.Clone()
+	tr.ResponseHeaderTimeout = timeout
+	copied := *hc
+	copied.Transport = tr
+	return &copied
+}
 
-		clientCACert, err := ioutil.ReadFile(certFile)
-		if err != nil {
-			log.Fatal("Unable to open cert", err)
-		}
+// HTTPClient returns the http client for the proxy of the cluster.
+func (r *Request) HTTPClient(cc ClusterConfig) (*http.Client, error) {
+	if cc.Name == r.selected && r.selectedClient != nil {
+		return r.selectedClient, nil
+	}
+	return r.auth.HTTPClient(cc)
+}
 
-		clientCertPool := x509.NewCertPool()
-		clientCertPool.AppendCertsFromPEM(clientCACert)
+// findClusterByAddress returns the configuration of the cluster with
+// the given address (like http://localhost:8888/v1).
+func (r *Request) findClusterByAddress(clusteraddress string) (ClusterConfig, bool) {
+	for _, cc := range r.clusters.Cluster {
+		if strings.TrimSuffix(cc.Address+cc.ProtocolVersion, "/") == strings.TrimSuffix(clusteraddress, "/") {
+			return cc, true
+		}
+	}
+	return ClusterConfig{}, false
+}
 
-		config = tls.Config{
-			InsecureSkipVerify: true,
-			Certificates:       certs,
-			RootCAs:            clientCertPool,
+// proxyClient creates a client for the proxy reachable at the given
+// cluster address (like http://localhost:8888/v1). The credentials
+// and TLS settings of the configured cluster with that address are
+// used; for the cluster given to UseClusterSettings the one time
+// password of the request. An error is returned when the TLS settings
+// or the credential of the cluster can not be used.
+func (r *Request) proxyClient(clusteraddress string) (*client.Client, error) {
+	var c *client.Client
+	cc, found := r.findClusterByAddress(clusteraddress)
+	if found && cc.Name != r.selected {
+		pc, err := r.auth.ProxyClient(cc)
+		if err != nil {
+			return nil, err
 		}
-		config.BuildNameToCertificate()
+		c = pc
 	} else {
-		fmt.Println("unsecure client")
-		config = tls.Config{
-			InsecureSkipVerify: true,
+		hc, err := r.HTTPClient(cc)
+		if err != nil {
+			return nil, err
+		}
+		c = client.New(clusteraddress, hc)
+		if r.otp != nil {
+			c.SetOTP(*r.otp)
 		}
 	}
-
-	config.BuildNameToCertificate()
-
-	tr := &http.Transport{
-		MaxIdleConns:       10,
-		IdleConnTimeout:    30 * time.Second,
-		DisableCompression: false,
-		TLSClientConfig:    &config,
-	}
-
-	client := &http.Client{Transport: tr}
-
-	return &Request{
-		otp:    oneTimePassword,
-		client: client,
+	if r.hops != nil {
+		c.SetHops(*r.hops)
 	}
+	return c, nil
 }
 
 func (r *Request) SelectClusterAddress(cluster, alg string) (string, string, error) {
+	if alg == "" {
+		return GetClusterAddress(cluster)
+	}
 	// a cluster selection algorithm chooses the right cluster
-	switch alg {
-	case "rand": // random scheduling
-		return GetClusterAddress(MakeNewScheduler(RandomSchedulerType, config, r.client).Impl.SelectCluster())
-	case "prob": // probabilistic scheduling
-		return GetClusterAddress(MakeNewScheduler(ProbabilisticSchedulerType, config, r.client).Impl.SelectCluster())
-	case "load": // load based scheduling
-		return GetClusterAddress(MakeNewScheduler(LoadBasedSchedulerType, config, r.client).Impl.SelectCluster())
-	}
-	if alg != "" {
+	st, exists := SchedulerTypes[alg]
+	if !exists {
 		fmt.Println("Unkown scheduler selection algorithm: ", alg)
 		os.Exit(2)
 	}
-	return GetClusterAddress(cluster)
+	return GetClusterAddress(MakeNewScheduler(st, config, r.auth).Impl.SelectCluster())
 }
 
 func (r *Request) GetJob(clusteraddress, jobid string) (types.JobInfo, error) {
-	request := fmt.Sprintf("%s%s%s", clusteraddress, "/msession/jobinfo/", jobid)
-	log.Println("Requesting:" + request)
-
-	resp, err := http_helper.UberGet(r.client, *otp, request)
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	var jobinfo types.JobInfo
-	if err := decoder.Decode(&jobinfo); err != nil {
-		return jobinfo, err
+		return types.JobInfo{}, err
 	}
-	return jobinfo, nil
+	return c.GetJobInfo(context.Background(), jobid)
 }
 
-func (r *Request) ShowJobDetails(clustername, jobid string, of output.OutputFormater) {
+// ShowJobDetails prints the job info of a job. If the job id
+// refers to a job array all tasks of the job array are shown. Since
+// the job array is requested first a one time password from the
+// yubikey (yubi) is read again for requesting the job.
+func (r *Request) ShowJobDetails(clustername, jobid string, yubi bool, of output.OutputFormater) {
+	c, err := r.proxyClient(clustername)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		return
+	}
+	aji, err := c.GetArrayJobInfo(context.Background(), jobid)
+	if err == nil {
+		of.PrintArrayJob(aji)
+		return
+	}
+	if cerr, ok := err.(*client.Error); !ok || cerr.Code != types.ErrorCodeNotFound {
+		fmt.Println("Error: ", err)
+		return
+	}
+	if yubi {
+		*r.otp = GetYubiKeyOrExit()
+	}
 	jobinfo, err := r.GetJob(clustername, jobid)
 	if err == nil {
 		of.PrintJobDetails(jobinfo)
@@ -135,44 +220,35 @@ func (r *Request) ShowJobDetails(clustername, jobid string, of output.OutputForm
 	}
 }
 
-func (r *Request) GetJobs(clusteraddress, state, user string) []types.JobInfo {
-	firstSet := false
-	request := fmt.Sprintf("%s%s", clusteraddress, "/msession/jobinfos")
-	if state != "" && state != "all" {
-		firstSet = true
-		request = fmt.Sprintf("%s%s%s", request, "?state=", state)
+func (r *Request) GetJobs(clusteraddress, state, user string) ([]types.JobInfo, error) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		return nil, err
 	}
-	if user != "" {
-		if firstSet == true {
-			request = fmt.Sprintf("%s%s", request, "&")
-		} else {
-			request = fmt.Sprintf("%s%s", request, "?")
-		}
-		request = fmt.Sprintf("%s%s%s", request, "user=", user)
+	return c.GetJobInfos(context.Background(), state, user)
+}
+
+// GetJobSessionJobs returns the jobs of a job session. For the default
+// job session all jobs of the cluster are returned.
+func (r *Request) GetJobSessionJobs(clusteraddress, jsession, state, user string) ([]types.JobInfo, error) {
+	if jsession == proxy.DefaultJobSession {
+		return r.GetJobs(clusteraddress, state, user)
 	}
-	log.Println("Requesting:" + request)
-	resp, err := http_helper.UberGet(r.client, *otp, request)
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	var joblist []types.JobInfo
-	decoder.Decode(&joblist)
-	log.Println(joblist)
-
-	return joblist
+	return c.GetJobSessionJobInfos(context.Background(), jsession, state, user)
 }
 
-func (r *Request) ShowJobs(clusteraddress, state, user string, of output.OutputFormater) {
-	joblist := r.GetJobs(clusteraddress, state, user)
-	for index := range joblist {
-		of.PrintJobDetails(joblist[index])
-		fmt.Println()
+func (r *Request) ShowJobs(clusteraddress, jsession, state, user string, of output.OutputFormater) {
+	joblist, err := r.GetJobSessionJobs(clusteraddress, jsession, state, user)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
 	}
-	if len(joblist) == 0 {
+	of.PrintJobs(joblist)
+	if len(joblist) == 0 && *outformat == "default" {
 		if state != "all" {
 			fmt.Printf("No job in state %s found.\n", state)
 		} else {
@@ -181,76 +257,138 @@ func (r *Request) ShowJobs(clusteraddress, state, user string, of output.OutputF
 	}
 }
 
-func (r *Request) RunLocalRequest(otp, clusteraddress, cmd, arg string) {
-	url := fmt.Sprintf("%s%s", clusteraddress, "/local/run")
-	log.Println("POST to URL:", url)
-	rlr := types.RunLocalRequest{
-		Command: cmd,
-		Arg:     arg,
+// WatchJobs prints each job state transition reported by the
+// cluster until the proxy closes the connection.
+func (r *Request) WatchJobs(clusteraddress, jobid string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	err = c.WatchJobInfos(context.Background(), jobid,
+		func(ji types.JobInfo) error {
+			if *outformat == "default" {
+				fmt.Printf("%s %s %s\n", time.Now().Format(time.RFC3339), ji.Id, ji.State)
+			} else {
+				of.PrintJobDetails(ji)
+			}
+			return nil
+		})
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+}
+
+// ShowJobOutput copies the stdout or stderr output of a job to stdout.
+// When follow is set it waits for new output until the job is finished.
+func (r *Request) ShowJobOutput(clusteraddress, jsession, jobid, stream string, follow bool) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
 	}
-	body, _ := json.Marshal(rlr)
-	resp, err := http_helper.UberPost(r.client, otp, url, "application/json", bytes.NewBuffer(body))
+	output, err := c.JobOutput(context.Background(),
+		jsession, jobid, stream, follow)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	defer output.Close()
+	if _, err := io.Copy(os.Stdout, output); err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+}
+
+func (r *Request) RunLocalRequest(otp, clusteraddress, cmd, arg string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
 		fmt.Println("Run local error: ", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	var answer string
-	respBody, err := ioutil.ReadAll(resp.Body)
+	c.SetOTP(otp)
+	answer, err := c.RunLocal(context.Background(), cmd, arg)
 	if err != nil {
-		fmt.Printf("Error during reading answer from proxy: %s\n", err.Error())
+		fmt.Println("Run local error: ", err)
 		return
 	}
-	json.Unmarshal(respBody, &answer)
-	fmt.Printf("%s\n", answer)
+	of.PrintOperation(types.OperationResult{Operation: "runlocal", Object: "command", Id: cmd, Message: answer})
 }
 
-func (r *Request) CreateJobRequest(jobname, cmd, arg, queue, category string) []byte {
-	jt := types.JobTemplate{
-		RemoteCommand: cmd,
-		JobName:       jobname,
-		QueueName:     queue,
-		JobCategory:   category,
+// CreateJobRequest layers the given command line values on top of
+// the job template. Empty values do not change the template.
+func (r *Request) CreateJobRequest(jt types.JobTemplate, jobname, cmd, arg, queue, category string) types.JobTemplate {
+	// "#nocommand#" is the default when no command is given
+	if cmd != "#nocommand#" || jt.RemoteCommand == "" {
+		jt.RemoteCommand = cmd
+	}
+	if jobname != "" {
+		jt.JobName = jobname
+	}
+	if queue != "" {
+		jt.QueueName = queue
+	}
+	if category != "" {
+		jt.JobCategory = category
 	}
 	if arg != "" {
 		jt.Args = []string{arg}
 	}
-	jtb, _ := json.Marshal(jt)
-	return jtb
+	return jt
 }
 
-// SubmitJob creates a new job in the given cluster
-func (r *Request) SubmitJob(clusteraddress, clustername, jobname, cmd, arg, queue, category, otp string) {
-	jtb := r.CreateJobRequest(jobname, cmd, arg, queue, category)
-
-	// create URL of cluster to send the job to
-	url := fmt.Sprintf("%s%s", clusteraddress, "/jsession/default/run")
-	log.Println("POST to URL:", url)
-	log.Println("Submit template: ", string(jtb))
+// SubmitJob creates a new job in the job session of the given cluster
+func (r *Request) SubmitJob(clusteraddress, clustername, jsession string, jt types.JobTemplate, otp string, of output.OutputFormater) {
+	log.Println("Submit template: ", jt)
 
-	resp, err := http_helper.UberPost(r.client, otp, url, "application/json", bytes.NewBuffer(jtb))
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
 		fmt.Printf("Job submission error: %s\n", err.Error())
 		return
 	}
-	defer resp.Body.Close()
-
-	// fmt.Println("Job submitted successfully: ", resp.Status)
-	var answer proxy.RunJobResult
-	body, err := ioutil.ReadAll(resp.Body)
+	c.SetOTP(otp)
+	jobid, err := c.RunJob(context.Background(), jsession, jt)
 	if err != nil {
-		fmt.Printf("Error during reading answer from proxy: %s\n", err.Error())
+		fmt.Printf("Job submission error: %s\n", err.Error())
 		return
 	}
+	of.PrintJobSubmission(types.RunJobResult{JobId: jobid, Cluster: clustername})
+}
 
-	err = json.Unmarshal(body, &answer)
+// SubmitArrayJob submits the job template as job array in the job
+// session of the given cluster. The task index is available in each
+// task in the environment variable UC_TASK_ID.
+func (r *Request) SubmitArrayJob(clusteraddress, clustername, jsession string, jt types.JobTemplate, taskRange string, maxParallel int, otp string, of output.OutputFormater) {
+	begin, end, step, err := ParseTaskRange(taskRange)
 	if err != nil {
-		fmt.Printf("Error during decoding answer from POSTING to proxy during job submission: %s\n", string(body))
-	} else {
-		fmt.Println("Job ID: ", answer.JobId)
-		fmt.Println("Cluster: ", clustername)
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
+	log.Println("Submit array job template: ", jt)
+
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Printf("Job submission error: %s\n", err.Error())
+		return
+	}
+	c.SetOTP(otp)
+	arrayjobid, err := c.RunBulkJobs(context.Background(), jsession, types.BulkJobRequest{
+		JobTemplate: jt,
+		Begin:       begin,
+		End:         end,
+		Step:        step,
+		MaxParallel: maxParallel,
+	})
+	if err != nil {
+		fmt.Printf("Job submission error: %s\n", err.Error())
+		return
+	}
+	of.PrintJobSubmission(types.RunJobResult{
+		JobId:   arrayjobid,
+		Cluster: clustername,
+		Tasks:   (end-begin)/step + 1,
+	})
 }
 
 func (r *Request) ShowQueues(clustername, queue string, of output.OutputFormater) {
@@ -261,161 +399,125 @@ func (r *Request) ShowMachines(clustername, machine string, of output.OutputForm
 	r.ShowMachinesQueues(clustername, "machines", machine, of)
 }
 
-func createRequestMachinesQueues(clusteraddress, req, filter string) string {
-	var request string
-	if filter == "all" {
-		request = fmt.Sprintf("%s/msession/%s", clusteraddress, req)
-	} else {
-		// filter for a specific queue or machine
-		if req == "machines" {
-			request = fmt.Sprintf("%s/msession/machine/%s", clusteraddress, filter)
-		} else {
-			request = fmt.Sprintf("%s/msession/queue/%s", clusteraddress, filter)
-		}
-	}
-	log.Println("Requesting:" + request)
-	return request
-}
-
 func (r *Request) GetQueues(clusteraddress, filter string) ([]types.Queue, error) {
-	resp, err := http_helper.UberGet(r.client, *otp, createRequestMachinesQueues(clusteraddress, "queues", filter))
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	var queuelist []types.Queue
-	if err := decoder.Decode(&queuelist); err != nil {
-		fmt.Println("Error during decoding: ", err)
 		return nil, err
 	}
-	return queuelist, nil
+	return c.GetQueues(context.Background(), filter)
 }
 
 func (r *Request) GetMachines(clusteraddress, filter string) ([]types.Machine, error) {
-	resp, err := http_helper.UberGet(r.client, *otp, createRequestMachinesQueues(clusteraddress, "machines", filter))
+	c, err := r.proxyClient(clusteraddress)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	var machinelist []types.Machine
-	if err := decoder.Decode(&machinelist); err != nil {
-		fmt.Println("Error during decoding: ", err)
 		return nil, err
 	}
-	return machinelist, nil
+	return c.GetMachines(context.Background(), filter)
 }
 
 func (r *Request) ShowMachinesQueues(clusteraddress, req, filter string, of output.OutputFormater) {
 	log.Println("showMachineQueues: ", clusteraddress, req, filter)
 	if req == "machines" {
-		if machinelist, err := r.GetMachines(clusteraddress, filter); err == nil {
-			for index := range machinelist {
-				//emulateQhost(machinelist[index])
-				of.PrintMachine(machinelist[index])
-			}
+		if machinelist, err := r.GetMachines(clusteraddress, filter); err == nil || client.IsPartialResult(err) {
+			of.PrintMachines(machinelist)
+			printPartialResult(err)
+		} else {
+			fmt.Println("Error: ", err)
 		}
 	} else if req == "queues" {
-		if queuelist, err := r.GetQueues(clusteraddress, filter); err == nil {
+		if queuelist, err := r.GetQueues(clusteraddress, filter); err == nil || client.IsPartialResult(err) {
 			log.Println("Queuelist: ", queuelist)
-			for index := range queuelist {
-				fmt.Println(queuelist[index].Name)
-				// TODO
-			}
+			of.PrintQueues(queuelist)
+			printPartialResult(err)
+		} else {
+			fmt.Println("Error: ", err)
 		}
 	}
 }
 
+// printPartialResult warns about clusters which did not contribute
+// to the result of an inception proxy.
+func printPartialResult(err error) {
+	if e, ok := err.(*client.PartialResultError); ok {
+		fmt.Fprintf(os.Stderr, "Warning: unreachable clusters: %s\n", strings.Join(e.Unreachable, ", "))
+	}
+}
+
 // PerformOperation sends request to perform an operation on a particular
 // job to a connected cluster (to its proxy).
 // The request url is: jsession/<jobsessionname>/<operation>/jobnumber
-func (r *Request) PerformOperation(clusteraddress, jsession, operation, jobId string) {
-	url := fmt.Sprintf("%s/jsession/%s/%s/%s", clusteraddress, jsession, operation, jobId)
-	log.Println("Requesting:" + url)
-	buffer := bytes.NewBuffer([]byte(""))
-	if resp, err := http_helper.UberPost(r.client, *otp, url, "application/json", buffer); err != nil {
+func (r *Request) PerformOperation(clusteraddress, jsession, operation, jobId string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
 		fmt.Println("Error during post: ", err)
-	} else {
-		log.Println("Status of request:", resp.Status)
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		fmt.Println(string(body))
+		return
+	}
+	answer, err := c.JobOperation(context.Background(), jsession, operation, jobId)
+	if err != nil {
+		fmt.Println("Error during post: ", err)
+		return
 	}
+	of.PrintOperation(types.OperationResult{Operation: operation, Object: "job", Id: jobId, Message: answer})
 }
 
-func (r *Request) GetJobCategories(clusteraddress, jsession, category string) []string {
-	var url string
+func (r *Request) GetJobCategories(clusteraddress, jsession, category string) ([]string, error) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		return nil, err
+	}
 	if category == "all" || category == "" {
-		url = fmt.Sprintf("%s/jsession/%s/jobcategories", clusteraddress, jsession)
-	} else {
-		url = fmt.Sprintf("%s/jsession/%s/jobcategory/%s", clusteraddress, jsession, category)
+		return c.GetJobCategories(context.Background(), jsession)
 	}
-	log.Println("Requesting:" + url)
-	if resp, err := http_helper.UberGet(r.client, *otp, url); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
-	} else {
-		defer resp.Body.Close()
-		if category == "all" || category == "" {
-			var catList []string
-			json.NewDecoder(resp.Body).Decode(&catList)
-			return catList
-		} else {
-			var cat string
-			json.NewDecoder(resp.Body).Decode(&cat)
-			return []string{cat}
-		}
+	cat, err := c.GetJobCategory(context.Background(), jsession, category)
+	if err == client.ErrEmptyResponse || client.IsNotFound(err) {
+		return []string{}, nil
+	}
+	if err != nil && !client.IsPartialResult(err) {
+		return nil, err
 	}
-	return nil
+	return []string{cat}, err
 }
 
-func (r *Request) ShowJobCategories(clusteraddress, jsession, category string) {
-	for _, cat := range r.GetJobCategories(clusteraddress, jsession, category) {
-		fmt.Println(cat)
+func (r *Request) ShowJobCategories(clusteraddress, jsession, category string, of output.OutputFormater) {
+	categories, err := r.GetJobCategories(clusteraddress, jsession, category)
+	if err != nil && !client.IsPartialResult(err) {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
 	}
+	of.PrintCategories(categories)
+	printPartialResult(err)
 }
 
-func (r *Request) GetJobSessions(clusteraddress, jsession string) []string {
-	url := fmt.Sprintf("%s/jsessions", clusteraddress)
-	log.Println("Requesting:" + url)
-	if resp, err := http_helper.UberGet(r.client, *otp, url); err != nil {
-		log.Fatal(err)
-		os.Exit(1)
-	} else {
-		defer resp.Body.Close()
-		var jsList []string
-		json.NewDecoder(resp.Body).Decode(&jsList)
-		found := false
-		if jsession != "all" {
-			for _, js := range jsList {
-				if js == jsession {
-					found = true
-				}
-			}
-			if found == true {
-				return []string{jsession}
-			} else {
-				return []string{}
+func (r *Request) GetJobSessions(clusteraddress, jsession string) ([]string, error) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		return nil, err
+	}
+	jsList, err := c.GetJobSessions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if jsession != "all" {
+		for _, js := range jsList {
+			if js == jsession {
+				return []string{jsession}, nil
 			}
 		}
-		return jsList
+		return []string{}, nil
 	}
-	return nil
+	return jsList, nil
 }
 
 // ShowJobSessions requests all job sessions available on the
 // given cluster and prints them out to the user.
-func (r *Request) ShowJobSessions(clusteraddress, jsession string) {
-	jSessions := r.GetJobSessions(clusteraddress, jsession)
+func (r *Request) ShowJobSessions(clusteraddress, jsession string, of output.OutputFormater) {
+	jSessions, err := r.GetJobSessions(clusteraddress, jsession)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
 	if len(jSessions) >= 1 {
-		for _, js := range jSessions {
-			fmt.Println(js)
-		}
+		of.PrintSessions(jSessions)
 	} else {
 		if jsession == "all" {
 			fmt.Println("No job session found.")
@@ -0,0 +1,121 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// CreateReservationTemplate creates the reservation template out of
+// the command line parameters. Start and end are RFC 3339 times; an
+// empty start means now. Either the end or the duration is required.
+func CreateReservationTemplate(name, start, end string, duration time.Duration, slots, maxSlots int64, category string, machines, users []string) (types.ReservationTemplate, error) {
+	rt := types.ReservationTemplate{
+		Name:              name,
+		Duration:          duration,
+		MinSlots:          slots,
+		MaxSlots:          maxSlots,
+		JobCategory:       category,
+		CandidateMachines: machines,
+		UsersACL:          users,
+	}
+	var err error
+	if start != "" {
+		if rt.StartTime, err = time.Parse(time.RFC3339, start); err != nil {
+			return rt, fmt.Errorf("invalid start time %s (expected RFC 3339 time)", start)
+		}
+	}
+	if end != "" {
+		if rt.EndTime, err = time.Parse(time.RFC3339, end); err != nil {
+			return rt, fmt.Errorf("invalid end time %s (expected RFC 3339 time)", end)
+		}
+	}
+	if rt.EndTime.IsZero() && duration <= 0 {
+		return rt, fmt.Errorf("reservation requires an end time or a duration")
+	}
+	return rt, nil
+}
+
+// RequestReservation requests an advance reservation in the cluster
+// and prints the granted reservation.
+func (r *Request) RequestReservation(clusteraddress, rsession string, rt types.ReservationTemplate, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	info, err := c.RequestReservation(context.Background(), rsession, rt)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintReservation(info)
+}
+
+// ShowReservations prints a particular reservation or all
+// reservations if no reservation id is given.
+func (r *Request) ShowReservations(clusteraddress, rsession, reservationid string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	if reservationid != "" {
+		info, err := c.GetReservation(context.Background(), rsession, reservationid)
+		if err != nil {
+			fmt.Println("Error: ", err)
+			os.Exit(1)
+		}
+		of.PrintReservation(info)
+		return
+	}
+	infos, err := c.GetReservations(context.Background(), rsession)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintReservations(infos)
+	if len(infos) == 0 && *outformat == "default" {
+		fmt.Println("No reservation found.")
+	}
+}
+
+// TerminateReservation terminates an advance reservation.
+func (r *Request) TerminateReservation(clusteraddress, rsession, reservationid string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	err = c.TerminateReservation(context.Background(), rsession, reservationid)
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintOperation(types.OperationResult{
+		Operation: "terminate",
+		Object:    "reservation",
+		Id:        reservationid,
+		Message:   "Terminated Reservation",
+	})
+}
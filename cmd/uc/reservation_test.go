@@ -0,0 +1,33 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("Reservation", func() {
+
+	It("must create the reservation template out of the parameters", func() {
+		rt, err := CreateReservationTemplate("demo", "2018-03-01T10:00:00Z", "", 2*time.Hour, 4, 0, "", []string{"host1"}, nil)
+		Ω(err).Should(BeNil())
+		Ω(rt.Name).Should(Equal("demo"))
+		Ω(rt.StartTime.Hour()).Should(Equal(10))
+		Ω(rt.Duration).Should(Equal(2 * time.Hour))
+		Ω(rt.MinSlots).Should(BeNumerically("==", 4))
+		Ω(rt.CandidateMachines).Should(Equal([]string{"host1"}))
+	})
+
+	It("must reject reservations without end or with invalid times", func() {
+		_, err := CreateReservationTemplate("", "", "", 0, 1, 0, "", nil, nil)
+		Ω(err).ShouldNot(BeNil())
+		_, err = CreateReservationTemplate("", "tomorrow", "", time.Hour, 1, 0, "", nil, nil)
+		Ω(err).ShouldNot(BeNil())
+		_, err = CreateReservationTemplate("", "", "2018-03-01", 0, 1, 0, "", nil, nil)
+		Ω(err).ShouldNot(BeNil())
+	})
+
+})
@@ -0,0 +1,106 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrRouteNotFound is returned when the routing table has no entry
+// for a job.
+var ErrRouteNotFound = errors.New("job not found in routing table")
+
+// routesBucket is the BoltDB bucket which contains the JSON encoded
+// job routes with the job id of the inception proxy as key.
+var routesBucket = []byte("routes")
+
+// JobRoute refers to a job which was submitted through the inception
+// proxy in a child cluster.
+type JobRoute struct {
+	JobId           string    `json:"jobId"` // job id in the child cluster
+	Cluster         string    `json:"cluster"`
+	Address         string    `json:"address"`
+	ProtocolVersion string    `json:"protocolVersion"`
+	SubmittedAt     time.Time `json:"submittedAt"`
+}
+
+// ClusterAddress returns the address of the proxy of the child
+// cluster including the protocol version.
+func (jr JobRoute) ClusterAddress() string {
+	return fmt.Sprintf("%s%s", jr.Address, jr.ProtocolVersion)
+}
+
+// RoutingTable maps the job ids returned by the inception proxy
+// (jobid@cluster) to the child clusters which run the jobs. It is
+// stored in a BoltDB file so that the jobs can be reached after a
+// restart of the inception proxy, even when the configuration of
+// the clusters changed.
+type RoutingTable struct {
+	db *bolt.DB
+}
+
+// NewRoutingTable opens or creates the BoltDB file which contains
+// the routing table.
+func NewRoutingTable(path string) (*RoutingTable, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(routesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &RoutingTable{db: db}, nil
+}
+
+// Close closes the BoltDB file.
+func (rt *RoutingTable) Close() error {
+	return rt.db.Close()
+}
+
+// Add stores the route of a job.
+func (rt *RoutingTable) Add(jobid string, route JobRoute) error {
+	value, err := json.Marshal(route)
+	if err != nil {
+		return err
+	}
+	return rt.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(routesBucket).Put([]byte(jobid), value)
+	})
+}
+
+// Lookup returns the route of a job or ErrRouteNotFound.
+func (rt *RoutingTable) Lookup(jobid string) (JobRoute, error) {
+	var route JobRoute
+	err := rt.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(routesBucket).Get([]byte(jobid))
+		if value == nil {
+			return ErrRouteNotFound
+		}
+		return json.Unmarshal(value, &route)
+	})
+	return route, err
+}
@@ -17,15 +17,14 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/dgruber/ubercluster/pkg/http_helper"
+	"context"
 	"log"
 	"math"
 	"math/rand"
-	"net/http"
 	"sync"
 	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
 )
 
 // just seed random number generator one time
@@ -43,15 +42,38 @@ const (
 	ProbabilisticSchedulerType SchedulerType = iota
 	RandomSchedulerType
 	LoadBasedSchedulerType
+	MatchingSchedulerType
 )
 
+// SchedulerTypes maps the names of the cluster selection algorithms
+// (like used in "uc run --alg") to the scheduler types.
+var SchedulerTypes = map[string]SchedulerType{
+	"rand":  RandomSchedulerType,
+	"prob":  ProbabilisticSchedulerType,
+	"load":  LoadBasedSchedulerType,
+	"match": MatchingSchedulerType,
+}
+
+// isMatchingScheduler returns true if the cluster selection algorithm
+// needs the job template for selecting the cluster.
+func isMatchingScheduler(alg string) bool {
+	st, exists := SchedulerTypes[alg]
+	return exists && st == MatchingSchedulerType
+}
+
 type SchedulerImpl struct {
 	Impl Scheduler
 }
 
+// ProxyClients creates the clients with which the schedulers request
+// the proxies of the clusters (like the ClusterAuth).
+type ProxyClients interface {
+	ProxyClient(cc ClusterConfig) (*client.Client, error)
+}
+
 // MakeNewScheduler create a new scheduler implementation based
 // on the SchedulerType and the cluster Config.
-func MakeNewScheduler(st SchedulerType, config Config, client *http.Client) *SchedulerImpl {
+func MakeNewScheduler(st SchedulerType, config Config, clients ProxyClients) *SchedulerImpl {
 	if seeded == false {
 		rand.Seed(time.Now().UTC().UnixNano())
 		seeded = true
@@ -60,18 +82,23 @@ func MakeNewScheduler(st SchedulerType, config Config, client *http.Client) *Sch
 	switch st {
 	case ProbabilisticSchedulerType:
 		s.Impl = &ProbSched{
-			conf:   config,
-			client: client,
+			conf:    config,
+			clients: clients,
 		}
 	case RandomSchedulerType:
 		s.Impl = &RandomSched{
-			conf:   config,
-			client: client,
+			conf:    config,
+			clients: clients,
 		}
 	case LoadBasedSchedulerType:
 		s.Impl = &LoadBasedSched{
-			conf:   config,
-			client: client,
+			conf:    config,
+			clients: clients,
+		}
+	case MatchingSchedulerType:
+		s.Impl = &MatchSched{
+			conf:    config,
+			clients: clients,
 		}
 	}
 	return &s
@@ -80,8 +107,8 @@ func MakeNewScheduler(st SchedulerType, config Config, client *http.Client) *Sch
 // Implements the cluster selection algorithms.
 
 type ProbSched struct {
-	conf   Config
-	client *http.Client
+	conf    Config
+	clients ProxyClients
 }
 
 // probabilisticScheduler returns the name of the selected
@@ -93,7 +120,7 @@ type ProbSched struct {
 // same probability to be chosen.
 func (ps *ProbSched) SelectCluster() string {
 	// get load of each cluster
-	selection := probabilisticSelection(getAllLoadValues(ps.conf, ps.client))
+	selection := probabilisticSelection(getAllLoadValues(ps.conf, ps.clients))
 	if selection >= 0 {
 		log.Printf("Selected cluster %s due to probabilistic selection.\n",
 			ps.conf.Cluster[selection].Name)
@@ -133,34 +160,41 @@ func probabilisticSelection(loads []float64) int {
 	return -1
 }
 
+// loadTimeout is the deadline for requesting the load of a cluster.
+var loadTimeout = 10 * time.Second
+
 type loadValues struct {
-	sync.Mutex
 	sync.WaitGroup
 	load []float64
 }
 
-func getClusterLoad(lv *loadValues, index int, request string, client *http.Client) {
-	if resp, err := http_helper.UberGet(client, *otp, request); err == nil {
-		defer resp.Body.Close()
-		decoder := json.NewDecoder(resp.Body)
-		var load float64
-		if err := decoder.Decode(&load); err != nil {
-			lv.load[index] = load
-		} else {
-			log.Println("Error during decoding cluster load from ", request, err)
-		}
+// getClusterLoad requests the load of the cluster. Clusters which
+// can't be reached get the load 1 so that they are not selected.
+func getClusterLoad(lv *loadValues, index int, c ClusterConfig, clients ProxyClients) {
+	defer lv.Done()
+	pc, err := clients.ProxyClient(c)
+	if err != nil {
+		log.Println("Error during requesting cluster load from ", c.Name, err)
+		lv.load[index] = 1.0
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	load, err := pc.DRMSLoad(ctx)
+	if err != nil {
+		log.Println("Error during requesting cluster load from ", c.Name, err)
+		lv.load[index] = 1.0
+		return
 	}
-	lv.Done()
+	lv.load[index] = load
 }
 
-func getAllLoadValues(conf Config, client *http.Client) []float64 {
+func getAllLoadValues(conf Config, clients ProxyClients) []float64 {
 	var lv loadValues
 	lv.load = make([]float64, len(conf.Cluster), len(conf.Cluster))
 	lv.Add(len(conf.Cluster))
 	for i := range conf.Cluster {
-		addr := conf.Cluster[i].Address
-		ver := conf.Cluster[i].ProtocolVersion
-		go getClusterLoad(&lv, i, fmt.Sprintf("%s/%s/drmsload", addr, ver), client)
+		go getClusterLoad(&lv, i, conf.Cluster[i], clients)
 	}
 	lv.Wait()
 	return lv.load
@@ -179,21 +213,21 @@ func minLoad(load []float64) int {
 }
 
 type LoadBasedSched struct {
-	conf   Config
-	client *http.Client
+	conf    Config
+	clients ProxyClients
 }
 
 // SelectCluster of the LoadBasedSched is a simple scheduler
 // that selects the cluster with the lowest load.
 func (lbs *LoadBasedSched) SelectCluster() string {
 	// get all load values (time consuming)
-	load := getAllLoadValues(lbs.conf, lbs.client)
+	load := getAllLoadValues(lbs.conf, lbs.clients)
 	return lbs.conf.Cluster[minLoad(load)].Name
 }
 
 type RandomSched struct {
-	conf   Config
-	client *http.Client
+	conf    Config
+	clients ProxyClients
 }
 
 // SelectCluster of the random scheduler selects a
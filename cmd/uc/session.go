@@ -0,0 +1,63 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// CreateJobSession creates a job session on the proxy of the cluster.
+func (r *Request) CreateJobSession(clusteraddress, jsession string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err == nil {
+		err = c.CreateJobSession(context.Background(), jsession)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintOperation(types.OperationResult{
+		Operation: "create",
+		Object:    "session",
+		Id:        jsession,
+		Message:   fmt.Sprintf("Created job session %s", jsession),
+	})
+}
+
+// DestroyJobSession removes a job session including its staging
+// area from the proxy of the cluster.
+func (r *Request) DestroyJobSession(clusteraddress, jsession string, of output.OutputFormater) {
+	c, err := r.proxyClient(clusteraddress)
+	if err == nil {
+		err = c.DestroyJobSession(context.Background(), jsession)
+	}
+	if err != nil {
+		fmt.Println("Error: ", err)
+		os.Exit(1)
+	}
+	of.PrintOperation(types.OperationResult{
+		Operation: "remove",
+		Object:    "session",
+		Id:        jsession,
+		Message:   fmt.Sprintf("Removed job session %s", jsession),
+	})
+}
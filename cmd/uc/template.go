@@ -0,0 +1,143 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+// Job templates can be read from YAML or JSON files. The keys are
+// the JSON names of the DRMAA2 job template fields (like "remoteCommand"
+// or "jobEnvironment").
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/ghodss/yaml"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DecodeJobTemplate decodes a YAML or JSON encoded job template.
+// Keys which are not part of the job template are rejected.
+func DecodeJobTemplate(data []byte) (types.JobTemplate, error) {
+	var jt types.JobTemplate
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return jt, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&jt); err != nil {
+		return jt, err
+	}
+	return jt, nil
+}
+
+// LoadJobTemplate reads the job template from the given YAML or JSON
+// file and applies the overrides (field=value) on top. When no file
+// is given the overrides are applied to an empty job template.
+func LoadJobTemplate(filename string, overrides []string) (types.JobTemplate, error) {
+	var jt types.JobTemplate
+	if filename != "" {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return jt, err
+		}
+		if jt, err = DecodeJobTemplate(data); err != nil {
+			return jt, fmt.Errorf("invalid job template %s: %s", filename, err)
+		}
+	}
+	for _, override := range overrides {
+		if err := SetJobTemplateValue(&jt, override); err != nil {
+			return jt, err
+		}
+	}
+	return jt, nil
+}
+
+// jobTemplateField returns the job template field which has
+// the given JSON name.
+func jobTemplateField(name string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(types.JobTemplate{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if strings.EqualFold(tag, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// SetJobTemplateValue sets a field of the job template. The assignment
+// has the form field=value where field is the JSON name of the job
+// template field. Values of string and time fields are taken as they
+// are, all other values are parsed as YAML (like "true", "4" or
+// "[a, b]"). A plain value for a list is a list with one element.
+// Single entries of maps are set by field.key=value
+// (like jobEnvironment.PATH=/bin).
+func SetJobTemplateValue(jt *types.JobTemplate, assignment string) error {
+	eq := strings.Index(assignment, "=")
+	if eq <= 0 {
+		return fmt.Errorf("expected field=value but got \"%s\"", assignment)
+	}
+	name, value := assignment[:eq], assignment[eq+1:]
+	key := ""
+	if dot := strings.Index(name, "."); dot >= 0 {
+		name, key = name[:dot], name[dot+1:]
+	}
+	field, found := jobTemplateField(name)
+	if !found {
+		return fmt.Errorf("unknown job template field \"%s\"", name)
+	}
+	v := reflect.ValueOf(jt).Elem().FieldByIndex(field.Index)
+
+	if key != "" {
+		if v.Kind() != reflect.Map {
+			return fmt.Errorf("job template field \"%s\" is not a map", name)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(value))
+		return nil
+	}
+
+	var raw []byte
+	var err error
+	switch {
+	case v.Kind() == reflect.String || v.Type() == reflect.TypeOf(time.Time{}):
+		raw, err = json.Marshal(value)
+	case v.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "["):
+		raw, err = json.Marshal([]string{value})
+	default:
+		raw, err = yaml.YAMLToJSON([]byte(value))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for job template field \"%s\": %s", name, err)
+	}
+	newValue := reflect.New(v.Type())
+	if err := json.Unmarshal(raw, newValue.Interface()); err != nil {
+		return fmt.Errorf("invalid value for job template field \"%s\": %s", name, err)
+	}
+	v.Set(newValue.Elem())
+	return nil
+}
@@ -0,0 +1,102 @@
+package main_test
+
+import (
+	. "github.com/dgruber/ubercluster/cmd/uc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+	"io/ioutil"
+	"os"
+)
+
+var _ = Describe("Template", func() {
+
+	Context("When decoding a job template", func() {
+
+		It("must decode all fields of a YAML job template", func() {
+			jt, err := DecodeJobTemplate([]byte(`
+remoteCommand: /bin/sleep
+args: ["10"]
+jobEnvironment:
+  MY_VAR: value
+minSlots: 4
+minPhysMemory: 1024
+emailOnTerminated: true
+stageInFiles:
+  input.txt: /tmp/input.txt
+resourceLimits:
+  CPU_TIME: "100"
+`))
+			Ω(err).Should(BeNil())
+			Ω(jt.RemoteCommand).Should(Equal("/bin/sleep"))
+			Ω(jt.Args).Should(Equal([]string{"10"}))
+			Ω(jt.JobEnvironment).Should(HaveKeyWithValue("MY_VAR", "value"))
+			Ω(jt.MinSlots).Should(BeNumerically("==", 4))
+			Ω(jt.MinPhysMemory).Should(BeNumerically("==", 1024))
+			Ω(jt.EmailOnTerminated).Should(BeTrue())
+			Ω(jt.StageInFiles).Should(HaveKeyWithValue("input.txt", "/tmp/input.txt"))
+			Ω(jt.ResourceLimits).Should(HaveKeyWithValue("CPU_TIME", "100"))
+		})
+
+		It("must decode a JSON job template", func() {
+			jt, err := DecodeJobTemplate([]byte(`{"remoteCommand": "/bin/date", "priority": 10}`))
+			Ω(err).Should(BeNil())
+			Ω(jt.RemoteCommand).Should(Equal("/bin/date"))
+			Ω(jt.Priority).Should(BeNumerically("==", 10))
+		})
+
+		It("must reject unknown keys", func() {
+			_, err := DecodeJobTemplate([]byte("remoteCommand: /bin/date\nslots: 4\n"))
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.Error()).Should(ContainSubstring("slots"))
+		})
+
+	})
+
+	Context("When setting job template fields", func() {
+
+		It("must convert the values to the type of the field", func() {
+			var jt types.JobTemplate
+			Ω(SetJobTemplateValue(&jt, "jobName=123")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "maxSlots=8")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "submitAsHold=true")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "args=[-c, echo hello]")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "email=me@example.com")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "jobEnvironment.PATH=/bin:/usr/bin")).Should(BeNil())
+			Ω(SetJobTemplateValue(&jt, "deadlineTime=2018-03-01T10:00:00Z")).Should(BeNil())
+			Ω(jt.JobName).Should(Equal("123"))
+			Ω(jt.MaxSlots).Should(BeNumerically("==", 8))
+			Ω(jt.SubmitAsHold).Should(BeTrue())
+			Ω(jt.Args).Should(Equal([]string{"-c", "echo hello"}))
+			Ω(jt.Email).Should(Equal([]string{"me@example.com"}))
+			Ω(jt.JobEnvironment).Should(HaveKeyWithValue("PATH", "/bin:/usr/bin"))
+			Ω(jt.DeadlineTime.Year()).Should(Equal(2018))
+		})
+
+		It("must reject unknown fields and invalid values", func() {
+			var jt types.JobTemplate
+			Ω(SetJobTemplateValue(&jt, "slots=4")).ShouldNot(BeNil())
+			Ω(SetJobTemplateValue(&jt, "maxSlots=many")).ShouldNot(BeNil())
+			Ω(SetJobTemplateValue(&jt, "jobName.x=y")).ShouldNot(BeNil())
+			Ω(SetJobTemplateValue(&jt, "jobName")).ShouldNot(BeNil())
+		})
+
+		It("must apply the overrides on top of the template file", func() {
+			file, err := ioutil.TempFile("", "jobtemplate")
+			Ω(err).Should(BeNil())
+			defer os.Remove(file.Name())
+			_, err = file.WriteString("remoteCommand: /bin/sleep\nqueueName: all.q\n")
+			Ω(err).Should(BeNil())
+			file.Close()
+
+			jt, err := LoadJobTemplate(file.Name(), []string{"queueName=big.q"})
+			Ω(err).Should(BeNil())
+			Ω(jt.RemoteCommand).Should(Equal("/bin/sleep"))
+			Ω(jt.QueueName).Should(Equal("big.q"))
+		})
+
+	})
+
+})
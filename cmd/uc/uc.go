@@ -18,12 +18,16 @@ package main
 
 import (
 	"fmt"
+	"github.com/dgruber/ubercluster/pkg/client"
 	"github.com/dgruber/ubercluster/pkg/output"
+	"github.com/dgruber/ubercluster/pkg/proxy"
 	"github.com/dgruber/ubercluster/pkg/staging"
 	"gopkg.in/alecthomas/kingpin.v1"
 	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Disable logging by default
@@ -36,10 +40,16 @@ var (
 	verbose   = app.Flag("verbose", "Enables enhanced logging for debugging.").Bool()
 	cluster   = app.Flag("cluster", "Cluster name to interact with.").Default("default").String()
 	otp       = app.Flag("otp", "One time password (\"yubikey\") or shared secret.").Default("").String()
-	outformat = app.Flag("format", "Output format specifier (default/json).").Default("default").String()
+	outformat = app.Flag("format", "Output format specifier (default/json/xml/yaml/csv/table, template=GOTEMPLATE, jsonpath=EXPRESSION).").Default("default").String()
+	columns   = app.Flag("columns", "Columns of the table and csv format (like id,state,owner,queue,cluster,submitted).").Default("").String()
+	sortBy    = app.Flag("sort-by", "Column the rows of the table and csv format are sorted by.").Default("").String()
+	noHeaders = app.Flag("no-headers", "Omits the column names in the table and csv format.").Bool()
+	session   = app.Flag("session", "Job session to work in (jobs and files of other job sessions are not visible).").Default(proxy.DefaultJobSession).String()
 
 	certFile = app.Flag("cert", "PEM encoded certificate file.").Default("").String()
 	keyFile  = app.Flag("key", "PEM encoded private key file.").Default("").String()
+	caFile   = app.Flag("ca", "PEM encoded CA bundle the certificates of the proxies are verified with.").Default("").String()
+	verify   = app.Flag("verify", "Verification of the proxy certificates (\"ca\", \"tofu\" pins them in ~/.ubercluster/known_proxies, \"insecure\").").Default("").String()
 
 	show               = app.Command("show", "Displays information about connected clusters.")
 	showJob            = show.Command("job", "Information about a particular job.")
@@ -54,6 +64,21 @@ var (
 	showCategoriesName = showCategories.Arg("name", "Name of job category to show.").Default("all").String()
 	showSession        = show.Command("session", "Information about job sessions.")
 	showSessionName    = showSession.Arg("name", "Name of the job session to show.").Default("all").String()
+	showHistory        = show.Command("history", "Finished and running jobs stored in the job history of the proxy.")
+	showHistorySince   = showHistory.Flag("since", "Shows only jobs which ran since (RFC 3339 time or duration like 24h).").Default("").String()
+	showHistoryUntil   = showHistory.Flag("until", "Shows only jobs which ran until (RFC 3339 time or duration like 1h).").Default("").String()
+	showHistoryOwner   = showHistory.Flag("owner", "Shows only jobs of a particular user.").Default("").String()
+	showReservation    = show.Command("reservation", "Information about advance reservations.")
+	showReservationId  = showReservation.Arg("id", "Id of the reservation (all reservations if not set).").Default("").String()
+
+	watch      = app.Command("watch", "Follows state changes in connected clusters.")
+	watchJob   = watch.Command("job", "Prints job state transitions as they happen.")
+	watchJobId = watchJob.Arg("id", "Id of the job to watch (all jobs if not set).").Default("").String()
+
+	logs       = app.Command("logs", "Prints the output of a job.")
+	logsFollow = logs.Flag("follow", "Follows the output until the job is finished.").Short('f').Bool()
+	logsStderr = logs.Flag("stderr", "Prints the error output instead of the standard output.").Bool()
+	logsJobId  = logs.Arg("jobid", "Id of the job.").Required().String()
 
 	run         = app.Command("run", "Submits an application to a cluster.")
 	runCommand  = run.Arg("command", "Command to submit.").Default("#nocommand#").String()
@@ -61,8 +86,25 @@ var (
 	runName     = run.Flag("name", "Reference name of the command.").Default("").String()
 	runQueue    = run.Flag("queue", "Queue name for the job.").Default("").String()
 	runCategory = run.Flag("category", "Job category / job class of the job.").Default("").String()
-	alg         = run.Flag("alg", "Automatic cluster selection when submitting jobs (\"rand\", \"prob\", \"load\")").Default("").String()
+	alg         = run.Flag("alg", "Automatic cluster selection when submitting jobs (\"rand\", \"prob\", \"load\", \"match\")").Default("").String()
 	fileUp      = run.Flag("upload", "Path to job which is uploaded before execution.").Default("").String()
+	runTemplate = run.Flag("template", "YAML or JSON file containing a complete DRMAA2 job template.").Default("").String()
+	runSet      = run.Flag("set", "Sets a job template field (field=value), can be repeated.").Strings()
+	runArray    = run.Flag("array", "Submits a job array with the task range begin-end:step (like 1-1000:1).").Default("").String()
+	runParallel = run.Flag("max-parallel", "Maximum amount of job array tasks running at the same time (0 is unlimited).").Default("0").Int()
+	runReserv   = run.Flag("reservation", "Id of the advance reservation the job runs in.").Default("").String()
+	runHold     = run.Flag("hold", "Submits the job in hold state (start it with \"release job\").").Bool()
+
+	reserve         = app.Command("reserve", "Requests an advance reservation of slots in a cluster.")
+	reserveName     = reserve.Flag("name", "Name of the reservation.").Default("").String()
+	reserveStart    = reserve.Flag("start", "Start time of the reservation (RFC 3339, default is now).").Default("").String()
+	reserveEnd      = reserve.Flag("end", "End time of the reservation (RFC 3339).").Default("").String()
+	reserveDuration = reserve.Flag("duration", "Duration of the reservation (like 2h) when no end time is set.").Default("0s").Duration()
+	reserveSlots    = reserve.Flag("slots", "Amount of slots to reserve.").Default("1").Int64()
+	reserveMaxSlots = reserve.Flag("max-slots", "Maximum amount of slots to reserve.").Default("0").Int64()
+	reserveCategory = reserve.Flag("category", "Job category of the jobs running in the reservation.").Default("").String()
+	reserveMachines = reserve.Flag("machine", "Candidate machine for the reservation, can be repeated.").Strings()
+	reserveUsers    = reserve.Flag("user", "User who is allowed to use the reservation, can be repeated.").Strings()
 
 	runlocal        = app.Command("runlocal", "Runs a command as child of the proxy.")
 	runlocalCommand = runlocal.Arg("command", "Command to run.").Required().String()
@@ -81,6 +123,22 @@ var (
 	resumeJob   = resume.Command("job", "Resumes a suspended job in a cluster.")
 	resumeJobId = resumeJob.Arg("jobid", "Id of the job to resume.").Default("").String()
 
+	hold      = app.Command("hold", "Hold operation.")
+	holdJob   = hold.Command("job", "Holds a queued job in a cluster so that it is not started.")
+	holdJobId = holdJob.Arg("jobid", "Id of the job to hold.").Default("").String()
+
+	release      = app.Command("release", "Release operation.")
+	releaseJob   = release.Command("job", "Releases a held job in a cluster.")
+	releaseJobId = releaseJob.Arg("jobid", "Id of the job to release.").Default("").String()
+
+	migrate      = app.Command("migrate", "Migrate operation.")
+	migrateJob   = migrate.Command("job", "Moves a queued or held job (with its staged input files) to another cluster.")
+	migrateJobId = migrateJob.Arg("jobid", "Id of the job to migrate (in the cluster given by --cluster).").Required().String()
+	migrateJobTo = migrateJob.Flag("to", "Cluster to migrate the job to. Default is the cluster with the lowest load.").Default("").String()
+
+	terminateReservation   = terminate.Command("reservation", "Terminates an advance reservation in a cluster.")
+	terminateReservationId = terminateReservation.Arg("id", "Id of the reservation to terminate.").Required().String()
+
 	// filestaging interface
 	fs          = app.Command("fs", "Filesystem interface")
 	fsLs        = fs.Command("ls", "List all files in staging area.")
@@ -89,15 +147,84 @@ var (
 	fsDown      = fs.Command("down", "Download files from staging area.")
 	fsDownFiles = fsDown.Arg("files", "Filenames to download from staging area.").Required().Strings()
 
+	// job sessions
+	sessionCmd    = app.Command("session", "Job sessions (isolated namespaces for jobs and files) on a cluster.")
+	sessionCreate = sessionCmd.Command("create", "Creates a job session.")
+	sessionCrName = sessionCreate.Arg("name", "Name of the job session.").Required().String()
+	sessionRm     = sessionCmd.Command("rm", "Removes a job session and its staging area.")
+	sessionRmName = sessionRm.Arg("name", "Name of the job session.").Required().String()
+	sessionLs     = sessionCmd.Command("ls", "Lists all job sessions.")
+
 	// configuration
-	cfg     = app.Command("config", "Configuration of cluster proxies.")
-	cfgList = cfg.Command("list", "Lists all configured cluster proxies.")
+	cfg               = app.Command("config", "Configuration of cluster proxies.")
+	cfgFile           = cfg.Flag("file", "Configuration file (.json, .yaml, .yml, or .toml). Default is the file uc reads.").Default("").String()
+	cfgList           = cfg.Command("list", "Lists all configured cluster proxies.")
+	cfgListTag        = cfgList.Flag("tag", "Lists only clusters with that tag.").Default("").String()
+	cfgInit           = cfg.Command("init", "Creates a configuration file (default is $HOME/.ubercluster/config.json).")
+	cfgInitAddress    = cfgInit.Flag("address", "Address of the proxy of the default cluster.").Default("http://localhost:8888/").String()
+	cfgInitForce      = cfgInit.Flag("force", "Replaces an existing configuration file.").Bool()
+	cfgAdd            = cfg.Command("add", "Adds a cluster proxy to the configuration.")
+	cfgAddName        = cfgAdd.Arg("name", "Name of the cluster.").Required().String()
+	cfgAddAddress     = cfgAdd.Arg("address", "Address of the proxy (like http://localhost:8888/).").Required().String()
+	cfgAddVersion     = cfgAdd.Flag("version", "Protocol version of the proxy.").Default("v1").String()
+	cfgAddDescription = cfgAdd.Flag("description", "Description of the cluster.").Default("").String()
+	cfgAddTags        = cfgAdd.Flag("tag", "Tag of the cluster, can be repeated.").Strings()
+	cfgAddQueue       = cfgAdd.Flag("queue", "Queue of submitted jobs if none is requested.").Default("").String()
+	cfgAddCategory    = cfgAdd.Flag("category", "Job category of submitted jobs if none is requested.").Default("").String()
+	cfgAddTimeout     = cfgAdd.Flag("timeout", "Deadline of requests to the proxy (like 30s).").Default("").String()
+	cfgAddCredential  = cfgAdd.Flag("credential", "Shared secret of the proxy (secret:VALUE, env:NAME, file:PATH, or yubikey).").Default("").String()
+	cfgAddCertFile    = cfgAdd.Flag("client-cert", "PEM encoded client certificate for the proxy.").Default("").String()
+	cfgAddKeyFile     = cfgAdd.Flag("client-key", "PEM encoded private key of the client certificate.").Default("").String()
+	cfgAddCAFile      = cfgAdd.Flag("ca", "PEM encoded CA bundle for verifying the proxy certificate.").Default("").String()
+	cfgAddServerName  = cfgAdd.Flag("server-name", "Name in the proxy certificate if it differs from the host.").Default("").String()
+	cfgAddVerify      = cfgAdd.Flag("verify", "Verification of the proxy certificate (ca, tofu, or insecure).").Default("").String()
+	cfgRemove         = cfg.Command("remove", "Removes a cluster proxy from the configuration.")
+	cfgRemoveName     = cfgRemove.Arg("name", "Name of the cluster.").Required().String()
+	cfgSetDefault     = cfg.Command("set-default", "Sets the cluster used when no cluster is given.")
+	cfgSetDefaultName = cfgSetDefault.Arg("name", "Name of the cluster.").Required().String()
+	cfgRename         = cfg.Command("rename", "Renames a cluster.")
+	cfgRenameOld      = cfgRename.Arg("name", "Name of the cluster.").Required().String()
+	cfgRenameNew      = cfgRename.Arg("newname", "New name of the cluster.").Required().String()
+	cfgShow           = cfg.Command("show", "Shows the settings of a cluster or of the configuration file.")
+	cfgShowName       = cfgShow.Arg("name", "Name of the cluster.").Default("").String()
+	cfgValidate       = cfg.Command("validate", "Checks the configuration file.")
 
 	// uc as proxy itself
-	incpt     = app.Command("inception", "Run uc as compatible proxy itself. Allows to create trees of clusters.")
-	incptPort = incpt.Arg("port", "Address to bind uc http server to.").Default(":8989").String()
+	incpt         = app.Command("inception", "Run uc as compatible proxy itself. Allows to create trees of clusters.")
+	incptPort     = incpt.Arg("port", "Address to bind uc http server to.").Default(":8989").String()
+	incptAlg      = incpt.Flag("alg", "Cluster selection for submitted jobs (rand, prob, load, match). Default is the \"default\" cluster.").Default("").String()
+	incptRoutes   = incpt.Flag("routes", "File which stores the routing table of the submitted jobs.").Default("inception.db").String()
+	incptID       = incpt.Flag("id", "Id of uc in the visited path of forwarded requests. Default is host name and port.").Default("").String()
+	incptMaxDepth = incpt.Flag("max-depth", "Maximum amount of inception proxies a request may pass.").Default(strconv.Itoa(DefaultMaxDepth)).Int()
+	incptTimeout  = incpt.Flag("timeout", "Deadline of requests to the connected clusters.").Default(DefaultClusterTimeout.String()).Duration()
+	incptCacheTTL = incpt.Flag("cache-ttl", "How long machines, queues, and categories of the connected clusters are cached (0 disables the cache).").Default(DefaultCacheTTL.String()).Duration()
+	incptMetrics  = incpt.Flag("metrics-auth", "Protection of /metrics: empty for the same as all other requests, \"none\", or a shared secret (sent as bearer token).").Default("").String()
 )
 
+// MakeOutputFormater creates the output formater of the format. The
+// table and csv formats use the columns, sorting, and headers given on
+// the command line. Jobs without cluster in their id are shown as jobs
+// of the given cluster.
+func MakeOutputFormater(format, clustername string) output.OutputFormater {
+	var cols []string
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+	}
+	options := output.TableOptions{
+		Columns:   cols,
+		SortBy:    *sortBy,
+		NoHeaders: *noHeaders,
+		Cluster:   clustername,
+	}
+	switch strings.ToLower(format) {
+	case "table":
+		return output.NewTableFormat(os.Stdout, options)
+	case "csv":
+		return output.NewCSVFormat(os.Stdout, options)
+	}
+	return output.MakeOutputFormater(format)
+}
+
 func main() {
 	arguments := os.Args[1:]
 	if len(arguments) == 0 {
@@ -110,14 +237,18 @@ func main() {
 		log.SetOutput(os.Stdout)
 	}
 
+	// the configuration commands work on the configuration file
+	if strings.HasPrefix(p, cfg.FullCommand()+" ") {
+		configCommand(p)
+		return
+	}
+
 	// read in configuration
 	ReadConfig()
 
-	// output can be produced in different formats
-	of := output.MakeOutputFormater(*outformat)
-
 	// read in one time password in case of yubikey
 	var yubi bool
+	otpGiven := *otp != ""
 	if *otp == "yubikey" {
 		yubi = true
 		*otp = GetYubiKeyOrExit()
@@ -125,59 +256,158 @@ func main() {
 		yubi = false
 	}
 
-	r := NewRequest(*certFile, *keyFile, otp)
+	tlsConfig := client.TLSConfig{CertFile: *certFile, KeyFile: *keyFile, CAFile: *caFile, Verify: *verify}
+	r, err := NewTLSRequest(tlsConfig, otp)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	r.auth.Yubikey = GetYubiKey
 
 	// based on cluster name or selection algorithm
-	// create the address to send requests
-	clusteraddress, clustername, err := r.SelectClusterAddress(*cluster, *alg)
+	// create the address to send requests (the matching
+	// algorithm selects the cluster when the job is known)
+	selectionAlg := *alg
+	if isMatchingScheduler(selectionAlg) {
+		selectionAlg = ""
+	}
+	clusteraddress, clustername, err := r.SelectClusterAddress(*cluster, selectionAlg)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	clusterconfig, _ := config.FindCluster(clustername)
+	if usesYubi, err := r.UseClusterSettings(clusterconfig, otpGiven); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	} else if usesYubi {
+		yubi = true
+	}
 
-	fs := staging.NewFilesystem(r.client)
+	// output can be produced in different formats
+	of := MakeOutputFormater(*outformat, clustername)
+
+	hc, err := r.HTTPClient(clusterconfig)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	fs := staging.NewFilesystem(hc)
 
 	switch p {
 	case showJob.FullCommand():
 		if showJobId != nil && *showJobId != "" {
 			log.Println("showJobId: ", *showJobId)
-			r.ShowJobDetails(clusteraddress, *showJobId, of)
+			r.ShowJobDetails(clusteraddress, *showJobId, yubi, of)
 		} else {
-			r.ShowJobs(clusteraddress, *showJobStateId, *showJobUser, of)
+			r.ShowJobs(clusteraddress, *session, *showJobStateId, *showJobUser, of)
+		}
+	case watchJob.FullCommand():
+		r.WatchJobs(clusteraddress, *watchJobId, of)
+	case logs.FullCommand():
+		stream := "stdout"
+		if *logsStderr {
+			stream = "stderr"
 		}
-	case cfgList.FullCommand():
-		listConfig(clusteraddress)
+		r.ShowJobOutput(clusteraddress, *session, *logsJobId, stream, *logsFollow)
+	case sessionCreate.FullCommand():
+		r.CreateJobSession(clusteraddress, *sessionCrName, of)
+	case sessionRm.FullCommand():
+		r.DestroyJobSession(clusteraddress, *sessionRmName, of)
+	case sessionLs.FullCommand():
+		r.ShowJobSessions(clusteraddress, "all", of)
 	case showMachine.FullCommand():
 		r.ShowMachines(clusteraddress, *showMachineName, of)
 	case showQueue.FullCommand():
 		r.ShowQueues(clusteraddress, *showQueueName, of)
 	case showCategories.FullCommand():
-		r.ShowJobCategories(clusteraddress, "ubercluster", *showCategoriesName)
+		r.ShowJobCategories(clusteraddress, *session, *showCategoriesName, of)
 	case showSession.FullCommand():
-		r.ShowJobSessions(clusteraddress, *showSessionName)
+		r.ShowJobSessions(clusteraddress, *showSessionName, of)
+	case showHistory.FullCommand():
+		r.ShowJobHistory(clusteraddress, *showHistorySince, *showHistoryUntil, *showHistoryOwner, of)
+	case showReservation.FullCommand():
+		r.ShowReservations(clusteraddress, *session, *showReservationId, of)
+	case reserve.FullCommand():
+		rt, err := CreateReservationTemplate(*reserveName, *reserveStart, *reserveEnd, *reserveDuration,
+			*reserveSlots, *reserveMaxSlots, *reserveCategory, *reserveMachines, *reserveUsers)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		r.RequestReservation(clusteraddress, *session, rt, of)
+	case terminateReservation.FullCommand():
+		r.TerminateReservation(clusteraddress, *session, *terminateReservationId, of)
 	case run.FullCommand():
+		jt, err := LoadJobTemplate(*runTemplate, *runSet)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		jt = r.CreateJobRequest(jt, *runName, *runCommand, *runArg, *runQueue, *runCategory)
+		if isMatchingScheduler(*alg) {
+			clusteraddress, clustername, err = r.MatchClusterAddress(jt)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			clusterconfig, _ = config.FindCluster(clustername)
+			if usesYubi, err := r.UseClusterSettings(clusterconfig, otpGiven); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			} else if usesYubi {
+				yubi = true
+			}
+			hc, err := r.HTTPClient(clusterconfig)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			fs = staging.NewFilesystem(hc)
+		}
+		clusterconfig.ApplyDefaults(&jt)
 		if *fileUp != "" {
-			fs.FsUploadFile(*otp, clusteraddress, "ubercluster", *fileUp)
+			fs.FsUploadFile(*otp, clusteraddress, *session, *fileUp)
+			if *outformat == "default" {
+				fmt.Println("Uploaded file ", *fileUp)
+			}
 			if yubi {
 				*otp = GetYubiKeyOrExit() // we need another one time password for submission
 			}
 		}
-		r.SubmitJob(clusteraddress, clustername, *runName, *runCommand, *runArg, *runQueue, *runCategory, *otp)
+		if *runReserv != "" {
+			jt.ReservationId = *runReserv
+		}
+		if *runHold {
+			jt.SubmitAsHold = true
+		}
+		if *runArray != "" {
+			r.SubmitArrayJob(clusteraddress, clustername, *session, jt, *runArray, *runParallel, *otp, of)
+		} else {
+			r.SubmitJob(clusteraddress, clustername, *session, jt, *otp, of)
+		}
 	case runlocal.FullCommand():
-		r.RunLocalRequest(*otp, clusteraddress, *runlocalCommand, *runlocalArg)
+		r.RunLocalRequest(*otp, clusteraddress, *runlocalCommand, *runlocalArg, of)
 	case terminateJob.FullCommand():
-		r.PerformOperation(clusteraddress, "ubercluster", "terminate", *terminateJobId)
+		r.PerformOperation(clusteraddress, *session, "terminate", *terminateJobId, of)
 	case suspendJob.FullCommand():
-		r.PerformOperation(clusteraddress, "ubercluster", "suspend", *suspendJobId)
+		r.PerformOperation(clusteraddress, *session, "suspend", *suspendJobId, of)
 	case resumeJob.FullCommand():
-		r.PerformOperation(clusteraddress, "ubercluster", "resume", *resumeJobId)
+		r.PerformOperation(clusteraddress, *session, "resume", *resumeJobId, of)
+	case holdJob.FullCommand():
+		r.PerformOperation(clusteraddress, *session, "hold", *holdJobId, of)
+	case releaseJob.FullCommand():
+		r.PerformOperation(clusteraddress, *session, "release", *releaseJobId, of)
+	case migrateJob.FullCommand():
+		r.MigrateJobRequest(clusteraddress, clustername, *migrateJobTo, *session, *migrateJobId, of)
 	case fsLs.FullCommand():
-		fs.FsListFiles(*otp, clusteraddress, "ubercluster", of)
+		fs.FsListFiles(*otp, clusteraddress, *session, of)
 	case fsUp.FullCommand():
-		fs.FsUploadFiles(*otp, clusteraddress, "ubercluster", *fsUpFiles, of)
+		fs.FsUploadFiles(*otp, clusteraddress, *session, *fsUpFiles, of)
 	case fsDown.FullCommand():
-		fs.FsDownloadFiles(*otp, clusteraddress, "ubercluster", *fsDownFiles, of)
+		fs.FsDownloadFiles(*otp, clusteraddress, *session, *fsDownFiles, of)
 	case incpt.FullCommand():
-		inceptionMode(*certFile, *keyFile, *otp, *incptPort)
+		inceptionMode(tlsConfig, *otp, *incptPort, *incptAlg, *incptRoutes, *incptID, *incptMaxDepth,
+			*incptTimeout, *incptCacheTTL, *incptMetrics)
 	}
 }
@@ -16,13 +16,12 @@ func GetYubiKey() (string, error) {
 	} else {
 		return string(pw), nil
 	}
-	return "", nil
 }
 
 func GetYubiKeyOrExit() string {
 	key, err := GetYubiKey()
 	if err != nil {
-		fmt.Printf("Error reading in yubikey password from stdin: \n", err)
+		fmt.Printf("Error reading in yubikey password from stdin: %s\n", err)
 		os.Exit(1)
 	}
 	return key
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// ErrEmptyResponse is returned when the proxy answered the request
+// successfully but did not send any content.
+var ErrEmptyResponse = errors.New("empty response from proxy")
+
+// Error is returned when a proxy answers a request with an http
+// status code which signals a failure. Code, Message, and Details
+// are taken from the JSON encoded error response of the proxy. For
+// proxies which don't send an error response the Message is the body
+// of the answer.
+type Error struct {
+	StatusCode int               // http status code returned by the proxy
+	Code       string            // error code (like types.ErrorCodeNotFound)
+	Message    string            // description of the failure
+	Details    map[string]string // additional information (like the job id)
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Details) == 0 {
+		return msg
+	}
+	keys := make([]string, 0, len(e.Details))
+	for key := range e.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	details := make([]string, 0, len(keys))
+	for _, key := range keys {
+		details = append(details, fmt.Sprintf("%s=%s", key, e.Details[key]))
+	}
+	return fmt.Sprintf("%s [%s]", msg, strings.Join(details, " "))
+}
+
+// IsNotFound returns true when the error is an answer of the proxy
+// that the requested object (like a job) does not exist.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// PartialResultError is returned together with the result when the
+// proxy collects its result from other proxies (like uc in inception
+// mode) and some of them were not reachable.
+type PartialResultError struct {
+	Unreachable []string // names of the proxies which did not answer
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("incomplete result, unreachable: %s", strings.Join(e.Unreachable, ", "))
+}
+
+// IsPartialResult returns true when the error signals that the result
+// returned with it is incomplete.
+func IsPartialResult(err error) bool {
+	_, ok := err.(*PartialResultError)
+	return ok
+}
+
+// Client accesses one ubercluster proxy. The address is the base
+// URL of the proxy including the protocol version (like
+// http://localhost:8888/v1).
+type Client struct {
+	address string
+	otp     func() (string, error)
+	hops    *types.Hops
+	peer    string
+	secret  string
+	client  *http.Client
+}
+
+// New creates a client for the proxy reachable at the given address.
+// When httpClient is nil the http.DefaultClient is used.
+func New(address string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		address: strings.TrimSuffix(address, "/"),
+		client:  httpClient,
+	}
+}
+
+// Address returns the base URL of the proxy.
+func (c *Client) Address() string {
+	return c.address
+}
+
+// HTTPClient returns the underlying http client.
+func (c *Client) HTTPClient() *http.Client {
+	return c.client
+}
+
+// SetOTP sets a fixed shared secret which is sent with each request.
+func (c *Client) SetOTP(otp string) {
+	if otp == "" {
+		c.otp = nil
+		return
+	}
+	c.otp = func() (string, error) { return otp, nil }
+}
+
+// SetOTPFunc sets a function which is called before each request
+// for getting a one time password (like a yubikey OTP).
+func (c *Client) SetOTPFunc(f func() (string, error)) {
+	c.otp = f
+}
+
+// SetHops sets the request id and the visited proxies which are sent
+// with each request. Proxies which forward requests to other proxies
+// use it for detecting loops.
+func (c *Client) SetHops(hops types.Hops) {
+	c.hops = &hops
+}
+
+// SetPeer sets the id of the proxy and the secret it shares with the
+// peer which are sent with each request when jobs are exchanged
+// between proxies.
+func (c *Client) SetPeer(id, secret string) {
+	c.peer = id
+	c.secret = secret
+}
+
+// newRequest creates an http request for the given path (relative
+// to the address of the proxy) and adds the one time password.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.otp != nil {
+		otp, err := c.otp()
+		if err != nil {
+			return nil, fmt.Errorf("can not get one time password: %s", err)
+		}
+		if otp != "" {
+			query.Set("otp", otp)
+		}
+	}
+	u := c.address + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.hops != nil {
+		req.Header.Set(types.RequestIDHeader, c.hops.RequestID)
+		req.Header.Set(types.VisitedHeader, strings.Join(c.hops.Visited, ","))
+	}
+	if c.peer != "" {
+		req.Header.Set(types.PeerHeader, c.peer)
+	}
+	if c.secret != "" {
+		req.Header.Set(types.PeerSecretHeader, c.secret)
+	}
+	return req.WithContext(ctx), nil
+}
+
+// do sends the request and turns non 2xx answers into an *Error.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var errResp types.ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Message != "" {
+			return nil, &Error{
+				StatusCode: resp.StatusCode,
+				Code:       errResp.Code,
+				Message:    errResp.Message,
+				Details:    errResp.Details,
+			}
+		}
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+	return resp, nil
+}
+
+// decode reads a JSON encoded answer into v.
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		if err == io.EOF {
+			return ErrEmptyResponse
+		}
+		return fmt.Errorf("can not decode answer of proxy: %s", err)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	req, err := c.newRequest(ctx, "GET", path, query, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	unreachable := resp.Header.Get(types.UnreachableHeader)
+	if err := decode(resp, v); err != nil {
+		return err
+	}
+	if unreachable != "" {
+		return &PartialResultError{Unreachable: strings.Split(unreachable, ",")}
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	req, err := c.newRequest(ctx, "POST", path, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return decode(resp, out)
+}
+
+func (c *Client) delete(ctx context.Context, path string, v interface{}) error {
+	req, err := c.newRequest(ctx, "DELETE", path, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	return decode(resp, v)
+}
@@ -0,0 +1,250 @@
+package client_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/proxy"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// fakeProxy implements the proxy.ProxyImplementer interface.
+type fakeProxy struct {
+	template types.JobTemplate
+}
+
+func (f *fakeProxy) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
+	jobs := []types.JobInfo{
+		{Id: "1", State: types.Running, JobOwner: "user"},
+		{Id: "2", State: types.Done, JobOwner: "other"},
+	}
+	if filtered == false {
+		return jobs
+	}
+	filteredJobs := make([]types.JobInfo, 0, len(jobs))
+	for _, j := range jobs {
+		if j.State == filter.State || j.JobOwner == filter.JobOwner {
+			filteredJobs = append(filteredJobs, j)
+		}
+	}
+	return filteredJobs
+}
+
+func (f *fakeProxy) GetJobInfo(jobid string) *types.JobInfo {
+	if jobid == "1" {
+		return &types.JobInfo{Id: "1", State: types.Running}
+	}
+	return nil
+}
+
+func (f *fakeProxy) GetAllMachines(machines []string) ([]types.Machine, error) {
+	return []types.Machine{{Name: "host"}}, nil
+}
+
+func (f *fakeProxy) GetAllQueues(queues []string) ([]types.Queue, error) {
+	return []types.Queue{{Name: "all.q"}}, nil
+}
+
+func (f *fakeProxy) GetAllCategories() ([]string, error) {
+	return []string{"a", "b"}, nil
+}
+
+func (f *fakeProxy) GetAllSessions(session []string) ([]string, error) {
+	return []string{"ubercluster"}, nil
+}
+
+func (f *fakeProxy) DRMSVersion() string { return "1.0" }
+func (f *fakeProxy) DRMSName() string    { return "fake" }
+func (f *fakeProxy) DRMSLoad() float64   { return 0.25 }
+
+func (f *fakeProxy) RunJob(template types.JobTemplate) (string, error) {
+	f.template = template
+	return "13", nil
+}
+
+func (f *fakeProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	if jobid != "1" {
+		return "", proxy.ErrJobNotFound
+	}
+	return "success", nil
+}
+
+var _ = Describe("Client", func() {
+
+	var (
+		server *httptest.Server
+		fake   *fakeProxy
+		c      *Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		fake = &fakeProxy{}
+		var pi persistency.DummyPersistency
+		router := proxy.NewProxyRouter(fake, proxy.SecConfig{OTP: "secret"}, &pi)
+		server = httptest.NewServer(router)
+		c = New(server.URL+"/v1", nil)
+		c.SetOTP("secret")
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	Context("monitoring session", func() {
+
+		It("should return all job infos", func() {
+			jobs, err := c.GetJobInfos(ctx, "all", "")
+			Ω(err).Should(BeNil())
+			Ω(jobs).Should(HaveLen(2))
+		})
+
+		It("should filter job infos by state", func() {
+			jobs, err := c.GetJobInfos(ctx, "r", "")
+			Ω(err).Should(BeNil())
+			Ω(jobs).Should(HaveLen(1))
+			Ω(jobs[0].Id).Should(Equal("1"))
+		})
+
+		It("should return a particular job info", func() {
+			job, err := c.GetJobInfo(ctx, "1")
+			Ω(err).Should(BeNil())
+			Ω(job.State).Should(Equal(types.Running))
+		})
+
+		It("should return machines, queues and DRMS details", func() {
+			machines, err := c.GetMachines(ctx, "all")
+			Ω(err).Should(BeNil())
+			Ω(machines[0].Name).Should(Equal("host"))
+
+			queues, err := c.GetQueues(ctx, "all.q")
+			Ω(err).Should(BeNil())
+			Ω(queues[0].Name).Should(Equal("all.q"))
+
+			name, err := c.DRMSName(ctx)
+			Ω(err).Should(BeNil())
+			Ω(name).Should(Equal("fake"))
+
+			version, err := c.DRMSVersion(ctx)
+			Ω(err).Should(BeNil())
+			Ω(version).Should(Equal("1.0"))
+
+			load, err := c.DRMSLoad(ctx)
+			Ω(err).Should(BeNil())
+			Ω(load).Should(BeNumerically("==", 0.25))
+		})
+
+	})
+
+	Context("job session", func() {
+
+		It("should submit a job", func() {
+			jobid, err := c.RunJob(ctx, "ubercluster", types.JobTemplate{
+				RemoteCommand: "/bin/sleep",
+				Args:          []string{"1"},
+			})
+			Ω(err).Should(BeNil())
+			Ω(jobid).Should(Equal("13"))
+			Ω(fake.template.RemoteCommand).Should(Equal("/bin/sleep"))
+		})
+
+		It("should perform job operations", func() {
+			out, err := c.JobOperation(ctx, "ubercluster", "suspend", "1")
+			Ω(err).Should(BeNil())
+			Ω(out).Should(Equal("success"))
+		})
+
+		It("should return job categories and sessions", func() {
+			cats, err := c.GetJobCategories(ctx, "ubercluster")
+			Ω(err).Should(BeNil())
+			Ω(cats).Should(Equal([]string{"a", "b"}))
+
+			cat, err := c.GetJobCategory(ctx, "ubercluster", "b")
+			Ω(err).Should(BeNil())
+			Ω(cat).Should(Equal("b"))
+
+			_, err = c.GetJobCategory(ctx, "ubercluster", "unknown")
+			Ω(IsNotFound(err)).Should(BeTrue())
+
+			sessions, err := c.GetJobSessions(ctx)
+			Ω(err).Should(BeNil())
+			Ω(sessions).Should(Equal([]string{"ubercluster"}))
+		})
+
+	})
+
+	Context("file staging", func() {
+
+		It("should upload, list and download a file", func() {
+			tmp, err := ioutil.TempFile("", "clienttest")
+			Ω(err).Should(BeNil())
+			defer os.Remove(tmp.Name())
+			tmp.WriteString("content")
+			tmp.Close()
+
+			err = c.UploadFile(ctx, "ubercluster", tmp.Name(), true)
+			Ω(err).Should(BeNil())
+
+			files, err := c.ListFiles(ctx, "ubercluster")
+			Ω(err).Should(BeNil())
+			Ω(files).Should(HaveLen(1))
+			Ω(files[0].Bytes).Should(BeNumerically("==", 7))
+
+			var buf bytes.Buffer
+			n, err := c.DownloadFile(ctx, "ubercluster", files[0].Filename, &buf)
+			Ω(err).Should(BeNil())
+			Ω(n).Should(BeNumerically("==", 7))
+			Ω(buf.String()).Should(Equal("content"))
+		})
+
+	})
+
+	Context("error cases", func() {
+
+		It("should return an error when the secret is wrong", func() {
+			c.SetOTP("wrong")
+			_, err := c.GetJobInfos(ctx, "all", "")
+			Ω(err).ShouldNot(BeNil())
+			clientErr, ok := err.(*Error)
+			Ω(ok).Should(BeTrue())
+			Ω(clientErr.StatusCode).Should(Equal(http.StatusUnauthorized))
+			Ω(clientErr.Code).Should(Equal(types.ErrorCodeUnauthorized))
+		})
+
+		It("should decode the error response of the proxy", func() {
+			_, err := c.GetJobInfo(ctx, "unknown")
+			Ω(err).ShouldNot(BeNil())
+			clientErr, ok := err.(*Error)
+			Ω(ok).Should(BeTrue())
+			Ω(clientErr.StatusCode).Should(Equal(http.StatusNotFound))
+			Ω(clientErr.Code).Should(Equal(types.ErrorCodeNotFound))
+			Ω(clientErr.Details).Should(HaveKeyWithValue("jobid", "unknown"))
+			Ω(err.Error()).Should(ContainSubstring("jobid=unknown"))
+
+			_, err = c.JobOperation(ctx, "ubercluster", "suspend", "2")
+			Ω(err).ShouldNot(BeNil())
+			Ω(IsNotFound(err)).Should(BeTrue())
+		})
+
+		It("should return an error when the context is canceled", func() {
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err := c.DRMSName(canceled)
+			Ω(err).ShouldNot(BeNil())
+		})
+
+	})
+
+})
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// PushJob submits a job in a peer proxy which accepts jobs distributed
+// by this proxy and returns the job ID in the peer.
+func (c *Client) PushJob(ctx context.Context, job types.DistributedJob) (string, error) {
+	var result types.RunJobResult
+	if err := c.post(ctx, "/distribution/push", job, &result); err != nil {
+		return "", err
+	}
+	return result.JobId, nil
+}
+
+// FetchJob takes a pending job from a peer proxy. When the peer has no
+// pending job false is returned. The job has to be confirmed with
+// ConfirmFetchedJob after it was submitted.
+func (c *Client) FetchJob(ctx context.Context) (types.DistributedJob, bool, error) {
+	var job types.DistributedJob
+	err := c.post(ctx, "/distribution/fetch", nil, &job)
+	if IsNotFound(err) {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+	return job, true, nil
+}
+
+// ConfirmFetchedJob tells the peer proxy that the fetched job was
+// submitted as job newid so that the peer terminates its job. When
+// the peer already started the job an error is returned.
+func (c *Client) ConfirmFetchedJob(ctx context.Context, jobid, newid string) error {
+	var answer string
+	return c.post(ctx, "/distribution/fetched/"+url.PathEscape(jobid), types.FetchConfirmation{JobId: newid}, &answer)
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// RunJob submits a job described by the job template in the given
+// job session and returns the job ID.
+func (c *Client) RunJob(ctx context.Context, jsession string, jt types.JobTemplate) (string, error) {
+	var result types.RunJobResult
+	path := fmt.Sprintf("/jsession/%s/run", url.PathEscape(jsession))
+	if err := c.post(ctx, path, jt, &result); err != nil {
+		return "", err
+	}
+	return result.JobId, nil
+}
+
+// runBulkJobsResult is the answer of the proxy after a successful
+// job array submission (see proxy.RunBulkJobsResult).
+type runBulkJobsResult struct {
+	ArrayJobId string `json:"arrayjobid"`
+}
+
+// RunBulkJobs submits a job array in the given job session and
+// returns the array job ID.
+func (c *Client) RunBulkJobs(ctx context.Context, jsession string, req types.BulkJobRequest) (string, error) {
+	var result runBulkJobsResult
+	path := fmt.Sprintf("/jsession/%s/runbulk", url.PathEscape(jsession))
+	if err := c.post(ctx, path, req, &result); err != nil {
+		return "", err
+	}
+	return result.ArrayJobId, nil
+}
+
+// JobOperation performs an operation (suspend, resume, terminate)
+// on a job and returns the answer of the proxy.
+func (c *Client) JobOperation(ctx context.Context, jsession, operation, jobid string) (string, error) {
+	var answer string
+	path := fmt.Sprintf("/jsession/%s/%s/%s", url.PathEscape(jsession),
+		url.PathEscape(operation), url.PathEscape(jobid))
+	if err := c.post(ctx, path, nil, &answer); err != nil {
+		return "", err
+	}
+	return answer, nil
+}
+
+// GetJobCategories returns all job categories available in the
+// job session. When not all clusters behind the proxy answered the
+// categories are returned with a *PartialResultError.
+func (c *Client) GetJobCategories(ctx context.Context, jsession string) ([]string, error) {
+	var categories []string
+	path := fmt.Sprintf("/jsession/%s/jobcategories", url.PathEscape(jsession))
+	if err := c.get(ctx, path, nil, &categories); err != nil {
+		if IsPartialResult(err) {
+			return categories, err
+		}
+		return nil, err
+	}
+	return categories, nil
+}
+
+// GetJobCategory returns the job category with the given name. If
+// the category does not exist ErrEmptyResponse is returned.
+func (c *Client) GetJobCategory(ctx context.Context, jsession, category string) (string, error) {
+	var cat string
+	path := fmt.Sprintf("/jsession/%s/jobcategory/%s", url.PathEscape(jsession),
+		url.PathEscape(category))
+	err := c.get(ctx, path, nil, &cat)
+	return cat, err
+}
+
+// GetJobSessions returns the names of all job sessions of the proxy.
+func (c *Client) GetJobSessions(ctx context.Context) ([]string, error) {
+	var sessions []string
+	if err := c.get(ctx, "/jsessions", nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// CreateJobSession creates a job session on the proxy. Jobs and files
+// of a job session are not visible in other job sessions.
+func (c *Client) CreateJobSession(ctx context.Context, jsession string) error {
+	var name string
+	return c.post(ctx, "/jsessions", types.JobSessionRequest{Name: jsession}, &name)
+}
+
+// DestroyJobSession removes a job session and its staging area from
+// the proxy. Job sessions with unfinished jobs can not be destroyed.
+func (c *Client) DestroyJobSession(ctx context.Context, jsession string) error {
+	var answer string
+	return c.delete(ctx, "/jsessions/"+url.PathEscape(jsession), &answer)
+}
+
+// GetJobSessionJobInfos returns the job infos of all jobs of the job
+// session. The state (r/q/h/s/R/Rh/d/f/u/all) and user restrict the
+// result when they are not empty.
+func (c *Client) GetJobSessionJobInfos(ctx context.Context, jsession, state, user string) ([]types.JobInfo, error) {
+	query := url.Values{}
+	if state != "" && state != "all" {
+		query.Set("state", state)
+	}
+	if user != "" {
+		query.Set("user", user)
+	}
+	var jobinfos []types.JobInfo
+	path := fmt.Sprintf("/jsession/%s/jobinfos", url.PathEscape(jsession))
+	if err := c.get(ctx, path, query, &jobinfos); err != nil {
+		return nil, err
+	}
+	return jobinfos, nil
+}
+
+// RunLocal starts a command as child process of the proxy and
+// returns the answer of the proxy.
+func (c *Client) RunLocal(ctx context.Context, cmd, arg string) (string, error) {
+	var answer string
+	rlr := types.RunLocalRequest{
+		Command: cmd,
+		Arg:     arg,
+	}
+	if err := c.post(ctx, "/local/run", rlr, &answer); err != nil {
+		return "", err
+	}
+	return answer, nil
+}
+
+// JobOutput returns the output of a job. The stream is either "stdout"
+// or "stderr". When follow is set the reader delivers new output until
+// the job is finished. The caller must close the reader.
+func (c *Client) JobOutput(ctx context.Context, jsession, jobid, stream string, follow bool) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("stream", stream)
+	if follow {
+		query.Set("follow", "true")
+	}
+	path := fmt.Sprintf("/jsession/%s/job/%s/output", url.PathEscape(jsession),
+		url.PathEscape(jobid))
+	req, err := c.newRequest(ctx, "GET", path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// GetJobInfos returns the job infos of all jobs known by the proxy.
+// The state (r/q/h/s/R/Rh/d/f/u/all) and user restrict the result
+// when they are not empty.
+func (c *Client) GetJobInfos(ctx context.Context, state, user string) ([]types.JobInfo, error) {
+	query := url.Values{}
+	if state != "" && state != "all" {
+		query.Set("state", state)
+	}
+	if user != "" {
+		query.Set("user", user)
+	}
+	var jobinfos []types.JobInfo
+	if err := c.get(ctx, "/msession/jobinfos", query, &jobinfos); err != nil {
+		if err == ErrEmptyResponse {
+			return []types.JobInfo{}, nil
+		}
+		return nil, err
+	}
+	return jobinfos, nil
+}
+
+// GetJobInfo returns the job info of a particular job.
+func (c *Client) GetJobInfo(ctx context.Context, jobid string) (types.JobInfo, error) {
+	var jobinfo types.JobInfo
+	err := c.get(ctx, "/msession/jobinfo/"+url.PathEscape(jobid), nil, &jobinfo)
+	return jobinfo, err
+}
+
+// GetArrayJobInfo returns the job array with the given id and the
+// job infos of its tasks.
+func (c *Client) GetArrayJobInfo(ctx context.Context, arrayjobid string) (types.ArrayJobInfo, error) {
+	var aji types.ArrayJobInfo
+	err := c.get(ctx, "/msession/arrayjobinfo/"+url.PathEscape(arrayjobid), nil, &aji)
+	return aji, err
+}
+
+// GetJobHistory returns the jobs stored in the job history of the
+// proxy which ran between since and until and belong to owner. Zero
+// times and an empty owner are not used for filtering.
+func (c *Client) GetJobHistory(ctx context.Context, since, until time.Time, owner string) ([]types.JobHistoryEntry, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	if !until.IsZero() {
+		query.Set("until", until.Format(time.RFC3339))
+	}
+	if owner != "" {
+		query.Set("owner", owner)
+	}
+	var entries []types.JobHistoryEntry
+	if err := c.get(ctx, "/msession/jobhistory", query, &entries); err != nil {
+		if err == ErrEmptyResponse {
+			return []types.JobHistoryEntry{}, nil
+		}
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetJobTemplate returns the job template of a job stored in the job
+// history of the proxy.
+func (c *Client) GetJobTemplate(ctx context.Context, jobid string) (types.JobTemplate, error) {
+	var jt types.JobTemplate
+	err := c.get(ctx, "/msession/jobtemplate/"+url.PathEscape(jobid), nil, &jt)
+	return jt, err
+}
+
+// SaveJobMigration records in the job history of the proxy that the
+// job was migrated from or to another cluster.
+func (c *Client) SaveJobMigration(ctx context.Context, jobid string, migration types.JobMigration) error {
+	var answer string
+	return c.post(ctx, "/msession/jobhistory/"+url.PathEscape(jobid)+"/migration", migration, &answer)
+}
+
+// GetMachines returns the machines of the cluster. If name is not
+// empty or "all" only the machine with that name is returned. When
+// not all clusters behind the proxy answered the machines are returned
+// with a *PartialResultError.
+func (c *Client) GetMachines(ctx context.Context, name string) ([]types.Machine, error) {
+	path := "/msession/machines"
+	if name != "" && name != "all" {
+		path = "/msession/machine/" + url.PathEscape(name)
+	}
+	var machines []types.Machine
+	if err := c.get(ctx, path, nil, &machines); err != nil {
+		if IsPartialResult(err) {
+			return machines, err
+		}
+		return nil, err
+	}
+	return machines, nil
+}
+
+// GetQueues returns the queues of the cluster. If name is not
+// empty or "all" only the queue with that name is returned. When
+// not all clusters behind the proxy answered the queues are returned
+// with a *PartialResultError.
+func (c *Client) GetQueues(ctx context.Context, name string) ([]types.Queue, error) {
+	path := "/msession/queues"
+	if name != "" && name != "all" {
+		path = "/msession/queue/" + url.PathEscape(name)
+	}
+	var queues []types.Queue
+	if err := c.get(ctx, path, nil, &queues); err != nil {
+		if IsPartialResult(err) {
+			return queues, err
+		}
+		return nil, err
+	}
+	return queues, nil
+}
+
+// DRMSName returns the name of the DRM system behind the proxy.
+func (c *Client) DRMSName(ctx context.Context) (string, error) {
+	var name string
+	err := c.get(ctx, "/msession/drmsname", nil, &name)
+	return name, err
+}
+
+// DRMSVersion returns the version of the DRM system behind the proxy.
+func (c *Client) DRMSVersion(ctx context.Context) (string, error) {
+	var version string
+	err := c.get(ctx, "/msession/drmsversion", nil, &version)
+	return version, err
+}
+
+// DRMSLoad returns the load of the cluster (0 is idle, 1 is full).
+func (c *Client) DRMSLoad(ctx context.Context) (float64, error) {
+	var load float64
+	err := c.get(ctx, "/msession/drmsload", nil, &load)
+	return load, err
+}
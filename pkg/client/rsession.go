@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// RequestReservation requests an advance reservation described by
+// the reservation template in the given reservation session and
+// returns the granted reservation.
+func (c *Client) RequestReservation(ctx context.Context, rsession string, rt types.ReservationTemplate) (types.ReservationInfo, error) {
+	var info types.ReservationInfo
+	path := fmt.Sprintf("/rsession/%s/reserve", url.PathEscape(rsession))
+	err := c.post(ctx, path, rt, &info)
+	return info, err
+}
+
+// GetReservations returns all reservations of the reservation session.
+func (c *Client) GetReservations(ctx context.Context, rsession string) ([]types.ReservationInfo, error) {
+	var infos []types.ReservationInfo
+	path := fmt.Sprintf("/rsession/%s/reservations", url.PathEscape(rsession))
+	if err := c.get(ctx, path, nil, &infos); err != nil {
+		if err == ErrEmptyResponse {
+			return []types.ReservationInfo{}, nil
+		}
+		return nil, err
+	}
+	return infos, nil
+}
+
+// GetReservation returns a particular reservation of the
+// reservation session.
+func (c *Client) GetReservation(ctx context.Context, rsession, reservationid string) (types.ReservationInfo, error) {
+	var info types.ReservationInfo
+	path := fmt.Sprintf("/rsession/%s/reservation/%s", url.PathEscape(rsession), url.PathEscape(reservationid))
+	err := c.get(ctx, path, nil, &info)
+	return info, err
+}
+
+// TerminateReservation terminates a reservation.
+func (c *Client) TerminateReservation(ctx context.Context, rsession, reservationid string) error {
+	var answer string
+	path := fmt.Sprintf("/rsession/%s/terminate/%s", url.PathEscape(rsession), url.PathEscape(reservationid))
+	return c.post(ctx, path, nil, &answer)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// ListFiles returns all files in the staging area of the job session.
+func (c *Client) ListFiles(ctx context.Context, jsession string) ([]types.FileInfo, error) {
+	var files []types.FileInfo
+	path := fmt.Sprintf("/jsession/%s/staging/files", url.PathEscape(jsession))
+	if err := c.get(ctx, path, nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetStagingUsage returns the space used in the staging area of the
+// job session and by the client together with the quotas of the proxy.
+func (c *Client) GetStagingUsage(ctx context.Context, jsession string) (types.StagingUsage, error) {
+	var usage types.StagingUsage
+	path := fmt.Sprintf("/jsession/%s/staging/usage", url.PathEscape(jsession))
+	err := c.get(ctx, path, nil, &usage)
+	return usage, err
+}
+
+// UploadFile uploads a local file into the staging area of the job
+// session. When executable is set the file is made executable on
+// the proxy so that it can be used as remote command of a job.
+func (c *Client) UploadFile(ctx context.Context, jsession, filename string, executable bool) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// stream the file instead of holding it in memory
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", filepath.Base(filename))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if executable {
+			writer.WriteField("permission", "exec")
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	path := fmt.Sprintf("/jsession/%s/staging/upload", url.PathEscape(jsession))
+	req, err := c.newRequest(ctx, "POST", path, nil, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := c.do(req)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	var answer string
+	return decode(resp, &answer)
+}
+
+// DownloadFile writes the content of a file from the staging area
+// of the job session into w and returns the amount of bytes written.
+func (c *Client) DownloadFile(ctx context.Context, jsession, name string, w io.Writer) (int64, error) {
+	path := fmt.Sprintf("/jsession/%s/staging/file/%s", url.PathEscape(jsession),
+		url.PathEscape(name))
+	req, err := c.newRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Verification modes of the proxy certificate.
+const (
+	VerifyCA   = "ca"       // verify with the CA bundle or the system CAs (default)
+	VerifyTOFU = "tofu"     // trust on first use: pin the certificate fingerprint in the known proxies file
+	VerifyNone = "insecure" // don't verify the proxy certificate
+)
+
+// TLSConfig contains the TLS settings for the connection to a proxy.
+type TLSConfig struct {
+	CertFile   string // PEM encoded client certificate (mutual TLS)
+	KeyFile    string // PEM encoded private key of the client certificate
+	CAFile     string // PEM encoded CA certificates the proxy certificate is verified with
+	ServerName string // name in the proxy certificate if it differs from the host of the address
+	Verify     string // verification mode of the proxy certificate (VerifyCA if not set)
+	// KnownProxiesFile stores the pinned certificate fingerprints in
+	// VerifyTOFU mode (DefaultKnownProxiesFile if not set).
+	KnownProxiesFile string
+}
+
+// DefaultKnownProxiesFile returns the file which stores the certificate
+// fingerprints of the known proxies ($HOME/.ubercluster/known_proxies).
+func DefaultKnownProxiesFile() string {
+	return filepath.Join(os.Getenv("HOME"), ".ubercluster", "known_proxies")
+}
+
+// NewHTTPClient creates an http client which authenticates with the
+// given PEM encoded certificate and key at the proxy (mutual TLS).
+// Without certificate and key a client for plain http or server-side
+// TLS is returned. The certificate of the proxy is verified with the
+// CAs of the system.
+func NewHTTPClient(certFile, keyFile string) (*http.Client, error) {
+	return NewTLSHTTPClient(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+}
+
+// NewTLSHTTPClient creates an http client with the given TLS settings.
+func NewTLSHTTPClient(tc TLSConfig) (*http.Client, error) {
+	config := &tls.Config{
+		ServerName: tc.ServerName,
+	}
+	if tc.CertFile != "" && tc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key pair: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if tc.CAFile != "" {
+		pem, err := ioutil.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open CA bundle: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", tc.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	tr := &http.Transport{
+		MaxIdleConns:       10,
+		IdleConnTimeout:    30 * time.Second,
+		DisableCompression: false,
+		TLSClientConfig:    config,
+	}
+	switch tc.Verify {
+	case "", VerifyCA:
+	case VerifyNone:
+		config.InsecureSkipVerify = true
+	case VerifyTOFU:
+		file := tc.KnownProxiesFile
+		if file == "" {
+			file = DefaultKnownProxiesFile()
+		}
+		tr.DialTLSContext = NewKnownProxies(file).dialTLS(config)
+	default:
+		return nil, fmt.Errorf("unknown verification mode %q (use %q, %q, or %q)", tc.Verify, VerifyCA, VerifyTOFU, VerifyNone)
+	}
+	return &http.Client{Transport: tr}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate as it is stored in the known proxies file.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// KnownProxies pins the certificates of proxies on first use like ssh
+// does with host keys. The file contains one proxy per line: its
+// address (host:port) and the fingerprint of its certificate.
+type KnownProxies struct {
+	sync.Mutex
+	file string
+}
+
+// NewKnownProxies returns the known proxies stored in the given file.
+func NewKnownProxies(file string) *KnownProxies {
+	return &KnownProxies{file: file}
+}
+
+// Lookup returns the pinned fingerprint of the proxy at the address.
+func (kp *KnownProxies) Lookup(address string) (string, bool, error) {
+	f, err := os.Open(kp.file)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == address {
+			return fields[1], true, nil
+		}
+	}
+	return "", false, scanner.Err()
+}
+
+// Verify checks the DER encoded certificate of the proxy at the address
+// against the pinned fingerprint. The fingerprint of a proxy which is
+// contacted the first time is added to the file.
+func (kp *KnownProxies) Verify(address string, der []byte) error {
+	kp.Lock()
+	defer kp.Unlock()
+	fingerprint := Fingerprint(der)
+	known, exists, err := kp.Lookup(address)
+	if err != nil {
+		return fmt.Errorf("reading known proxies: %s", err)
+	}
+	if exists {
+		if known != fingerprint {
+			return fmt.Errorf("certificate of proxy %s has changed (%s, pinned %s in %s): "+
+				"someone could intercept the connection; remove the entry if the change is expected",
+				address, fingerprint, known, kp.file)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(kp.file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(kp.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("storing known proxy: %s", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n", address, fingerprint); err != nil {
+		return fmt.Errorf("storing known proxy: %s", err)
+	}
+	log.Printf("Added proxy %s with certificate %s to %s\n", address, fingerprint, kp.file)
+	return nil
+}
+
+// dialTLS returns a function for http.Transport.DialTLSContext which
+// accepts the certificate of the proxy when it is pinned or when the
+// proxy is contacted the first time.
+func (kp *KnownProxies) dialTLS(config *tls.Config) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c := config.Clone()
+		if c.ServerName == "" {
+			c.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		// the chain is not verified, only the pinned certificate
+		c.InsecureSkipVerify = true
+		c.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("proxy sent no certificate")
+			}
+			return kp.Verify(addr, rawCerts[0])
+		}
+		return (&tls.Dialer{Config: c}).DialContext(ctx, network, addr)
+	}
+}
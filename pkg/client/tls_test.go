@@ -0,0 +1,84 @@
+package client_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Describe("TLS", func() {
+
+	var (
+		server *httptest.Server
+		dir    string
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "ok")
+		}))
+		var err error
+		dir, err = ioutil.TempDir("", "uctls")
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	get := func(tc TLSConfig) error {
+		hc, err := NewTLSHTTPClient(tc)
+		Ω(err).Should(BeNil())
+		resp, err := hc.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	It("should verify the proxy certificate with the CA bundle", func() {
+		Ω(get(TLSConfig{})).ShouldNot(BeNil())
+
+		caFile := filepath.Join(dir, "ca.pem")
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		Ω(ioutil.WriteFile(caFile, cert, 0600)).Should(BeNil())
+		Ω(get(TLSConfig{CAFile: caFile})).Should(BeNil())
+		Ω(get(TLSConfig{CAFile: caFile, ServerName: "proxy.example.org"})).ShouldNot(BeNil())
+
+		Ω(get(TLSConfig{Verify: VerifyNone})).Should(BeNil())
+	})
+
+	It("should pin the proxy certificate on first use", func() {
+		known := filepath.Join(dir, "known_proxies")
+		Ω(get(TLSConfig{Verify: VerifyTOFU, KnownProxiesFile: known})).Should(BeNil())
+		address := strings.TrimPrefix(server.URL, "https://")
+		fingerprint, exists, err := NewKnownProxies(known).Lookup(address)
+		Ω(err).Should(BeNil())
+		Ω(exists).Should(BeTrue())
+		Ω(fingerprint).Should(Equal(Fingerprint(server.Certificate().Raw)))
+		Ω(get(TLSConfig{Verify: VerifyTOFU, KnownProxiesFile: known})).Should(BeNil())
+
+		// a changed certificate is rejected
+		Ω(ioutil.WriteFile(known, []byte(address+" sha256:0000\n"), 0600)).Should(BeNil())
+		err = get(TLSConfig{Verify: VerifyTOFU, KnownProxiesFile: known})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.Error()).Should(ContainSubstring("has changed"))
+	})
+
+	It("should reject unknown verification modes", func() {
+		_, err := NewTLSHTTPClient(TLSConfig{Verify: "sometimes"})
+		Ω(err).ShouldNot(BeNil())
+	})
+
+})
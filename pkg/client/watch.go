@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// WatchJobInfos opens the job state stream of the proxy and calls f
+// for each job info received. The first job infos reflect the current
+// state of the jobs, later ones are sent when a job changes its state.
+// If jobid is not empty only this job is watched. WatchJobInfos blocks
+// until the context is done, the proxy closes the stream, or f returns
+// an error.
+func (c *Client) WatchJobInfos(ctx context.Context, jobid string, f func(types.JobInfo) error) error {
+	query := url.Values{}
+	if jobid != "" {
+		query.Set("jobid", jobid)
+	}
+	req, err := c.newRequest(ctx, "GET", "/msession/jobinfos/watch", query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			// end of event
+			if data.Len() == 0 {
+				continue
+			}
+			var ji types.JobInfo
+			if err := json.Unmarshal(data.Bytes(), &ji); err != nil {
+				return fmt.Errorf("can not decode job info event: %s", err)
+			}
+			data.Reset()
+			if err := f(ji); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			data.Write(bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
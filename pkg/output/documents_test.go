@@ -0,0 +1,74 @@
+package output_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/output"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/ghodss/yaml"
+)
+
+var _ = Describe("Documents", func() {
+
+	var (
+		out  *bytes.Buffer
+		jobs []types.JobInfo
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		jobs = []types.JobInfo{
+			{Id: "10", State: types.Running, JobOwner: "alice"},
+			{Id: "11", State: types.Queued, JobOwner: "bob"},
+		}
+	})
+
+	It("should print lists as one JSON document", func() {
+		NewJSONFormat(out).PrintJobs(jobs)
+		var decoded []types.JobInfo
+		Ω(json.Unmarshal(out.Bytes(), &decoded)).Should(BeNil())
+		Ω(decoded).Should(HaveLen(2))
+		Ω(decoded[1].JobOwner).Should(Equal("bob"))
+
+		out.Reset()
+		NewJSONFormat(out).PrintSessions(nil)
+		Ω(out.String()).Should(Equal("[]\n"))
+	})
+
+	It("should print lists as one XML document", func() {
+		NewXMLFormat(out).PrintJobs(jobs)
+		var decoded struct {
+			XMLName xml.Name
+			Jobs    []types.JobInfo `xml:"JobInfo"`
+		}
+		Ω(xml.Unmarshal(out.Bytes(), &decoded)).Should(BeNil())
+		Ω(decoded.XMLName.Local).Should(Equal("jobs"))
+		Ω(decoded.Jobs).Should(HaveLen(2))
+	})
+
+	It("should print results of submissions and operations", func() {
+		NewJSONFormat(out).PrintJobSubmission(types.RunJobResult{JobId: "12", Cluster: "big", Tasks: 4})
+		Ω(out.String()).Should(MatchJSON(`{"jobid":"12","cluster":"big","tasks":4}`))
+
+		out.Reset()
+		NewStandardFormat(out).PrintJobSubmission(types.RunJobResult{JobId: "12", Cluster: "big"})
+		Ω(out.String()).Should(Equal("Job ID:  12\nCluster:  big\n"))
+	})
+
+	It("should separate YAML documents", func() {
+		yf := NewYAMLFormat(out)
+		yf.PrintCategories([]string{"short"})
+		yf.PrintStagingArea(types.StagingArea{Files: []types.FileInfo{{Filename: "job.sh", Bytes: 21}}})
+		Ω(out.String()).Should(HavePrefix("- short\n---\n"))
+		var area types.StagingArea
+		Ω(yaml.Unmarshal(bytes.SplitN(out.Bytes(), []byte("---\n"), 2)[1], &area)).Should(BeNil())
+		Ω(area.Files[0].Filename).Should(Equal("job.sh"))
+	})
+
+})
@@ -18,35 +18,115 @@ package output
 
 import (
 	"encoding/json"
-	"fmt"
-	"github.com/dgruber/ubercluster/pkg/types"
 	"io"
 	"log"
+	"reflect"
+
+	"github.com/dgruber/ubercluster/pkg/types"
 )
 
-// JSONFormat defines how information is published.
+// JSONFormat defines how information is published. Each object and
+// each list is written as one JSON document in one line.
 type JSONFormat struct {
 	output io.Writer // defines where to print
 }
 
+// NewJSONFormat creates a JSONFormat which prints to w.
+func NewJSONFormat(w io.Writer) *JSONFormat {
+	return &JSONFormat{output: w}
+}
+
+// emptyList returns an empty list instead of a nil slice so that
+// empty lists are encoded as [] and not as null.
+func emptyList(data interface{}) interface{} {
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice && v.IsNil() {
+		return []interface{}{}
+	}
+	return data
+}
+
 func (jf *JSONFormat) marshalJSON(data interface{}) {
-	if out, err := json.Marshal(data); err != nil {
+	if err := json.NewEncoder(jf.output).Encode(emptyList(data)); err != nil {
 		log.Panic(err)
-	} else {
-		fmt.Fprintf(jf.output, "%s", string(out))
 	}
 }
 
-// PrintFiles writes information about each file in one
-// line in the configured output stream
+// PrintFiles writes information about all files JSON encoded.
 func (jf *JSONFormat) PrintFiles(fs []types.FileInfo) {
 	jf.marshalJSON(fs)
 }
 
+// PrintStagingArea writes the files and the used space of the staging area JSON encoded.
+func (jf *JSONFormat) PrintStagingArea(sa types.StagingArea) {
+	jf.marshalJSON(sa)
+}
+
+// PrintJobDetails writes the job info JSON encoded.
 func (jf *JSONFormat) PrintJobDetails(ji types.JobInfo) {
 	jf.marshalJSON(ji)
 }
 
+// PrintJobs writes the job infos as one list JSON encoded.
+func (jf *JSONFormat) PrintJobs(jis []types.JobInfo) {
+	jf.marshalJSON(jis)
+}
+
+// PrintArrayJob writes the job array with its tasks JSON encoded.
+func (jf *JSONFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	jf.marshalJSON(aji)
+}
+
+// PrintMachine writes the machine JSON encoded.
 func (jf *JSONFormat) PrintMachine(m types.Machine) {
 	jf.marshalJSON(m)
 }
+
+// PrintMachines writes the machines as one list JSON encoded.
+func (jf *JSONFormat) PrintMachines(ms []types.Machine) {
+	jf.marshalJSON(ms)
+}
+
+// PrintQueues writes the queues as one list JSON encoded.
+func (jf *JSONFormat) PrintQueues(qs []types.Queue) {
+	jf.marshalJSON(qs)
+}
+
+// PrintCategories writes the job categories as one list JSON encoded.
+func (jf *JSONFormat) PrintCategories(categories []string) {
+	jf.marshalJSON(categories)
+}
+
+// PrintSessions writes the job sessions as one list JSON encoded.
+func (jf *JSONFormat) PrintSessions(sessions []string) {
+	jf.marshalJSON(sessions)
+}
+
+// PrintReservation writes the advance reservation JSON encoded.
+func (jf *JSONFormat) PrintReservation(ri types.ReservationInfo) {
+	jf.marshalJSON(ri)
+}
+
+// PrintReservations writes the advance reservations as one list JSON encoded.
+func (jf *JSONFormat) PrintReservations(ris []types.ReservationInfo) {
+	jf.marshalJSON(ris)
+}
+
+// PrintJobSubmission writes the id of the submitted job JSON encoded.
+func (jf *JSONFormat) PrintJobSubmission(r types.RunJobResult) {
+	jf.marshalJSON(r)
+}
+
+// PrintOperation writes the result of the operation JSON encoded.
+func (jf *JSONFormat) PrintOperation(op types.OperationResult) {
+	jf.marshalJSON(op)
+}
+
+// PrintClusters writes the clusters of the configuration as one list JSON encoded.
+func (jf *JSONFormat) PrintClusters(cs []types.ClusterInfo) {
+	jf.marshalJSON(cs)
+}
+
+// PrintConfig writes the configuration with all clusters JSON encoded.
+func (jf *JSONFormat) PrintConfig(c types.ConfigInfo) {
+	jf.marshalJSON(c)
+}
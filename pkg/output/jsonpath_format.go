@@ -0,0 +1,664 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// JSONPathFormat prints the values selected by a JSONPath template
+// like "{.[*].id}" (the syntax of kubectl). The expressions are
+// evaluated on the JSON format of the objects, hence the field names
+// are the names of the JSON format and lists are arrays. Job states
+// are given by their names (like Running). Supported are:
+//
+//	.name, ['name']   field of an object
+//	[n], [a:b], [*]   element, slice, or all elements of an array
+//	..name            field in the value and all nested objects
+//	[?(@.name==v)]    elements matching a condition (==, !=, <, <=, >, >=)
+//	{range PATH}{end} repeats the enclosed template for each value
+//	{"text"}          quoted text (like {"\n"})
+//
+// Expressions start at the current value of the range (@, the default)
+// or at the document ($). Multiple values of one expression are
+// separated by a space. The output of each object is terminated by a
+// newline unless it ends with one.
+type JSONPathFormat struct {
+	output io.Writer // defines where to print
+	nodes  []jsonPathNode
+}
+
+// NewJSONPathFormat parses the JSONPath template and creates a
+// JSONPathFormat which prints to w.
+func NewJSONPathFormat(w io.Writer, text string) (*JSONPathFormat, error) {
+	tokens, err := splitJSONPathTemplate(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jsonpath %q: %s", text, err)
+	}
+	nodes, rest, err := parseJSONPathNodes(tokens, false)
+	if err == nil && len(rest) > 0 {
+		err = errors.New("{end} without {range}")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid jsonpath %q: %s", text, err)
+	}
+	return &JSONPathFormat{output: w, nodes: nodes}, nil
+}
+
+// jsonPathToken is literal text or the expression of a {...} block.
+type jsonPathToken struct {
+	text       string
+	expression bool
+}
+
+// jsonPathNode is a part of a JSONPath template: literal text, an
+// expression, or a range with its enclosed nodes.
+type jsonPathNode struct {
+	text       string
+	expression *jsonPath
+	body       []jsonPathNode // nodes repeated for each value of a range
+	isRange    bool
+}
+
+// jsonPath is a parsed expression like $.jobs[*].id.
+type jsonPath struct {
+	root  bool // starts at the document instead of the current value
+	steps []pathStep
+}
+
+type stepKind int
+
+const (
+	stepField stepKind = iota
+	stepRecursive
+	stepWildcard
+	stepIndex
+	stepSlice
+	stepFilter
+)
+
+// pathStep is one step of a JSONPath expression.
+type pathStep struct {
+	kind     stepKind
+	name     string      // field of stepField and stepRecursive
+	index    [2]int      // index of stepIndex, bounds of stepSlice
+	bounded  [2]bool     // bounds given in stepSlice
+	operator string      // comparison of stepFilter, existence when empty
+	operand  *jsonPath   // value compared in stepFilter
+	value    interface{} // float64, string, or bool the operand is compared with
+}
+
+// splitJSONPathTemplate splits the template into text and the
+// expressions in braces. Braces in quotes belong to the expression.
+func splitJSONPathTemplate(text string) ([]jsonPathToken, error) {
+	var tokens []jsonPathToken
+	for len(text) > 0 {
+		open := strings.Index(text, "{")
+		if open < 0 {
+			tokens = append(tokens, jsonPathToken{text: text})
+			break
+		}
+		if open > 0 {
+			tokens = append(tokens, jsonPathToken{text: text[:open]})
+		}
+		end := -1
+		var quote byte
+		for i := open + 1; i < len(text) && end < 0; i++ {
+			switch c := text[i]; {
+			case quote != 0 && c == '\\':
+				i++
+			case quote != 0 && c == quote:
+				quote = 0
+			case quote != 0:
+			case c == '"' || c == '\'':
+				quote = c
+			case c == '}':
+				end = i
+			}
+		}
+		if end < 0 {
+			return nil, errors.New("unclosed {")
+		}
+		tokens = append(tokens, jsonPathToken{text: strings.TrimSpace(text[open+1 : end]), expression: true})
+		text = text[end+1:]
+	}
+	return tokens, nil
+}
+
+// parseJSONPathNodes parses the tokens until the end of the template
+// or, in a range, until {end}. The tokens after {end} are returned.
+func parseJSONPathNodes(tokens []jsonPathToken, inRange bool) ([]jsonPathNode, []jsonPathToken, error) {
+	var nodes []jsonPathNode
+	for len(tokens) > 0 {
+		token := tokens[0]
+		tokens = tokens[1:]
+		switch {
+		case !token.expression:
+			nodes = append(nodes, jsonPathNode{text: token.text})
+		case token.text == "end":
+			if !inRange {
+				return nil, nil, errors.New("{end} without {range}")
+			}
+			return nodes, tokens, nil
+		case strings.HasPrefix(token.text, "range "):
+			path, err := parseJSONPath(strings.TrimSpace(strings.TrimPrefix(token.text, "range ")))
+			if err != nil {
+				return nil, nil, err
+			}
+			var body []jsonPathNode
+			if body, tokens, err = parseJSONPathNodes(tokens, true); err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, jsonPathNode{expression: path, body: body, isRange: true})
+		case strings.HasPrefix(token.text, `"`):
+			text, err := strconv.Unquote(token.text)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid text %s", token.text)
+			}
+			nodes = append(nodes, jsonPathNode{text: text})
+		default:
+			path, err := parseJSONPath(token.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, jsonPathNode{expression: path})
+		}
+	}
+	if inRange {
+		return nil, nil, errors.New("{range} without {end}")
+	}
+	return nodes, nil, nil
+}
+
+// isNameChar returns true for characters of field names.
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseJSONPath parses an expression like .jobs[0].id.
+func parseJSONPath(expr string) (*jsonPath, error) {
+	path := &jsonPath{}
+	switch {
+	case strings.HasPrefix(expr, "$"):
+		path.root = true
+		expr = expr[1:]
+	case strings.HasPrefix(expr, "@"):
+		expr = expr[1:]
+	}
+	for len(expr) > 0 {
+		switch {
+		case strings.HasPrefix(expr, ".."):
+			n := 2
+			for n < len(expr) && isNameChar(expr[n]) {
+				n++
+			}
+			if n == 2 {
+				return nil, fmt.Errorf("missing field name after .. in %q", expr)
+			}
+			path.steps = append(path.steps, pathStep{kind: stepRecursive, name: expr[2:n]})
+			expr = expr[n:]
+		case strings.HasPrefix(expr, ".*"):
+			path.steps = append(path.steps, pathStep{kind: stepWildcard})
+			expr = expr[2:]
+		case expr[0] == '.':
+			n := 1
+			for n < len(expr) && isNameChar(expr[n]) {
+				n++
+			}
+			if n > 1 {
+				path.steps = append(path.steps, pathStep{kind: stepField, name: expr[1:n]})
+			}
+			expr = expr[n:]
+		case expr[0] == '[':
+			end := strings.Index(expr, "]")
+			if strings.HasPrefix(expr, "[?(") {
+				end = strings.Index(expr, ")]") + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", expr)
+			}
+			step, err := parseSubscript(expr[1:end])
+			if err != nil {
+				return nil, err
+			}
+			path.steps = append(path.steps, step)
+			expr = expr[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", expr)
+		}
+	}
+	return path, nil
+}
+
+// parseSubscript parses the content of brackets.
+func parseSubscript(s string) (pathStep, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		return pathStep{kind: stepWildcard}, nil
+	case strings.HasPrefix(s, "?(") && strings.HasSuffix(s, ")"):
+		return parseFilter(strings.TrimSpace(s[2 : len(s)-1]))
+	case len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0]:
+		return pathStep{kind: stepField, name: s[1 : len(s)-1]}, nil
+	case strings.Contains(s, ":"):
+		step := pathStep{kind: stepSlice}
+		for i, bound := range strings.SplitN(s, ":", 2) {
+			if bound = strings.TrimSpace(bound); bound == "" {
+				continue
+			}
+			n, err := strconv.Atoi(bound)
+			if err != nil {
+				return step, fmt.Errorf("invalid slice [%s]", s)
+			}
+			step.index[i], step.bounded[i] = n, true
+		}
+		return step, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return pathStep{}, fmt.Errorf("invalid subscript [%s]", s)
+	}
+	return pathStep{kind: stepIndex, index: [2]int{n}}, nil
+}
+
+// parseFilter parses a condition like @.state=='Failed' or @.tasks.
+func parseFilter(s string) (pathStep, error) {
+	step := pathStep{kind: stepFilter}
+	operand := s
+	for _, operator := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if i := strings.Index(s, operator); i > 0 {
+			step.operator = operator
+			operand = strings.TrimSpace(s[:i])
+			value := strings.TrimSpace(s[i+len(operator):])
+			switch {
+			case len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]:
+				step.value = value[1 : len(value)-1]
+			case value == "true" || value == "false":
+				step.value = value == "true"
+			default:
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return step, fmt.Errorf("invalid value %q in filter", value)
+				}
+				step.value = f
+			}
+			break
+		}
+	}
+	if !strings.HasPrefix(operand, "@") {
+		return step, fmt.Errorf("filter %q does not start with @", s)
+	}
+	path, err := parseJSONPath(operand)
+	if err != nil {
+		return step, err
+	}
+	step.operand = path
+	return step, nil
+}
+
+// evaluate returns the values selected by the path.
+func (p *jsonPath) evaluate(document, current interface{}) []interface{} {
+	values := []interface{}{current}
+	if p.root {
+		values[0] = document
+	}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, value := range values {
+			next = append(next, step.apply(document, value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+// elements returns the elements of an array or the values of an
+// object ordered by their keys.
+func elements(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]interface{}, 0, len(v))
+		for _, key := range keys {
+			values = append(values, v[key])
+		}
+		return values
+	}
+	return nil
+}
+
+// apply returns the values the step selects in the value. Missing
+// fields and indices select nothing.
+func (s pathStep) apply(document, value interface{}) []interface{} {
+	switch s.kind {
+	case stepField:
+		if object, ok := value.(map[string]interface{}); ok {
+			if field, exists := object[s.name]; exists {
+				return []interface{}{field}
+			}
+		}
+	case stepRecursive:
+		var found []interface{}
+		if object, ok := value.(map[string]interface{}); ok {
+			if field, exists := object[s.name]; exists {
+				found = append(found, field)
+			}
+		}
+		for _, element := range elements(value) {
+			found = append(found, s.apply(document, element)...)
+		}
+		return found
+	case stepWildcard:
+		return elements(value)
+	case stepIndex, stepSlice:
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		bound := func(i int) int {
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 {
+				return 0
+			}
+			if i > len(array) {
+				return len(array)
+			}
+			return i
+		}
+		if s.kind == stepIndex {
+			i := s.index[0]
+			if i < 0 {
+				i += len(array)
+			}
+			if i < 0 || i >= len(array) {
+				return nil
+			}
+			return []interface{}{array[i]}
+		}
+		start, end := 0, len(array)
+		if s.bounded[0] {
+			start = bound(s.index[0])
+		}
+		if s.bounded[1] {
+			end = bound(s.index[1])
+		}
+		if start >= end {
+			return nil
+		}
+		return array[start:end]
+	case stepFilter:
+		var matching []interface{}
+		for _, element := range elements(value) {
+			if s.matches(document, element) {
+				matching = append(matching, element)
+			}
+		}
+		return matching
+	}
+	return nil
+}
+
+// matches returns true if the element fulfills the condition of the
+// filter.
+func (s pathStep) matches(document, element interface{}) bool {
+	for _, value := range s.operand.evaluate(document, element) {
+		if s.operator == "" {
+			return value != nil
+		}
+		var cmp int
+		switch expected := s.value.(type) {
+		case float64:
+			n, ok := value.(json.Number)
+			if !ok {
+				continue
+			}
+			f, err := n.Float64()
+			if err != nil {
+				continue
+			}
+			switch {
+			case f < expected:
+				cmp = -1
+			case f > expected:
+				cmp = 1
+			}
+		case string:
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+			cmp = strings.Compare(str, expected)
+		case bool:
+			b, ok := value.(bool)
+			if !ok || (s.operator != "==" && s.operator != "!=") {
+				continue
+			}
+			if b != expected {
+				cmp = 1
+			}
+		}
+		switch s.operator {
+		case "==":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		}
+	}
+	return false
+}
+
+// formatValue prints strings and numbers as they are, objects and
+// arrays JSON encoded.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return "null"
+	}
+	out, _ := json.Marshal(value)
+	return string(out)
+}
+
+// write prints the nodes for the current value.
+func (jf *JSONPathFormat) write(out *bytes.Buffer, nodes []jsonPathNode, document, current interface{}) {
+	for _, node := range nodes {
+		switch {
+		case node.expression == nil:
+			out.WriteString(node.text)
+		case node.isRange:
+			values := node.expression.evaluate(document, current)
+			if len(values) == 1 {
+				if array, ok := values[0].([]interface{}); ok {
+					values = array
+				}
+			}
+			for _, value := range values {
+				jf.write(out, node.body, document, value)
+			}
+		default:
+			values := node.expression.evaluate(document, current)
+			formatted := make([]string, 0, len(values))
+			for _, value := range values {
+				formatted = append(formatted, formatValue(value))
+			}
+			out.WriteString(strings.Join(formatted, " "))
+		}
+	}
+}
+
+// execute evaluates the template on the JSON format of the object.
+func (jf *JSONPathFormat) execute(data interface{}) {
+	encoded, err := json.Marshal(emptyList(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	var out bytes.Buffer
+	jf.write(&out, jf.nodes, document, document)
+	if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	jf.output.Write(out.Bytes())
+}
+
+// PrintFiles evaluates the template on the list of files.
+func (jf *JSONPathFormat) PrintFiles(fs []types.FileInfo) {
+	jf.execute(fs)
+}
+
+// PrintStagingArea evaluates the template on the staging area.
+func (jf *JSONPathFormat) PrintStagingArea(sa types.StagingArea) {
+	jf.execute(sa)
+}
+
+// jsonPathJobInfo is the job info the templates are evaluated on. The
+// state is the name of the job state (like Failed) so that filters
+// like [?(@.state=='Failed')] can be used.
+type jsonPathJobInfo struct {
+	types.JobInfo
+	State string `json:"state"`
+}
+
+func newJSONPathJobInfo(ji types.JobInfo) jsonPathJobInfo {
+	return jsonPathJobInfo{JobInfo: ji, State: ji.State.String()}
+}
+
+// jsonPathArrayTaskInfo is a task of a job array with a jsonPathJobInfo.
+type jsonPathArrayTaskInfo struct {
+	Index   int             `json:"index"`
+	JobInfo jsonPathJobInfo `json:"jobInfo"`
+}
+
+// jsonPathArrayJobInfo is a job array with jsonPathArrayTaskInfos.
+type jsonPathArrayJobInfo struct {
+	types.ArrayJobInfo
+	Tasks []jsonPathArrayTaskInfo `json:"tasks"`
+}
+
+// PrintJobDetails evaluates the template on the job.
+func (jf *JSONPathFormat) PrintJobDetails(ji types.JobInfo) {
+	jf.execute(newJSONPathJobInfo(ji))
+}
+
+// PrintJobs evaluates the template on the list of jobs.
+func (jf *JSONPathFormat) PrintJobs(jis []types.JobInfo) {
+	jobs := make([]jsonPathJobInfo, 0, len(jis))
+	for _, ji := range jis {
+		jobs = append(jobs, newJSONPathJobInfo(ji))
+	}
+	jf.execute(jobs)
+}
+
+// PrintArrayJob evaluates the template on the job array.
+func (jf *JSONPathFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	tasks := make([]jsonPathArrayTaskInfo, 0, len(aji.Tasks))
+	for _, task := range aji.Tasks {
+		tasks = append(tasks, jsonPathArrayTaskInfo{Index: task.Index, JobInfo: newJSONPathJobInfo(task.JobInfo)})
+	}
+	jf.execute(jsonPathArrayJobInfo{ArrayJobInfo: aji, Tasks: tasks})
+}
+
+// PrintMachine evaluates the template on the machine.
+func (jf *JSONPathFormat) PrintMachine(m types.Machine) {
+	jf.execute(m)
+}
+
+// PrintMachines evaluates the template on the list of machines.
+func (jf *JSONPathFormat) PrintMachines(ms []types.Machine) {
+	jf.execute(ms)
+}
+
+// PrintQueues evaluates the template on the list of queues.
+func (jf *JSONPathFormat) PrintQueues(qs []types.Queue) {
+	jf.execute(qs)
+}
+
+// PrintCategories evaluates the template on the list of job categories.
+func (jf *JSONPathFormat) PrintCategories(categories []string) {
+	jf.execute(categories)
+}
+
+// PrintSessions evaluates the template on the list of job sessions.
+func (jf *JSONPathFormat) PrintSessions(sessions []string) {
+	jf.execute(sessions)
+}
+
+// PrintReservation evaluates the template on the advance reservation.
+func (jf *JSONPathFormat) PrintReservation(ri types.ReservationInfo) {
+	jf.execute(ri)
+}
+
+// PrintReservations evaluates the template on the list of advance reservations.
+func (jf *JSONPathFormat) PrintReservations(ris []types.ReservationInfo) {
+	jf.execute(ris)
+}
+
+// PrintJobSubmission evaluates the template on the submitted job.
+func (jf *JSONPathFormat) PrintJobSubmission(r types.RunJobResult) {
+	jf.execute(r)
+}
+
+// PrintOperation evaluates the template on the result of the operation.
+func (jf *JSONPathFormat) PrintOperation(op types.OperationResult) {
+	jf.execute(op)
+}
+
+// PrintClusters evaluates the template on the list of clusters.
+func (jf *JSONPathFormat) PrintClusters(cs []types.ClusterInfo) {
+	jf.execute(cs)
+}
+
+// PrintConfig evaluates the template on the configuration.
+func (jf *JSONPathFormat) PrintConfig(c types.ConfigInfo) {
+	jf.execute(c)
+}
@@ -0,0 +1,83 @@
+package output_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/output"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("JSONPathFormat", func() {
+
+	var (
+		out  *bytes.Buffer
+		jobs []types.JobInfo
+	)
+
+	print := func(expression string) string {
+		out.Reset()
+		jf, err := NewJSONPathFormat(out, expression)
+		Ω(err).Should(BeNil())
+		jf.PrintJobs(jobs)
+		return out.String()
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		jobs = []types.JobInfo{
+			{Id: "10", State: types.Running, JobOwner: "alice", AllocatedMachines: []string{"u1010", "u1011"}},
+			{Id: "11", State: types.Failed, JobOwner: "bob"},
+			{Id: "12", State: types.Failed, JobOwner: "alice"},
+		}
+	})
+
+	It("should print the selected values", func() {
+		Ω(print("{.[*].id}")).Should(Equal("10 11 12\n"))
+		Ω(print("{.[0].allocatedMachines[1]}")).Should(Equal("u1011\n"))
+		Ω(print("{.[-1].jobOwner}")).Should(Equal("alice\n"))
+		Ω(print("{.[1:].id}")).Should(Equal("11 12\n"))
+		Ω(print("{.[0]..allocatedMachines}")).Should(Equal(`["u1010","u1011"]` + "\n"))
+	})
+
+	It("should filter elements", func() {
+		Ω(print("{.[?(@.state=='Failed')].id}")).Should(Equal("11 12\n"))
+		Ω(print("{.[?(@.state!='Failed')].id}")).Should(Equal("10\n"))
+		Ω(print("{.[0].state}")).Should(Equal("Running\n"))
+		Ω(print("{.[?(@.jobOwner=='alice')].id}")).Should(Equal("10 12\n"))
+		Ω(print("{.[?(@.allocatedMachines)].id}")).Should(Equal("10\n"))
+	})
+
+	It("should repeat ranges", func() {
+		Ω(print(`{range .[*]}{.id}{"\t"}{.jobOwner}{"\n"}{end}`)).Should(Equal("10\talice\n11\tbob\n12\talice\n"))
+		Ω(print(`{range .}{.id}:{$[0].id} {end}`)).Should(Equal("10:10 11:10 12:10 \n"))
+	})
+
+	It("should print submission results", func() {
+		jf, err := NewJSONPathFormat(out, "{.jobid} {.tasks}")
+		Ω(err).Should(BeNil())
+		jf.PrintJobSubmission(types.RunJobResult{JobId: "13", Tasks: 4})
+		Ω(out.String()).Should(Equal("13 4\n"))
+	})
+
+	It("should print the states of the tasks of job arrays by name", func() {
+		jf, err := NewJSONPathFormat(out, "{.id} {.tasks[?(@.jobInfo.state=='Failed')].index}")
+		Ω(err).Should(BeNil())
+		jf.PrintArrayJob(types.ArrayJobInfo{Id: "20", Begin: 1, End: 2, Step: 1, Tasks: []types.ArrayTaskInfo{
+			{Index: 1, JobInfo: jobs[0]},
+			{Index: 2, JobInfo: jobs[1]},
+		}})
+		Ω(out.String()).Should(Equal("20 2\n"))
+	})
+
+	It("should reject invalid expressions", func() {
+		for _, expression := range []string{"{.id", "{range .[*]}{.id}", "{end}", "{.[x]}", `{.[?(@.id==x)]}`} {
+			_, err := NewJSONPathFormat(out, expression)
+			Ω(err).ShouldNot(BeNil(), expression)
+		}
+	})
+
+})
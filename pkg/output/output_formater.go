@@ -21,20 +21,52 @@ import (
 	"github.com/dgruber/ubercluster/pkg/types"
 	"log"
 	"os"
+	"strings"
 )
 
 // OutputFormater is an interface which defines
 // all required functions needed for the uc client
 // to print out the results.
 type OutputFormater interface {
-	PrintFiles(fs []types.FileInfo) // output format of "uc ls"
-	PrintJobDetails(ji types.JobInfo)
-	PrintMachine(m types.Machine)
+	PrintFiles(fs []types.FileInfo)                // output format of "uc ls"
+	PrintStagingArea(sa types.StagingArea)         // output format of "uc fs ls"
+	PrintJobDetails(ji types.JobInfo)              // output format of "uc show job <id>" and "uc watch job"
+	PrintJobs(jis []types.JobInfo)                 // output format of "uc show job" and "uc show history"
+	PrintArrayJob(aji types.ArrayJobInfo)          // output format of "uc show job" for job arrays
+	PrintMachine(m types.Machine)                  // output format of a single machine
+	PrintMachines(ms []types.Machine)              // output format of "uc show machine"
+	PrintQueues(qs []types.Queue)                  // output format of "uc show queue"
+	PrintCategories(categories []string)           // output format of "uc show category"
+	PrintSessions(sessions []string)               // output format of "uc show session" and "uc session ls"
+	PrintReservation(ri types.ReservationInfo)     // output format of "uc reserve" and "uc show reservation <id>"
+	PrintReservations(ris []types.ReservationInfo) // output format of "uc show reservation"
+	PrintJobSubmission(r types.RunJobResult)       // output format of "uc run" and "uc migrate job"
+	PrintOperation(op types.OperationResult)       // output format of job operations, "uc session", and "uc fs up/down"
+	PrintClusters(cs []types.ClusterInfo)          // output format of "uc config list" and "uc config show <name>"
+	PrintConfig(c types.ConfigInfo)                // output format of "uc config show"
 }
 
 // MakeOutputFormater creates an output formater depending
 // on the chosen output format.
 func MakeOutputFormater(format string) OutputFormater {
+	switch {
+	case strings.HasPrefix(format, "template="):
+		log.Println("Template output format selected.")
+		tf, err := NewTemplateFormat(os.Stdout, strings.TrimPrefix(format, "template="))
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		return tf
+	case strings.HasPrefix(format, "jsonpath="):
+		log.Println("JSONPath output format selected.")
+		jf, err := NewJSONPathFormat(os.Stdout, strings.TrimPrefix(format, "jsonpath="))
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		return jf
+	}
 	switch format {
 	case "default":
 		log.Println("Standard output format selected.")
@@ -51,6 +83,17 @@ func MakeOutputFormater(format string) OutputFormater {
 		var jf XMLFormat
 		jf.output = os.Stdout
 		return &jf
+	case "YAML", "yaml":
+		log.Println("YAML output format selected.")
+		var yf YAMLFormat
+		yf.output = os.Stdout
+		return &yf
+	case "table":
+		log.Println("Table output format selected.")
+		return NewTableFormat(os.Stdout, TableOptions{})
+	case "CSV", "csv":
+		log.Println("CSV output format selected.")
+		return NewCSVFormat(os.Stdout, TableOptions{})
 	}
 	fmt.Println("Error selecting output format module.")
 	os.Exit(1)
@@ -20,7 +20,7 @@ import (
 	"fmt"
 	"github.com/dgruber/ubercluster/pkg/types"
 	"io"
-	"os"
+	"strings"
 	"time"
 )
 
@@ -29,6 +29,11 @@ type StandardFormat struct {
 	output io.Writer // defines where to print
 }
 
+// NewStandardFormat creates a StandardFormat which prints to w.
+func NewStandardFormat(w io.Writer) *StandardFormat {
+	return &StandardFormat{output: w}
+}
+
 // PrintFiles writes information about each file in one
 // line in the configured output stream
 func (sf *StandardFormat) PrintFiles(fs []types.FileInfo) {
@@ -44,10 +49,34 @@ func (sf *StandardFormat) PrintFiles(fs []types.FileInfo) {
 			exec = "executable"
 		}
 		fmt.Fprintf(sf.output, "%-40s %12dkb %s", f.Filename, kb, exec)
+		if f.Expires != nil {
+			fmt.Fprintf(sf.output, " expires %s", f.Expires.Format(time.RFC3339))
+		}
 		fmt.Fprintln(sf.output)
 	}
 }
 
+// formatQuota returns the used kb of a quota in bytes.
+func formatQuota(used, quota int64) string {
+	if quota == 0 {
+		return fmt.Sprintf("%dkb of unlimited", used/1024)
+	}
+	return fmt.Sprintf("%dkb of %dkb (%d%%)", used/1024, quota/1024, used*100/quota)
+}
+
+// PrintStagingArea prints the files of the staging area followed by
+// the used space against the quotas (output of "uc fs ls").
+func (sf *StandardFormat) PrintStagingArea(sa types.StagingArea) {
+	sf.PrintFiles(sa.Files)
+	if u := sa.Usage; u != nil {
+		fmt.Fprintf(sf.output, "job session %s: %s\n", u.Session, formatQuota(u.SessionBytes, u.SessionQuota))
+		fmt.Fprintf(sf.output, "uploaded by %s: %s\n", u.Identity, formatQuota(u.IdentityBytes, u.IdentityQuota))
+		if u.FileTTL != "" {
+			fmt.Fprintf(sf.output, "files are removed after %s\n", u.FileTTL)
+		}
+	}
+}
+
 func makeDate(date time.Time) string {
 	if date.Unix() == types.UnsetTime {
 		return "-"
@@ -62,46 +91,168 @@ func makeDate(date time.Time) string {
 }
 
 // emulateQstat prints DRMAA2 JobInfo information on
-// stdout in a similar way than qstat -j (same keyes)
-func emulateQstat(ji types.JobInfo) {
-	fmt.Fprintf(os.Stdout, "job_number:\t\t%s\n", ji.Id)
-	fmt.Fprintf(os.Stdout, "state:\t\t\t%s\n", ji.State)
-	fmt.Fprintf(os.Stdout, "submission_time:\t%s\n", makeDate(ji.SubmissionTime))
-	fmt.Fprintf(os.Stdout, "dispatch_time:\t\t%s\n", makeDate(ji.DispatchTime))
-	fmt.Fprintf(os.Stdout, "finish_time:\t\t%s\n", makeDate(ji.FinishTime))
-	fmt.Fprintf(os.Stdout, "owner:\t\t\t%s\n", ji.JobOwner)
-	fmt.Fprintf(os.Stdout, "slots:\t\t\t%d\n", ji.Slots)
-	fmt.Fprintf(os.Stdout, "allocated_machines:\t")
+// w in a similar way than qstat -j (same keyes)
+func emulateQstat(w io.Writer, ji types.JobInfo) {
+	fmt.Fprintf(w, "job_number:\t\t%s\n", ji.Id)
+	fmt.Fprintf(w, "state:\t\t\t%s\n", ji.State)
+	fmt.Fprintf(w, "submission_time:\t%s\n", makeDate(ji.SubmissionTime))
+	fmt.Fprintf(w, "dispatch_time:\t\t%s\n", makeDate(ji.DispatchTime))
+	fmt.Fprintf(w, "finish_time:\t\t%s\n", makeDate(ji.FinishTime))
+	fmt.Fprintf(w, "owner:\t\t\t%s\n", ji.JobOwner)
+	fmt.Fprintf(w, "slots:\t\t\t%d\n", ji.Slots)
+	fmt.Fprintf(w, "allocated_machines:\t")
 	if ji.AllocatedMachines != nil {
 		first := true
 		for _, machine := range ji.AllocatedMachines {
 			if machine != "" {
 				if first {
 					first = false
-					fmt.Fprintf(os.Stdout, "%s", machine)
+					fmt.Fprintf(w, "%s", machine)
 				} else {
-					fmt.Fprintf(os.Stdout, ",%s", machine)
+					fmt.Fprintf(w, ",%s", machine)
 				}
 			}
 		}
-		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(w, "\n")
 	} else {
-		fmt.Fprintf(os.Stdout, "NONE\n")
+		fmt.Fprintf(w, "NONE\n")
 	}
-	fmt.Fprintf(os.Stdout, "exit_status:\t\t%d\n", ji.ExitStatus)
+	fmt.Fprintf(w, "exit_status:\t\t%d\n", ji.ExitStatus)
 }
 
 // emulateQhost prints machine information in SGE style out
-func emulateQhost(m types.Machine) {
-	fmt.Fprintf(os.Stdout, "%s %s %d %d %d %f %d %d\n", m.Name, m.Architecture.String(), m.Sockets,
+func emulateQhost(w io.Writer, m types.Machine) {
+	fmt.Fprintf(w, "%s %s %d %d %d %f %d %d\n", m.Name, m.Architecture.String(), m.Sockets,
 		m.Sockets*m.CoresPerSocket, m.Sockets*m.CoresPerSocket*m.ThreadsPerCore, m.Load,
 		m.PhysicalMemory, m.VirtualMemory)
 }
 
 func (sf *StandardFormat) PrintJobDetails(ji types.JobInfo) {
-	emulateQstat(ji)
+	emulateQstat(sf.output, ji)
+}
+
+// PrintJobs prints the details of each job followed by an empty line.
+func (sf *StandardFormat) PrintJobs(jis []types.JobInfo) {
+	for _, ji := range jis {
+		emulateQstat(sf.output, ji)
+		fmt.Fprintln(sf.output)
+	}
+}
+
+// PrintArrayJob prints the task range of a job array followed
+// by one line for each task (index, job id, and state).
+func (sf *StandardFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	fmt.Fprintf(sf.output, "array_job_number:\t%s\n", aji.Id)
+	fmt.Fprintf(sf.output, "task_range:\t\t%d-%d:%d\n", aji.Begin, aji.End, aji.Step)
+	fmt.Fprintf(sf.output, "max_parallel:\t\t%d\n", aji.MaxParallel)
+	fmt.Fprintf(sf.output, "tasks:\t\t\t%d\n", len(aji.Tasks))
+	for _, task := range aji.Tasks {
+		jobid := task.JobInfo.Id
+		if jobid == "" {
+			jobid = "-"
+		}
+		fmt.Fprintf(sf.output, "%-8d %-20s %s\n", task.Index, jobid, task.JobInfo.State)
+	}
 }
 
 func (sf *StandardFormat) PrintMachine(m types.Machine) {
-	emulateQhost(m)
+	emulateQhost(sf.output, m)
+}
+
+// PrintMachines prints one line per machine.
+func (sf *StandardFormat) PrintMachines(ms []types.Machine) {
+	for _, m := range ms {
+		emulateQhost(sf.output, m)
+	}
+}
+
+// PrintQueues prints the name of each queue in one line.
+func (sf *StandardFormat) PrintQueues(qs []types.Queue) {
+	for _, q := range qs {
+		fmt.Fprintln(sf.output, q.Name)
+	}
+}
+
+// PrintCategories prints each job category in one line.
+func (sf *StandardFormat) PrintCategories(categories []string) {
+	for _, category := range categories {
+		fmt.Fprintln(sf.output, category)
+	}
+}
+
+// PrintSessions prints each job session in one line.
+func (sf *StandardFormat) PrintSessions(sessions []string) {
+	for _, session := range sessions {
+		fmt.Fprintln(sf.output, session)
+	}
+}
+
+// PrintReservation prints the details of an advance reservation.
+func (sf *StandardFormat) PrintReservation(ri types.ReservationInfo) {
+	fmt.Fprintf(sf.output, "reservation_id:\t%s\n", ri.ReservationId)
+	fmt.Fprintf(sf.output, "name:\t\t\t%s\n", ri.ReservationName)
+	fmt.Fprintf(sf.output, "start_time:\t\t%s\n", ri.ReservationStartTime)
+	fmt.Fprintf(sf.output, "end_time:\t\t%s\n", ri.ReservationEndTime)
+	fmt.Fprintf(sf.output, "reserved_slots:\t\t%d\n", ri.ReservedSlots)
+	fmt.Fprintf(sf.output, "reserved_machines:\t%s\n", strings.Join(ri.ReservedMachines, ","))
+	fmt.Fprintf(sf.output, "acl:\t\t\t%s\n", strings.Join(ri.ACL, ","))
+}
+
+// PrintReservations prints the details of each advance reservation
+// followed by an empty line.
+func (sf *StandardFormat) PrintReservations(ris []types.ReservationInfo) {
+	for _, ri := range ris {
+		sf.PrintReservation(ri)
+		fmt.Fprintln(sf.output)
+	}
+}
+
+// PrintJobSubmission prints the id of the submitted job (or job array)
+// and the cluster it was submitted to.
+func (sf *StandardFormat) PrintJobSubmission(r types.RunJobResult) {
+	if r.Tasks > 0 {
+		fmt.Fprintln(sf.output, "Array Job ID: ", r.JobId)
+		fmt.Fprintln(sf.output, "Tasks: ", r.Tasks)
+	} else {
+		fmt.Fprintln(sf.output, "Job ID: ", r.JobId)
+	}
+	fmt.Fprintln(sf.output, "Cluster: ", r.Cluster)
+}
+
+// PrintOperation prints the message of the operation.
+func (sf *StandardFormat) PrintOperation(op types.OperationResult) {
+	fmt.Fprintln(sf.output, op.Message)
+}
+
+// PrintClusters prints the settings of each cluster followed by an
+// empty line.
+func (sf *StandardFormat) PrintClusters(cs []types.ClusterInfo) {
+	for _, c := range cs {
+		fmt.Fprintf(sf.output, "Name: %s\nAddress: %s\nProtocolVersion: %s\n", c.Name, c.Address, c.ProtocolVersion)
+		settings := []struct{ name, value string }{
+			{"Description", c.Description},
+			{"Tags", strings.Join(c.Tags, ", ")},
+			{"DefaultQueue", c.DefaultQueue},
+			{"DefaultCategory", c.DefaultCategory},
+			{"Timeout", c.Timeout},
+			{"Credential", c.Credential},
+			{"CertFile", c.CertFile},
+			{"KeyFile", c.KeyFile},
+			{"CAFile", c.CAFile},
+			{"ServerName", c.ServerName},
+			{"Verify", c.Verify},
+		}
+		for _, setting := range settings {
+			if setting.value != "" {
+				fmt.Fprintf(sf.output, "%s: %s\n", setting.name, setting.value)
+			}
+		}
+		fmt.Fprintln(sf.output)
+	}
+}
+
+// PrintConfig prints the configuration file, its default cluster, and
+// the amount of clusters.
+func (sf *StandardFormat) PrintConfig(c types.ConfigInfo) {
+	fmt.Fprintf(sf.output, "File: %s\nDefault: %s\nClusters: %d\n", c.File, c.Default, len(c.Clusters))
 }
@@ -0,0 +1,398 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// TableOptions select the columns of a TableFormat and how the rows
+// are ordered.
+type TableOptions struct {
+	Columns   []string // columns to print, the default columns of the object when empty
+	SortBy    string   // column the rows are sorted by, unsorted when empty
+	NoHeaders bool     // omit the line with the column names
+	Cluster   string   // cluster of the jobs which have no cluster in their id (jobid@cluster)
+}
+
+// TableFormat prints one line per object with aligned columns which
+// are separated by spaces. Empty values are printed as "-" so that
+// the output can be processed with tools like awk or sort.
+type TableFormat struct {
+	output  io.Writer // defines where to print
+	options TableOptions
+	csv     bool // comma separated values instead of aligned columns
+}
+
+// NewTableFormat creates a TableFormat which prints to w.
+func NewTableFormat(w io.Writer, options TableOptions) *TableFormat {
+	return &TableFormat{output: w, options: options}
+}
+
+// NewCSVFormat creates a TableFormat which prints the same columns as
+// comma separated values (RFC 4180). Empty values stay empty.
+func NewCSVFormat(w io.Writer, options TableOptions) *TableFormat {
+	return &TableFormat{output: w, options: options, csv: true}
+}
+
+// column of a table: its name and how the value of a row is formatted
+type column struct {
+	name  string
+	value func(row int) string
+}
+
+// Default columns of the objects.
+var (
+	DefaultJobColumns         = []string{"id", "state", "owner", "queue", "cluster", "submitted"}
+	DefaultMachineColumns     = []string{"name", "arch", "sockets", "cores", "threads", "load", "memory"}
+	DefaultFileColumns        = []string{"name", "bytes", "executable", "expires"}
+	DefaultReservationColumns = []string{"id", "name", "start", "end", "slots", "machines"}
+	DefaultTaskColumns        = []string{"index", "id", "state"}
+	DefaultNameColumns        = []string{"name"}
+	DefaultSubmissionColumns  = []string{"id", "cluster"}
+	DefaultOperationColumns   = []string{"operation", "object", "id", "message"}
+	DefaultClusterColumns     = []string{"name", "address", "version", "default", "tags"}
+)
+
+// tableDate formats a time of an object (RFC 3339).
+func tableDate(date time.Time) string {
+	formatted, _ := formatTime(time.RFC3339, date)
+	return formatted
+}
+
+// selectColumns returns the columns to print in their order.
+func (tf *TableFormat) selectColumns(kind string, all []column, defaults []string) ([]column, error) {
+	names := tf.options.Columns
+	if len(names) == 0 {
+		names = defaults
+	}
+	byName := make(map[string]column, len(all))
+	available := make([]string, 0, len(all))
+	for _, c := range all {
+		byName[c.name] = c
+		available = append(available, c.name)
+	}
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		c, exists := byName[strings.ToLower(strings.TrimSpace(name))]
+		if !exists {
+			return nil, fmt.Errorf("unknown column %q of %s (available: %s)", name, kind,
+				strings.Join(available, ","))
+		}
+		selected = append(selected, c)
+	}
+	if tf.options.SortBy != "" {
+		if _, exists := byName[strings.ToLower(tf.options.SortBy)]; !exists {
+			return nil, fmt.Errorf("can not sort %s by unknown column %q (available: %s)", kind,
+				tf.options.SortBy, strings.Join(available, ","))
+		}
+	}
+	return selected, nil
+}
+
+// less compares two values of a column: numbers numerically, all
+// other values alphabetically.
+func less(a, b string) bool {
+	fa, erra := strconv.ParseFloat(a, 64)
+	fb, errb := strconv.ParseFloat(b, 64)
+	if erra == nil && errb == nil {
+		return fa < fb
+	}
+	return a < b
+}
+
+// printTable prints the rows of a table of objects. Invalid columns
+// are reported on stderr and make uc exit like an unknown format.
+func (tf *TableFormat) printTable(kind string, rows int, all []column, defaults []string) {
+	selected, err := tf.selectColumns(kind, all, defaults)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	order := make([]int, rows)
+	for i := range order {
+		order[i] = i
+	}
+	if tf.options.SortBy != "" {
+		for _, c := range all {
+			if c.name == strings.ToLower(tf.options.SortBy) {
+				sort.SliceStable(order, func(i, j int) bool {
+					return less(c.value(order[i]), c.value(order[j]))
+				})
+			}
+		}
+	}
+	tf.write(selected, order)
+}
+
+// write prints the given rows aligned or as comma separated values.
+func (tf *TableFormat) write(columns []column, rows []int) {
+	if tf.csv {
+		tf.writeCSV(columns, rows)
+		return
+	}
+	w := tabwriter.NewWriter(tf.output, 0, 0, 2, ' ', 0)
+	if !tf.options.NoHeaders {
+		names := make([]string, 0, len(columns))
+		for _, c := range columns {
+			names = append(names, strings.ToUpper(c.name))
+		}
+		fmt.Fprintln(w, strings.Join(names, "\t"))
+	}
+	for _, row := range rows {
+		values := make([]string, 0, len(columns))
+		for _, c := range columns {
+			value := c.value(row)
+			if value == "" {
+				value = "-"
+			}
+			values = append(values, value)
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+	w.Flush()
+}
+
+// writeCSV prints the given rows as comma separated values.
+func (tf *TableFormat) writeCSV(columns []column, rows []int) {
+	w := csv.NewWriter(tf.output)
+	if !tf.options.NoHeaders {
+		names := make([]string, 0, len(columns))
+		for _, c := range columns {
+			names = append(names, c.name)
+		}
+		w.Write(names)
+	}
+	for _, row := range rows {
+		values := make([]string, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, c.value(row))
+		}
+		w.Write(values)
+	}
+	w.Flush()
+}
+
+// jobCluster returns the cluster of a job: the cluster in its id
+// (jobid@cluster) or the cluster uc talks to.
+func (tf *TableFormat) jobCluster(ji types.JobInfo) string {
+	if at := strings.LastIndex(ji.Id, "@"); at >= 0 {
+		return ji.Id[at+1:]
+	}
+	return tf.options.Cluster
+}
+
+// PrintJobs prints one line per job.
+func (tf *TableFormat) PrintJobs(jis []types.JobInfo) {
+	job := func(f func(ji types.JobInfo) string) func(int) string {
+		return func(row int) string { return f(jis[row]) }
+	}
+	tf.printTable("jobs", len(jis), []column{
+		{"id", job(func(ji types.JobInfo) string { return ji.Id })},
+		{"state", job(func(ji types.JobInfo) string { return ji.State.String() })},
+		{"substate", job(func(ji types.JobInfo) string { return ji.SubState })},
+		{"owner", job(func(ji types.JobInfo) string { return ji.JobOwner })},
+		{"queue", job(func(ji types.JobInfo) string { return ji.QueueName })},
+		{"cluster", job(tf.jobCluster)},
+		{"submitted", job(func(ji types.JobInfo) string { return tableDate(ji.SubmissionTime) })},
+		{"started", job(func(ji types.JobInfo) string { return tableDate(ji.DispatchTime) })},
+		{"finished", job(func(ji types.JobInfo) string { return tableDate(ji.FinishTime) })},
+		{"slots", job(func(ji types.JobInfo) string { return strconv.FormatInt(ji.Slots, 10) })},
+		{"machines", job(func(ji types.JobInfo) string { return strings.Join(ji.AllocatedMachines, ",") })},
+		{"exit", job(func(ji types.JobInfo) string { return strconv.Itoa(ji.ExitStatus) })},
+		{"annotation", job(func(ji types.JobInfo) string { return ji.Annotation })},
+	}, DefaultJobColumns)
+}
+
+// PrintJobDetails prints the job as table with one line.
+func (tf *TableFormat) PrintJobDetails(ji types.JobInfo) {
+	tf.PrintJobs([]types.JobInfo{ji})
+}
+
+// PrintArrayJob prints one line per task of the job array.
+func (tf *TableFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	tasks := aji.Tasks
+	tf.printTable("job array tasks", len(tasks), []column{
+		{"index", func(row int) string { return strconv.Itoa(tasks[row].Index) }},
+		{"id", func(row int) string { return tasks[row].JobInfo.Id }},
+		{"state", func(row int) string { return tasks[row].JobInfo.State.String() }},
+		{"owner", func(row int) string { return tasks[row].JobInfo.JobOwner }},
+		{"queue", func(row int) string { return tasks[row].JobInfo.QueueName }},
+		{"submitted", func(row int) string { return tableDate(tasks[row].JobInfo.SubmissionTime) }},
+		{"exit", func(row int) string { return strconv.Itoa(tasks[row].JobInfo.ExitStatus) }},
+	}, DefaultTaskColumns)
+}
+
+// PrintMachines prints one line per machine.
+func (tf *TableFormat) PrintMachines(ms []types.Machine) {
+	tf.printTable("machines", len(ms), []column{
+		{"name", func(row int) string { return ms[row].Name }},
+		{"available", func(row int) string { return strconv.FormatBool(ms[row].Available) }},
+		{"arch", func(row int) string { return ms[row].Architecture.String() }},
+		{"os", func(row int) string { return ms[row].OS.String() }},
+		{"sockets", func(row int) string { return strconv.FormatInt(ms[row].Sockets, 10) }},
+		{"cores", func(row int) string { return strconv.FormatInt(ms[row].Sockets*ms[row].CoresPerSocket, 10) }},
+		{"threads", func(row int) string {
+			return strconv.FormatInt(ms[row].Sockets*ms[row].CoresPerSocket*ms[row].ThreadsPerCore, 10)
+		}},
+		{"load", func(row int) string { return strconv.FormatFloat(ms[row].Load, 'f', 2, 64) }},
+		{"memory", func(row int) string { return strconv.FormatInt(ms[row].PhysicalMemory, 10) }},
+		{"virtual", func(row int) string { return strconv.FormatInt(ms[row].VirtualMemory, 10) }},
+	}, DefaultMachineColumns)
+}
+
+// PrintMachine prints the machine as table with one line.
+func (tf *TableFormat) PrintMachine(m types.Machine) {
+	tf.PrintMachines([]types.Machine{m})
+}
+
+// PrintQueues prints one line per queue.
+func (tf *TableFormat) PrintQueues(qs []types.Queue) {
+	tf.printTable("queues", len(qs), []column{
+		{"name", func(row int) string { return qs[row].Name }},
+	}, DefaultNameColumns)
+}
+
+// PrintCategories prints one line per job category.
+func (tf *TableFormat) PrintCategories(categories []string) {
+	tf.printTable("job categories", len(categories), []column{
+		{"name", func(row int) string { return categories[row] }},
+	}, DefaultNameColumns)
+}
+
+// PrintSessions prints one line per job session.
+func (tf *TableFormat) PrintSessions(sessions []string) {
+	tf.printTable("job sessions", len(sessions), []column{
+		{"name", func(row int) string { return sessions[row] }},
+	}, DefaultNameColumns)
+}
+
+// PrintFiles prints one line per file of the staging area.
+func (tf *TableFormat) PrintFiles(fs []types.FileInfo) {
+	tf.printTable("files", len(fs), []column{
+		{"name", func(row int) string { return fs[row].Filename }},
+		{"bytes", func(row int) string { return strconv.FormatInt(fs[row].Bytes, 10) }},
+		{"executable", func(row int) string { return strconv.FormatBool(fs[row].Executable) }},
+		{"owner", func(row int) string { return fs[row].Owner }},
+		{"expires", func(row int) string {
+			if fs[row].Expires == nil {
+				return ""
+			}
+			return tableDate(*fs[row].Expires)
+		}},
+	}, DefaultFileColumns)
+}
+
+// PrintReservation prints the advance reservation as table with one line.
+func (tf *TableFormat) PrintReservation(ri types.ReservationInfo) {
+	tf.PrintReservations([]types.ReservationInfo{ri})
+}
+
+// PrintReservations prints one line per advance reservation.
+func (tf *TableFormat) PrintReservations(ris []types.ReservationInfo) {
+	tf.printTable("reservations", len(ris), []column{
+		{"id", func(row int) string { return ris[row].ReservationId }},
+		{"name", func(row int) string { return ris[row].ReservationName }},
+		{"start", func(row int) string { return tableDate(ris[row].ReservationStartTime) }},
+		{"end", func(row int) string { return tableDate(ris[row].ReservationEndTime) }},
+		{"slots", func(row int) string { return strconv.FormatInt(ris[row].ReservedSlots, 10) }},
+		{"machines", func(row int) string { return strings.Join(ris[row].ReservedMachines, ",") }},
+		{"acl", func(row int) string { return strings.Join(ris[row].ACL, ",") }},
+	}, DefaultReservationColumns)
+}
+
+// PrintStagingArea prints the files of the staging area followed by
+// a table of the used space. The second table has fixed columns which
+// are not affected by the column selection and the sorting. It is
+// omitted in the CSV format.
+func (tf *TableFormat) PrintStagingArea(sa types.StagingArea) {
+	tf.PrintFiles(sa.Files)
+	u := sa.Usage
+	if u == nil || tf.csv {
+		return
+	}
+	scopes := []string{"session", "identity"}
+	names := []string{u.Session, u.Identity}
+	used := []int64{u.SessionBytes, u.IdentityBytes}
+	quotas := []int64{u.SessionQuota, u.IdentityQuota}
+	quota := func(row int) string {
+		if quotas[row] == 0 {
+			return "unlimited"
+		}
+		return strconv.FormatInt(quotas[row], 10)
+	}
+	fmt.Fprintln(tf.output)
+	tf.write([]column{
+		{"scope", func(row int) string { return scopes[row] }},
+		{"name", func(row int) string { return names[row] }},
+		{"bytes", func(row int) string { return strconv.FormatInt(used[row], 10) }},
+		{"quota", quota},
+	}, []int{0, 1})
+}
+
+// PrintJobSubmission prints the id of the submitted job (or job array)
+// as table with one line.
+func (tf *TableFormat) PrintJobSubmission(r types.RunJobResult) {
+	tf.printTable("submitted jobs", 1, []column{
+		{"id", func(int) string { return r.JobId }},
+		{"cluster", func(int) string { return r.Cluster }},
+		{"tasks", func(int) string { return strconv.Itoa(r.Tasks) }},
+	}, DefaultSubmissionColumns)
+}
+
+// PrintOperation prints the result of the operation as table with one
+// line.
+func (tf *TableFormat) PrintOperation(op types.OperationResult) {
+	tf.printTable("operations", 1, []column{
+		{"operation", func(int) string { return op.Operation }},
+		{"object", func(int) string { return op.Object }},
+		{"id", func(int) string { return op.Id }},
+		{"message", func(int) string { return op.Message }},
+	}, DefaultOperationColumns)
+}
+
+// PrintClusters prints one line per cluster of the configuration.
+func (tf *TableFormat) PrintClusters(cs []types.ClusterInfo) {
+	tf.printTable("clusters", len(cs), []column{
+		{"name", func(row int) string { return cs[row].Name }},
+		{"address", func(row int) string { return cs[row].Address }},
+		{"version", func(row int) string { return cs[row].ProtocolVersion }},
+		{"default", func(row int) string { return strconv.FormatBool(cs[row].Default) }},
+		{"description", func(row int) string { return cs[row].Description }},
+		{"tags", func(row int) string { return strings.Join(cs[row].Tags, ",") }},
+		{"queue", func(row int) string { return cs[row].DefaultQueue }},
+		{"category", func(row int) string { return cs[row].DefaultCategory }},
+		{"timeout", func(row int) string { return cs[row].Timeout }},
+		{"credential", func(row int) string { return cs[row].Credential }},
+		{"verify", func(row int) string { return cs[row].Verify }},
+	}, DefaultClusterColumns)
+}
+
+// PrintConfig prints the clusters of the configuration.
+func (tf *TableFormat) PrintConfig(c types.ConfigInfo) {
+	tf.PrintClusters(c.Clusters)
+}
@@ -0,0 +1,88 @@
+package output_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/output"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("TableFormat", func() {
+
+	var (
+		out  *bytes.Buffer
+		jobs []types.JobInfo
+	)
+
+	lines := func() []string {
+		return strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	}
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		submitted := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+		jobs = []types.JobInfo{
+			{Id: "10", State: types.Running, JobOwner: "alice", QueueName: "all.q", SubmissionTime: submitted},
+			{Id: "9@big", State: types.Queued, JobOwner: "bob"},
+			{Id: "100", State: types.Done, JobOwner: "carol", QueueName: "long.q"},
+		}
+	})
+
+	It("should print the default columns of jobs aligned", func() {
+		NewTableFormat(out, TableOptions{Cluster: "small"}).PrintJobs(jobs)
+		Ω(lines()).Should(Equal([]string{
+			"ID     STATE    OWNER  QUEUE   CLUSTER  SUBMITTED",
+			"10     Running  alice  all.q   small    2018-05-01T12:00:00Z",
+			"9@big  Queued   bob    -       big      -",
+			"100    Done     carol  long.q  small    -",
+		}))
+	})
+
+	It("should print the selected columns sorted without headers", func() {
+		NewTableFormat(out, TableOptions{Columns: []string{"owner", "id"}, SortBy: "id", NoHeaders: true}).PrintJobs(jobs[:1])
+		Ω(lines()).Should(Equal([]string{"alice  10"}))
+
+		out.Reset()
+		jobs[1].Id = "9"
+		NewTableFormat(out, TableOptions{Columns: []string{"id"}, SortBy: "id", NoHeaders: true}).PrintJobs(jobs)
+		// numbers are sorted numerically
+		Ω(lines()).Should(Equal([]string{"9", "10", "100"}))
+	})
+
+	It("should print names of queues, categories, and sessions", func() {
+		tf := NewTableFormat(out, TableOptions{SortBy: "name"})
+		tf.PrintQueues([]types.Queue{{Name: "long.q"}, {Name: "all.q"}})
+		tf.PrintSessions([]string{"ubercluster"})
+		Ω(lines()).Should(Equal([]string{"NAME", "all.q", "long.q", "NAME", "ubercluster"}))
+	})
+
+	It("should print files with their expiration", func() {
+		expires := time.Date(2018, 5, 4, 12, 0, 0, 0, time.UTC)
+		NewTableFormat(out, TableOptions{}).PrintFiles([]types.FileInfo{
+			{Filename: "job.sh", Bytes: 21, Executable: true, Expires: &expires},
+			{Filename: "input.dat", Bytes: 4096},
+		})
+		Ω(lines()).Should(Equal([]string{
+			"NAME       BYTES  EXECUTABLE  EXPIRES",
+			"job.sh     21     true        2018-05-04T12:00:00Z",
+			"input.dat  4096   false       -",
+		}))
+	})
+
+	It("should print comma separated values", func() {
+		NewCSVFormat(out, TableOptions{Columns: []string{"id", "queue"}}).PrintJobs(jobs[1:])
+		Ω(lines()).Should(Equal([]string{"id,queue", "9@big,", "100,long.q"}))
+
+		out.Reset()
+		NewCSVFormat(out, TableOptions{NoHeaders: true}).PrintOperation(types.OperationResult{
+			Operation: "terminate", Object: "job", Id: "10", Message: "job 10, terminated"})
+		Ω(lines()).Should(Equal([]string{`terminate,job,10,"job 10, terminated"`}))
+	})
+
+})
@@ -0,0 +1,238 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// TemplateFormat prints objects with a Go template (text/template)
+// like "{{.Id}} {{.State}}". The fields are the fields of the Go
+// types (like types.JobInfo). Lists are printed by executing the
+// template for each element. Each execution is terminated by a
+// newline unless the template ends with one.
+type TemplateFormat struct {
+	output   io.Writer // defines where to print
+	template *template.Template
+}
+
+// NewTemplateFormat parses the template and creates a TemplateFormat
+// which prints to w.
+func NewTemplateFormat(w io.Writer, text string) (*TemplateFormat, error) {
+	t, err := template.New("format").Funcs(TemplateFuncs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %s", err)
+	}
+	return &TemplateFormat{output: w, template: t}, nil
+}
+
+// TemplateFuncs returns the helper functions available in templates:
+//
+//	date LAYOUT TIME  formats a time with a layout of package time
+//	rfc3339 TIME      formats a time as RFC 3339
+//	since TIME        time passed since TIME (like 1h2m3s)
+//	join SEP LIST     joins a list of strings (like machines)
+//	upper, lower      changes the case of a string
+//	json VALUE        encodes a value as JSON
+//
+// Unset times are formatted as "-".
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"date":    formatTime,
+		"rfc3339": func(t interface{}) (string, error) { return formatTime(time.RFC3339, t) },
+		"since":   since,
+		"join":    join,
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"json": func(v interface{}) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+	}
+}
+
+// timeValue returns the time of a time.Time or *time.Time and false
+// if the time is not set.
+func timeValue(t interface{}) (time.Time, bool, error) {
+	var date time.Time
+	switch v := t.(type) {
+	case time.Time:
+		date = v
+	case *time.Time:
+		if v == nil {
+			return date, false, nil
+		}
+		date = *v
+	default:
+		return date, false, fmt.Errorf("%v is not a time", t)
+	}
+	if date.IsZero() {
+		return date, false, nil
+	}
+	switch date.Unix() {
+	case types.UnsetTime, types.ZeroTime:
+		return date, false, nil
+	}
+	return date, true, nil
+}
+
+func formatTime(layout string, t interface{}) (string, error) {
+	date, set, err := timeValue(t)
+	if !set {
+		return "-", err
+	}
+	if date.Unix() == types.InfiniteTime {
+		return "inf", nil
+	}
+	return date.Format(layout), nil
+}
+
+func since(t interface{}) (string, error) {
+	date, set, err := timeValue(t)
+	if !set {
+		return "-", err
+	}
+	return time.Since(date).Round(time.Second).String(), nil
+}
+
+func join(sep string, list interface{}) (string, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: %v is not a list", list)
+	}
+	values := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		values = append(values, fmt.Sprint(v.Index(i).Interface()))
+	}
+	return strings.Join(values, sep), nil
+}
+
+// execute prints the object or each element of a list. Errors during
+// the execution (like unknown fields) are reported on stderr and make
+// uc exit like an invalid format.
+func (tf *TemplateFormat) execute(data interface{}) {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Slice {
+		tf.executeOne(data)
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		tf.executeOne(v.Index(i).Interface())
+	}
+}
+
+func (tf *TemplateFormat) executeOne(data interface{}) {
+	var out bytes.Buffer
+	if err := tf.template.Execute(&out, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+		out.WriteByte('\n')
+	}
+	tf.output.Write(out.Bytes())
+}
+
+// PrintFiles executes the template for each file.
+func (tf *TemplateFormat) PrintFiles(fs []types.FileInfo) {
+	tf.execute(fs)
+}
+
+// PrintStagingArea executes the template for the staging area.
+func (tf *TemplateFormat) PrintStagingArea(sa types.StagingArea) {
+	tf.execute(sa)
+}
+
+// PrintJobDetails executes the template for the job.
+func (tf *TemplateFormat) PrintJobDetails(ji types.JobInfo) {
+	tf.execute(ji)
+}
+
+// PrintJobs executes the template for each job.
+func (tf *TemplateFormat) PrintJobs(jis []types.JobInfo) {
+	tf.execute(jis)
+}
+
+// PrintArrayJob executes the template for the job array.
+func (tf *TemplateFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	tf.execute(aji)
+}
+
+// PrintMachine executes the template for the machine.
+func (tf *TemplateFormat) PrintMachine(m types.Machine) {
+	tf.execute(m)
+}
+
+// PrintMachines executes the template for each machine.
+func (tf *TemplateFormat) PrintMachines(ms []types.Machine) {
+	tf.execute(ms)
+}
+
+// PrintQueues executes the template for each queue.
+func (tf *TemplateFormat) PrintQueues(qs []types.Queue) {
+	tf.execute(qs)
+}
+
+// PrintCategories executes the template for each job category.
+func (tf *TemplateFormat) PrintCategories(categories []string) {
+	tf.execute(categories)
+}
+
+// PrintSessions executes the template for each job session.
+func (tf *TemplateFormat) PrintSessions(sessions []string) {
+	tf.execute(sessions)
+}
+
+// PrintReservation executes the template for the advance reservation.
+func (tf *TemplateFormat) PrintReservation(ri types.ReservationInfo) {
+	tf.execute(ri)
+}
+
+// PrintReservations executes the template for each advance reservation.
+func (tf *TemplateFormat) PrintReservations(ris []types.ReservationInfo) {
+	tf.execute(ris)
+}
+
+// PrintJobSubmission executes the template for the submitted job.
+func (tf *TemplateFormat) PrintJobSubmission(r types.RunJobResult) {
+	tf.execute(r)
+}
+
+// PrintOperation executes the template for the result of the operation.
+func (tf *TemplateFormat) PrintOperation(op types.OperationResult) {
+	tf.execute(op)
+}
+
+// PrintClusters executes the template for each cluster.
+func (tf *TemplateFormat) PrintClusters(cs []types.ClusterInfo) {
+	tf.execute(cs)
+}
+
+// PrintConfig executes the template for the configuration.
+func (tf *TemplateFormat) PrintConfig(c types.ConfigInfo) {
+	tf.execute(c)
+}
@@ -0,0 +1,61 @@
+package output_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/output"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"bytes"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("TemplateFormat", func() {
+
+	var (
+		out  *bytes.Buffer
+		jobs []types.JobInfo
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		jobs = []types.JobInfo{
+			{Id: "10", State: types.Running, SubmissionTime: time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC),
+				AllocatedMachines: []string{"u1010", "u1011"}},
+			{Id: "11", State: types.Failed},
+		}
+	})
+
+	It("should execute the template for each element of a list", func() {
+		tf, err := NewTemplateFormat(out, "{{.Id}} {{.State}}")
+		Ω(err).Should(BeNil())
+		tf.PrintJobs(jobs)
+		Ω(out.String()).Should(Equal("10 Running\n11 Failed\n"))
+
+		out.Reset()
+		tf.PrintJobs(nil)
+		Ω(out.String()).Should(BeEmpty())
+	})
+
+	It("should provide helper functions", func() {
+		tf, err := NewTemplateFormat(out, `{{.SubmissionTime | date "2006-01-02"}} {{join "," .AllocatedMachines}} {{.State.String | upper}}`)
+		Ω(err).Should(BeNil())
+		tf.PrintJobs(jobs)
+		Ω(out.String()).Should(Equal("2018-05-01 u1010,u1011 RUNNING\n-  FAILED\n"))
+	})
+
+	It("should print submission results", func() {
+		tf, err := NewTemplateFormat(out, "{{.JobId}}@{{.Cluster}}")
+		Ω(err).Should(BeNil())
+		tf.PrintJobSubmission(types.RunJobResult{JobId: "12", Cluster: "big"})
+		Ω(out.String()).Should(Equal("12@big\n"))
+	})
+
+	It("should reject invalid templates", func() {
+		_, err := NewTemplateFormat(out, "{{.Id")
+		Ω(err).ShouldNot(BeNil())
+	})
+
+})
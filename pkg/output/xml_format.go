@@ -19,34 +19,135 @@ package output
 import (
 	"encoding/xml"
 	"fmt"
-	"github.com/dgruber/ubercluster/pkg/types"
 	"io"
 	"log"
+	"reflect"
+
+	"github.com/dgruber/ubercluster/pkg/types"
 )
 
+// XMLFormat defines how information is published. Each object and
+// each list (enclosed by an element like <jobs>) is written as one
+// XML document in one line.
+type XMLFormat struct {
+	output io.Writer // defines where to print
+}
+
+// NewXMLFormat creates a XMLFormat which prints to w.
+func NewXMLFormat(w io.Writer) *XMLFormat {
+	return &XMLFormat{output: w}
+}
+
 func (xf *XMLFormat) marshalXML(data interface{}) {
 	if out, err := xml.Marshal(data); err != nil {
 		log.Panic(err)
 	} else {
-		fmt.Fprintf(xf.output, "%s", string(out))
+		fmt.Fprintf(xf.output, "%s\n", string(out))
 	}
 }
 
-// XMLFormat defines how information is published.
-type XMLFormat struct {
-	output io.Writer // defines where to print
+// marshalXMLList writes the elements of the list enclosed by the root
+// element. The elements are named by their type unless item is given.
+func (xf *XMLFormat) marshalXMLList(root, item string, list interface{}) {
+	enc := xml.NewEncoder(xf.output)
+	start := xml.StartElement{Name: xml.Name{Local: root}}
+	err := enc.EncodeToken(start)
+	v := reflect.ValueOf(list)
+	for i := 0; err == nil && i < v.Len(); i++ {
+		if item != "" {
+			err = enc.EncodeElement(v.Index(i).Interface(), xml.StartElement{Name: xml.Name{Local: item}})
+		} else {
+			err = enc.Encode(v.Index(i).Interface())
+		}
+	}
+	if err == nil {
+		err = enc.EncodeToken(start.End())
+	}
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Fprintln(xf.output)
 }
 
-// PrintFiles writes information about each file to output
-// encoded in plain XML format.
+// PrintFiles writes information about all files XML encoded.
 func (xf *XMLFormat) PrintFiles(fs []types.FileInfo) {
-	xf.marshalXML(fs)
+	xf.marshalXMLList("files", "", fs)
 }
 
+// PrintStagingArea writes the files and the used space of the staging area XML encoded.
+func (xf *XMLFormat) PrintStagingArea(sa types.StagingArea) {
+	xf.marshalXML(sa)
+}
+
+// PrintJobDetails writes the job info XML encoded.
 func (xf *XMLFormat) PrintJobDetails(ji types.JobInfo) {
 	xf.marshalXML(ji)
 }
 
+// PrintJobs writes the job infos as one list XML encoded.
+func (xf *XMLFormat) PrintJobs(jis []types.JobInfo) {
+	xf.marshalXMLList("jobs", "", jis)
+}
+
+// PrintArrayJob writes the job array with its tasks XML encoded.
+func (xf *XMLFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	xf.marshalXML(aji)
+}
+
+// PrintMachine writes the machine XML encoded.
 func (xf *XMLFormat) PrintMachine(m types.Machine) {
 	xf.marshalXML(m)
 }
+
+// PrintMachines writes the machines as one list XML encoded.
+func (xf *XMLFormat) PrintMachines(ms []types.Machine) {
+	xf.marshalXMLList("machines", "", ms)
+}
+
+// PrintQueues writes the queues as one list XML encoded.
+func (xf *XMLFormat) PrintQueues(qs []types.Queue) {
+	xf.marshalXMLList("queues", "", qs)
+}
+
+// PrintCategories writes the job categories as one list XML encoded.
+func (xf *XMLFormat) PrintCategories(categories []string) {
+	xf.marshalXMLList("categories", "category", categories)
+}
+
+// PrintSessions writes the job sessions as one list XML encoded.
+func (xf *XMLFormat) PrintSessions(sessions []string) {
+	xf.marshalXMLList("sessions", "session", sessions)
+}
+
+// PrintReservation writes the advance reservation XML encoded.
+func (xf *XMLFormat) PrintReservation(ri types.ReservationInfo) {
+	xf.marshalXML(ri)
+}
+
+// PrintReservations writes the advance reservations as one list XML encoded.
+func (xf *XMLFormat) PrintReservations(ris []types.ReservationInfo) {
+	xf.marshalXMLList("reservations", "", ris)
+}
+
+// PrintJobSubmission writes the id of the submitted job XML encoded.
+func (xf *XMLFormat) PrintJobSubmission(r types.RunJobResult) {
+	xf.marshalXML(r)
+}
+
+// PrintOperation writes the result of the operation XML encoded.
+func (xf *XMLFormat) PrintOperation(op types.OperationResult) {
+	xf.marshalXML(op)
+}
+
+// PrintClusters writes the clusters of the configuration as one list XML encoded.
+func (xf *XMLFormat) PrintClusters(cs []types.ClusterInfo) {
+	xf.marshalXMLList("clusters", "", cs)
+}
+
+// PrintConfig writes the configuration with all clusters XML encoded.
+func (xf *XMLFormat) PrintConfig(c types.ConfigInfo) {
+	xf.marshalXML(c)
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package output
+
+import (
+	"io"
+	"log"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/ghodss/yaml"
+)
+
+// YAMLFormat defines how information is published. Each object and
+// each list is written as one YAML document. The documents are
+// separated by "---" so that the output is a valid YAML stream. The
+// field names are the same as in the JSON format.
+type YAMLFormat struct {
+	output    io.Writer // defines where to print
+	documents int       // amount of written documents
+}
+
+// NewYAMLFormat creates a YAMLFormat which prints to w.
+func NewYAMLFormat(w io.Writer) *YAMLFormat {
+	return &YAMLFormat{output: w}
+}
+
+func (yf *YAMLFormat) marshalYAML(data interface{}) {
+	out, err := yaml.Marshal(emptyList(data))
+	if err != nil {
+		log.Panic(err)
+	}
+	if yf.documents > 0 {
+		io.WriteString(yf.output, "---\n")
+	}
+	yf.documents++
+	yf.output.Write(out)
+}
+
+// PrintFiles writes information about all files YAML encoded.
+func (yf *YAMLFormat) PrintFiles(fs []types.FileInfo) {
+	yf.marshalYAML(fs)
+}
+
+// PrintStagingArea writes the files and the used space of the staging area YAML encoded.
+func (yf *YAMLFormat) PrintStagingArea(sa types.StagingArea) {
+	yf.marshalYAML(sa)
+}
+
+// PrintJobDetails writes the job info YAML encoded.
+func (yf *YAMLFormat) PrintJobDetails(ji types.JobInfo) {
+	yf.marshalYAML(ji)
+}
+
+// PrintJobs writes the job infos as one list YAML encoded.
+func (yf *YAMLFormat) PrintJobs(jis []types.JobInfo) {
+	yf.marshalYAML(jis)
+}
+
+// PrintArrayJob writes the job array with its tasks YAML encoded.
+func (yf *YAMLFormat) PrintArrayJob(aji types.ArrayJobInfo) {
+	yf.marshalYAML(aji)
+}
+
+// PrintMachine writes the machine YAML encoded.
+func (yf *YAMLFormat) PrintMachine(m types.Machine) {
+	yf.marshalYAML(m)
+}
+
+// PrintMachines writes the machines as one list YAML encoded.
+func (yf *YAMLFormat) PrintMachines(ms []types.Machine) {
+	yf.marshalYAML(ms)
+}
+
+// PrintQueues writes the queues as one list YAML encoded.
+func (yf *YAMLFormat) PrintQueues(qs []types.Queue) {
+	yf.marshalYAML(qs)
+}
+
+// PrintCategories writes the job categories as one list YAML encoded.
+func (yf *YAMLFormat) PrintCategories(categories []string) {
+	yf.marshalYAML(categories)
+}
+
+// PrintSessions writes the job sessions as one list YAML encoded.
+func (yf *YAMLFormat) PrintSessions(sessions []string) {
+	yf.marshalYAML(sessions)
+}
+
+// PrintReservation writes the advance reservation YAML encoded.
+func (yf *YAMLFormat) PrintReservation(ri types.ReservationInfo) {
+	yf.marshalYAML(ri)
+}
+
+// PrintReservations writes the advance reservations as one list YAML encoded.
+func (yf *YAMLFormat) PrintReservations(ris []types.ReservationInfo) {
+	yf.marshalYAML(ris)
+}
+
+// PrintJobSubmission writes the id of the submitted job YAML encoded.
+func (yf *YAMLFormat) PrintJobSubmission(r types.RunJobResult) {
+	yf.marshalYAML(r)
+}
+
+// PrintOperation writes the result of the operation YAML encoded.
+func (yf *YAMLFormat) PrintOperation(op types.OperationResult) {
+	yf.marshalYAML(op)
+}
+
+// PrintClusters writes the clusters of the configuration as one list YAML encoded.
+func (yf *YAMLFormat) PrintClusters(cs []types.ClusterInfo) {
+	yf.marshalYAML(cs)
+}
+
+// PrintConfig writes the configuration with all clusters YAML encoded.
+func (yf *YAMLFormat) PrintConfig(c types.ConfigInfo) {
+	yf.marshalYAML(c)
+}
@@ -0,0 +1,166 @@
+package persistency
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// jobsBucket is the BoltDB bucket which contains the job history
+// entries as JSON encoded values with the job id as key.
+var jobsBucket = []byte("jobs")
+
+// BoltPersistency implements the PersistencyImplementer interface
+// by storing the job templates of submitted jobs and the job infos
+// of finished jobs in a BoltDB file. When a job id is reused by the
+// DRM (like after a restart) the older job is replaced.
+type BoltPersistency struct {
+	db *bolt.DB
+}
+
+// NewBoltPersistency opens or creates the BoltDB file which
+// contains the job history.
+func NewBoltPersistency(path string) (*BoltPersistency, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltPersistency{db: db}, nil
+}
+
+// Close closes the BoltDB file.
+func (bp *BoltPersistency) Close() error {
+	return bp.db.Close()
+}
+
+// updateEntry reads the job history entry of the job, lets
+// update change it, and stores it again.
+func (bp *BoltPersistency) updateEntry(jobid string, update func(entry *types.JobHistoryEntry)) error {
+	return bp.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucket)
+		entry := types.JobHistoryEntry{JobId: jobid}
+		if value := bucket.Get([]byte(jobid)); value != nil {
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+		}
+		update(&entry)
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(jobid), value)
+	})
+}
+
+// getEntry returns the job history entry of the job or ErrNotFound.
+func (bp *BoltPersistency) getEntry(jobid string) (types.JobHistoryEntry, error) {
+	var entry types.JobHistoryEntry
+	err := bp.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(jobsBucket).Get([]byte(jobid))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &entry)
+	})
+	return entry, err
+}
+
+// SaveJobTemplate stores the job template of a submitted job. It
+// starts a new job history entry for the job.
+func (bp *BoltPersistency) SaveJobTemplate(jobid string, jt types.JobTemplate) error {
+	return bp.updateEntry(jobid, func(entry *types.JobHistoryEntry) {
+		*entry = types.JobHistoryEntry{
+			JobId:       jobid,
+			JobTemplate: jt,
+			SubmittedAt: time.Now(),
+		}
+	})
+}
+
+// SaveJobInfo stores the job info of a job. When the job is
+// finished the finish time is set.
+func (bp *BoltPersistency) SaveJobInfo(jobid string, ji types.JobInfo) error {
+	return bp.updateEntry(jobid, func(entry *types.JobHistoryEntry) {
+		entry.JobInfo = &ji
+		if entry.SubmittedAt.IsZero() {
+			entry.SubmittedAt = ji.SubmissionTime
+		}
+		if ji.State == types.Done || ji.State == types.Failed {
+			entry.FinishedAt = ji.FinishTime
+			if entry.FinishedAt.IsZero() {
+				entry.FinishedAt = time.Now()
+			}
+		}
+	})
+}
+
+// SaveJobMigration stores the job ids the job was migrated from or to.
+// Only jobs which are in the job history can be updated.
+func (bp *BoltPersistency) SaveJobMigration(jobid string, migration types.JobMigration) error {
+	if _, err := bp.getEntry(jobid); err != nil {
+		return err
+	}
+	return bp.updateEntry(jobid, func(entry *types.JobHistoryEntry) {
+		if migration.MigratedFrom != "" {
+			entry.MigratedFrom = migration.MigratedFrom
+		}
+		if migration.MigratedTo != "" {
+			entry.MigratedTo = migration.MigratedTo
+		}
+	})
+}
+
+// GetJobTemplate returns the stored job template of the job.
+func (bp *BoltPersistency) GetJobTemplate(jobid string) (types.JobTemplate, error) {
+	entry, err := bp.getEntry(jobid)
+	return entry.JobTemplate, err
+}
+
+// GetJobInfo returns the stored job info of the job.
+func (bp *BoltPersistency) GetJobInfo(jobid string) (types.JobInfo, error) {
+	entry, err := bp.getEntry(jobid)
+	if err != nil {
+		return types.JobInfo{}, err
+	}
+	if entry.JobInfo == nil {
+		return types.JobInfo{}, ErrNotFound
+	}
+	return *entry.JobInfo, nil
+}
+
+// GetJobHistory returns all stored jobs matching the filter ordered
+// by submission time.
+func (bp *BoltPersistency) GetJobHistory(filter HistoryFilter) ([]types.JobHistoryEntry, error) {
+	entries := []types.JobHistoryEntry{}
+	err := bp.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(key, value []byte) error {
+			var entry types.JobHistoryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			if filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SubmittedAt.Before(entries[j].SubmittedAt)
+	})
+	return entries, nil
+}
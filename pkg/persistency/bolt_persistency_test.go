@@ -0,0 +1,109 @@
+package persistency_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/persistency"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("BoltPersistency", func() {
+
+	var (
+		dir string
+		bp  *BoltPersistency
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "boltpersistency")
+		Ω(err).Should(BeNil())
+		bp, err = NewBoltPersistency(filepath.Join(dir, "history.db"))
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		bp.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("should store job templates and final job infos", func() {
+		Ω(bp.SaveJobTemplate("1", types.JobTemplate{RemoteCommand: "/bin/sleep"})).Should(BeNil())
+		_, err := bp.GetJobInfo("1")
+		Ω(err).Should(Equal(ErrNotFound))
+
+		Ω(bp.SaveJobInfo("1", types.JobInfo{Id: "1", State: types.Done, JobOwner: "user"})).Should(BeNil())
+		jt, err := bp.GetJobTemplate("1")
+		Ω(err).Should(BeNil())
+		Ω(jt.RemoteCommand).Should(Equal("/bin/sleep"))
+		ji, err := bp.GetJobInfo("1")
+		Ω(err).Should(BeNil())
+		Ω(ji.State).Should(Equal(types.Done))
+
+		_, err = bp.GetJobTemplate("2")
+		Ω(err).Should(Equal(ErrNotFound))
+	})
+
+	It("should keep the job history after reopening the file", func() {
+		Ω(bp.SaveJobTemplate("1", types.JobTemplate{RemoteCommand: "/bin/date"})).Should(BeNil())
+		Ω(bp.Close()).Should(BeNil())
+
+		var err error
+		bp, err = NewBoltPersistency(filepath.Join(dir, "history.db"))
+		Ω(err).Should(BeNil())
+		entries, err := bp.GetJobHistory(HistoryFilter{})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].JobTemplate.RemoteCommand).Should(Equal("/bin/date"))
+		Ω(entries[0].JobInfo).Should(BeNil())
+	})
+
+	It("should record the migration of stored jobs", func() {
+		Ω(bp.SaveJobTemplate("1", types.JobTemplate{RemoteCommand: "/bin/sleep"})).Should(BeNil())
+		Ω(bp.SaveJobMigration("1", types.JobMigration{MigratedTo: "7@big"})).Should(BeNil())
+		Ω(bp.SaveJobMigration("1", types.JobMigration{MigratedFrom: "3@small"})).Should(BeNil())
+		Ω(bp.SaveJobMigration("2", types.JobMigration{MigratedTo: "8@big"})).Should(Equal(ErrNotFound))
+
+		entries, err := bp.GetJobHistory(HistoryFilter{})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].MigratedTo).Should(Equal("7@big"))
+		Ω(entries[0].MigratedFrom).Should(Equal("3@small"))
+		Ω(entries[0].JobTemplate.RemoteCommand).Should(Equal("/bin/sleep"))
+	})
+
+	It("should filter the job history by time range and owner", func() {
+		Ω(bp.SaveJobTemplate("1", types.JobTemplate{})).Should(BeNil())
+		Ω(bp.SaveJobInfo("1", types.JobInfo{State: types.Done, JobOwner: "alice",
+			FinishTime: time.Now().Add(-48 * time.Hour)})).Should(BeNil())
+		Ω(bp.SaveJobTemplate("2", types.JobTemplate{})).Should(BeNil())
+		Ω(bp.SaveJobInfo("2", types.JobInfo{State: types.Failed, JobOwner: "bob"})).Should(BeNil())
+		Ω(bp.SaveJobTemplate("3", types.JobTemplate{})).Should(BeNil())
+
+		entries, err := bp.GetJobHistory(HistoryFilter{})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(3))
+		Ω(entries[0].JobId).Should(Equal("1"))
+
+		entries, err = bp.GetJobHistory(HistoryFilter{Since: time.Now().Add(-24 * time.Hour)})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(2))
+
+		entries, err = bp.GetJobHistory(HistoryFilter{Owner: "alice"})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].JobId).Should(Equal("1"))
+
+		entries, err = bp.GetJobHistory(HistoryFilter{Until: time.Now().Add(-time.Hour)})
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(BeEmpty())
+	})
+
+})
@@ -19,3 +19,20 @@ func (dp *DummyPersistency) SaveJobInfo(jobid string, ji types.JobInfo) error {
 	log.Println("SaveJobInfo called")
 	return nil
 }
+
+func (dp *DummyPersistency) GetJobTemplate(jobid string) (types.JobTemplate, error) {
+	return types.JobTemplate{}, ErrNotFound
+}
+
+func (dp *DummyPersistency) GetJobInfo(jobid string) (types.JobInfo, error) {
+	return types.JobInfo{}, ErrNotFound
+}
+
+func (dp *DummyPersistency) GetJobHistory(filter HistoryFilter) ([]types.JobHistoryEntry, error) {
+	return []types.JobHistoryEntry{}, nil
+}
+
+func (dp *DummyPersistency) SaveJobMigration(jobid string, migration types.JobMigration) error {
+	log.Println("SaveJobMigration called")
+	return nil
+}
@@ -0,0 +1,13 @@
+package persistency_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPersistency(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Persistency Suite")
+}
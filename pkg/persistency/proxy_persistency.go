@@ -1,9 +1,15 @@
 package persistency
 
 import (
+	"errors"
+	"time"
+
 	"github.com/dgruber/ubercluster/pkg/types"
 )
 
+// ErrNotFound is returned when a job is not stored.
+var ErrNotFound = errors.New("job not found in job history")
+
 // PersistencyImplementer is an interface which contains
 // all functions required for making elements (job templates /
 // states etc.) persistent on some endpoints (databases,
@@ -19,4 +25,52 @@ type PersistencyImplementer interface {
 	// in intervalls or when the user requests a JobInfo object or when the
 	// job is reaped from the DRM:
 	SaveJobInfo(jobid string, jinfo types.JobInfo) error
+	// GetJobTemplate returns the stored JobTemplate of a job or
+	// ErrNotFound.
+	GetJobTemplate(jobid string) (types.JobTemplate, error)
+	// GetJobInfo returns the stored JobInfo of a job or ErrNotFound.
+	GetJobInfo(jobid string) (types.JobInfo, error)
+	// GetJobHistory returns all stored jobs which match the filter
+	// ordered by submission time.
+	GetJobHistory(filter HistoryFilter) ([]types.JobHistoryEntry, error)
+	// SaveJobMigration records where a job was moved to or where it
+	// came from when it was migrated between clusters.
+	SaveJobMigration(jobid string, migration types.JobMigration) error
+}
+
+// HistoryFilter selects jobs of the job history. Unset fields
+// match all jobs.
+type HistoryFilter struct {
+	// Since skips all jobs which finished before.
+	Since time.Time
+	// Until skips all jobs which were submitted afterwards.
+	Until time.Time
+	// Owner skips all jobs which are not finished or which have
+	// a different job owner.
+	Owner string
+}
+
+// Matches returns true if the job history entry is selected by the
+// filter, i.e. if the job ran at some point in the time range.
+func (f HistoryFilter) Matches(entry types.JobHistoryEntry) bool {
+	if !f.Since.IsZero() && !entry.FinishedAt.IsZero() && entry.FinishedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.SubmittedAt.After(f.Until) {
+		return false
+	}
+	if f.Owner != "" && (entry.JobInfo == nil || entry.JobInfo.JobOwner != f.Owner) {
+		return false
+	}
+	return true
+}
+
+// NewPersistency returns a BoltPersistency which stores the job
+// history in the given file. When no file is given the job history
+// is disabled and a DummyPersistency is returned.
+func NewPersistency(historyFile string) (PersistencyImplementer, error) {
+	if historyFile == "" {
+		return &DummyPersistency{}, nil
+	}
+	return NewBoltPersistency(historyFile)
 }
@@ -10,32 +10,24 @@ import (
 
 // ProxyListenAndServe starts an http proxy for a cluster which is accessed by functions
 // specified in the ProxyImplementer interface. If a certification and key file is given
-// as parameter then it starts an TLS secured http proxy. The port is specified by addr
-// in the form which is used by http.ListenAndServe.
+// as parameter then it starts an TLS secured http proxy which checks the certificates
+// of the clients as defined by SecConfig.ClientAuth. The port is specified by addr
+// in the form which is used by http.ListenAndServe. It exits when the TLS settings are
+// invalid.
 func ProxyListenAndServe(addr, certFile, keyFile string, sc SecConfig, pi persistency.PersistencyImplementer, impl ProxyImplementer) {
 	if certFile != "" && keyFile != "" {
-
-		clientCertPool, _ := ReadTrustedClientCertPool(sc.TrustedClientCertDir)
-
 		servTLSCert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err != nil {
 			fmt.Printf("invalid key pair: %v\n", err)
 			os.Exit(1)
 		}
 
-		tlsConfig := &tls.Config{
-			// Reject any TLS certificate that cannot be validated
-			ClientAuth: tls.RequireAndVerifyClientCert,
-			// Ensure that we only use our "CA" to validate certificates
-			ClientCAs:    clientCertPool,
-			Certificates: []tls.Certificate{servTLSCert},
-			//CipherSuites:             []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
-			//PreferServerCipherSuites: true,
-			//MinVersion: tls.VersionTLS12,
-			//InsecureSkipVerify: true,
+		tlsConfig, err := ServerTLSConfig(sc)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
-
-		tlsConfig.BuildNameToCertificate()
+		tlsConfig.Certificates = []tls.Certificate{servTLSCert}
 
 		httpServer := &http.Server{
 			Addr:      addr,
@@ -47,6 +39,10 @@ func ProxyListenAndServe(addr, certFile, keyFile string, sc SecConfig, pi persis
 			os.Exit(1)
 		}
 	} else {
+		if sc.TrustedClientCertDir != "" {
+			fmt.Println("trusted client certificates require a certificate and key of the proxy")
+			os.Exit(1)
+		}
 		fmt.Println("starting plain http server")
 		if err := http.ListenAndServe(addr, NewProxyRouter(impl, sc, pi)); err != nil {
 			fmt.Println(err)
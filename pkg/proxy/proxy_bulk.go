@@ -0,0 +1,396 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// TaskIDEnvironmentVariable is the name of the environment variable
+// which contains the task index of a job array task.
+const TaskIDEnvironmentVariable = "UC_TASK_ID"
+
+// DefaultMaxArrayTasks is the default of MaxArrayTasks.
+const DefaultMaxArrayTasks = 10000
+
+// MaxArrayTasks is the largest amount of tasks a job array submitted
+// through the proxy can have (0 is unlimited). It must be set before
+// the proxy is started.
+var MaxArrayTasks = DefaultMaxArrayTasks
+
+// RunBulkJobsResult is the JSON answer when a job array could
+// successfully be submitted in the cluster.
+type RunBulkJobsResult struct {
+	ArrayJobId string `json:"arrayjobid"`
+}
+
+// checkBulkJobRequest verifies the task index range of a bulk job
+// request like required by DRMAA2 and that the job array has not more
+// than MaxArrayTasks tasks.
+func checkBulkJobRequest(req types.BulkJobRequest) error {
+	if req.Begin < 1 {
+		return errors.New("begin must be at least 1")
+	}
+	if req.End < req.Begin {
+		return errors.New("end must not be smaller than begin")
+	}
+	if req.Step < 1 {
+		return errors.New("step must be at least 1")
+	}
+	if req.MaxParallel < 0 {
+		return errors.New("maxParallel must not be negative")
+	}
+	if tasks := (req.End-req.Begin)/req.Step + 1; MaxArrayTasks > 0 && tasks > MaxArrayTasks {
+		return fmt.Errorf("job array has %d tasks, at most %d are allowed", tasks, MaxArrayTasks)
+	}
+	return nil
+}
+
+// TaskJobTemplate returns a copy of the job template which has the
+// task index set in the TaskIDEnvironmentVariable.
+func TaskJobTemplate(template types.JobTemplate, index int) types.JobTemplate {
+	env := make(map[string]string, len(template.JobEnvironment)+1)
+	for key, value := range template.JobEnvironment {
+		env[key] = value
+	}
+	env[TaskIDEnvironmentVariable] = strconv.Itoa(index)
+	template.JobEnvironment = env
+	return template
+}
+
+// emulatedArrayJob is a job array submitted by the arrayJobEmulator.
+// submitted is called with the job id of each submitted task.
+type emulatedArrayJob struct {
+	impl      ProxyImplementer
+	info      types.ArrayJobInfo
+	submitted func(jobid string)
+	// terminated stops the submission of the remaining tasks and
+	// session is the job session in which it was terminated
+	terminated bool
+	session    string
+	// suspended pauses the submission of the remaining tasks
+	suspended bool
+}
+
+// arrayJobEmulator submits job arrays for ProxyImplementers which don't
+// implement the BulkJobRunner interface. Each task is submitted with
+// RunJob. When maxParallel is set the remaining tasks are submitted in
+// the background as soon as running tasks finish. The job arrays are
+// only kept in memory until all of their tasks are finished. The job
+// array ids contain the start time of the proxy so that they are not
+// reused after a restart.
+type arrayJobEmulator struct {
+	sync.Mutex
+	idPrefix  string
+	lastID    int
+	arrayJobs map[string]*emulatedArrayJob
+}
+
+var emulatedArrayJobs = &arrayJobEmulator{
+	idPrefix:  strconv.FormatInt(time.Now().UnixNano(), 36),
+	arrayJobs: make(map[string]*emulatedArrayJob),
+}
+
+// submitTask submits the task with the given position in the task list
+// and stores the job id or the error in the task job info. A task
+// submitted while the job array got terminated is terminated as well.
+func (e *arrayJobEmulator) submitTask(aj *emulatedArrayJob, template types.JobTemplate, task int) error {
+	e.Lock()
+	index := aj.info.Tasks[task].Index
+	e.Unlock()
+
+	jobid, err := aj.impl.RunJob(TaskJobTemplate(template, index))
+
+	if err == nil && aj.submitted != nil {
+		aj.submitted(jobid)
+	}
+	e.Lock()
+	if err != nil {
+		aj.info.Tasks[task].JobInfo.State = types.Failed
+		aj.info.Tasks[task].JobInfo.Annotation = fmt.Sprintf("submission failed: %s", err)
+		e.Unlock()
+		log.Printf("(proxy) Error during submission of task %d: %s\n", index, err)
+		return err
+	}
+	aj.info.Tasks[task].JobInfo.Id = jobid
+	terminated, session := aj.terminated, aj.session
+	e.Unlock()
+
+	if terminated {
+		if _, err := aj.impl.JobOperation(session, "terminate", jobid); err != nil {
+			log.Printf("(proxy) Error during terminating task %d: %s\n", index, err)
+		}
+	}
+	return nil
+}
+
+// runBulkJobs submits the first tasks of the job array directly so
+// that submission errors can be reported and returns the array job id.
+func (e *arrayJobEmulator) runBulkJobs(impl ProxyImplementer, template types.JobTemplate, begin, end, step, maxParallel int, submitted func(jobid string)) (string, error) {
+	aj := &emulatedArrayJob{
+		impl:      impl,
+		submitted: submitted,
+		info: types.ArrayJobInfo{
+			Begin:       begin,
+			End:         end,
+			Step:        step,
+			MaxParallel: maxParallel,
+			Tasks:       make([]types.ArrayTaskInfo, 0, (end-begin)/step+1),
+		},
+	}
+	for index := begin; index <= end; index += step {
+		aj.info.Tasks = append(aj.info.Tasks, types.ArrayTaskInfo{
+			Index:   index,
+			JobInfo: types.JobInfo{State: types.Queued},
+		})
+	}
+	limit := len(aj.info.Tasks)
+	if maxParallel > 0 && maxParallel < limit {
+		limit = maxParallel
+	}
+	for task := 0; task < limit; task++ {
+		if err := e.submitTask(aj, template, task); err != nil && task == 0 {
+			return "", err
+		}
+	}
+
+	e.Lock()
+	e.lastID++
+	aj.info.Id = fmt.Sprintf("array-%s-%d", e.idPrefix, e.lastID)
+	e.arrayJobs[aj.info.Id] = aj
+	e.Unlock()
+
+	go e.track(aj, template, limit)
+	return aj.info.Id, nil
+}
+
+// track submits the tasks starting with the given position in the task
+// list whenever less than maxParallel tasks are active. The job array
+// is removed when no further tasks are submitted and all submitted
+// tasks are finished.
+func (e *arrayJobEmulator) track(aj *emulatedArrayJob, template types.JobTemplate, next int) {
+	ticker := time.NewTicker(WatchPollInterval)
+	defer ticker.Stop()
+	for {
+		<-ticker.C
+		e.Lock()
+		terminated, suspended := aj.terminated, aj.suspended
+		e.Unlock()
+		if terminated {
+			next = len(aj.info.Tasks)
+		}
+		active := 0
+		for _, jobid := range e.taskJobIDs(aj, next) {
+			if jobid == "" {
+				continue
+			}
+			if ji := aj.impl.GetJobInfo(jobid); ji != nil && ji.State != types.Done && ji.State != types.Failed {
+				active++
+			}
+		}
+		if active == 0 && next == len(aj.info.Tasks) {
+			e.Lock()
+			delete(e.arrayJobs, aj.info.Id)
+			e.Unlock()
+			return
+		}
+		if suspended {
+			continue
+		}
+		for ; (aj.info.MaxParallel == 0 || active < aj.info.MaxParallel) && next < len(aj.info.Tasks); next++ {
+			if err := e.submitTask(aj, template, next); err == nil {
+				active++
+			}
+		}
+	}
+}
+
+// taskJobIDs returns the job ids of the first n tasks.
+func (e *arrayJobEmulator) taskJobIDs(aj *emulatedArrayJob, n int) []string {
+	e.Lock()
+	defer e.Unlock()
+	jobids := make([]string, 0, n)
+	for _, task := range aj.info.Tasks[:n] {
+		jobids = append(jobids, task.JobInfo.Id)
+	}
+	return jobids
+}
+
+// jobOperation performs the operation on all unfinished tasks of the
+// emulated job array. Terminating the job array stops the submission
+// of its remaining tasks and suspending it pauses the submission until
+// it is resumed. The returned bool is false when the job id is not the
+// id of an emulated job array.
+func (e *arrayJobEmulator) jobOperation(jobsessionname, operation, arrayjobid string) (string, bool, error) {
+	e.Lock()
+	aj, exists := e.arrayJobs[arrayjobid]
+	if !exists {
+		e.Unlock()
+		return "", false, nil
+	}
+	switch operation {
+	case "terminate":
+		aj.terminated, aj.session = true, jobsessionname
+	case "suspend":
+		aj.suspended = true
+	case "resume":
+		aj.suspended = false
+	}
+	e.Unlock()
+
+	var failed []string
+	for _, jobid := range e.taskJobIDs(aj, len(aj.info.Tasks)) {
+		if jobid == "" {
+			continue
+		}
+		if ji := aj.impl.GetJobInfo(jobid); ji == nil || ji.State == types.Done || ji.State == types.Failed {
+			continue
+		}
+		if _, err := aj.impl.JobOperation(jobsessionname, operation, jobid); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s)", jobid, err))
+		}
+	}
+	if len(failed) > 0 {
+		return "", true, Errorf(types.ErrorCodeConflict, "%s failed for the tasks %s", operation, strings.Join(failed, ", "))
+	}
+	return fmt.Sprintf("Performed %s on job array %s", operation, arrayjobid), true, nil
+}
+
+// unfinished returns true if the job id is the id of an emulated job
+// array which has unfinished or not yet submitted tasks.
+func (e *arrayJobEmulator) unfinished(arrayjobid string) bool {
+	e.Lock()
+	defer e.Unlock()
+	_, exists := e.arrayJobs[arrayjobid]
+	return exists
+}
+
+// getArrayJobInfo returns the array job info with the current job
+// infos of all submitted tasks or nil if the array job is unknown.
+func (e *arrayJobEmulator) getArrayJobInfo(arrayjobid string) *types.ArrayJobInfo {
+	e.Lock()
+	aj, exists := e.arrayJobs[arrayjobid]
+	if !exists {
+		e.Unlock()
+		return nil
+	}
+	info := aj.info
+	info.Tasks = append([]types.ArrayTaskInfo(nil), aj.info.Tasks...)
+	e.Unlock()
+
+	for i := range info.Tasks {
+		if jobid := info.Tasks[i].JobInfo.Id; jobid != "" {
+			if ji := aj.impl.GetJobInfo(jobid); ji != nil {
+				info.Tasks[i].JobInfo = *ji
+			}
+		}
+	}
+	return &info
+}
+
+// RunBulkJobs submits a job array. If the ProxyImplementer implements
+// the BulkJobRunner interface the job array is submitted natively,
+// otherwise each task is submitted with RunJob. When submitted is not
+// nil it is called with the job id of each task once the task is
+// submitted (for native job arrays the tasks known after submission).
+func RunBulkJobs(impl ProxyImplementer, template types.JobTemplate, begin, end, step, maxParallel int, submitted func(jobid string)) (string, error) {
+	if runner, ok := impl.(BulkJobRunner); ok {
+		arrayjobid, err := runner.RunBulkJobs(template, begin, end, step, maxParallel)
+		if err != nil || submitted == nil {
+			return arrayjobid, err
+		}
+		if aji := runner.GetArrayJobInfo(arrayjobid); aji != nil {
+			for _, task := range aji.Tasks {
+				if task.JobInfo.Id != "" {
+					submitted(task.JobInfo.Id)
+				}
+			}
+		}
+		return arrayjobid, nil
+	}
+	return emulatedArrayJobs.runBulkJobs(impl, template, begin, end, step, maxParallel, submitted)
+}
+
+// GetArrayJobInfo returns the job array with the given id or nil if
+// the job array is not known.
+func GetArrayJobInfo(impl ProxyImplementer, arrayjobid string) *types.ArrayJobInfo {
+	if runner, ok := impl.(BulkJobRunner); ok {
+		return runner.GetArrayJobInfo(arrayjobid)
+	}
+	return emulatedArrayJobs.getArrayJobInfo(arrayjobid)
+}
+
+// MakeJSessionRunBulkHandler returns an http handler function which
+// reads a JSON encoded BulkJobRequest from the body of the http request
+// and submits the job array in the cluster. Like for single jobs the
+// working directory is set to the staging area of the job session and
+// the tasks belong to the job session.
+func MakeJSessionRunBulkHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	stagingBase := stagingWorkingDir()
+	sessions := getJobSessions(impl)
+	manager := getStagingManager(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		var req types.BulkJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Println("(proxy) Unmarshall error")
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		if err := checkBulkJobRequest(req); err != nil {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		jt := req.JobTemplate
+		jt.WorkingDirectory = stagingDir(stagingBase, session)
+
+		arrayjobid, err := RunBulkJobs(impl, jt, req.Begin, req.End, req.Step, req.MaxParallel,
+			func(jobid string) { sessions.addJob(session, jobid) })
+		if err != nil {
+			log.Printf("(proxy) Error during job array submission: %s\n", err)
+			writeError(w, err, nil)
+			return
+		}
+		log.Printf("(proxy) Job array successfully submitted: %s\n", arrayjobid)
+		sessions.addJob(session, arrayjobid)
+		manager.jobSubmitted(session, arrayjobid)
+
+		if pi != nil {
+			if err := pi.SaveJobTemplate(arrayjobid, jt); err != nil {
+				log.Printf("(proxy) Error during making Job Template persistent: %s\n", err)
+			}
+		}
+		json.NewEncoder(w).Encode(RunBulkJobsResult{ArrayJobId: arrayjobid})
+	}
+}
+
+// MakeMSessionArrayJobInfoHandler returns an http handler function which
+// returns the JSON encoded ArrayJobInfo of a job array.
+func MakeMSessionArrayJobInfoHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		arrayjobid := mux.Vars(r)["arrayjobid"]
+		aji := GetArrayJobInfo(impl, arrayjobid)
+		if aji == nil {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "array job not found",
+				map[string]string{"arrayjobid": arrayjobid})
+			return
+		}
+		json.NewEncoder(w).Encode(*aji)
+	}
+}
@@ -0,0 +1,152 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// taskProxy is a ProxyImplementer which starts each submitted job
+// in running state and remembers the task index of the job.
+type taskProxy struct {
+	*stateProxy
+	taskIDs map[string]string
+}
+
+func (tp *taskProxy) RunJob(template types.JobTemplate) (string, error) {
+	tp.Lock()
+	jobid := fmt.Sprintf("%d", len(tp.states)+1)
+	tp.taskIDs[jobid] = template.JobEnvironment[TaskIDEnvironmentVariable]
+	tp.Unlock()
+	tp.setState(jobid, types.Running)
+	return jobid, nil
+}
+
+func (tp *taskProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	if operation == "terminate" {
+		tp.setState(jobid, types.Failed)
+	}
+	return operation, nil
+}
+
+var _ = Describe("ProxyBulk", func() {
+
+	var (
+		tp     *taskProxy
+		server *httptest.Server
+		c      *client.Client
+	)
+
+	BeforeEach(func() {
+		tp = &taskProxy{
+			stateProxy: &stateProxy{states: map[string]types.JobState{}},
+			taskIDs:    map[string]string{},
+		}
+		router := mux.NewRouter()
+		router.HandleFunc("/v1/jsession/{jsname}/runbulk", MakeJSessionRunBulkHandler(tp, nil))
+		router.HandleFunc("/v1/msession/arrayjobinfo/{arrayjobid}", MakeMSessionArrayJobInfoHandler(tp, nil))
+		router.HandleFunc("/v1/jsession/{jsname}/{operation}/{jobid}", MakeJSessionJobManipulationHandler(tp, nil))
+		server = httptest.NewServer(router)
+		c = client.New(server.URL+"/v1", nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should submit all tasks with their task index", func() {
+		arrayjobid, err := c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{
+			JobTemplate: types.JobTemplate{RemoteCommand: "/bin/sleep"},
+			Begin:       1, End: 5, Step: 2,
+		})
+		Ω(err).Should(BeNil())
+		Ω(arrayjobid).ShouldNot(BeEmpty())
+		Ω(tp.taskIDs).Should(Equal(map[string]string{"1": "1", "2": "3", "3": "5"}))
+
+		aji, err := c.GetArrayJobInfo(context.Background(), arrayjobid)
+		Ω(err).Should(BeNil())
+		Ω(aji.Id).Should(Equal(arrayjobid))
+		Ω(aji.Tasks).Should(HaveLen(3))
+		Ω(aji.Tasks[2].Index).Should(Equal(5))
+		Ω(aji.Tasks[2].JobInfo.Id).Should(Equal("3"))
+		Ω(aji.Tasks[2].JobInfo.State).Should(Equal(types.Running))
+	})
+
+	It("should not run more than maxParallel tasks at the same time", func() {
+		arrayjobid, err := c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{
+			Begin: 1, End: 3, Step: 1, MaxParallel: 2,
+		})
+		Ω(err).Should(BeNil())
+
+		aji, err := c.GetArrayJobInfo(context.Background(), arrayjobid)
+		Ω(err).Should(BeNil())
+		Ω(aji.Tasks[2].JobInfo.Id).Should(BeEmpty())
+		Consistently(func() int {
+			tp.Lock()
+			defer tp.Unlock()
+			return len(tp.states)
+		}, 50*time.Millisecond).Should(Equal(2))
+
+		tp.setState("1", types.Done)
+		Eventually(func() string {
+			aji, _ := c.GetArrayJobInfo(context.Background(), arrayjobid)
+			return aji.Tasks[2].JobInfo.Id
+		}).Should(Equal("3"))
+	})
+
+	It("should terminate all tasks of job arrays and stop the submission of the remaining tasks", func() {
+		arrayjobid, err := c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{
+			Begin: 1, End: 4, Step: 1, MaxParallel: 2,
+		})
+		Ω(err).Should(BeNil())
+		Ω(arrayjobid).Should(MatchRegexp(`^array-[0-9a-z]+-[0-9]+$`))
+
+		_, err = c.JobOperation(context.Background(), "default", "terminate", arrayjobid)
+		Ω(err).Should(BeNil())
+		Ω(tp.GetJobInfo("1").State).Should(Equal(types.Failed))
+		Ω(tp.GetJobInfo("2").State).Should(Equal(types.Failed))
+		Consistently(func() int {
+			tp.Lock()
+			defer tp.Unlock()
+			return len(tp.states)
+		}, 50*time.Millisecond).Should(Equal(2))
+
+		// the finished job array is removed
+		_, err = c.GetArrayJobInfo(context.Background(), arrayjobid)
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("should reject invalid task ranges and unknown array jobs", func() {
+		_, err := c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{Begin: 0, End: 3, Step: 1})
+		Ω(err).ShouldNot(BeNil())
+		_, err = c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{Begin: 1, End: 3, Step: 0})
+		Ω(err).ShouldNot(BeNil())
+		_, err = c.GetArrayJobInfo(context.Background(), "unknown")
+		Ω(err).ShouldNot(BeNil())
+	})
+
+	It("should reject job arrays with more than MaxArrayTasks tasks", func() {
+		defer func(max int) { MaxArrayTasks = max }(MaxArrayTasks)
+		MaxArrayTasks = 3
+		_, err := c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{Begin: 1, End: 1000000000, Step: 1})
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeInvalidRequest))
+		Ω(tp.taskIDs).Should(BeEmpty())
+		_, err = c.RunBulkJobs(context.Background(), "default", types.BulkJobRequest{
+			JobTemplate: types.JobTemplate{RemoteCommand: "/bin/sleep"},
+			Begin:       1, End: 5, Step: 2,
+		})
+		Ω(err).Should(BeNil())
+	})
+
+})
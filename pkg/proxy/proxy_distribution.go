@@ -0,0 +1,799 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// Default settings of the job distribution.
+const (
+	DefaultHighLoad      = 0.8              // load above which submitted jobs are pushed to peers
+	DefaultLowLoad       = 0.2              // load below which pending jobs are fetched from peers
+	DefaultFetchInterval = 30 * time.Second // how often peers are asked for pending jobs
+)
+
+// peerTimeout is the deadline of requests to peers.
+var peerTimeout = 10 * time.Second
+
+// fetchReservation is how long a fetched job is kept for the fetching
+// peer until it has to confirm the job.
+var fetchReservation = time.Minute
+
+// pruneInterval is how often jobs which can't be fetched anymore are
+// removed from the pending jobs.
+var pruneInterval = time.Minute
+
+// Peer is another proxy jobs are exchanged with. Secret is shared by
+// the proxy and the peer. It authenticates the proxies which don't
+// use a client certificate (mutual TLS).
+type Peer struct {
+	Name    string // id of the peer (the ID in its DistributionConfig)
+	Address string // like http://host:8888/v1
+	Secret  string // secret shared with the peer
+}
+
+// DistributionConfig configures the exchange of jobs between proxies.
+// In push mode jobs submitted while the load of the cluster is above
+// HighLoad are submitted in the peer of DistributeTo with the lowest
+// load. In pull mode the proxy fetches queued jobs from the peers of
+// FetchFrom while its load is below LowLoad. Peers are only allowed
+// to push jobs or fetch jobs when they are listed in the accept lists.
+// They are authenticated by the common name of their verified client
+// certificate (mutual TLS) or else by the Secret of their entry in
+// the accept list. Requests of fetched jobs are sent to the Address
+// of the peer in FetchAcceptFrom.
+type DistributionConfig struct {
+	ID                   string  // id of the proxy sent to peers
+	DistributeTo         []Peer  // peers which get jobs when the load is high
+	DistributeAcceptFrom []Peer  // peers which can push jobs to the proxy
+	FetchFrom            []Peer  // peers which are asked for jobs when the load is low
+	FetchAcceptFrom      []Peer  // peers which can fetch jobs from the proxy (Address required)
+	HighLoad             float64 // DefaultHighLoad when 0
+	LowLoad              float64 // DefaultLowLoad when 0
+	FetchInterval        string  // duration like "30s", DefaultFetchInterval when empty
+	StateFile            string  // BoltDB file of the exchanged jobs (kept in memory only when empty)
+	OTP                  string  // shared secret sent to the peers
+	CertFile             string  // client certificate for peers (mutual TLS)
+	KeyFile              string  // key of the client certificate
+	CAFile               string  // CA bundle the certificates of the peers are verified with
+	Verify               string  // verification of the peer certificates (client.VerifyCA if not set)
+}
+
+// ReadDistributionConfig reads a JSON encoded DistributionConfig.
+func ReadDistributionConfig(path string) (DistributionConfig, error) {
+	var config DistributionConfig
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid distribution config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// pendingJob is a job submitted through the proxy which can be
+// fetched by a peer as long as it is queued. Reservations are not
+// stored.
+type pendingJob struct {
+	Session       string            `json:"session"`
+	Template      types.JobTemplate `json:"template"`
+	reservedBy    string            // id of the peer which fetched the job
+	reservedUntil time.Time
+}
+
+// remoteJob is a job which runs in the cluster of a peer. Its requests
+// are sent to the peer of the configuration with that name.
+type remoteJob struct {
+	Peer    string `json:"peer"`    // id of the peer
+	Fetched bool   `json:"fetched"` // fetched by the peer, otherwise pushed to it
+	JobID   string `json:"jobId"`   // id of the job in the peer
+	Session string `json:"session"`
+}
+
+// JobDistributor exchanges jobs of a ProxyImplementer with the proxies
+// of other clusters. It keeps the jobs which were pushed to peers or
+// fetched by peers, so that their job infos and operations are
+// forwarded to the peers. The jobs are stored in the StateFile of the
+// config and only kept in memory when it is not set.
+type JobDistributor struct {
+	sync.Mutex
+	impl        ProxyImplementer
+	config      DistributionConfig
+	interval    time.Duration
+	stagingBase string
+	httpClient  *http.Client
+	store       *distributionStore
+	pending     map[string]*pendingJob
+	remote      map[string]remoteJob
+	cancel      context.CancelFunc
+}
+
+// distributors contains the JobDistributor of each ProxyImplementer
+// which exchanges jobs with peers.
+var distributors = struct {
+	sync.Mutex
+	registries map[ProxyImplementer]*JobDistributor
+}{registries: make(map[ProxyImplementer]*JobDistributor)}
+
+// getJobDistributor returns the JobDistributor of the ProxyImplementer
+// or nil if it does not exchange jobs with peers.
+func getJobDistributor(impl ProxyImplementer) *JobDistributor {
+	distributors.Lock()
+	defer distributors.Unlock()
+	return distributors.registries[impl]
+}
+
+// EnableJobDistribution lets the ProxyImplementer exchange jobs with
+// the peers given in the config. It must be called before the http
+// handlers of the proxy are created (like in ProxyListenAndServe).
+// When FetchFrom is set, the peers are periodically asked for jobs
+// until Stop is called.
+func EnableJobDistribution(impl ProxyImplementer, config DistributionConfig) (*JobDistributor, error) {
+	if config.ID == "" && (len(config.DistributeTo) > 0 || len(config.FetchFrom) > 0) {
+		return nil, fmt.Errorf("distribution config requires an ID for pushing or fetching jobs")
+	}
+	for _, peer := range config.FetchAcceptFrom {
+		if peer.Address == "" {
+			return nil, fmt.Errorf("distribution config requires the Address of peer %q in FetchAcceptFrom", peer.Name)
+		}
+	}
+	if config.HighLoad == 0 {
+		config.HighLoad = DefaultHighLoad
+	}
+	if config.LowLoad == 0 {
+		config.LowLoad = DefaultLowLoad
+	}
+	interval := DefaultFetchInterval
+	if config.FetchInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(config.FetchInterval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid fetch interval %q", config.FetchInterval)
+		}
+	}
+	httpClient, err := client.NewTLSHTTPClient(client.TLSConfig{
+		CertFile: config.CertFile,
+		KeyFile:  config.KeyFile,
+		CAFile:   config.CAFile,
+		Verify:   config.Verify,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stagingBase, err := filepath.Abs(stagingArea)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openDistributionStore(config.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("can not open distribution state file %s: %s", config.StateFile, err)
+	}
+	d := &JobDistributor{
+		impl:        impl,
+		config:      config,
+		interval:    interval,
+		stagingBase: stagingBase,
+		httpClient:  httpClient,
+		store:       store,
+		pending:     make(map[string]*pendingJob),
+		remote:      make(map[string]remoteJob),
+	}
+	if err := d.load(); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("can not read distribution state file %s: %s", config.StateFile, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	distributors.Lock()
+	distributors.registries[impl] = d
+	distributors.Unlock()
+
+	if len(config.FetchFrom) > 0 {
+		go d.fetchLoop(ctx)
+	}
+	if len(config.FetchAcceptFrom) > 0 {
+		go d.pruneLoop(ctx)
+	}
+	return d, nil
+}
+
+// load reads the exchanged jobs from the state file.
+func (d *JobDistributor) load() error {
+	err := d.store.load(pendingBucket, func(jobid string, value []byte) error {
+		var job pendingJob
+		if err := json.Unmarshal(value, &job); err != nil {
+			return err
+		}
+		d.pending[jobid] = &job
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.store.load(remoteBucket, func(jobid string, value []byte) error {
+		var job remoteJob
+		if err := json.Unmarshal(value, &job); err != nil {
+			return err
+		}
+		d.remote[jobid] = job
+		return nil
+	})
+}
+
+// Stop stops fetching jobs from peers, closes the state file, and
+// removes the JobDistributor of the ProxyImplementer.
+func (d *JobDistributor) Stop() {
+	d.cancel()
+	distributors.Lock()
+	defer distributors.Unlock()
+	if distributors.registries[d.impl] == d {
+		delete(distributors.registries, d.impl)
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.store.Close()
+	d.store = nil
+}
+
+// peerClient creates a client for a peer which identifies the proxy.
+func (d *JobDistributor) peerClient(peer Peer) *client.Client {
+	c := client.New(peer.Address, d.httpClient)
+	c.SetOTP(d.config.OTP)
+	c.SetPeer(d.config.ID, peer.Secret)
+	return c
+}
+
+// peer returns the configured peer which runs the job. Pushed jobs
+// run in a peer of DistributeTo, fetched jobs in a peer of
+// FetchAcceptFrom.
+func (d *JobDistributor) peer(job remoteJob) (Peer, bool) {
+	peers := d.config.DistributeTo
+	if job.Fetched {
+		peers = d.config.FetchAcceptFrom
+	}
+	for _, peer := range peers {
+		if peer.Name == job.Peer {
+			return peer, true
+		}
+	}
+	return Peer{}, false
+}
+
+// addRemote remembers a job running in a peer cluster. The caller
+// holds the lock.
+func (d *JobDistributor) addRemote(jobid string, job remoteJob) {
+	d.remote[jobid] = job
+	if err := d.store.put(remoteBucket, jobid, job); err != nil {
+		log.Printf("(proxy) Can not store job %s running in peer %s: %s\n", jobid, job.Peer, err)
+	}
+}
+
+// removePending forgets a job which can't be fetched anymore. The
+// caller holds the lock.
+func (d *JobDistributor) removePending(jobid string) {
+	delete(d.pending, jobid)
+	if err := d.store.remove(pendingBucket, jobid); err != nil {
+		log.Printf("(proxy) Can not remove pending job %s: %s\n", jobid, err)
+	}
+}
+
+// usesStagedFiles returns true if the job uses a file from the staging
+// area of its job session. Those jobs are not exchanged with peers.
+func (d *JobDistributor) usesStagedFiles(session string, jt types.JobTemplate) bool {
+	dir := stagingDir(d.stagingBase, session)
+	for _, name := range []string{jt.RemoteCommand, jt.InputPath} {
+		if name == "" || filepath.IsAbs(name) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// push submits the job in the peer with the lowest load when the load
+// of the cluster is high. It returns the job id (jobid@peer) and true
+// if the job was submitted in a peer. Jobs running in an advance
+// reservation or using staged files are not pushed.
+func (d *JobDistributor) push(session string, jt types.JobTemplate) (string, bool) {
+	if d == nil || len(d.config.DistributeTo) == 0 || jt.ReservationId != "" || d.usesStagedFiles(session, jt) {
+		return "", false
+	}
+	load := d.impl.DRMSLoad()
+	if load < d.config.HighLoad {
+		return "", false
+	}
+	type peerLoad struct {
+		peer Peer
+		load float64
+	}
+	candidates := make([]peerLoad, 0, len(d.config.DistributeTo))
+	for _, peer := range d.config.DistributeTo {
+		ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+		peerload, err := d.peerClient(peer).DRMSLoad(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("(proxy) Can not get load of peer %s: %s\n", peer.Name, err)
+			continue
+		}
+		if peerload < d.config.HighLoad && peerload < load {
+			candidates = append(candidates, peerLoad{peer: peer, load: peerload})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].load < candidates[j].load })
+
+	jt.WorkingDirectory = ""
+	for _, candidate := range candidates {
+		ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+		jobid, err := d.peerClient(candidate.peer).PushJob(ctx, types.DistributedJob{JobSession: session, JobTemplate: jt})
+		cancel()
+		if err != nil {
+			log.Printf("(proxy) Pushing job to peer %s failed: %s\n", candidate.peer.Name, err)
+			continue
+		}
+		id := fmt.Sprintf("%s@%s", jobid, candidate.peer.Name)
+		d.Lock()
+		d.addRemote(id, remoteJob{Peer: candidate.peer.Name, JobID: jobid, Session: session})
+		d.Unlock()
+		log.Printf("(proxy) Pushed job to peer %s (load %f, local load %f): %s\n",
+			candidate.peer.Name, candidate.load, load, id)
+		return id, true
+	}
+	return "", false
+}
+
+// track remembers a job submitted in the cluster so that peers can
+// fetch it while it is queued.
+func (d *JobDistributor) track(session, jobid string, jt types.JobTemplate) {
+	if d == nil || len(d.config.FetchAcceptFrom) == 0 || jt.ReservationId != "" || d.usesStagedFiles(session, jt) {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	job := &pendingJob{Session: session, Template: jt}
+	d.pending[jobid] = job
+	if err := d.store.put(pendingBucket, jobid, job); err != nil {
+		log.Printf("(proxy) Can not store pending job %s: %s\n", jobid, err)
+	}
+}
+
+// fetchable returns the ids of the pending jobs which are not
+// reserved by a peer.
+func (d *JobDistributor) fetchable(now time.Time) []string {
+	d.Lock()
+	defer d.Unlock()
+	jobids := make([]string, 0, len(d.pending))
+	for jobid, job := range d.pending {
+		if job.reservedBy == "" || !now.Before(job.reservedUntil) {
+			jobids = append(jobids, jobid)
+		}
+	}
+	sort.Strings(jobids)
+	return jobids
+}
+
+// queued returns the state of a pending job and if the job can still
+// be fetched. Jobs which started, finished, or are not known anymore
+// are removed from the pending jobs.
+func (d *JobDistributor) queued(jobid string, now time.Time) (types.JobState, bool) {
+	ji := d.impl.GetJobInfo(jobid)
+	if ji != nil && (ji.State == types.Queued || ji.State == types.QueuedHeld) {
+		return ji.State, true
+	}
+	d.Lock()
+	defer d.Unlock()
+	if job, exists := d.pending[jobid]; exists && (job.reservedBy == "" || !now.Before(job.reservedUntil)) {
+		d.removePending(jobid)
+	}
+	return types.Undetermined, false
+}
+
+// reserve returns a queued job for the peer and keeps it for the peer
+// until the job is confirmed or the reservation expires. The states of
+// the jobs are requested without holding the lock.
+func (d *JobDistributor) reserve(peer string) (types.DistributedJob, bool) {
+	now := time.Now()
+	for _, jobid := range d.fetchable(now) {
+		if state, ok := d.queued(jobid, now); !ok || state == types.QueuedHeld {
+			continue
+		}
+		d.Lock()
+		job, exists := d.pending[jobid]
+		if !exists || (job.reservedBy != "" && now.Before(job.reservedUntil)) {
+			// reserved by another peer in the meantime
+			d.Unlock()
+			continue
+		}
+		job.reservedBy, job.reservedUntil = peer, now.Add(fetchReservation)
+		jt := job.Template
+		d.Unlock()
+		jt.WorkingDirectory = ""
+		return types.DistributedJob{JobId: jobid, JobSession: job.Session, JobTemplate: jt}, true
+	}
+	return types.DistributedJob{}, false
+}
+
+// PrunePending removes the pending jobs which can't be fetched anymore
+// and returns their amount. PrunePending is called periodically when
+// peers can fetch jobs.
+func (d *JobDistributor) PrunePending() int {
+	pruned := 0
+	now := time.Now()
+	for _, jobid := range d.fetchable(now) {
+		if _, ok := d.queued(jobid, now); !ok {
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// pruneLoop prunes the pending jobs until the context is done.
+func (d *JobDistributor) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.PrunePending()
+		}
+	}
+}
+
+// confirm terminates a job fetched by the peer after the peer submitted
+// it as newid. Later requests for the job are forwarded to the peer.
+// The job stays pending when it can't be terminated.
+func (d *JobDistributor) confirm(peer, jobid, newid string) error {
+	d.Lock()
+	job, exists := d.pending[jobid]
+	if !exists || job.reservedBy != peer {
+		d.Unlock()
+		return Errorf(types.ErrorCodeNotFound, "job %s is not fetched by %s", jobid, peer)
+	}
+	session := job.Session
+	d.Unlock()
+
+	if ji := d.impl.GetJobInfo(jobid); ji == nil || ji.State != types.Queued {
+		return Errorf(types.ErrorCodeConflict, "job %s is not queued anymore", jobid)
+	}
+	if _, err := d.impl.JobOperation(session, "terminate", jobid); err != nil {
+		return Errorf(types.ErrorCodeConflict, "can not terminate job %s: %s", jobid, err)
+	}
+	d.Lock()
+	d.removePending(jobid)
+	d.addRemote(jobid, remoteJob{Peer: peer, Fetched: true, JobID: newid, Session: session})
+	d.Unlock()
+	log.Printf("(proxy) Job %s was fetched by peer %s (%s)\n", jobid, peer, newid)
+	return nil
+}
+
+// fetchLoop fetches jobs from the peers until the context is done.
+func (d *JobDistributor) fetchLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Fetch()
+		}
+	}
+}
+
+// Fetch asks each peer of FetchFrom for one pending job when the load
+// of the cluster is low and submits the jobs in the cluster. It returns
+// the amount of fetched jobs. Fetch is called periodically when job
+// distribution is enabled.
+func (d *JobDistributor) Fetch() int {
+	fetched := 0
+	for _, peer := range d.config.FetchFrom {
+		if load := d.impl.DRMSLoad(); load > d.config.LowLoad {
+			log.Printf("(proxy) Not fetching jobs, load %f is above %f\n", load, d.config.LowLoad)
+			return fetched
+		}
+		if d.fetchFrom(peer) {
+			fetched++
+		}
+	}
+	return fetched
+}
+
+// fetchFrom fetches one pending job from the peer and submits it.
+func (d *JobDistributor) fetchFrom(peer Peer) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+	pc := d.peerClient(peer)
+	job, exists, err := pc.FetchJob(ctx)
+	if err != nil {
+		log.Printf("(proxy) Fetching job from peer %s failed: %s\n", peer.Name, err)
+		return false
+	}
+	if !exists {
+		return false
+	}
+
+	sessions := getJobSessions(d.impl)
+	if _, exists := sessions.lookup(job.JobSession); !exists {
+		if err := sessions.create(job.JobSession); err != nil {
+			log.Printf("(proxy) Can not create job session for fetched job: %s\n", err)
+			return false
+		}
+	}
+	jt := job.JobTemplate
+	jt.WorkingDirectory = stagingDir(d.stagingBase, job.JobSession)
+	newid, err := d.impl.RunJob(jt)
+	if err != nil {
+		log.Printf("(proxy) Submitting job fetched from peer %s failed: %s\n", peer.Name, err)
+		return false
+	}
+	if err := pc.ConfirmFetchedJob(ctx, job.JobId, newid); err != nil {
+		log.Printf("(proxy) Peer %s refused fetched job %s: %s\n", peer.Name, job.JobId, err)
+		d.impl.JobOperation(job.JobSession, "terminate", newid)
+		return false
+	}
+	sessions.addJob(job.JobSession, newid)
+	log.Printf("(proxy) Fetched job %s from peer %s as job %s\n", job.JobId, peer.Name, newid)
+	return true
+}
+
+// remoteJob returns the job running in a peer cluster and the peer.
+// Jobs of peers which are not configured anymore are reported as
+// not found.
+func (d *JobDistributor) remoteJob(jobid string) (remoteJob, Peer, bool, error) {
+	if d == nil {
+		return remoteJob{}, Peer{}, false, nil
+	}
+	d.Lock()
+	job, exists := d.remote[jobid]
+	d.Unlock()
+	if !exists {
+		return job, Peer{}, false, nil
+	}
+	peer, configured := d.peer(job)
+	if !configured {
+		return job, peer, true, Errorf(types.ErrorCodeNotFound, "job %s runs in peer %s which is not configured", jobid, job.Peer)
+	}
+	return job, peer, true, nil
+}
+
+// peerError converts the error of a request to a peer into an Error.
+func peerError(peer Peer, err error) error {
+	if client.IsNotFound(err) {
+		return ErrJobNotFound
+	}
+	if e, ok := err.(*client.Error); ok && e.Code != "" {
+		return Errorf(e.Code, "peer %s: %s", peer.Name, e.Message)
+	}
+	return Errorf(types.ErrorCodeInternal, "peer %s: %s", peer.Name, err)
+}
+
+// jobInfo returns the job info of a job running in a peer cluster. The
+// returned bool is false if the job does not run in a peer cluster.
+func (d *JobDistributor) jobInfo(jobid string) (*types.JobInfo, bool, error) {
+	job, peer, exists, err := d.remoteJob(jobid)
+	if !exists || err != nil {
+		return nil, exists, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+	ji, err := d.peerClient(peer).GetJobInfo(ctx, job.JobID)
+	if err != nil {
+		return nil, true, peerError(peer, err)
+	}
+	ji.Id = jobid
+	if ji.Annotation == "" {
+		ji.Annotation = "running in " + peer.Name
+	}
+	return &ji, true, nil
+}
+
+// currentJobInfo returns the job info of a job of the cluster or of a
+// job running in a peer cluster. The job info is nil when the job is
+// not known anymore. An error is returned when the peer can't tell.
+func currentJobInfo(impl ProxyImplementer, jobid string) (*types.JobInfo, error) {
+	ji, remote, err := getJobDistributor(impl).jobInfo(jobid)
+	if !remote {
+		return impl.GetJobInfo(jobid), nil
+	}
+	if e, ok := err.(*Error); ok && e.Code == types.ErrorCodeNotFound {
+		return nil, nil
+	}
+	return ji, err
+}
+
+// remoteJobIDs returns the ids of all jobs of the job session which
+// run in peer clusters.
+func (d *JobDistributor) remoteJobIDs(session string) []string {
+	if d == nil {
+		return nil
+	}
+	d.Lock()
+	defer d.Unlock()
+	jobids := make([]string, 0)
+	for jobid, job := range d.remote {
+		if job.Session == session {
+			jobids = append(jobids, jobid)
+		}
+	}
+	sort.Strings(jobids)
+	return jobids
+}
+
+// jobOperation performs the operation on a job running in a peer
+// cluster. The returned bool is false if the job does not run in a
+// peer cluster.
+func (d *JobDistributor) jobOperation(operation, jobid string) (string, bool, error) {
+	job, peer, exists, err := d.remoteJob(jobid)
+	if !exists || err != nil {
+		return "", exists, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+	answer, err := d.peerClient(peer).JobOperation(ctx, job.Session, operation, job.JobID)
+	if err != nil {
+		return "", true, peerError(peer, err)
+	}
+	return answer, true, nil
+}
+
+// PeerID returns the common name of the verified client certificate
+// of the request or "" if the request has no verified certificate.
+func PeerID(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return ""
+}
+
+// authenticatePeer returns the peer of the accept list which sent the
+// request. Peers with a verified client certificate are identified by
+// its common name. Otherwise the peer named in the types.PeerHeader
+// has to send its Secret in the types.PeerSecretHeader.
+func authenticatePeer(r *http.Request, accepted []Peer) (string, bool) {
+	if id := PeerID(r); id != "" {
+		for _, peer := range accepted {
+			if peer.Name == id {
+				return id, true
+			}
+		}
+		return id, false
+	}
+	id := r.Header.Get(types.PeerHeader)
+	secret := r.Header.Get(types.PeerSecretHeader)
+	for _, peer := range accepted {
+		if peer.Name == id && peer.Secret != "" &&
+			subtle.ConstantTimeCompare([]byte(peer.Secret), []byte(secret)) == 1 {
+			return id, true
+		}
+	}
+	return id, false
+}
+
+// acceptPeer returns the id of the peer which sent the request if it
+// is authenticated and in the accept list. Otherwise an error is sent
+// and false is returned.
+func acceptPeer(w http.ResponseWriter, r *http.Request, d *JobDistributor, accepted func(DistributionConfig) []Peer) (string, bool) {
+	if d == nil {
+		writeError(w, Errorf(types.ErrorCodeNotImplemented, "job distribution is not enabled"), nil)
+		return "", false
+	}
+	peer, ok := authenticatePeer(r, accepted(d.config))
+	if ok {
+		return peer, true
+	}
+	log.Printf("(proxy) Rejecting job distribution request of peer %q\n", peer)
+	writeError(w, Errorf(types.ErrorCodeForbidden, "peer %q is not accepted", peer),
+		map[string]string{"peer": peer})
+	return "", false
+}
+
+// MakeDistributionPushHandler returns an http handler function which
+// submits a JSON encoded types.DistributedJob pushed by a peer listed
+// in DistributeAcceptFrom. The job is not distributed any further.
+func MakeDistributionPushHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	distributor := getJobDistributor(impl)
+	sessions := getJobSessions(impl)
+	history := getHistoryRecorder(impl, pi)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		peer, ok := acceptPeer(w, r, distributor, func(c DistributionConfig) []Peer { return c.DistributeAcceptFrom })
+		if !ok {
+			return
+		}
+		var job types.DistributedJob
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		session, exists := sessions.lookup(job.JobSession)
+		if !exists {
+			if err := sessions.create(session); err != nil {
+				writeError(w, err, map[string]string{"jsession": session})
+				return
+			}
+		}
+		jt := job.JobTemplate
+		jt.WorkingDirectory = stagingDir(distributor.stagingBase, session)
+		jobid, err := impl.RunJob(jt)
+		if err != nil {
+			log.Printf("(proxy) Error during submission of job pushed by %s: %s\n", peer, err)
+			writeError(w, err, nil)
+			return
+		}
+		log.Printf("(proxy) Job pushed by peer %s submitted: %s\n", peer, jobid)
+		sessions.addJob(session, jobid)
+		if pi != nil {
+			if err := pi.SaveJobTemplate(jobid, jt); err == nil {
+				history.track(jobid)
+			}
+		}
+		json.NewEncoder(w).Encode(RunJobResult{JobId: jobid})
+	}
+}
+
+// MakeDistributionFetchHandler returns an http handler function which
+// hands out a queued job to a peer listed in FetchAcceptFrom. The answer
+// is a JSON encoded types.DistributedJob or NotFound when no job is
+// queued. Requests for the job are later sent to the Address of the
+// peer in FetchAcceptFrom.
+func MakeDistributionFetchHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	distributor := getJobDistributor(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := acceptPeer(w, r, distributor, func(c DistributionConfig) []Peer { return c.FetchAcceptFrom })
+		if !ok {
+			return
+		}
+		job, exists := distributor.reserve(peer)
+		if !exists {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "no pending job", nil)
+			return
+		}
+		log.Printf("(proxy) Job %s is fetched by peer %s\n", job.JobId, peer)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// MakeDistributionFetchedHandler returns an http handler function which
+// terminates a job fetched by a peer after the peer confirmed with a
+// JSON encoded types.FetchConfirmation that it submitted the job.
+func MakeDistributionFetchedHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	distributor := getJobDistributor(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobid := mux.Vars(r)["jobid"]
+		peer, ok := acceptPeer(w, r, distributor, func(c DistributionConfig) []Peer { return c.FetchAcceptFrom })
+		if !ok {
+			return
+		}
+		var confirmation types.FetchConfirmation
+		if err := json.NewDecoder(r.Body).Decode(&confirmation); err != nil || confirmation.JobId == "" {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "job id of the fetched job is required", nil)
+			return
+		}
+		if err := distributor.confirm(peer, jobid, confirmation.JobId); err != nil {
+			writeError(w, err, map[string]string{"jobid": jobid})
+			return
+		}
+		json.NewEncoder(w).Encode("Job fetched")
+	}
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// BoltDB buckets of the distribution store which contain the JSON
+// encoded jobs with the job id of the proxy as key.
+var (
+	pendingBucket = []byte("pending")
+	remoteBucket  = []byte("remote")
+)
+
+// distributionStore keeps the jobs which can be fetched by peers and
+// the jobs running in peer clusters in a BoltDB file, so that they
+// can be reached after a restart of the proxy. A nil store keeps
+// nothing.
+type distributionStore struct {
+	db *bolt.DB
+}
+
+// openDistributionStore opens or creates the BoltDB file of the
+// distribution store. For an empty path nil is returned.
+func openDistributionStore(path string) (*distributionStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{pendingBucket, remoteBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &distributionStore{db: db}, nil
+}
+
+// Close closes the BoltDB file.
+func (ds *distributionStore) Close() error {
+	if ds == nil {
+		return nil
+	}
+	return ds.db.Close()
+}
+
+// put stores the JSON encoded value of the job.
+func (ds *distributionStore) put(bucket []byte, jobid string, v interface{}) error {
+	if ds == nil {
+		return nil
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(jobid), value)
+	})
+}
+
+// remove deletes the job from the bucket.
+func (ds *distributionStore) remove(bucket []byte, jobid string) error {
+	if ds == nil {
+		return nil
+	}
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(jobid))
+	})
+}
+
+// load calls add for each job of the bucket.
+func (ds *distributionStore) load(bucket []byte, add func(jobid string, value []byte) error) error {
+	if ds == nil {
+		return nil
+	}
+	return ds.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			return add(string(k), v)
+		})
+	})
+}
@@ -0,0 +1,298 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// loadProxy is a ProxyImplementer with a fixed load which keeps all
+// submitted jobs queued until they are terminated. Terminating jobs
+// fails with terminateErr when it is set.
+type loadProxy struct {
+	*stateProxy
+	name         string
+	load         float64
+	terminateErr error
+}
+
+func newLoadProxy(name string, load float64) *loadProxy {
+	return &loadProxy{stateProxy: &stateProxy{states: map[string]types.JobState{}}, name: name, load: load}
+}
+
+func (lp *loadProxy) DRMSLoad() float64 { return lp.load }
+
+func (lp *loadProxy) RunJob(template types.JobTemplate) (string, error) {
+	lp.Lock()
+	jobid := fmt.Sprintf("%s%d", lp.name, len(lp.states)+1)
+	lp.Unlock()
+	lp.setState(jobid, types.Queued)
+	return jobid, nil
+}
+
+func (lp *loadProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	if lp.GetJobInfo(jobid) == nil {
+		return "", ErrJobNotFound
+	}
+	if operation == "terminate" {
+		if lp.terminateErr != nil {
+			return "", lp.terminateErr
+		}
+		lp.setState(jobid, types.Failed)
+	}
+	return "done", nil
+}
+
+// startPeer starts the proxy of a peer after job distribution is
+// enabled with the given config. The address of the peer is known
+// before it is started.
+func startPeer(impl ProxyImplementer, server *httptest.Server, config DistributionConfig) *JobDistributor {
+	d, err := EnableJobDistribution(impl, config)
+	Ω(err).Should(BeNil())
+	server.Config.Handler = NewProxyRouter(impl, SecConfig{}, nil)
+	server.Start()
+	return d
+}
+
+var _ = Describe("ProxyDistribution", func() {
+
+	var (
+		busy, idle         *loadProxy
+		busyS, idleS       *httptest.Server
+		busyPeer, idlePeer Peer
+		busyD, idleD       *JobDistributor
+		c                  *client.Client
+	)
+
+	BeforeEach(func() {
+		busy, idle = newLoadProxy("b", 0.9), newLoadProxy("i", 0.1)
+		busyS, idleS = httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)
+		busyPeer = Peer{Name: "busy", Address: "http://" + busyS.Listener.Addr().String() + "/v1", Secret: "s3cr3t"}
+		idlePeer = Peer{Name: "idle", Address: "http://" + idleS.Listener.Addr().String() + "/v1", Secret: "s3cr3t"}
+		busyD, idleD = nil, nil
+		c = client.New(busyPeer.Address, nil)
+	})
+
+	AfterEach(func() {
+		for _, d := range []*JobDistributor{busyD, idleD} {
+			if d != nil {
+				d.Stop()
+			}
+		}
+		busyS.Close()
+		idleS.Close()
+		os.RemoveAll("uploads")
+	})
+
+	Context("in push mode", func() {
+
+		It("should submit jobs in an accepting peer when the load is high", func() {
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", DistributeTo: []Peer{idlePeer}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle", DistributeAcceptFrom: []Peer{busyPeer}})
+
+			jobid, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(jobid).Should(Equal("i1@idle"))
+			Ω(idle.GetJobInfo("i1")).ShouldNot(BeNil())
+
+			ji, err := c.GetJobInfo(context.Background(), jobid)
+			Ω(err).Should(BeNil())
+			Ω(ji.Id).Should(Equal(jobid))
+			Ω(ji.State).Should(Equal(types.Queued))
+
+			jis, err := c.GetJobSessionJobInfos(context.Background(), DefaultJobSession, "", "")
+			Ω(err).Should(BeNil())
+			Ω(jis).Should(HaveLen(1))
+			Ω(jis[0].Id).Should(Equal(jobid))
+
+			_, err = c.JobOperation(context.Background(), DefaultJobSession, "terminate", jobid)
+			Ω(err).Should(BeNil())
+			Ω(idle.GetJobInfo("i1").State).Should(Equal(types.Failed))
+		})
+
+		It("should keep the job history of jobs submitted in a peer", func() {
+			tmpdir, err := ioutil.TempDir("", "distribution")
+			Ω(err).Should(BeNil())
+			defer os.RemoveAll(tmpdir)
+			bp, err := persistency.NewBoltPersistency(filepath.Join(tmpdir, "history.db"))
+			Ω(err).Should(BeNil())
+			defer bp.Close()
+			busyD, err = EnableJobDistribution(busy, DistributionConfig{ID: "busy", DistributeTo: []Peer{idlePeer}})
+			Ω(err).Should(BeNil())
+			busyS.Config.Handler = NewProxyRouter(busy, SecConfig{}, bp)
+			busyS.Start()
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle", DistributeAcceptFrom: []Peer{busyPeer}})
+
+			jobid, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(jobid).Should(Equal("i1@idle"))
+			entries, err := c.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+			Ω(err).Should(BeNil())
+			Ω(entries).Should(HaveLen(1))
+			Ω(entries[0].JobId).Should(Equal(jobid))
+			Ω(entries[0].JobTemplate.RemoteCommand).Should(Equal("/bin/sleep"))
+
+			idle.setState("i1", types.Done)
+			Eventually(func() *types.JobInfo {
+				entries, _ := c.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+				return entries[0].JobInfo
+			}).ShouldNot(BeNil())
+		})
+
+		It("should run jobs locally when the peer does not accept them", func() {
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", DistributeTo: []Peer{idlePeer}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle", DistributeAcceptFrom: []Peer{{Name: "other"}}})
+
+			jobid, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(jobid).Should(Equal("b1"))
+			Ω(idle.GetJobInfo("i1")).Should(BeNil())
+		})
+
+		It("should not accept peers with a wrong or without a secret", func() {
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle", DistributeAcceptFrom: []Peer{busyPeer}})
+
+			for _, secret := range []string{"", "wrong"} {
+				pc := client.New(idlePeer.Address, nil)
+				pc.SetPeer("busy", secret)
+				_, err := pc.PushJob(context.Background(), types.DistributedJob{JobSession: DefaultJobSession})
+				Ω(err).ShouldNot(BeNil())
+				Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeForbidden))
+			}
+			Ω(idle.GetJobInfo("i1")).Should(BeNil())
+		})
+
+	})
+
+	Context("in pull mode", func() {
+
+		It("should let idle peers fetch queued jobs", func() {
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{idlePeer}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle",
+				FetchFrom: []Peer{busyPeer}, FetchInterval: "1h"})
+
+			jobid, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(jobid).Should(Equal("b1"))
+
+			Ω(idleD.Fetch()).Should(Equal(1))
+			Ω(busy.GetJobInfo("b1").State).Should(Equal(types.Failed))
+			Ω(idle.GetJobInfo("i1").State).Should(Equal(types.Queued))
+
+			// the job keeps its id
+			ji, err := c.GetJobInfo(context.Background(), jobid)
+			Ω(err).Should(BeNil())
+			Ω(ji.Id).Should(Equal("b1"))
+			Ω(ji.State).Should(Equal(types.Queued))
+
+			// nothing left to fetch
+			Ω(idleD.Fetch()).Should(Equal(0))
+		})
+
+		It("should not hand out jobs to peers which are not accepted", func() {
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{{Name: "other", Address: idlePeer.Address}}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle",
+				FetchFrom: []Peer{busyPeer}, FetchInterval: "1h"})
+
+			_, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(idleD.Fetch()).Should(Equal(0))
+			Ω(busy.GetJobInfo("b1").State).Should(Equal(types.Queued))
+
+			pc := client.New(busyPeer.Address, nil)
+			pc.SetPeer("idle", idlePeer.Secret)
+			_, _, err = pc.FetchJob(context.Background())
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeForbidden))
+		})
+
+		It("should keep fetched jobs which can't be terminated", func() {
+			busy.terminateErr = Errorf(types.ErrorCodeInternal, "can not terminate")
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{idlePeer}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle",
+				FetchFrom: []Peer{busyPeer}, FetchInterval: "1h"})
+
+			_, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(idleD.Fetch()).Should(Equal(0))
+			Ω(busy.GetJobInfo("b1").State).Should(Equal(types.Queued))
+			Ω(idle.GetJobInfo("i1").State).Should(Equal(types.Failed))
+
+			// the reservation of the peer is still valid
+			busy.terminateErr = nil
+			pc := client.New(busyPeer.Address, nil)
+			pc.SetPeer("idle", idlePeer.Secret)
+			Ω(pc.ConfirmFetchedJob(context.Background(), "b1", "i2")).Should(BeNil())
+			Ω(busy.GetJobInfo("b1").State).Should(Equal(types.Failed))
+		})
+
+		It("should prune pending jobs which are not queued anymore", func() {
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{idlePeer}})
+
+			for i := 0; i < 3; i++ {
+				_, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+				Ω(err).Should(BeNil())
+			}
+			busy.setState("b1", types.Running)
+			busy.setState("b2", types.Done)
+			Ω(busyD.PrunePending()).Should(Equal(2))
+			Ω(busyD.PrunePending()).Should(Equal(0))
+		})
+
+		It("should not fetch jobs when the load is high", func() {
+			idle.load = 0.5
+			busyD = startPeer(busy, busyS, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{idlePeer}})
+			idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle",
+				FetchFrom: []Peer{busyPeer}, FetchInterval: "1h"})
+
+			_, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+			Ω(err).Should(BeNil())
+			Ω(idleD.Fetch()).Should(Equal(0))
+		})
+
+	})
+
+	It("should keep the exchanged jobs after a restart", func() {
+		tmpdir, err := ioutil.TempDir("", "distribution")
+		Ω(err).Should(BeNil())
+		defer os.RemoveAll(tmpdir)
+		busyConfig := DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{idlePeer},
+			StateFile: filepath.Join(tmpdir, "busy.db")}
+		busyD = startPeer(busy, busyS, busyConfig)
+		idleD = startPeer(idle, idleS, DistributionConfig{ID: "idle",
+			FetchFrom: []Peer{busyPeer}, FetchInterval: "1h"})
+
+		jobid, err := c.RunJob(context.Background(), DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+		Ω(idleD.Fetch()).Should(Equal(1))
+
+		busyD.Stop()
+		busyD, err = EnableJobDistribution(busy, busyConfig)
+		Ω(err).Should(BeNil())
+		restarted := httptest.NewServer(NewProxyRouter(busy, SecConfig{}, nil))
+		defer restarted.Close()
+		ji, err := client.New(restarted.URL+"/v1", nil).GetJobInfo(context.Background(), jobid)
+		Ω(err).Should(BeNil())
+		Ω(ji.Id).Should(Equal(jobid))
+		Ω(ji.Annotation).Should(Equal("running in idle"))
+	})
+
+	It("should require the address of peers which can fetch jobs", func() {
+		_, err := EnableJobDistribution(busy, DistributionConfig{ID: "busy", FetchAcceptFrom: []Peer{{Name: "idle"}}})
+		Ω(err).ShouldNot(BeNil())
+	})
+
+})
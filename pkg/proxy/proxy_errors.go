@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// Error is an error with an error code (like types.ErrorCodeNotFound).
+// ProxyImplementers return it for letting the proxy answer with the
+// http status code belonging to the error code. All other errors are
+// reported as internal errors.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf creates an Error with the given error code and a formatted
+// message.
+func Errorf(code string, format string, a ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// Errors which are returned by ProxyImplementers.
+var (
+	ErrJobNotFound          = &Error{Code: types.ErrorCodeNotFound, Message: "job not found"}
+	ErrUnsupportedOperation = &Error{Code: types.ErrorCodeNotImplemented, Message: "operation not supported"}
+	ErrInvalidState         = &Error{Code: types.ErrorCodeConflict, Message: "operation not possible in current job state"}
+)
+
+// PartialResultError is returned by ProxyImplementers which collect
+// their results from other proxies (like uc in inception mode) together
+// with the results when some of the proxies were not reachable. The
+// results are sent and the unreachable proxies are listed in the
+// types.UnreachableHeader of the answer.
+type PartialResultError struct {
+	Unreachable []string
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("incomplete result, unreachable: %s", strings.Join(e.Unreachable, ", "))
+}
+
+// partialResult sets the types.UnreachableHeader and returns true when
+// the error is a PartialResultError so that the result can be sent.
+func partialResult(w http.ResponseWriter, err error) bool {
+	if e, ok := err.(*PartialResultError); ok {
+		w.Header().Set(types.UnreachableHeader, strings.Join(e.Unreachable, ","))
+		return true
+	}
+	return false
+}
+
+// errorStatusCodes maps the error codes to http status codes.
+var errorStatusCodes = map[string]int{
+	types.ErrorCodeInvalidRequest: http.StatusBadRequest,
+	types.ErrorCodeUnauthorized:   http.StatusUnauthorized,
+	types.ErrorCodeForbidden:      http.StatusForbidden,
+	types.ErrorCodeNotFound:       http.StatusNotFound,
+	types.ErrorCodeConflict:       http.StatusConflict,
+	types.ErrorCodeQuotaExceeded:  http.StatusRequestEntityTooLarge,
+	types.ErrorCodeInternal:       http.StatusInternalServerError,
+	types.ErrorCodeNotImplemented: http.StatusNotImplemented,
+	types.ErrorCodeLoopDetected:   http.StatusLoopDetected,
+}
+
+// StatusCode returns the http status code of an error code.
+// Unknown error codes are internal errors.
+func StatusCode(code string) int {
+	if status, exists := errorStatusCodes[code]; exists {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// writeErrorResponse sends a JSON encoded types.ErrorResponse with
+// the http status code belonging to the error code.
+func writeErrorResponse(w http.ResponseWriter, code, message string, details map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(StatusCode(code))
+	err := json.NewEncoder(w).Encode(types.ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: details,
+	})
+	if err != nil {
+		log.Printf("(proxy) Error during sending error response: %s\n", err)
+	}
+}
+
+// writeError sends the error as JSON encoded types.ErrorResponse. The
+// error code is taken from an Error, all other errors are internal
+// errors.
+func writeError(w http.ResponseWriter, err error, details map[string]string) {
+	if e, ok := err.(*Error); ok {
+		writeErrorResponse(w, e.Code, e.Message, details)
+		return
+	}
+	writeErrorResponse(w, types.ErrorCodeInternal, err.Error(), details)
+}
+
+// notFoundHandler answers requests for unknown routes.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeErrorResponse(w, types.ErrorCodeNotFound, "route not found",
+		map[string]string{"path": r.URL.Path})
+}
@@ -0,0 +1,86 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// opProxy is a ProxyImplementer which fails job operations with
+// the given error.
+type opProxy struct {
+	*stateProxy
+	err error
+}
+
+func (op *opProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	return "", op.err
+}
+
+var _ = Describe("ProxyErrors", func() {
+
+	var (
+		op     *opProxy
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		op = &opProxy{stateProxy: &stateProxy{states: map[string]types.JobState{}}}
+		server = httptest.NewServer(NewProxyRouter(op, SecConfig{}, nil))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	request := func(method, path string) (int, types.ErrorResponse) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		Ω(err).Should(BeNil())
+		resp, err := http.DefaultClient.Do(req)
+		Ω(err).Should(BeNil())
+		defer resp.Body.Close()
+		Ω(resp.Header.Get("Content-Type")).Should(Equal("application/json"))
+		var er types.ErrorResponse
+		Ω(json.NewDecoder(resp.Body).Decode(&er)).Should(BeNil())
+		return resp.StatusCode, er
+	}
+
+	It("should map error codes to http status codes", func() {
+		Ω(StatusCode(types.ErrorCodeInvalidRequest)).Should(Equal(http.StatusBadRequest))
+		Ω(StatusCode(types.ErrorCodeConflict)).Should(Equal(http.StatusConflict))
+		Ω(StatusCode(types.ErrorCodeNotImplemented)).Should(Equal(http.StatusNotImplemented))
+		Ω(StatusCode("unknown")).Should(Equal(http.StatusInternalServerError))
+	})
+
+	It("should answer unknown routes and jobs with not found errors", func() {
+		status, er := request("GET", "/v1/unknown")
+		Ω(status).Should(Equal(http.StatusNotFound))
+		Ω(er.Code).Should(Equal(types.ErrorCodeNotFound))
+
+		status, er = request("GET", "/v1/msession/jobinfo/42")
+		Ω(status).Should(Equal(http.StatusNotFound))
+		Ω(er.Details).Should(HaveKeyWithValue("jobid", "42"))
+	})
+
+	It("should take the status code from errors of the ProxyImplementer", func() {
+		op.err = ErrInvalidState
+		status, er := request("POST", "/v1/jsession/ubercluster/resume/1")
+		Ω(status).Should(Equal(http.StatusConflict))
+		Ω(er.Code).Should(Equal(types.ErrorCodeConflict))
+		Ω(er.Details).Should(HaveKeyWithValue("operation", "resume"))
+
+		status, er = request("POST", "/v1/jsession/ubercluster/release/1")
+		Ω(status).Should(Equal(http.StatusConflict))
+		Ω(er.Details).Should(HaveKeyWithValue("operation", "release"))
+	})
+
+})
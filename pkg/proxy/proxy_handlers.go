@@ -29,6 +29,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
@@ -56,44 +57,85 @@ func getDRMAA2JobState(state string) types.JobState {
 	return types.Undetermined
 }
 
+// parseJobInfoFilter reads the "state" and "user" form values which
+// restrict the job infos returned to the client.
+func parseJobInfoFilter(r *http.Request) (bool, types.JobInfo) {
+	filterSet := false
+	var filter types.JobInfo
+	if state := r.FormValue("state"); state != "all" && state != "" {
+		filter.State = getDRMAA2JobState(state)
+		log.Printf("filter for state: %s\n", filter.State)
+		filterSet = true
+	}
+	if user := r.FormValue("user"); user != "" {
+		filter.JobOwner = user
+		log.Printf("filter for user: %s\n", filter.JobOwner)
+		filterSet = true
+	}
+	return filterSet, filter
+}
+
+// matchesJobInfoFilter returns true if the job info matches the
+// filter read by parseJobInfoFilter.
+func matchesJobInfoFilter(filterSet bool, filter, ji types.JobInfo) bool {
+	if !filterSet {
+		return true
+	}
+	if filter.State != types.Unset && filter.State != ji.State {
+		return false
+	}
+	return filter.JobOwner == "" || filter.JobOwner == ji.JobOwner
+}
+
 // MakeMSessionJobInfosHandler retuns an http handler function which returns
 // a JSON encoded collection of DRMAA2 job info object of all jobs available.
 func MakeMSessionJobInfosHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filterSet := false
-		var filter types.JobInfo
-		if state := r.FormValue("state"); state != "all" && state != "" {
-			filter.State = getDRMAA2JobState(state)
-			log.Printf("filter for state: %s\n", filter.State)
-			filterSet = true
-		}
-		if user := r.FormValue("user"); user != "" {
-			filter.JobOwner = user
-			log.Printf("filter for user: %s\n", filter.JobOwner)
-			filterSet = true
-		}
-		if jobinfos := impl.GetJobInfosByFilter(filterSet, filter); jobinfos != nil {
-			encoder := json.NewEncoder(w)
-			if err := encoder.Encode(jobinfos); err != nil {
-				fmt.Printf("Encoding error: %s\n", err)
-			} else {
-				log.Printf("Encoded: %s\n", jobinfos)
-			}
+		impl := forRequest(r, impl)
+		filterSet, filter := parseJobInfoFilter(r)
+		jobinfos := impl.GetJobInfosByFilter(filterSet, filter)
+		if jobinfos == nil {
+			writeErrorResponse(w, types.ErrorCodeInternal, "can not get job infos", nil)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		if err := encoder.Encode(jobinfos); err != nil {
+			fmt.Printf("Encoding error: %s\n", err)
+		} else {
+			log.Printf("Encoded: %v\n", jobinfos)
 		}
 	}
 }
 
 // MakeMSessionJobInfoHandler returns an http handler function which returns
-// a JSON encoded DRMAA2 Job Info object.
+// a JSON encoded DRMAA2 Job Info object. Finished jobs which are not known
+// by the DRM anymore are looked up in the job history. The job infos of
+// jobs which were distributed to peers are requested from the peers.
 func MakeMSessionJobInfoHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	distributor := getJobDistributor(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		vars := mux.Vars(r)
-		if jobid := vars["jobid"]; jobid != "" {
-			if jobinfo := impl.GetJobInfo(jobid); jobinfo != nil {
-				json.NewEncoder(w).Encode(*jobinfo)
+		jobid := vars["jobid"]
+		if jobinfo, remote, err := distributor.jobInfo(jobid); remote {
+			// the job runs in the cluster of a peer
+			if err != nil {
+				writeError(w, err, map[string]string{"jobid": jobid})
 			} else {
-				log.Printf("JobInfo not found for job %s\n", jobinfo)
+				json.NewEncoder(w).Encode(*jobinfo)
 			}
+		} else if jobinfo := impl.GetJobInfo(jobid); jobinfo != nil {
+			json.NewEncoder(w).Encode(*jobinfo)
+		} else if pi == nil {
+			log.Printf("JobInfo not found for job %s\n", jobid)
+			writeError(w, ErrJobNotFound, map[string]string{"jobid": jobid})
+		} else if jobinfo, err := pi.GetJobInfo(jobid); err == nil {
+			// the DRM forgot the job but it is in the job history
+			json.NewEncoder(w).Encode(jobinfo)
+		} else {
+			log.Printf("JobInfo not found for job %s\n", jobid)
+			writeError(w, ErrJobNotFound, map[string]string{"jobid": jobid})
 		}
 	}
 }
@@ -102,10 +144,12 @@ func MakeMSessionJobInfoHandler(impl ProxyImplementer, pi persistency.Persistenc
 // a JSON encoded collection of all machines availale in the DRM.
 func MakeMachinesHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if machines, err := impl.GetAllMachines(nil); err == nil {
+		impl := forRequest(r, impl)
+		if machines, err := impl.GetAllMachines(nil); err == nil || partialResult(w, err) {
 			json.NewEncoder(w).Encode(machines)
 		} else {
 			log.Printf("Error in GetAllMachines: %s\n", err)
+			writeError(w, err, nil)
 		}
 	}
 }
@@ -115,12 +159,17 @@ func MakeMachinesHandler(impl ProxyImplementer, pi persistency.PersistencyImplem
 // DRM system.
 func MakeMachineHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		vars := mux.Vars(r)
 		name := vars["name"]
-		if machines, err := impl.GetAllMachines([]string{name}); err == nil {
-			json.NewEncoder(w).Encode(machines)
-		} else {
+		if machines, err := impl.GetAllMachines([]string{name}); err != nil && !partialResult(w, err) {
 			log.Printf("Error in GetAllMachines: %s\n", err)
+			writeError(w, err, map[string]string{"machine": name})
+		} else if len(machines) == 0 {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "machine not found",
+				map[string]string{"machine": name})
+		} else {
+			json.NewEncoder(w).Encode(machines)
 		}
 	}
 }
@@ -129,10 +178,12 @@ func MakeMachineHandler(impl ProxyImplementer, pi persistency.PersistencyImpleme
 // all available queues in the DRM system JSON encoded.
 func MakeQueuesHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if queues, err := impl.GetAllQueues(nil); err == nil {
+		impl := forRequest(r, impl)
+		if queues, err := impl.GetAllQueues(nil); err == nil || partialResult(w, err) {
 			json.NewEncoder(w).Encode(queues)
 		} else {
 			log.Printf("Error in GetAllQueues: %s\n", err)
+			writeError(w, err, nil)
 		}
 	}
 }
@@ -141,12 +192,17 @@ func MakeQueuesHandler(impl ProxyImplementer, pi persistency.PersistencyImplemen
 // the requested queue if it is available on the system JSON encoded.
 func MakeQueueHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		vars := mux.Vars(r)
 		name := vars["name"]
-		if queues, err := impl.GetAllQueues([]string{name}); err == nil {
-			json.NewEncoder(w).Encode(queues)
-		} else {
+		if queues, err := impl.GetAllQueues([]string{name}); err != nil && !partialResult(w, err) {
 			log.Printf("Error in GetAllQueues: %s\n", err)
+			writeError(w, err, map[string]string{"queue": name})
+		} else if len(queues) == 0 {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "queue not found",
+				map[string]string{"queue": name})
+		} else {
+			json.NewEncoder(w).Encode(queues)
 		}
 	}
 }
@@ -154,11 +210,18 @@ func MakeQueueHandler(impl ProxyImplementer, pi persistency.PersistencyImplement
 // MakeMSessionDRMSVersionHandler returns an http handler function which
 // returns all available DRMAA2 job categories as JSON encoded string.
 func MakeJSessionCategoriesHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		if categories, err := impl.GetAllCategories(); err == nil {
+		impl := forRequest(r, impl)
+		if _, ok := jobSession(w, r, sessions); !ok {
+			return
+		}
+		if categories, err := impl.GetAllCategories(); err == nil || partialResult(w, err) {
 			json.NewEncoder(w).Encode(categories)
 		} else {
 			log.Printf("Error in GetAllCategories: %s\n", err)
+			writeError(w, err, nil)
 		}
 	}
 }
@@ -167,19 +230,29 @@ func MakeJSessionCategoriesHandler(impl ProxyImplementer, pi persistency.Persist
 // returns a requested job category when it is available.
 func MakeJSessionCategoryHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	// at the moment all job sessions have the same categories
+	sessions := getJobSessions(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		if _, ok := jobSession(w, r, sessions); !ok {
+			return
+		}
 		vars := mux.Vars(r)
 		name := vars["category"]
-		if categories, err := impl.GetAllCategories(); err == nil {
-			for _, c := range categories {
-				if c == name {
-					json.NewEncoder(w).Encode(c)
-					return
-				}
-			}
-		} else {
+		categories, err := impl.GetAllCategories()
+		if err != nil && !partialResult(w, err) {
 			log.Printf("Error in GetJobCategories: %s\n", err)
+			writeError(w, err, map[string]string{"category": name})
+			return
 		}
+		for _, c := range categories {
+			if c == name {
+				json.NewEncoder(w).Encode(c)
+				return
+			}
+		}
+		writeErrorResponse(w, types.ErrorCodeNotFound, "job category not found",
+			map[string]string{"category": name})
 	}
 }
 
@@ -187,6 +260,7 @@ func MakeJSessionCategoryHandler(impl ProxyImplementer, pi persistency.Persisten
 // returns the DRMS name encoded by the ProxyImplementer as JSON string.
 func MakeMSessionDRMSNameHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		json.NewEncoder(w).Encode(impl.DRMSName())
 	}
 }
@@ -195,6 +269,7 @@ func MakeMSessionDRMSNameHandler(impl ProxyImplementer, pi persistency.Persisten
 // returns the DRMS name encoded by the ProxyImplementer as JSON string.
 func MakeMSessionDRMSVersionHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		json.NewEncoder(w).Encode(impl.DRMSVersion())
 	}
 }
@@ -203,66 +278,93 @@ func MakeMSessionDRMSVersionHandler(impl ProxyImplementer, pi persistency.Persis
 // returns the DRMS encoded load by the ProxyImplementer as JSON string.
 func MakeMSessionDRMSLoadHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		json.NewEncoder(w).Encode(impl.DRMSLoad())
 	}
 }
 
+// stagingWorkingDir returns the absolute path of the staging area
+// ("uploads"). The staging area of the job session is the working
+// directory of submitted jobs.
+func stagingWorkingDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Can't set working directory for the jobs.")
+		os.Exit(2)
+	}
+	log.Println("(proxy) adapt cwd to ", wd, stagingArea)
+	return filepath.Join(wd, stagingArea)
+}
+
 // RunJobResult is the JSON answer when a job could successully
 // started in the cluster.
-type RunJobResult struct {
-	JobId string `json:"jobid"`
-}
+type RunJobResult = types.RunJobResult
 
 // MakeJSessionSubmitHandler returns an http handler function which
 // reads in a DRMAA2 job template struct (in JSON) in the body of the
 // http request. In case of success the job is submitted in the cluster
 // using the RunJob function implemented by the proxy.
-// TODO In case a ProxyImplementer is given as a parameter the job template
-// is made persistent.
+// In case a PersistencyImplementer is given as a parameter the job template
+// and the final job info of the job are made persistent. When job
+// distribution is enabled and the cluster is busy the job is submitted
+// in a peer cluster instead.
 func MakeJSessionSubmitHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
-	var workingDir string
-	if wd, wdErr := os.Getwd(); wdErr == nil {
-		log.Println("(proxy) adapt cwd to ", wd, "uploads")
-		workingDir = wd + "/uploads"
-	} else {
-		fmt.Println("Can't set working directory for the jobs.")
-		os.Exit(2)
-	}
+	stagingBase := stagingWorkingDir()
+	history := getHistoryRecorder(impl, pi)
+	sessions := getJobSessions(impl)
+	distributor := getJobDistributor(impl)
+	manager := getStagingManager(impl)
 
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		workingDir := stagingDir(stagingBase, session)
 		if body, err := ioutil.ReadAll(r.Body); err != nil {
 			log.Printf("(proxy) %s\n", err)
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
 		} else {
 			var jt types.JobTemplate
 			if uerr := json.Unmarshal(body, &jt); uerr != nil {
 				log.Println("(proxy) Unmarshall error")
-				http.Error(w, uerr.Error(), http.StatusInternalServerError)
+				writeErrorResponse(w, types.ErrorCodeInvalidRequest, uerr.Error(), nil)
 			} else {
 				log.Printf("(proxy) Set working dir for job %s\n", workingDir)
 				jt.WorkingDirectory = workingDir
-				// required when file is in staging area but not for general path
-				// jt.RemoteCommand = workingDir + "/" + jt.RemoteCommand
-				log.Println("(proxy) Submit now job")
-				// Submit job in compute cluster
-				if jobid, joberr := impl.RunJob(jt); joberr != nil {
-					log.Printf("(proxy) Error during job submission: %s\n", joberr)
-					http.Error(w, joberr.Error(), http.StatusInternalServerError)
-				} else {
+				// submit job in a peer cluster when the cluster is busy
+				jobid, pushed := distributor.push(session, jt)
+				if !pushed {
+					// required when file is in staging area but not for general path
+					// jt.RemoteCommand = workingDir + "/" + jt.RemoteCommand
+					log.Println("(proxy) Submit now job")
+					// Submit job in compute cluster
+					var joberr error
+					if jobid, joberr = impl.RunJob(jt); joberr != nil {
+						log.Printf("(proxy) Error during job submission: %s\n", joberr)
+						writeError(w, joberr, nil)
+						return
+					}
 					log.Printf("(proxy) Job successfully submitted: %s\n", jobid)
+					distributor.track(session, jobid, jt)
+				}
+				sessions.addJob(session, jobid)
+				manager.jobSubmitted(session, jobid)
 
-					// make job submission persistent on proxy
-					if pi != nil {
-						if err := pi.SaveJobTemplate(jobid, jt); err != nil {
-							log.Printf("(proxy) Error during making Job Template persistent: %s\n", err)
-						} else {
-							log.Printf("(proxy) Job template for job %s successfully made persistent.\n", jobid)
-						}
+				// make job submission persistent on proxy
+				if pi != nil {
+					if err := pi.SaveJobTemplate(jobid, jt); err != nil {
+						log.Printf("(proxy) Error during making Job Template persistent: %s\n", err)
+					} else {
+						log.Printf("(proxy) Job template for job %s successfully made persistent.\n", jobid)
+						history.track(jobid)
 					}
-
-					var result RunJobResult
-					result.JobId = jobid
-					json.NewEncoder(w).Encode(result)
 				}
+
+				var result RunJobResult
+				result.JobId = jobid
+				json.NewEncoder(w).Encode(result)
 			}
 		}
 	}
@@ -273,11 +375,13 @@ func MakeRunLocalHandler(impl ProxyImplementer, pi persistency.PersistencyImplem
 	return func(w http.ResponseWriter, r *http.Request) {
 		if body, err := ioutil.ReadAll(r.Body); err != nil {
 			log.Printf("(proxy) %s\n", err)
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
 		} else {
 			var rlr types.RunLocalRequest
 			if uerr := json.Unmarshal(body, &rlr); uerr != nil {
 				log.Println("(proxy) Unmarshall error")
-				http.Error(w, uerr.Error(), http.StatusInternalServerError)
+				writeErrorResponse(w, types.ErrorCodeInvalidRequest, uerr.Error(), nil)
+				return
 			}
 			cli := []string{"-c", rlr.Command + " " + rlr.Arg}
 
@@ -289,7 +393,9 @@ func MakeRunLocalHandler(impl ProxyImplementer, pi persistency.PersistencyImplem
 			log.Printf("Start command: %s %v\n", cmd.Path, cmd.Args)
 			if errStart := cmd.Start(); errStart != nil {
 				log.Printf("(proxy) Error during starting command %s %s: %s\n", rlr.Command, rlr.Arg, errStart.Error())
-				json.NewEncoder(w).Encode(fmt.Sprintf("Failed starting command: %s", errStart.Error()))
+				writeErrorResponse(w, types.ErrorCodeInternal,
+					fmt.Sprintf("Failed starting command: %s", errStart.Error()),
+					map[string]string{"command": rlr.Command})
 			} else {
 				json.NewEncoder(w).Encode(fmt.Sprintf("Started command with PID %d", cmd.Process.Pid))
 			}
@@ -297,120 +403,185 @@ func MakeRunLocalHandler(impl ProxyImplementer, pi persistency.PersistencyImplem
 	}
 }
 
+// MakeUCFileUploadHandler returns an http handler function which stores
+// an uploaded file in the staging area of the job session. The size of
+// the file is limited by the quotas of the staging area.
 func MakeUCFileUploadHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
-	stagingDir := "uploads"
-
-	if err := staging.CheckUploadFilesystem(stagingDir); err != nil {
+	if err := staging.CheckUploadFilesystem(stagingArea); err != nil {
 		fmt.Println(err)
 		os.Exit(2)
 	}
+	sessions := getJobSessions(impl)
+	manager := getStagingManager(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		// currently limited to 1GB until tested
-		const maxSize = 1024 * 1024 * 1024
-		if r.ContentLength > maxSize {
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		sessionDir := stagingDir(stagingArea, session)
+		if err := staging.CheckUploadFilesystem(sessionDir); err != nil {
+			log.Println("Error: ", err)
+			writeErrorResponse(w, types.ErrorCodeForbidden, "Error in staging area", nil)
+			return
+		}
+		maxSize := manager.config.MaxFileSize
+		if r.ContentLength > maxSize+maxFormOverhead {
 			log.Println("File content too large", r.ContentLength)
-			http.Error(w, "File too large", http.StatusExpectationFailed)
+			writeError(w, manager.quotaError(maxSize), nil)
 			return
 		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+maxFormOverhead)
 		err := r.ParseMultipartForm(1024 * 1024 * 128)
 		if err != nil {
 			log.Println(err)
-			http.Error(w, err.Error(), http.StatusExpectationFailed)
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
 			return
 		}
 
 		file, header, err := r.FormFile("file")
 		if err != nil {
 			log.Println("Error: ", err)
-			panic(err)
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
 		}
-		if strings.ContainsAny(header.Filename, "/\\!") || strings.Contains(header.Filename, "..") {
+		defer file.Close()
+		if strings.ContainsAny(header.Filename, "/\\!") || strings.Contains(header.Filename, "..") ||
+			strings.HasPrefix(header.Filename, internalFilePrefix) {
 			log.Println("File name contains invalid characters..", header.Filename)
-			http.Error(w, "File name contains invalid chars", http.StatusExpectationFailed)
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "File name contains invalid chars",
+				map[string]string{"filename": header.Filename})
 			return
 		}
-		dst, err := os.Create(stagingDir + "/" + header.Filename)
-		defer dst.Close()
+		path := filepath.Join(sessionDir, header.Filename)
+		identity := requestIdentity(r)
+		limit := manager.uploadLimit(sessionDir, identity, path)
+		if limit <= 0 {
+			writeError(w, manager.quotaError(limit), map[string]string{"filename": header.Filename})
+			return
+		}
+
+		// the file is written next to its destination and replaces an
+		// existing file only when it is within the quotas
+		dst, err := ioutil.TempFile(sessionDir, uploadTmpPrefix)
 		if err != nil {
-			panic(err)
+			log.Println("Error: ", err)
+			writeErrorResponse(w, types.ErrorCodeForbidden, err.Error(),
+				map[string]string{"filename": header.Filename})
+			return
 		}
+		defer os.Remove(dst.Name())
+		defer dst.Close()
 
-		if written, err := io.Copy(dst, io.LimitReader(file, maxSize)); err != nil {
+		written, err := io.Copy(dst, io.LimitReader(file, limit+1))
+		if err != nil {
 			log.Println("Error: ", err)
-			panic(err)
-		} else {
-			if written == maxSize {
-				log.Println("File upload too large.")
-				http.Error(w, "File too large", http.StatusExpectationFailed)
-				return
-			}
-			log.Println("File saved successfully")
+			writeError(w, err, map[string]string{"filename": header.Filename})
+			return
+		}
+		if written > limit {
+			log.Println("File upload too large.")
+			writeError(w, manager.quotaError(limit), map[string]string{"filename": header.Filename})
+			return
 		}
+		mode := os.FileMode(0644)
 		log.Println(r.FormValue("permission"))
 		if r.FormValue("permission") == "exec" {
 			// make the file an executable
-			if err := dst.Chmod(0700); err != nil {
-				log.Println(err)
-			} else {
-				log.Println("Made file executable.")
-			}
+			mode = 0700
+		}
+		if err := dst.Chmod(mode); err != nil {
+			log.Println(err)
+		}
+		if err := manager.commitUpload(session, identity, dst.Name(), path, written); err != nil {
+			log.Println("Error: ", err)
+			writeError(w, err, map[string]string{"filename": header.Filename})
+			return
 		}
+		log.Println("File saved successfully")
 
 		json.NewEncoder(w).Encode("File upload successful")
 	}
 }
 
 // MakeJSessionJobManipulationHandler returns an http handler function which
-// calls the JobOperation function defined by an ProxyImplementer.
+// calls the JobOperation function defined by an ProxyImplementer. Only jobs
+// of the job session can be manipulated.
 func MakeJSessionJobManipulationHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+	distributor := getJobDistributor(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
 		vars := mux.Vars(r)
-		name := vars["jsname"]
 		operation := vars["operation"]
 		jobid := vars["jobid"]
-		log.Println("(jobManipulationHandler) called with: ", name, operation, jobid)
+		log.Println("(jobManipulationHandler) called with: ", vars["jsname"], operation, jobid)
 
-		// job session name must be the one created by d2proxy
-		if name != "ubercluster" {
-			json.NewEncoder(w).Encode("invalid job session name")
+		name, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		if !sessions.contains(name, jobid) {
+			writeError(w, ErrJobNotFound, map[string]string{"jobid": jobid, "jsession": name})
 			return
 		}
-		if str, err := impl.JobOperation(name, operation, jobid); err == nil {
+		if str, remote, err := distributor.jobOperation(operation, jobid); remote {
+			// the job runs in the cluster of a peer
+			if err == nil {
+				json.NewEncoder(w).Encode(str)
+			} else {
+				writeError(w, err, map[string]string{"jobid": jobid, "operation": operation})
+			}
+		} else if str, array, err := emulatedArrayJobs.jobOperation(name, operation, jobid); array {
+			// the job is a job array emulated by the proxy
+			if err == nil {
+				json.NewEncoder(w).Encode(str)
+			} else {
+				writeError(w, err, map[string]string{"jobid": jobid, "operation": operation})
+			}
+		} else if str, err := impl.JobOperation(name, operation, jobid); err == nil {
 			json.NewEncoder(w).Encode(str)
 		} else {
-			json.NewEncoder(w).Encode(err)
+			writeError(w, err, map[string]string{"jobid": jobid, "operation": operation})
 		}
 	}
 }
 
 // MakeListFilesHandler creates an http handler function which returns
-// a list of all files in the staging area over http.
+// a list of all files in the staging area of the job session over http.
 func MakeListFilesHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	// TODO disallow based on config / startup params ...
+	sessions := getJobSessions(impl)
+	manager := getStagingManager(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("(ListFilesHandler) called")
-		// job session name must be the one created by d2proxy
-		// json.NewEncoder(w).Encode("invalid job session name")
-		if dir, err := os.Open("uploads"); err != nil {
-			fmt.Println("Can't open staging directory. ", err)
-			os.Exit(1)
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		sessionDir := stagingDir(stagingArea, session)
+		if dir, err := os.Open(sessionDir); err != nil {
+			log.Println("Can't open staging directory. ", err)
+			writeErrorResponse(w, types.ErrorCodeForbidden, "Error in staging area", nil)
 		} else {
+			defer dir.Close()
 			if fi, err := dir.Stat(); err != nil {
 				log.Println("Can't stat file staging directory: ", err)
-				http.Error(w, "Error in staging area", http.StatusForbidden)
+				writeErrorResponse(w, types.ErrorCodeForbidden, "Error in staging area", nil)
 				return
 			} else {
 				if fi.IsDir() == false {
 					log.Println("File staging directory not found: ", err)
-					http.Error(w, "Error in staging area", http.StatusForbidden)
+					writeErrorResponse(w, types.ErrorCodeForbidden, "Error in staging area", nil)
 					return
 				} else {
 					if fis, err := dir.Readdir(-1); err == nil {
 						log.Println("Files in staging directory found ")
 						fileinfos := make([]types.FileInfo, 0, len(fis))
 						for _, fi := range fis {
-							if fi.IsDir() == false {
+							if isStagedFile(fi) {
 								var info types.FileInfo
 								info.Filename = fi.Name()
 								info.Bytes = fi.Size()
@@ -419,15 +590,17 @@ func MakeListFilesHandler(impl ProxyImplementer, pi persistency.PersistencyImple
 								} else {
 									info.Executable = false
 								}
+								path := filepath.Join(sessionDir, fi.Name())
+								info.Owner = manager.owner(path)
+								info.Expires = manager.expires(path, fi)
 								fileinfos = append(fileinfos, info)
 								log.Println("added: ", info.Filename)
 							}
 						}
-						fmt.Println(fileinfos)
 						json.NewEncoder(w).Encode(fileinfos)
 					} else {
 						log.Println("Error during dir.Readdir: ", err)
-						http.Error(w, "Error in staging area", http.StatusForbidden)
+						writeErrorResponse(w, types.ErrorCodeForbidden, "Error in staging area", nil)
 					}
 				}
 			}
@@ -436,34 +609,47 @@ func MakeListFilesHandler(impl ProxyImplementer, pi persistency.PersistencyImple
 }
 
 // MakeDownloadFilesHandler returns an http handler function which
-// serves a file requested with the *name* http request.
+// serves a file of the staging area of the job session requested with
+// the *name* http request.
 func MakeDownloadFilesHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
 	// TODO uploads directory should be defined by the proxy implementer
-	// or depend from the job session.
+	sessions := getJobSessions(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
 		vars := mux.Vars(r)
-		if filename := vars["name"]; filename != "" {
-			log.Println("Serving file: ./uploads/", filename)
-			http.ServeFile(w, r, "./uploads/"+filename)
-		} else {
-			http.Error(w, "No filename given.", http.StatusForbidden)
+		filename := vars["name"]
+		if filename == "" || strings.ContainsAny(filename, "/\\") || strings.Contains(filename, "..") ||
+			strings.HasPrefix(filename, internalFilePrefix) {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "invalid filename",
+				map[string]string{"filename": filename})
+			return
+		}
+		path := filepath.Join(stagingDir(stagingArea, session), filename)
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "file not found in staging area",
+				map[string]string{"filename": filename})
+			return
 		}
+		log.Println("Serving file: ", path)
+		http.ServeFile(w, r, path)
 	}
 }
 
 // MakeSessionListHandler implements an http handler which serves
-// a list of (DRMAA2) job sessions available on this proxy.
+// a list of job sessions available on this proxy.
 func MakeSessionListHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		if sessions, err := impl.GetAllSessions(nil); err == nil {
-			json.NewEncoder(w).Encode(sessions)
-		} else {
-			log.Println("Error in GetAllSessions: ", err)
-		}
+		json.NewEncoder(w).Encode(sessions.names())
 	}
 }
 
 func AutenticationErrorHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Authentication error")
-	http.NotFound(w, r)
+	writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
 }
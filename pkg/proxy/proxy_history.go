@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// HistoryPollInterval is the interval in which the states of submitted
+// jobs are checked for making the job info of finished jobs persistent.
+var HistoryPollInterval = 5 * time.Second
+
+// historyRecorder saves the final job info of jobs submitted through
+// the proxy in the PersistencyImplementer. The job infos of jobs which
+// were pushed to peers are requested from the peers. Jobs which are not
+// known anymore are dropped without a job info.
+type historyRecorder struct {
+	sync.Mutex
+	impl    ProxyImplementer
+	pi      persistency.PersistencyImplementer
+	pending map[string]struct{}
+	running bool
+}
+
+// newHistoryRecorder creates a historyRecorder which continues to
+// track the unfinished jobs of the job history.
+func newHistoryRecorder(impl ProxyImplementer, pi persistency.PersistencyImplementer) *historyRecorder {
+	hr := &historyRecorder{
+		impl:    impl,
+		pi:      pi,
+		pending: make(map[string]struct{}),
+	}
+	if pi == nil {
+		return hr
+	}
+	entries, err := pi.GetJobHistory(persistency.HistoryFilter{})
+	if err != nil {
+		log.Printf("(proxy) Error during reading job history: %s\n", err)
+		return hr
+	}
+	for _, entry := range entries {
+		if entry.FinishedAt.IsZero() {
+			hr.track(entry.JobId)
+		}
+	}
+	return hr
+}
+
+// historyRecorders contains one historyRecorder per PersistencyImplementer.
+var historyRecorders = struct {
+	sync.Mutex
+	recorders map[persistency.PersistencyImplementer]*historyRecorder
+}{recorders: make(map[persistency.PersistencyImplementer]*historyRecorder)}
+
+// getHistoryRecorder returns the historyRecorder which stores the
+// job infos of finished jobs in the given PersistencyImplementer.
+func getHistoryRecorder(impl ProxyImplementer, pi persistency.PersistencyImplementer) *historyRecorder {
+	if pi == nil {
+		return newHistoryRecorder(impl, nil)
+	}
+	historyRecorders.Lock()
+	defer historyRecorders.Unlock()
+	hr, exists := historyRecorders.recorders[pi]
+	if !exists {
+		hr = newHistoryRecorder(impl, pi)
+		historyRecorders.recorders[pi] = hr
+	}
+	return hr
+}
+
+// track adds a job to the jobs which are checked for being finished.
+func (hr *historyRecorder) track(jobid string) {
+	if hr.pi == nil {
+		return
+	}
+	hr.Lock()
+	defer hr.Unlock()
+	hr.pending[jobid] = struct{}{}
+	if !hr.running {
+		hr.running = true
+		go hr.run()
+	}
+}
+
+// run checks the pending jobs in HistoryPollInterval until no job
+// is pending anymore.
+func (hr *historyRecorder) run() {
+	ticker := time.NewTicker(HistoryPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		hr.Lock()
+		jobids := make([]string, 0, len(hr.pending))
+		for jobid := range hr.pending {
+			jobids = append(jobids, jobid)
+		}
+		hr.Unlock()
+
+		finished := make([]string, 0, len(jobids))
+		for _, jobid := range jobids {
+			ji, err := currentJobInfo(hr.impl, jobid)
+			if err != nil {
+				log.Printf("(proxy) Can not get job info of job %s: %s\n", jobid, err)
+				continue
+			}
+			if ji == nil {
+				log.Printf("(proxy) Job %s is not known anymore, no job info stored\n", jobid)
+				finished = append(finished, jobid)
+				continue
+			}
+			if ji.State != types.Done && ji.State != types.Failed {
+				continue
+			}
+			if err := hr.pi.SaveJobInfo(jobid, *ji); err != nil {
+				log.Printf("(proxy) Error during making Job Info persistent: %s\n", err)
+				continue
+			}
+			finished = append(finished, jobid)
+		}
+
+		hr.Lock()
+		for _, jobid := range finished {
+			delete(hr.pending, jobid)
+		}
+		if len(hr.pending) == 0 {
+			hr.running = false
+			hr.Unlock()
+			return
+		}
+		hr.Unlock()
+	}
+}
+
+// parseHistoryFilter reads the "since", "until" (both RFC 3339) and
+// "owner" query parameters.
+func parseHistoryFilter(r *http.Request) (persistency.HistoryFilter, error) {
+	var filter persistency.HistoryFilter
+	query := r.URL.Query()
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, Errorf(types.ErrorCodeInvalidRequest, "invalid since time: %s", err)
+		}
+		filter.Since = t
+	}
+	if until := query.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return filter, Errorf(types.ErrorCodeInvalidRequest, "invalid until time: %s", err)
+		}
+		filter.Until = t
+	}
+	filter.Owner = query.Get("owner")
+	return filter, nil
+}
+
+// MakeMSessionJobHistoryHandler returns an http handler function which
+// returns the JSON encoded job history stored by the proxy. The jobs
+// can be filtered by a time range ("since" and "until" in RFC 3339)
+// and by the job owner ("owner").
+func MakeMSessionJobHistoryHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if pi == nil {
+			writeError(w, Errorf(types.ErrorCodeNotImplemented, "proxy has no job history"), nil)
+			return
+		}
+		filter, err := parseHistoryFilter(r)
+		if err != nil {
+			writeError(w, err, nil)
+			return
+		}
+		entries, err := pi.GetJobHistory(filter)
+		if err != nil {
+			log.Printf("(proxy) Error during reading job history: %s\n", err)
+			writeError(w, err, nil)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+// MakeMSessionJobTemplateHandler returns an http handler function which
+// returns the JSON encoded job template of a job stored in the job
+// history. It allows to submit the job again in another cluster.
+func MakeMSessionJobTemplateHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobid := mux.Vars(r)["jobid"]
+		if pi == nil {
+			writeError(w, Errorf(types.ErrorCodeNotImplemented, "proxy has no job history"), nil)
+			return
+		}
+		jt, err := pi.GetJobTemplate(jobid)
+		if err == persistency.ErrNotFound {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "job template not stored by proxy",
+				map[string]string{"jobid": jobid})
+			return
+		}
+		if err != nil {
+			log.Printf("(proxy) Error during reading job template: %s\n", err)
+			writeError(w, err, map[string]string{"jobid": jobid})
+			return
+		}
+		json.NewEncoder(w).Encode(jt)
+	}
+}
+
+// MakeMSessionJobMigrationHandler returns an http handler function which
+// records in the job history that a job was migrated. The body is a
+// JSON encoded types.JobMigration.
+func MakeMSessionJobMigrationHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobid := mux.Vars(r)["jobid"]
+		if pi == nil {
+			writeError(w, Errorf(types.ErrorCodeNotImplemented, "proxy has no job history"), nil)
+			return
+		}
+		var migration types.JobMigration
+		if err := json.NewDecoder(r.Body).Decode(&migration); err != nil {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		err := pi.SaveJobMigration(jobid, migration)
+		if err == persistency.ErrNotFound {
+			writeErrorResponse(w, types.ErrorCodeNotFound, "job not stored by proxy",
+				map[string]string{"jobid": jobid})
+			return
+		}
+		if err != nil {
+			log.Printf("(proxy) Error during recording job migration: %s\n", err)
+			writeError(w, err, map[string]string{"jobid": jobid})
+			return
+		}
+		log.Printf("(proxy) Recorded migration of job %s (from %q to %q)\n", jobid,
+			migration.MigratedFrom, migration.MigratedTo)
+		json.NewEncoder(w).Encode("Recorded job migration")
+	}
+}
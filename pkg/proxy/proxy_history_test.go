@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("ProxyHistory", func() {
+
+	var (
+		dir    string
+		tp     *taskProxy
+		bp     *persistency.BoltPersistency
+		server *httptest.Server
+		c      *client.Client
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "proxyhistory")
+		Ω(err).Should(BeNil())
+		bp, err = persistency.NewBoltPersistency(filepath.Join(dir, "history.db"))
+		Ω(err).Should(BeNil())
+		tp = &taskProxy{
+			stateProxy: &stateProxy{states: map[string]types.JobState{}},
+			taskIDs:    map[string]string{},
+		}
+		server = httptest.NewServer(NewProxyRouter(tp, SecConfig{}, bp))
+		c = client.New(server.URL+"/v1", nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		bp.Close()
+		os.RemoveAll(dir)
+		os.RemoveAll("uploads")
+	})
+
+	It("should store the job info of finished jobs in the job history", func() {
+		jobid, err := c.RunJob(context.Background(), "ubercluster", types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+
+		entries, err := c.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+		Ω(err).Should(BeNil())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].JobTemplate.RemoteCommand).Should(Equal("/bin/sleep"))
+		Ω(entries[0].JobInfo).Should(BeNil())
+
+		tp.setState(jobid, types.Done)
+		Eventually(func() *types.JobInfo {
+			entries, _ := c.GetJobHistory(context.Background(), time.Time{}, time.Time{}, "")
+			return entries[0].JobInfo
+		}).ShouldNot(BeNil())
+
+		// the DRM forgets the job but the proxy still knows it
+		tp.Lock()
+		delete(tp.states, jobid)
+		tp.Unlock()
+		ji, err := c.GetJobInfo(context.Background(), jobid)
+		Ω(err).Should(BeNil())
+		Ω(ji.State).Should(Equal(types.Done))
+	})
+
+	It("should reject invalid time ranges", func() {
+		resp, err := server.Client().Get(server.URL + "/v1/msession/jobhistory?since=yesterday")
+		Ω(err).Should(BeNil())
+		resp.Body.Close()
+		Ω(resp.StatusCode).Should(Equal(400))
+	})
+
+})
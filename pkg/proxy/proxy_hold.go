@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"fmt"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// HoldEmulator emulates holding and releasing jobs for ProxyImplementers
+// whose DRM starts each job immediately (like processes or containers).
+// Jobs submitted with SubmitAsHold are kept by the proxy in the
+// QueuedHeld state and are started when they get released. A held job
+// gets a job id assigned by the emulator ("held-1") which refers to the
+// started job after the release. Jobs which are already started can't
+// be held anymore.
+type HoldEmulator struct {
+	sync.Mutex
+	lastID int
+	jobs   map[string]*heldJob
+}
+
+// heldJob is a job submitted with SubmitAsHold.
+type heldJob struct {
+	template  types.JobTemplate
+	owner     string
+	submitted time.Time
+	releasing bool
+	released  bool
+	jobid     string // id of the started job after the release
+}
+
+// NewHoldEmulator creates a HoldEmulator without held jobs.
+func NewHoldEmulator() *HoldEmulator {
+	return &HoldEmulator{jobs: make(map[string]*heldJob)}
+}
+
+// Hold stores the job template and returns the job id of the held job.
+func (h *HoldEmulator) Hold(template types.JobTemplate) string {
+	template.SubmitAsHold = false
+	h.Lock()
+	defer h.Unlock()
+	h.lastID++
+	jobid := fmt.Sprintf("held-%d", h.lastID)
+	job := &heldJob{template: template, submitted: time.Now()}
+	if u, err := user.Current(); err == nil {
+		job.owner = u.Username
+	}
+	h.jobs[jobid] = job
+	return jobid
+}
+
+// JobID returns the id of the started job when the job id refers to
+// a released job. Otherwise the job id is returned unchanged.
+func (h *HoldEmulator) JobID(jobid string) string {
+	h.Lock()
+	defer h.Unlock()
+	if job, exists := h.jobs[jobid]; exists && job.released {
+		return job.jobid
+	}
+	return jobid
+}
+
+// jobInfo creates the job info of a held job.
+func (job *heldJob) jobInfo(jobid string) types.JobInfo {
+	return types.JobInfo{
+		Id:             jobid,
+		State:          types.QueuedHeld,
+		JobOwner:       job.owner,
+		QueueName:      job.template.QueueName,
+		SubmissionTime: job.submitted,
+		Annotation:     "held by the proxy",
+	}
+}
+
+// JobInfo returns the job info of a held job or nil if the job is
+// not held by the emulator.
+func (h *HoldEmulator) JobInfo(jobid string) *types.JobInfo {
+	h.Lock()
+	defer h.Unlock()
+	job, exists := h.jobs[jobid]
+	if !exists || job.released {
+		return nil
+	}
+	ji := job.jobInfo(jobid)
+	return &ji
+}
+
+// JobInfos returns the job infos of all held jobs.
+func (h *HoldEmulator) JobInfos() []types.JobInfo {
+	h.Lock()
+	defer h.Unlock()
+	jobinfos := make([]types.JobInfo, 0, len(h.jobs))
+	for jobid, job := range h.jobs {
+		if !job.released {
+			jobinfos = append(jobinfos, job.jobInfo(jobid))
+		}
+	}
+	return jobinfos
+}
+
+// JobOperation performs the operation on a held job. Releasing the job
+// starts it with the run function. A held job which is terminated is
+// removed. The returned bool is false when the job is not held by the
+// emulator so that the operation must be performed on the started job.
+func (h *HoldEmulator) JobOperation(operation, jobid string, run func(types.JobTemplate) (string, error)) (string, bool, error) {
+	h.Lock()
+	job, exists := h.jobs[jobid]
+	if !exists || job.released {
+		h.Unlock()
+		return "", false, nil
+	}
+	if job.releasing {
+		h.Unlock()
+		return "", true, ErrInvalidState
+	}
+	switch operation {
+	case "hold":
+		h.Unlock()
+		return "Held Job", true, nil
+	case "terminate":
+		delete(h.jobs, jobid)
+		h.Unlock()
+		return "Terminated Job", true, nil
+	case "release":
+		job.releasing = true
+		h.Unlock()
+	default:
+		h.Unlock()
+		return "", true, ErrInvalidState
+	}
+
+	started, err := run(job.template)
+
+	h.Lock()
+	defer h.Unlock()
+	job.releasing = false
+	if err != nil {
+		return "", true, err
+	}
+	job.released = true
+	job.jobid = started
+	return "Released Job", true, nil
+}
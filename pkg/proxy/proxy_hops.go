@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// RequestForwarder is an optional interface of a ProxyImplementer which
+// forwards requests to other proxies (like uc in inception mode). For
+// each request ForRequest is called with the hops of the request. The
+// returned ProxyImplementer handles the request and sends the hops
+// (extended by itself) to the proxies it forwards the request to. An
+// error (like a detected loop) is sent as answer of the request.
+type RequestForwarder interface {
+	ForRequest(hops types.Hops) (ProxyImplementer, error)
+}
+
+// requestImplementerKey is the context key of the ProxyImplementer
+// which handles a forwarded request.
+type requestImplementerKey struct{}
+
+// newRequestID creates a random id for a request which has no request
+// id yet.
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// HopsFromRequest returns the hops of a request. Requests which are not
+// forwarded by another proxy get a new request id.
+func HopsFromRequest(r *http.Request) types.Hops {
+	hops := types.Hops{
+		RequestID: r.Header.Get(types.RequestIDHeader),
+		Visited:   make([]string, 0),
+	}
+	if hops.RequestID == "" {
+		hops.RequestID = newRequestID()
+	}
+	for _, id := range strings.Split(r.Header.Get(types.VisitedHeader), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			hops.Visited = append(hops.Visited, id)
+		}
+	}
+	return hops
+}
+
+// MakeHopHandler returns an http handler function which lets a
+// RequestForwarder check the hops of the request before the request
+// is handled. For other ProxyImplementers the handler is returned
+// unchanged.
+func MakeHopHandler(impl ProxyImplementer, handler http.HandlerFunc) http.HandlerFunc {
+	forwarder, ok := impl.(RequestForwarder)
+	if !ok {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		hops := HopsFromRequest(r)
+		requestImpl, err := forwarder.ForRequest(hops)
+		if err != nil {
+			log.Printf("(proxy) Rejecting request %s: %s\n", hops.RequestID, err)
+			writeError(w, err, map[string]string{
+				"requestId": hops.RequestID,
+				"visited":   strings.Join(hops.Visited, ","),
+			})
+			return
+		}
+		ctx := context.WithValue(r.Context(), requestImplementerKey{}, requestImpl)
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// forRequest returns the ProxyImplementer which handles the request.
+// That is the ProxyImplementer returned by the RequestForwarder for
+// the request or impl itself.
+func forRequest(r *http.Request, impl ProxyImplementer) ProxyImplementer {
+	if requestImpl, ok := r.Context().Value(requestImplementerKey{}).(ProxyImplementer); ok {
+		return requestImpl
+	}
+	return impl
+}
@@ -0,0 +1,75 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"net/http/httptest"
+	"os"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// forwardProxy is a RequestForwarder which remembers the hops of the
+// last request and rejects requests with too many hops.
+type forwardProxy struct {
+	*stateProxy
+	hops types.Hops
+}
+
+func (fp *forwardProxy) ForRequest(hops types.Hops) (ProxyImplementer, error) {
+	if len(hops.Visited) > 1 {
+		return nil, Errorf(types.ErrorCodeLoopDetected, "too many hops")
+	}
+	fp.hops = hops
+	return fp, nil
+}
+
+var _ = Describe("ProxyHops", func() {
+
+	var (
+		fp     *forwardProxy
+		server *httptest.Server
+		c      *client.Client
+	)
+
+	BeforeEach(func() {
+		fp = &forwardProxy{stateProxy: &stateProxy{states: map[string]types.JobState{"1": types.Running}}}
+		server = httptest.NewServer(NewProxyRouter(fp, SecConfig{}, nil))
+		c = client.New(server.URL+"/v1", nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	It("should assign a request id to requests without hops", func() {
+		_, err := c.GetJobInfo(context.Background(), "1")
+		Ω(err).Should(BeNil())
+		Ω(fp.hops.RequestID).ShouldNot(BeEmpty())
+		Ω(fp.hops.Visited).Should(BeEmpty())
+	})
+
+	It("should pass the hops of forwarded requests", func() {
+		c.SetHops(types.Hops{RequestID: "42", Visited: []string{"a"}})
+		_, err := c.GetJobInfo(context.Background(), "1")
+		Ω(err).Should(BeNil())
+		Ω(fp.hops).Should(Equal(types.Hops{RequestID: "42", Visited: []string{"a"}}))
+	})
+
+	It("should reject requests refused by the forwarder", func() {
+		c.SetHops(types.Hops{RequestID: "42", Visited: []string{"a", "b"}})
+		_, err := c.GetJobInfo(context.Background(), "1")
+		Ω(err).ShouldNot(BeNil())
+		e := err.(*client.Error)
+		Ω(e.StatusCode).Should(Equal(508))
+		Ω(e.Code).Should(Equal(types.ErrorCodeLoopDetected))
+		Ω(e.Details).Should(HaveKeyWithValue("visited", "a,b"))
+	})
+
+})
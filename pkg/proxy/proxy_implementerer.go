@@ -1,12 +1,17 @@
 package proxy
 
 import (
+	"context"
+	"io"
+
 	"github.com/dgruber/ubercluster/pkg/types"
 )
 
 // ProxyImplementer interface specified functions required to interface
 // a ubercluster proxy. Those functions are called in the standard
-// http request handlers.
+// http request handlers. JobOperation performs one of the operations
+// "suspend", "resume", "terminate", "hold" (keep a queued job from
+// being scheduled), and "release" (remove the hold of a job).
 type ProxyImplementer interface {
 	GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo
 	GetJobInfo(jobid string) *types.JobInfo
@@ -20,3 +25,43 @@ type ProxyImplementer interface {
 	JobOperation(jobsessionname, operation, jobid string) (string, error)
 	DRMSLoad() float64
 }
+
+// JobInfoWatcher is an optional interface of a ProxyImplementer which
+// is able to report job state changes itself. The returned channel
+// delivers a job info each time a job changes its state and is closed
+// when the context is done. If jobid is not empty only that job is
+// watched.
+type JobInfoWatcher interface {
+	WatchJobInfos(ctx context.Context, jobid string) (<-chan types.JobInfo, error)
+}
+
+// JobOutputProvider is an optional interface of a ProxyImplementer which
+// gives access to the output of jobs. The stream is either "stdout" or
+// "stderr". When follow is set the returned reader delivers new output
+// until the job is finished or the context is done.
+type JobOutputProvider interface {
+	JobOutput(ctx context.Context, jobid, stream string, follow bool) (io.ReadCloser, error)
+}
+
+// BulkJobRunner is an optional interface of a ProxyImplementer which
+// submits job arrays natively (like DRMAA2 RunBulkJobs). Each task
+// needs to find its task index in the environment variable
+// TaskIDEnvironmentVariable. GetArrayJobInfo returns nil when the
+// array job is not known. If a ProxyImplementer does not implement
+// the interface the tasks are submitted one by one with RunJob.
+type BulkJobRunner interface {
+	RunBulkJobs(template types.JobTemplate, begin, end, step, maxParallel int) (string, error)
+	GetArrayJobInfo(arrayjobid string) *types.ArrayJobInfo
+}
+
+// ReservationImplementer is an optional interface of a ProxyImplementer
+// which supports DRMAA2 advance reservations. The reservations are
+// grouped in reservation sessions. Unknown reservations are reported
+// with an Error with types.ErrorCodeNotFound. Jobs run in a reservation
+// when the reservation id is set in their job template.
+type ReservationImplementer interface {
+	RequestReservation(rsession string, template types.ReservationTemplate) (types.ReservationInfo, error)
+	GetReservations(rsession string) ([]types.ReservationInfo, error)
+	GetReservation(rsession, reservationid string) (types.ReservationInfo, error)
+	TerminateReservation(rsession, reservationid string) error
+}
@@ -0,0 +1,384 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// DefaultJobSession is the job session which always exists. Jobs which
+// were not submitted in another job session of the proxy (like jobs
+// submitted directly in the cluster) belong to it.
+const DefaultJobSession = "ubercluster"
+
+// legacyJobSession is the job session name older uc versions used
+// for submitting jobs. It refers to the DefaultJobSession.
+const legacyJobSession = "default"
+
+// stagingArea is the directory of the staging area of the default
+// job session. Each other job session has a sub-directory with the
+// name of the job session.
+const stagingArea = "uploads"
+
+// jobSessionName defines the allowed job session names. They are used
+// as directory names in the staging area.
+var jobSessionName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// jobSessions is the registry of the job sessions of a ProxyImplementer.
+// Each job session is an isolated namespace on the proxy: jobs can only
+// be listed and manipulated through the job session they were submitted
+// in and each job session has its own staging area. The job sessions
+// are restored from the staging area after a restart of the proxy. The
+// jobs of a job session are listed in the sessionJobsFile of its
+// staging area.
+type jobSessions struct {
+	sync.Mutex
+	sessions map[string]struct{}
+	jobs     map[string]string // job id -> job session
+}
+
+// newJobSessions creates the registry with the default job session and
+// the job sessions which have a staging area.
+func newJobSessions() *jobSessions {
+	js := &jobSessions{
+		sessions: map[string]struct{}{DefaultJobSession: {}},
+		jobs:     make(map[string]string),
+	}
+	fis, err := ioutil.ReadDir(stagingArea)
+	if err != nil {
+		return js
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && jobSessionName.MatchString(fi.Name()) {
+			js.sessions[fi.Name()] = struct{}{}
+			if err := js.load(fi.Name()); err != nil {
+				log.Printf("(proxy) Can not read the jobs of job session %s: %s\n", fi.Name(), err)
+			}
+		}
+	}
+	return js
+}
+
+// load reads the jobs of the job session from its sessionJobsFile. Each
+// line adds (+jobid) or removes (-jobid) a job. The file is rewritten
+// with the remaining jobs.
+func (js *jobSessions) load(session string) error {
+	path := filepath.Join(stagingDir(stagingArea, session), sessionJobsFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	jobids := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) < 2 {
+			continue
+		}
+		jobids[line[1:]] = line[0] == '+'
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(jobids))
+	for jobid, added := range jobids {
+		if added {
+			js.jobs[jobid] = session
+			lines = append(lines, "+"+jobid+"\n")
+		}
+	}
+	sort.Strings(lines)
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0600)
+}
+
+// record appends the change of the jobs of the job session to its
+// sessionJobsFile. The caller must hold the lock.
+func (js *jobSessions) record(session, change string) {
+	path := filepath.Join(stagingDir(stagingArea, session), sessionJobsFile)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err == nil {
+		_, err = fmt.Fprintln(file, change)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.Printf("(proxy) Can not store the jobs of job session %s: %s\n", session, err)
+	}
+}
+
+// jobSessionRegistries contains the job sessions of each ProxyImplementer.
+var jobSessionRegistries = struct {
+	sync.Mutex
+	registries map[ProxyImplementer]*jobSessions
+}{registries: make(map[ProxyImplementer]*jobSessions)}
+
+// getJobSessions returns the job session registry of the ProxyImplementer.
+func getJobSessions(impl ProxyImplementer) *jobSessions {
+	jobSessionRegistries.Lock()
+	defer jobSessionRegistries.Unlock()
+	js, exists := jobSessionRegistries.registries[impl]
+	if !exists {
+		js = newJobSessions()
+		jobSessionRegistries.registries[impl] = js
+	}
+	return js
+}
+
+// stagingDir returns the staging area of the job session below the
+// staging area of the default job session.
+func stagingDir(base, session string) string {
+	if session == DefaultJobSession {
+		return base
+	}
+	return filepath.Join(base, session)
+}
+
+// lookup returns the name of the job session and true if it exists.
+func (js *jobSessions) lookup(name string) (string, bool) {
+	if name == legacyJobSession {
+		name = DefaultJobSession
+	}
+	js.Lock()
+	defer js.Unlock()
+	_, exists := js.sessions[name]
+	return name, exists
+}
+
+// create creates a job session and its staging area.
+func (js *jobSessions) create(name string) error {
+	if !jobSessionName.MatchString(name) {
+		return Errorf(types.ErrorCodeInvalidRequest, "invalid job session name %q", name)
+	}
+	js.Lock()
+	defer js.Unlock()
+	if _, exists := js.sessions[name]; exists || name == legacyJobSession {
+		return Errorf(types.ErrorCodeConflict, "job session %s already exists", name)
+	}
+	if err := os.MkdirAll(stagingDir(stagingArea, name), 0700); err != nil {
+		return Errorf(types.ErrorCodeInternal, "can not create staging area: %s", err)
+	}
+	js.sessions[name] = struct{}{}
+	return nil
+}
+
+// destroy removes a job session and its staging area. Job sessions
+// with unfinished jobs can not be destroyed. The jobs are requested
+// from the ProxyImplementer without holding the lock.
+func (js *jobSessions) destroy(impl ProxyImplementer, name string) error {
+	if name == DefaultJobSession || name == legacyJobSession {
+		return Errorf(types.ErrorCodeForbidden, "the default job session can not be destroyed")
+	}
+	if _, exists := js.lookup(name); !exists {
+		return Errorf(types.ErrorCodeNotFound, "job session %s not found", name)
+	}
+	checked := make(map[string]bool)
+	for _, jobid := range js.jobIDs(name) {
+		if ji := impl.GetJobInfo(jobid); (ji != nil && ji.State != types.Done && ji.State != types.Failed) ||
+			emulatedArrayJobs.unfinished(jobid) {
+			return Errorf(types.ErrorCodeConflict, "job session %s has unfinished jobs (like %s)", name, jobid)
+		}
+		checked[jobid] = true
+	}
+
+	js.Lock()
+	defer js.Unlock()
+	if _, exists := js.sessions[name]; !exists {
+		return Errorf(types.ErrorCodeNotFound, "job session %s not found", name)
+	}
+	for jobid, session := range js.jobs {
+		if session == name && !checked[jobid] {
+			// submitted while the jobs were checked
+			return Errorf(types.ErrorCodeConflict, "job session %s has unfinished jobs (like %s)", name, jobid)
+		}
+	}
+	if err := os.RemoveAll(stagingDir(stagingArea, name)); err != nil {
+		return Errorf(types.ErrorCodeInternal, "can not remove staging area: %s", err)
+	}
+	for jobid, session := range js.jobs {
+		if session == name {
+			delete(js.jobs, jobid)
+		}
+	}
+	delete(js.sessions, name)
+	return nil
+}
+
+// names returns the names of all job sessions in alphabetical order.
+func (js *jobSessions) names() []string {
+	js.Lock()
+	defer js.Unlock()
+	names := make([]string, 0, len(js.sessions))
+	for name := range js.sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addJob assigns a submitted job to the job session.
+func (js *jobSessions) addJob(session, jobid string) {
+	js.Lock()
+	defer js.Unlock()
+	if previous, exists := js.jobs[jobid]; exists && previous != session {
+		// the job id could be reused by the DRM
+		delete(js.jobs, jobid)
+		js.record(previous, "-"+jobid)
+	}
+	if session == DefaultJobSession {
+		return
+	}
+	js.jobs[jobid] = session
+	js.record(session, "+"+jobid)
+}
+
+// contains returns true if the job belongs to the job session.
+func (js *jobSessions) contains(session, jobid string) bool {
+	js.Lock()
+	defer js.Unlock()
+	if s, exists := js.jobs[jobid]; exists {
+		return s == session
+	}
+	return session == DefaultJobSession
+}
+
+// jobIDs returns the ids of all jobs submitted in the job session. For
+// the default job session nil is returned since all jobs which are not
+// assigned to another job session belong to it.
+func (js *jobSessions) jobIDs(session string) []string {
+	js.Lock()
+	defer js.Unlock()
+	if session == DefaultJobSession {
+		return nil
+	}
+	jobids := make([]string, 0)
+	for jobid, s := range js.jobs {
+		if s == session {
+			jobids = append(jobids, jobid)
+		}
+	}
+	sort.Strings(jobids)
+	return jobids
+}
+
+// jobSession returns the job session referenced by the jsname route
+// variable. If the job session does not exist an error is sent and
+// false is returned.
+func jobSession(w http.ResponseWriter, r *http.Request, sessions *jobSessions) (string, bool) {
+	name, exists := sessions.lookup(mux.Vars(r)["jsname"])
+	if !exists {
+		writeErrorResponse(w, types.ErrorCodeNotFound, "job session not found",
+			map[string]string{"jsession": mux.Vars(r)["jsname"]})
+	}
+	return name, exists
+}
+
+// MakeJSessionCreateHandler returns an http handler function which
+// creates the job session given by a JSON encoded JobSessionRequest.
+func MakeJSessionCreateHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req types.JobSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Println("(proxy) Unmarshall error")
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		if err := sessions.create(req.Name); err != nil {
+			writeError(w, err, map[string]string{"jsession": req.Name})
+			return
+		}
+		log.Printf("(proxy) Created job session %s\n", req.Name)
+		json.NewEncoder(w).Encode(req.Name)
+	}
+}
+
+// MakeJSessionDestroyHandler returns an http handler function which
+// destroys a job session including its staging area.
+func MakeJSessionDestroyHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		name := mux.Vars(r)["jsname"]
+		if err := sessions.destroy(impl, name); err != nil {
+			writeError(w, err, map[string]string{"jsession": name})
+			return
+		}
+		log.Printf("(proxy) Destroyed job session %s\n", name)
+		json.NewEncoder(w).Encode("Destroyed job session")
+	}
+}
+
+// MakeJSessionJobInfosHandler returns an http handler function which
+// returns the JSON encoded job infos of all jobs of the job session.
+// Like for the monitoring session the jobs can be filtered by "state"
+// and "user". Finished jobs which are not known by the DRM anymore
+// are looked up in the job history. Jobs which were distributed to
+// peers are requested from the peers.
+func MakeJSessionJobInfosHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+	distributor := getJobDistributor(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		filterSet, filter := parseJobInfoFilter(r)
+
+		jobinfos := make([]types.JobInfo, 0)
+		if session == DefaultJobSession {
+			all := impl.GetJobInfosByFilter(filterSet, filter)
+			if all == nil {
+				writeErrorResponse(w, types.ErrorCodeInternal, "can not get job infos", nil)
+				return
+			}
+			for _, ji := range all {
+				if _, _, remote, _ := distributor.remoteJob(ji.Id); !remote && sessions.contains(session, ji.Id) {
+					jobinfos = append(jobinfos, ji)
+				}
+			}
+			for _, jobid := range distributor.remoteJobIDs(session) {
+				if ji, _, err := distributor.jobInfo(jobid); err == nil && matchesJobInfoFilter(filterSet, filter, *ji) {
+					jobinfos = append(jobinfos, *ji)
+				}
+			}
+		} else {
+			for _, jobid := range sessions.jobIDs(session) {
+				ji, remote, _ := distributor.jobInfo(jobid)
+				if !remote {
+					ji = impl.GetJobInfo(jobid)
+				}
+				if ji == nil && pi != nil {
+					if stored, err := pi.GetJobInfo(jobid); err == nil {
+						ji = &stored
+					}
+				}
+				if ji != nil && matchesJobInfoFilter(filterSet, filter, *ji) {
+					jobinfos = append(jobinfos, *ji)
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(jobinfos)
+	}
+}
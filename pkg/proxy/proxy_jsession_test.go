@@ -0,0 +1,178 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// runProxy is a ProxyImplementer which runs each job in the
+// running state.
+type runProxy struct {
+	*stateProxy
+	lastID int
+}
+
+func (rp *runProxy) RunJob(template types.JobTemplate) (string, error) {
+	rp.Lock()
+	rp.lastID++
+	jobid := fmt.Sprintf("%d", rp.lastID)
+	rp.Unlock()
+	rp.setState(jobid, types.Running)
+	return jobid, nil
+}
+
+var _ = Describe("ProxyJSession", func() {
+
+	var (
+		rp     *runProxy
+		server *httptest.Server
+		c      *client.Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		rp = &runProxy{stateProxy: &stateProxy{states: map[string]types.JobState{}}}
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{}, nil))
+		c = client.New(server.URL+"/v1", nil)
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	It("should create, list, and destroy job sessions", func() {
+		sessions, err := c.GetJobSessions(ctx)
+		Ω(err).Should(BeNil())
+		Ω(sessions).Should(Equal([]string{DefaultJobSession}))
+
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		sessions, err = c.GetJobSessions(ctx)
+		Ω(err).Should(BeNil())
+		Ω(sessions).Should(Equal([]string{"projectA", DefaultJobSession}))
+		Ω(filepath.Join("uploads", "projectA")).Should(BeADirectory())
+
+		err = c.CreateJobSession(ctx, "projectA")
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeConflict))
+		err = c.CreateJobSession(ctx, "../etc")
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeInvalidRequest))
+
+		Ω(c.DestroyJobSession(ctx, "projectA")).Should(BeNil())
+		Ω(filepath.Join("uploads", "projectA")).ShouldNot(BeADirectory())
+		err = c.DestroyJobSession(ctx, "projectA")
+		Ω(client.IsNotFound(err)).Should(BeTrue())
+		err = c.DestroyJobSession(ctx, DefaultJobSession)
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeForbidden))
+	})
+
+	It("should isolate the jobs of job sessions", func() {
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		defaultJob, err := c.RunJob(ctx, DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+		projectJob, err := c.RunJob(ctx, "projectA", types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+
+		jobinfos, err := c.GetJobSessionJobInfos(ctx, "projectA", "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(HaveLen(1))
+		Ω(jobinfos[0].Id).Should(Equal(projectJob))
+		jobinfos, err = c.GetJobSessionJobInfos(ctx, DefaultJobSession, "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(HaveLen(1))
+		Ω(jobinfos[0].Id).Should(Equal(defaultJob))
+
+		_, err = c.JobOperation(ctx, DefaultJobSession, "suspend", projectJob)
+		Ω(client.IsNotFound(err)).Should(BeTrue())
+		_, err = c.JobOperation(ctx, "projectA", "suspend", projectJob)
+		Ω(err).Should(BeNil())
+		_, err = c.RunJob(ctx, "unknown", types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(client.IsNotFound(err)).Should(BeTrue())
+
+		err = c.DestroyJobSession(ctx, "projectA")
+		Ω(err).ShouldNot(BeNil())
+		Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeConflict))
+		rp.setState(projectJob, types.Done)
+		Ω(c.DestroyJobSession(ctx, "projectA")).Should(BeNil())
+	})
+
+	It("should keep the jobs of job sessions after a restart", func() {
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		projectJob, err := c.RunJob(ctx, "projectA", types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+		defaultJob, err := c.RunJob(ctx, DefaultJobSession, types.JobTemplate{RemoteCommand: "/bin/sleep"})
+		Ω(err).Should(BeNil())
+
+		// a new ProxyImplementer of the same cluster
+		restarted := httptest.NewServer(NewProxyRouter(&runProxy{stateProxy: rp.stateProxy}, SecConfig{}, nil))
+		defer restarted.Close()
+		rc := client.New(restarted.URL+"/v1", nil)
+		jobinfos, err := rc.GetJobSessionJobInfos(ctx, "projectA", "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(HaveLen(1))
+		Ω(jobinfos[0].Id).Should(Equal(projectJob))
+		jobinfos, err = rc.GetJobSessionJobInfos(ctx, DefaultJobSession, "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(HaveLen(1))
+		Ω(jobinfos[0].Id).Should(Equal(defaultJob))
+		_, err = rc.JobOperation(ctx, DefaultJobSession, "suspend", projectJob)
+		Ω(client.IsNotFound(err)).Should(BeTrue())
+
+		files, err := rc.ListFiles(ctx, "projectA")
+		Ω(err).Should(BeNil())
+		Ω(files).Should(BeEmpty())
+	})
+
+	It("should assign the tasks of job arrays to the job session", func() {
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		_, err := c.RunBulkJobs(ctx, "projectA", types.BulkJobRequest{
+			JobTemplate: types.JobTemplate{RemoteCommand: "/bin/sleep"},
+			Begin:       1, End: 2, Step: 1,
+		})
+		Ω(err).Should(BeNil())
+
+		jobinfos, err := c.GetJobSessionJobInfos(ctx, "projectA", "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(HaveLen(2))
+		jobinfos, err = c.GetJobSessionJobInfos(ctx, DefaultJobSession, "all", "")
+		Ω(err).Should(BeNil())
+		Ω(jobinfos).Should(BeEmpty())
+
+		_, err = c.JobOperation(ctx, "projectA", "suspend", "1")
+		Ω(err).Should(BeNil())
+		_, err = c.JobOperation(ctx, DefaultJobSession, "suspend", "1")
+		Ω(client.IsNotFound(err)).Should(BeTrue())
+	})
+
+	It("should have a staging area per job session", func() {
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		tmp, err := ioutil.TempFile("", "jsession")
+		Ω(err).Should(BeNil())
+		defer os.Remove(tmp.Name())
+		tmp.Close()
+
+		Ω(c.UploadFile(ctx, "projectA", tmp.Name(), false)).Should(BeNil())
+		files, err := c.ListFiles(ctx, "projectA")
+		Ω(err).Should(BeNil())
+		Ω(files).Should(HaveLen(1))
+		files, err = c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(BeEmpty())
+	})
+
+})
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"math"
+	"runtime"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/shirou/gopsutil/load"
+)
+
+// Weights of the parts of the cluster load. They sum up to 1.
+const (
+	UtilizationWeight = 0.7 // weight of the used slots over the capacity
+	BacklogWeight     = 0.3 // weight of the queued work
+)
+
+// ClusterLoad returns the load of a cluster as reported by DRMSLoad:
+// a value between 0 (idle, give me all jobs you have) and 1 (full,
+// don't send me any job).
+//
+// The load blends the utilization of the cluster (used slots over the
+// capacity in slots, at most 1) with its backlog (queued jobs over
+// queued jobs plus capacity):
+//
+//	load = UtilizationWeight * used/capacity + BacklogWeight * queued/(queued+capacity)
+//
+// Hence a cluster whose slots are all used has a load of 0.7 which
+// grows towards 1 the more jobs are waiting. A cluster without any
+// capacity has a load of 1.
+func ClusterLoad(used, queued, capacity float64) float64 {
+	if capacity <= 0 {
+		return 1.0
+	}
+	utilization := math.Min(math.Max(used, 0)/capacity, 1.0)
+	backlog := math.Max(queued, 0) / (math.Max(queued, 0) + capacity)
+	return UtilizationWeight*utilization + BacklogWeight*backlog
+}
+
+// HostLoad returns the load of the local host (see ClusterLoad) with
+// the amount of CPUs as capacity. The used slots are the slots of the
+// running jobs or the 1 minute load average of the host when it is
+// higher, so that other processes on the host are respected as well.
+func HostLoad(used float64) float64 {
+	if avg, err := load.Avg(); err == nil {
+		used = math.Max(used, avg.Load1)
+	}
+	return ClusterLoad(used, 0, float64(runtime.NumCPU()))
+}
+
+// MachineSlots returns the capacity of the machines in slots, which
+// is the amount of hardware threads of the available machines. A
+// machine counts at least as one slot.
+func MachineSlots(machines []types.Machine) float64 {
+	var slots float64
+	for _, m := range machines {
+		if !m.Available {
+			continue
+		}
+		threads := m.Sockets * m.CoresPerSocket * m.ThreadsPerCore
+		if threads < 1 {
+			threads = 1
+		}
+		slots += float64(threads)
+	}
+	return slots
+}
+
+// JobSlots returns the slots used by the running jobs and the slots
+// of the queued jobs. A job without slot information counts as one
+// slot.
+func JobSlots(jobs []types.JobInfo) (used, queued float64) {
+	for _, ji := range jobs {
+		slots := float64(ji.Slots)
+		if slots < 1 {
+			slots = 1
+		}
+		switch ji.State {
+		case types.Running:
+			used += slots
+		case types.Queued, types.Requeued:
+			queued += slots
+		}
+	}
+	return used, queued
+}
@@ -0,0 +1,41 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("ProxyLoad", func() {
+
+	It("should blend the utilization with the queued work", func() {
+		Ω(ClusterLoad(0, 0, 4)).Should(BeNumerically("==", 0))
+		Ω(ClusterLoad(2, 0, 4)).Should(BeNumerically("~", 0.35))
+		Ω(ClusterLoad(4, 0, 4)).Should(BeNumerically("~", 0.7))
+		Ω(ClusterLoad(8, 4, 4)).Should(BeNumerically("~", 0.85))
+		Ω(ClusterLoad(4, 1000, 4)).Should(BeNumerically(">", 0.99))
+		Ω(ClusterLoad(0, 0, 0)).Should(BeNumerically("==", 1))
+	})
+
+	It("should count the slots of machines and jobs", func() {
+		Ω(MachineSlots([]types.Machine{
+			{Available: true, Sockets: 2, CoresPerSocket: 4, ThreadsPerCore: 2},
+			{Available: true},
+			{Available: false, Sockets: 1, CoresPerSocket: 8, ThreadsPerCore: 1},
+		})).Should(BeNumerically("==", 17))
+
+		used, queued := JobSlots([]types.JobInfo{
+			{State: types.Running, Slots: 4},
+			{State: types.Running},
+			{State: types.Queued, Slots: 2},
+			{State: types.QueuedHeld, Slots: 8},
+			{State: types.Done},
+		})
+		Ω(used).Should(BeNumerically("==", 5))
+		Ω(queued).Should(BeNumerically("==", 2))
+	})
+
+})
@@ -0,0 +1,469 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// MetricsPath is the path of the Prometheus metrics of a proxy.
+const MetricsPath = "/metrics"
+
+// MetricsAuthNone as SecConfig.MetricsAuth serves the metrics without
+// authentication.
+const MetricsAuthNone = "none"
+
+// metricsRoute is the route name of MetricsPath.
+const metricsRoute = "metrics"
+
+// DefaultLatencyBuckets are the upper bounds (in seconds) of the
+// buckets of the latency histograms of the http handlers.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// JobMetricsInterval is how long the jobs counted for the metric of
+// jobs by state are reused before the jobs are requested again from
+// the ProxyImplementer.
+var JobMetricsInterval = 15 * time.Second
+
+// metricName defines valid names of metrics and labels.
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// GaugeValue is a value of a gauge which is not maintained by the
+// proxy itself, like data of the backend of a ProxyImplementer.
+type GaugeValue struct {
+	Name   string            // name of the metric like "uc_docker_containers"
+	Help   string            // description of the metric
+	Labels map[string]string // labels of the value, can be empty
+	Value  float64
+}
+
+// GaugeCollector returns the current values of extra gauges. It is
+// called each time the metrics are requested.
+type GaugeCollector func() []GaugeValue
+
+// histogram counts observations in buckets with upper bounds.
+type histogram struct {
+	buckets []uint64 // observations per bucket (not cumulative)
+	count   uint64
+	sum     float64
+}
+
+// routeStatus is a route name with an http status code.
+type routeStatus struct {
+	route  string
+	status int
+}
+
+// operationResult is a job operation with its result.
+type operationResult struct {
+	operation string
+	result    string
+}
+
+// Metrics contains the metrics of the http handlers of a
+// ProxyImplementer. The state of the cluster (like jobs by state
+// and the DRMSLoad) is requested from the ProxyImplementer each time
+// the metrics are requested.
+type Metrics struct {
+	sync.Mutex
+	impl         ProxyImplementer
+	latencies    map[string]*histogram // route -> latency of the handler
+	requests     map[routeStatus]uint64
+	submissions  map[string]uint64 // result -> submitted jobs and job arrays
+	operations   map[operationResult]uint64
+	authFailures uint64
+	collectors   []GaugeCollector
+	jobs         map[types.JobState]int // jobs by state, counted at jobsCounted
+	jobsCounted  time.Time
+}
+
+// metricsRegistries contains the Metrics of each ProxyImplementer.
+var metricsRegistries = struct {
+	sync.Mutex
+	registries map[ProxyImplementer]*Metrics
+}{registries: make(map[ProxyImplementer]*Metrics)}
+
+// getMetrics returns the Metrics of the ProxyImplementer.
+func getMetrics(impl ProxyImplementer) *Metrics {
+	metricsRegistries.Lock()
+	defer metricsRegistries.Unlock()
+	m, exists := metricsRegistries.registries[impl]
+	if !exists {
+		m = &Metrics{
+			impl:        impl,
+			latencies:   make(map[string]*histogram),
+			requests:    make(map[routeStatus]uint64),
+			submissions: make(map[string]uint64),
+			operations:  make(map[operationResult]uint64),
+		}
+		metricsRegistries.registries[impl] = m
+	}
+	return m
+}
+
+// RegisterGauges adds gauges of the ProxyImplementer to its metrics.
+// The collector is called each time the metrics are requested. Values
+// with invalid names are not exposed.
+func RegisterGauges(impl ProxyImplementer, collector GaugeCollector) {
+	m := getMetrics(impl)
+	m.Lock()
+	defer m.Unlock()
+	m.collectors = append(m.collectors, collector)
+}
+
+// statusRecorder remembers the status code sent by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(data)
+}
+
+// Flush lets watching jobs and following job output work through the
+// recorder.
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrument measures the latency and the results of the handler of
+// the route.
+func (m *Metrics) instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler(recorder, r)
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.observe(route, mux.Vars(r)["operation"], status, time.Since(start))
+	}
+}
+
+// observe records the result of a request.
+func (m *Metrics) observe(route, operation string, status int, latency time.Duration) {
+	result := "success"
+	if status >= http.StatusBadRequest {
+		result = "error"
+	}
+	m.Lock()
+	defer m.Unlock()
+	h, exists := m.latencies[route]
+	if !exists {
+		h = &histogram{buckets: make([]uint64, len(DefaultLatencyBuckets)+1)}
+		m.latencies[route] = h
+	}
+	seconds := latency.Seconds()
+	h.buckets[sort.SearchFloat64s(DefaultLatencyBuckets, seconds)]++
+	h.count++
+	h.sum += seconds
+	m.requests[routeStatus{route, status}]++
+	if status == http.StatusUnauthorized {
+		m.authFailures++
+	}
+	switch route {
+	case "JobSubmit", "JobRunBulk":
+		m.submissions[result]++
+	case "JobManipulation":
+		m.operations[operationResult{operation, result}]++
+	}
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// family starts a metric with its help text and type.
+func (mw metricsWriter) family(name, help, kind string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.Replace(help, "\n", " ", -1), name, kind)
+}
+
+// escapeLabel escapes a label value of the text format.
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatMetricValue formats a value of the text format.
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sample writes a value of a metric. The labels are given as name and
+// value pairs.
+func (mw metricsWriter) sample(name string, value float64, labels ...string) {
+	mw.w.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel.Replace(labels[i+1])))
+		}
+		fmt.Fprintf(mw.w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(mw.w, " %s\n", formatMetricValue(value))
+}
+
+// exposedJobStates are the states exposed in the metric of jobs by
+// state. Finished jobs are not exposed since their amount only grows.
+var exposedJobStates = []types.JobState{types.Undetermined, types.Queued, types.QueuedHeld, types.Running,
+	types.Suspended, types.Requeued, types.RequeuedHeld}
+
+// jobCounts returns the jobs of the ProxyImplementer by state. The jobs
+// are requested again when the counts are older than JobMetricsInterval.
+func (m *Metrics) jobCounts(impl ProxyImplementer) map[types.JobState]int {
+	m.Lock()
+	jobs, counted := m.jobs, m.jobsCounted
+	m.Unlock()
+	if jobs != nil && time.Since(counted) < JobMetricsInterval {
+		return jobs
+	}
+	jobs = make(map[types.JobState]int)
+	for _, ji := range impl.GetJobInfosByFilter(false, types.JobInfo{}) {
+		jobs[ji.State]++
+	}
+	m.Lock()
+	m.jobs, m.jobsCounted = jobs, time.Now()
+	m.Unlock()
+	return jobs
+}
+
+// writeClusterMetrics writes the metrics requested from the
+// ProxyImplementer.
+func (m *Metrics) writeClusterMetrics(mw metricsWriter, impl ProxyImplementer) {
+	jobs := m.jobCounts(impl)
+	mw.family("uc_proxy_jobs", "Jobs of the cluster by state.", "gauge")
+	for _, state := range exposedJobStates {
+		mw.sample("uc_proxy_jobs", float64(jobs[state]), "state", state.String())
+	}
+	mw.family("uc_proxy_drms_load", "Load of the cluster between 0 (idle) and 1 (full) as reported by DRMSLoad.", "gauge")
+	mw.sample("uc_proxy_drms_load", impl.DRMSLoad())
+}
+
+// writeStagingMetrics writes the used space of the staging area of
+// each job session.
+func (m *Metrics) writeStagingMetrics(mw metricsWriter) {
+	sessions := getJobSessions(m.impl).names()
+	files := make([]int, len(sessions))
+	used := make([]int64, len(sessions))
+	for i, session := range sessions {
+		fis, err := ioutil.ReadDir(stagingDir(stagingArea, session))
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			if isStagedFile(fi) {
+				files[i]++
+				used[i] += fi.Size()
+			}
+		}
+	}
+	mw.family("uc_proxy_staging_bytes", "Bytes in the staging area of the job session.", "gauge")
+	for i, session := range sessions {
+		mw.sample("uc_proxy_staging_bytes", float64(used[i]), "session", session)
+	}
+	mw.family("uc_proxy_staging_files", "Files in the staging area of the job session.", "gauge")
+	for i, session := range sessions {
+		mw.sample("uc_proxy_staging_files", float64(files[i]), "session", session)
+	}
+}
+
+// writeRequestMetrics writes the metrics of the http handlers.
+func (m *Metrics) writeRequestMetrics(mw metricsWriter) {
+	m.Lock()
+	defer m.Unlock()
+
+	mw.family("uc_proxy_job_submissions_total", "Submitted jobs and job arrays by result.", "counter")
+	for _, result := range []string{"success", "error"} {
+		mw.sample("uc_proxy_job_submissions_total", float64(m.submissions[result]), "result", result)
+	}
+
+	mw.family("uc_proxy_job_operations_total", "Operations on jobs (like terminate) by result.", "counter")
+	operations := make([]operationResult, 0, len(m.operations))
+	for op := range m.operations {
+		operations = append(operations, op)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].operation != operations[j].operation {
+			return operations[i].operation < operations[j].operation
+		}
+		return operations[i].result < operations[j].result
+	})
+	for _, op := range operations {
+		mw.sample("uc_proxy_job_operations_total", float64(m.operations[op]),
+			"operation", op.operation, "result", op.result)
+	}
+
+	mw.family("uc_proxy_auth_failures_total", "Requests rejected because the authentication failed.", "counter")
+	mw.sample("uc_proxy_auth_failures_total", float64(m.authFailures))
+
+	mw.family("uc_proxy_requests_total", "Handled http requests by route and status code.", "counter")
+	requests := make([]routeStatus, 0, len(m.requests))
+	for rs := range m.requests {
+		requests = append(requests, rs)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].route != requests[j].route {
+			return requests[i].route < requests[j].route
+		}
+		return requests[i].status < requests[j].status
+	})
+	for _, rs := range requests {
+		mw.sample("uc_proxy_requests_total", float64(m.requests[rs]), "route", rs.route, "code", strconv.Itoa(rs.status))
+	}
+
+	mw.family("uc_proxy_request_duration_seconds", "Latency of the http handlers by route.", "histogram")
+	routes := make([]string, 0, len(m.latencies))
+	for route := range m.latencies {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		h := m.latencies[route]
+		var cumulative uint64
+		for i, bound := range DefaultLatencyBuckets {
+			cumulative += h.buckets[i]
+			mw.sample("uc_proxy_request_duration_seconds_bucket", float64(cumulative),
+				"route", route, "le", formatMetricValue(bound))
+		}
+		mw.sample("uc_proxy_request_duration_seconds_bucket", float64(h.count), "route", route, "le", "+Inf")
+		mw.sample("uc_proxy_request_duration_seconds_sum", h.sum, "route", route)
+		mw.sample("uc_proxy_request_duration_seconds_count", float64(h.count), "route", route)
+	}
+}
+
+// writeExtraGauges writes the gauges of the registered collectors
+// grouped by their names.
+func (m *Metrics) writeExtraGauges(mw metricsWriter) {
+	m.Lock()
+	collectors := append([]GaugeCollector(nil), m.collectors...)
+	m.Unlock()
+
+	var names []string
+	help := make(map[string]string)
+	values := make(map[string][]GaugeValue)
+	for _, collector := range collectors {
+		for _, value := range collector() {
+			if !metricName.MatchString(value.Name) || strings.HasPrefix(value.Name, "uc_proxy_") {
+				log.Printf("(proxy) Ignoring gauge with invalid name %q\n", value.Name)
+				continue
+			}
+			if _, exists := values[value.Name]; !exists {
+				names = append(names, value.Name)
+				help[value.Name] = value.Help
+			}
+			values[value.Name] = append(values[value.Name], value)
+		}
+	}
+	for _, name := range names {
+		mw.family(name, help[name], "gauge")
+		for _, value := range values[name] {
+			labels := make([]string, 0, 2*len(value.Labels))
+			keys := make([]string, 0, len(value.Labels))
+			for key := range value.Labels {
+				if metricName.MatchString(key) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				labels = append(labels, key, value.Labels[key])
+			}
+			mw.sample(name, value.Value, labels...)
+		}
+	}
+}
+
+// WriteMetrics writes all metrics in the Prometheus text format.
+func (m *Metrics) WriteMetrics(w io.Writer, impl ProxyImplementer) error {
+	mw := metricsWriter{w: bufio.NewWriter(w)}
+	m.writeClusterMetrics(mw, impl)
+	m.writeStagingMetrics(mw)
+	m.writeRequestMetrics(mw)
+	m.writeExtraGauges(mw)
+	return mw.w.Flush()
+}
+
+// MakeMetricsHandler returns an http handler function which serves
+// the metrics of the ProxyImplementer in the Prometheus text format.
+func MakeMetricsHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	m := getMetrics(impl)
+	return func(w http.ResponseWriter, r *http.Request) {
+		var out bytes.Buffer
+		if err := m.WriteMetrics(&out, forRequest(r, impl)); err != nil {
+			writeError(w, err, nil)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(out.Bytes())
+	}
+}
+
+// MakeMetricsSecretHandler protects the metrics by a shared secret
+// which is sent as bearer token (like by Prometheus) or as otp form
+// value.
+func MakeMetricsSecretHandler(secret string, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.FormValue("otp")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			log.Println("Unauthorized access to metrics by ", r.RemoteAddr)
+			writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
+			return
+		}
+		f(w, r)
+	}
+}
@@ -0,0 +1,122 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// getMetrics returns the body and status code of /metrics.
+func getMetrics(url, token string) (string, int) {
+	req, err := http.NewRequest("GET", url+MetricsPath, nil)
+	Ω(err).Should(BeNil())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	Ω(err).Should(BeNil())
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	Ω(err).Should(BeNil())
+	return string(body), resp.StatusCode
+}
+
+var _ = Describe("ProxyMetrics", func() {
+
+	var (
+		rp     *runProxy
+		server *httptest.Server
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		rp = &runProxy{stateProxy: &stateProxy{states: map[string]types.JobState{}}}
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	It("should expose jobs, staging, and request metrics", func() {
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{}, nil))
+		c := client.New(server.URL+"/v1", nil)
+		_, err := c.RunJob(ctx, DefaultJobSession, types.JobTemplate{RemoteCommand: "sleep"})
+		Ω(err).Should(BeNil())
+		rp.setState("failed", types.Failed)
+
+		tmpdir, err := ioutil.TempDir("", "metrics")
+		Ω(err).Should(BeNil())
+		defer os.RemoveAll(tmpdir)
+		file := filepath.Join(tmpdir, "input.txt")
+		Ω(ioutil.WriteFile(file, []byte("12345"), 0644)).Should(BeNil())
+		Ω(c.UploadFile(ctx, DefaultJobSession, file, false)).Should(BeNil())
+
+		metrics, status := getMetrics(server.URL, "")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(metrics).Should(ContainSubstring("# TYPE uc_proxy_jobs gauge\n"))
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_jobs{state="Running"} 1` + "\n"))
+		Ω(metrics).ShouldNot(ContainSubstring(`uc_proxy_jobs{state="Failed"}`))
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_jobs{state="Queued"} 0` + "\n"))
+		Ω(metrics).Should(ContainSubstring("uc_proxy_drms_load 0\n"))
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_staging_files{session="` + DefaultJobSession + `"} 1` + "\n"))
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_staging_bytes{session="` + DefaultJobSession + `"} 5` + "\n"))
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_job_submissions_total{result="success"} 1` + "\n"))
+		Ω(metrics).Should(ContainSubstring("# TYPE uc_proxy_request_duration_seconds histogram\n"))
+		Ω(metrics).Should(MatchRegexp(`uc_proxy_request_duration_seconds_bucket\{route="[^"]+",le="\+Inf"\} 1`))
+		Ω(metrics).Should(MatchRegexp(`uc_proxy_requests_total\{route="[^"]+",code="200"\} 1`))
+
+		// the jobs are counted again only after JobMetricsInterval
+		rp.setState("queued", types.Queued)
+		metrics, _ = getMetrics(server.URL, "")
+		Ω(metrics).Should(ContainSubstring(`uc_proxy_jobs{state="Queued"} 0` + "\n"))
+	})
+
+	It("should expose gauges registered by the proxy", func() {
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{}, nil))
+		RegisterGauges(rp, func() []GaugeValue {
+			return []GaugeValue{
+				{Name: "uc_test_containers", Help: "Containers.", Labels: map[string]string{"image": "busybox"}, Value: 3},
+				{Name: "invalid name", Value: 1},
+			}
+		})
+		metrics, status := getMetrics(server.URL, "")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(metrics).Should(ContainSubstring("# HELP uc_test_containers Containers.\n# TYPE uc_test_containers gauge\n"))
+		Ω(metrics).Should(ContainSubstring(`uc_test_containers{image="busybox"} 3` + "\n"))
+		Ω(metrics).ShouldNot(ContainSubstring("invalid name"))
+	})
+
+	It("should protect the metrics independently of the other requests", func() {
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{OTP: "secret", MetricsAuth: MetricsAuthNone}, nil))
+		resp, err := http.Get(server.URL + "/v1/msession/drmsload")
+		Ω(err).Should(BeNil())
+		resp.Body.Close()
+		Ω(resp.StatusCode).Should(Equal(http.StatusUnauthorized))
+		metrics, status := getMetrics(server.URL, "")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(metrics).Should(ContainSubstring("uc_proxy_auth_failures_total 1\n"))
+		server.Close()
+
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{MetricsAuth: "scrape"}, nil))
+		_, status = getMetrics(server.URL, "")
+		Ω(status).Should(Equal(http.StatusUnauthorized))
+		_, status = getMetrics(server.URL, "wrong")
+		Ω(status).Should(Equal(http.StatusUnauthorized))
+		_, status = getMetrics(server.URL, "scrape")
+		Ω(status).Should(Equal(http.StatusOK))
+	})
+
+})
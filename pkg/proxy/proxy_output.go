@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// FollowPollInterval is the interval in which a followed output
+// file is checked for new content.
+var FollowPollInterval = 500 * time.Millisecond
+
+// fileFollower reads a file like "tail -f" until the job which
+// writes the file is finished.
+type fileFollower struct {
+	ctx      context.Context
+	file     *os.File
+	finished func() bool
+}
+
+// FollowFile opens the file for reading. When reaching the end
+// of the file the reader waits for new content as long as the
+// finished function returns false and the context is not done.
+// The file does not need to exist when calling FollowFile as long
+// as the job is not finished.
+func FollowFile(ctx context.Context, filename string, finished func() bool) (io.ReadCloser, error) {
+	for {
+		file, err := os.Open(filename)
+		if err == nil {
+			return &fileFollower{ctx: ctx, file: file, finished: finished}, nil
+		}
+		if !os.IsNotExist(err) || finished() {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(FollowPollInterval):
+		}
+	}
+}
+
+func (ff *fileFollower) Read(p []byte) (int, error) {
+	for {
+		n, err := ff.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		// check before reading the last time to not miss
+		// output written right before the job finished
+		finished := ff.finished()
+		if n, err = ff.file.Read(p); n > 0 || err != io.EOF || finished {
+			return n, err
+		}
+		select {
+		case <-ff.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(FollowPollInterval):
+		}
+	}
+}
+
+func (ff *fileFollower) Close() error {
+	return ff.file.Close()
+}
+
+// flushWriter flushes each write so that followed output
+// reaches the client immediately.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+// MakeJSessionJobOutputHandler returns an http handler function which
+// serves the output of a job as plain text. The "stream" form value
+// selects between "stdout" (default) and "stderr". When the "follow"
+// form value is "true" new output is sent until the job is finished.
+// Requires that the ProxyImplementer implements the JobOutputProvider
+// interface.
+func MakeJSessionJobOutputHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		provider, ok := impl.(JobOutputProvider)
+		if !ok {
+			writeErrorResponse(w, types.ErrorCodeNotImplemented, "job output not supported by proxy", nil)
+			return
+		}
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		jobid := mux.Vars(r)["jobid"]
+		stream := r.FormValue("stream")
+		if stream == "" {
+			stream = "stdout"
+		}
+		if stream != "stdout" && stream != "stderr" {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "stream must be stdout or stderr",
+				map[string]string{"stream": stream})
+			return
+		}
+		follow := r.FormValue("follow") == "true"
+
+		if !sessions.contains(session, jobid) || impl.GetJobInfo(jobid) == nil {
+			writeError(w, ErrJobNotFound, map[string]string{"jobid": jobid})
+			return
+		}
+		output, err := provider.JobOutput(r.Context(), jobid, stream, follow)
+		if err != nil {
+			log.Printf("(proxy) Error during JobOutput(): %s\n", err)
+			writeError(w, err, map[string]string{"jobid": jobid})
+			return
+		}
+		defer output.Close()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		var dst io.Writer = w
+		if flusher, isFlusher := w.(http.Flusher); follow && isFlusher {
+			dst = flushWriter{w: w, f: flusher}
+		}
+		if _, err := io.Copy(dst, output); err != nil {
+			log.Printf("(proxy) Error during sending job output: %s\n", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+	"github.com/gorilla/mux"
+)
+
+// errReservationsNotSupported is returned when the ProxyImplementer
+// does not implement the ReservationImplementer interface.
+var errReservationsNotSupported = Errorf(types.ErrorCodeNotImplemented,
+	"advance reservations are not supported by the proxy")
+
+// reservationImplementer returns the ReservationImplementer of the
+// ProxyImplementer or sends a not implemented error.
+func reservationImplementer(w http.ResponseWriter, impl ProxyImplementer) (ReservationImplementer, bool) {
+	ri, ok := impl.(ReservationImplementer)
+	if !ok {
+		writeError(w, errReservationsNotSupported, nil)
+	}
+	return ri, ok
+}
+
+// MakeRSessionReserveHandler returns an http handler function which
+// reads a JSON encoded ReservationTemplate from the body of the http
+// request and requests the advance reservation in the cluster. The
+// answer is the JSON encoded ReservationInfo.
+func MakeRSessionReserveHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		ri, ok := reservationImplementer(w, impl)
+		if !ok {
+			return
+		}
+		var rt types.ReservationTemplate
+		if err := json.NewDecoder(r.Body).Decode(&rt); err != nil {
+			log.Println("(proxy) Unmarshall error")
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, err.Error(), nil)
+			return
+		}
+		if !rt.EndTime.IsZero() && !rt.StartTime.IsZero() && rt.EndTime.Before(rt.StartTime) {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "end time of reservation is before start time", nil)
+			return
+		}
+		if rt.Duration < 0 || rt.MinSlots < 0 || (rt.MaxSlots != 0 && rt.MaxSlots < rt.MinSlots) {
+			writeErrorResponse(w, types.ErrorCodeInvalidRequest, "invalid duration or slot range of reservation", nil)
+			return
+		}
+		info, err := ri.RequestReservation(mux.Vars(r)["rsname"], rt)
+		if err != nil {
+			log.Printf("(proxy) Error during requesting reservation: %s\n", err)
+			writeError(w, err, nil)
+			return
+		}
+		log.Printf("(proxy) Reservation granted: %s\n", info.ReservationId)
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// MakeRSessionReservationsHandler returns an http handler function which
+// returns the JSON encoded ReservationInfos of all reservations of the
+// reservation session.
+func MakeRSessionReservationsHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		ri, ok := reservationImplementer(w, impl)
+		if !ok {
+			return
+		}
+		infos, err := ri.GetReservations(mux.Vars(r)["rsname"])
+		if err != nil {
+			writeError(w, err, nil)
+			return
+		}
+		if infos == nil {
+			infos = []types.ReservationInfo{}
+		}
+		json.NewEncoder(w).Encode(infos)
+	}
+}
+
+// MakeRSessionReservationHandler returns an http handler function which
+// returns the JSON encoded ReservationInfo of a reservation.
+func MakeRSessionReservationHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		ri, ok := reservationImplementer(w, impl)
+		if !ok {
+			return
+		}
+		vars := mux.Vars(r)
+		info, err := ri.GetReservation(vars["rsname"], vars["reservationid"])
+		if err != nil {
+			writeError(w, err, map[string]string{"reservationid": vars["reservationid"]})
+			return
+		}
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+// MakeRSessionTerminateHandler returns an http handler function which
+// terminates a reservation.
+func MakeRSessionTerminateHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		ri, ok := reservationImplementer(w, impl)
+		if !ok {
+			return
+		}
+		vars := mux.Vars(r)
+		if err := ri.TerminateReservation(vars["rsname"], vars["reservationid"]); err != nil {
+			writeError(w, err, map[string]string{"reservationid": vars["reservationid"]})
+			return
+		}
+		json.NewEncoder(w).Encode("Terminated Reservation")
+	}
+}
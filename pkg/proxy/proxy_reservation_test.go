@@ -0,0 +1,132 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// reservingProxy is a ProxyImplementer which grants all reservations.
+type reservingProxy struct {
+	*stateProxy
+	reservations map[string]types.ReservationInfo
+}
+
+func (rp *reservingProxy) RequestReservation(rsession string, rt types.ReservationTemplate) (types.ReservationInfo, error) {
+	info := types.ReservationInfo{
+		ReservationId:        "r1",
+		ReservationName:      rt.Name,
+		ReservationStartTime: rt.StartTime,
+		ReservationEndTime:   rt.StartTime.Add(rt.Duration),
+		ReservedSlots:        rt.MinSlots,
+	}
+	rp.reservations[info.ReservationId] = info
+	return info, nil
+}
+
+func (rp *reservingProxy) GetReservations(rsession string) ([]types.ReservationInfo, error) {
+	infos := []types.ReservationInfo{}
+	for _, info := range rp.reservations {
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (rp *reservingProxy) GetReservation(rsession, reservationid string) (types.ReservationInfo, error) {
+	if info, exists := rp.reservations[reservationid]; exists {
+		return info, nil
+	}
+	return types.ReservationInfo{}, Errorf(types.ErrorCodeNotFound, "reservation %s not found", reservationid)
+}
+
+func (rp *reservingProxy) TerminateReservation(rsession, reservationid string) error {
+	if _, exists := rp.reservations[reservationid]; !exists {
+		return Errorf(types.ErrorCodeNotFound, "reservation %s not found", reservationid)
+	}
+	delete(rp.reservations, reservationid)
+	return nil
+}
+
+var _ = Describe("ProxyReservation", func() {
+
+	var (
+		server *httptest.Server
+		c      *client.Client
+		ctx    = context.Background()
+	)
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll("uploads")
+	})
+
+	Context("when the ProxyImplementer supports reservations", func() {
+
+		BeforeEach(func() {
+			rp := &reservingProxy{
+				stateProxy:   &stateProxy{states: map[string]types.JobState{}},
+				reservations: map[string]types.ReservationInfo{},
+			}
+			server = httptest.NewServer(NewProxyRouter(rp, SecConfig{}, nil))
+			c = client.New(server.URL+"/v1", nil)
+		})
+
+		It("should create, list, show, and terminate reservations", func() {
+			start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+			info, err := c.RequestReservation(ctx, "ubercluster", types.ReservationTemplate{
+				Name: "demo", StartTime: start, Duration: time.Hour, MinSlots: 4,
+			})
+			Ω(err).Should(BeNil())
+			Ω(info.ReservationId).Should(Equal("r1"))
+			Ω(info.ReservationEndTime).Should(Equal(start.Add(time.Hour)))
+
+			infos, err := c.GetReservations(ctx, "ubercluster")
+			Ω(err).Should(BeNil())
+			Ω(infos).Should(HaveLen(1))
+
+			info, err = c.GetReservation(ctx, "ubercluster", "r1")
+			Ω(err).Should(BeNil())
+			Ω(info.ReservedSlots).Should(BeNumerically("==", 4))
+
+			Ω(c.TerminateReservation(ctx, "ubercluster", "r1")).Should(BeNil())
+			_, err = c.GetReservation(ctx, "ubercluster", "r1")
+			Ω(client.IsNotFound(err)).Should(BeTrue())
+		})
+
+		It("should reject invalid reservation templates", func() {
+			start := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+			_, err := c.RequestReservation(ctx, "ubercluster", types.ReservationTemplate{
+				StartTime: start, EndTime: start.Add(-time.Hour),
+			})
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeInvalidRequest))
+		})
+
+	})
+
+	Context("when the ProxyImplementer does not support reservations", func() {
+
+		BeforeEach(func() {
+			sp := &stateProxy{states: map[string]types.JobState{}}
+			server = httptest.NewServer(NewProxyRouter(sp, SecConfig{}, nil))
+			c = client.New(server.URL+"/v1", nil)
+		})
+
+		It("should answer with not implemented", func() {
+			_, err := c.GetReservations(ctx, "ubercluster")
+			Ω(err).ShouldNot(BeNil())
+			Ω(err.(*client.Error).Code).Should(Equal(types.ErrorCodeNotImplemented))
+		})
+
+	})
+
+})
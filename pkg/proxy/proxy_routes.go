@@ -17,9 +17,11 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"github.com/GeertJohan/yubigo"
 	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
@@ -41,9 +43,15 @@ var routes = Routes{
 	Route{
 		"JobSubmit", "POST", "/v1/jsession/{jsname}/run", MakeJSessionSubmitHandler,
 	},
-	// Operations are: suspend resume delete (hold / release)
 	Route{
-		"JobManipulation", "POST", "/v1/jsession/{jsname}/{operation:suspend|resume|terminate}/{jobid}", MakeJSessionJobManipulationHandler,
+		"JobRunBulk", "POST", "/v1/jsession/{jsname}/runbulk", MakeJSessionRunBulkHandler,
+	},
+	// Operations are: suspend resume terminate hold release
+	Route{
+		"JobManipulation", "POST", "/v1/jsession/{jsname}/{operation:suspend|resume|terminate|hold|release}/{jobid}", MakeJSessionJobManipulationHandler,
+	},
+	Route{
+		"JobOutput", "GET", "/v1/jsession/{jsname}/job/{jobid}/output", MakeJSessionJobOutputHandler,
 	},
 	Route{
 		"JobCategories", "GET", "/v1/jsession/{jsname}/jobcategories", MakeJSessionCategoriesHandler,
@@ -51,12 +59,48 @@ var routes = Routes{
 	Route{
 		"JobCategory", "GET", "/v1/jsession/{jsname}/jobcategory/{category}", MakeJSessionCategoryHandler,
 	},
+	Route{
+		"RSessionReserve", "POST", "/v1/rsession/{rsname}/reserve", MakeRSessionReserveHandler,
+	},
+	Route{
+		"RSessionReservations", "GET", "/v1/rsession/{rsname}/reservations", MakeRSessionReservationsHandler,
+	},
+	Route{
+		"RSessionReservation", "GET", "/v1/rsession/{rsname}/reservation/{reservationid}", MakeRSessionReservationHandler,
+	},
+	Route{
+		"RSessionTerminate", "POST", "/v1/rsession/{rsname}/terminate/{reservationid}", MakeRSessionTerminateHandler,
+	},
 	Route{
 		"msessionJobInfos", "GET", "/v1/msession/jobinfos", MakeMSessionJobInfosHandler,
 	},
+	Route{
+		"msessionJobInfosWatch", "GET", "/v1/msession/jobinfos/watch", MakeMSessionJobInfosWatchHandler,
+	},
 	Route{
 		"jobid", "GET", "/v1/msession/jobinfo/{jobid}", MakeMSessionJobInfoHandler,
 	},
+	Route{
+		"distributionPush", "POST", "/v1/distribution/push", MakeDistributionPushHandler,
+	},
+	Route{
+		"distributionFetch", "POST", "/v1/distribution/fetch", MakeDistributionFetchHandler,
+	},
+	Route{
+		"distributionFetched", "POST", "/v1/distribution/fetched/{jobid}", MakeDistributionFetchedHandler,
+	},
+	Route{
+		"msessionJobHistory", "GET", "/v1/msession/jobhistory", MakeMSessionJobHistoryHandler,
+	},
+	Route{
+		"msessionJobTemplate", "GET", "/v1/msession/jobtemplate/{jobid}", MakeMSessionJobTemplateHandler,
+	},
+	Route{
+		"msessionJobMigration", "POST", "/v1/msession/jobhistory/{jobid}/migration", MakeMSessionJobMigrationHandler,
+	},
+	Route{
+		"arrayjobid", "GET", "/v1/msession/arrayjobinfo/{arrayjobid}", MakeMSessionArrayJobInfoHandler,
+	},
 	Route{
 		"msessionMachines", "GET", "/v1/msession/machines", MakeMachinesHandler,
 	},
@@ -84,12 +128,24 @@ var routes = Routes{
 	Route{
 		"jsessionSessions", "GET", "/v1/jsessions", MakeSessionListHandler,
 	},
+	Route{
+		"jsessionCreate", "POST", "/v1/jsessions", MakeJSessionCreateHandler,
+	},
+	Route{
+		"jsessionDestroy", "DELETE", "/v1/jsessions/{jsname}", MakeJSessionDestroyHandler,
+	},
+	Route{
+		"jsessionJobInfos", "GET", "/v1/jsession/{jsname}/jobinfos", MakeJSessionJobInfosHandler,
+	},
 	Route{
 		"jsessionFiles", "GET", "/v1/jsession/{jsname}/staging/files", MakeListFilesHandler,
 	},
 	Route{
 		"jsessionFileDownload", "GET", "/v1/jsession/{jsname}/staging/file/{name}", MakeDownloadFilesHandler,
 	},
+	Route{
+		"jsessionStagingUsage", "GET", "/v1/jsession/{jsname}/staging/usage", MakeStagingUsageHandler,
+	},
 	Route{
 		"runLocal", "POST", "/v1/local/run", MakeRunLocalHandler,
 	},
@@ -113,7 +169,7 @@ func MakeFixedSecretHandler(secret string, f http.HandlerFunc) http.HandlerFunc
 			} else {
 				log.Println("Unauthorized access by ", r.RemoteAddr)
 				// slow down
-				http.Error(w, "authorization failed", http.StatusUnauthorized)
+				writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
 				return
 			}
 		} else {
@@ -127,6 +183,11 @@ func MakeFixedSecretHandler(secret string, f http.HandlerFunc) http.HandlerFunc
 // http handlers - a bit hacky
 var yubiAuth *yubigo.YubiAuth
 
+// yubikeyIDKey is the key of the context value which contains the id
+// of the yubikey (first 12 characters of the OTP) after its OTP was
+// verified.
+type yubikeyIDKey struct{}
+
 // MakeYubikeyHandler creates an http handler which is protected by an
 // yubkikey one-time-password verification. The OTP needs to be given
 // by either a form value ("otp") or a POST form value ("otp").
@@ -153,7 +214,8 @@ func MakeYubikeyHandler(id, key string, allowedIDs []string, f http.HandlerFunc)
 		if len(otpFromClient) != 44 {
 			log.Println("Unauthorized access by ", r.RemoteAddr)
 			log.Printf("Length of OTP does not match 44: %d", len(otpFromClient))
-			http.Error(w, "authorization failed", http.StatusUnauthorized)
+			writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
+			return
 		}
 
 		id := otpFromClient[0:12]
@@ -168,24 +230,24 @@ func MakeYubikeyHandler(id, key string, allowedIDs []string, f http.HandlerFunc)
 		if found == false {
 			log.Println("Unauthorized access by ", r.RemoteAddr)
 			log.Printf("ID %s not in list of allowed IDs", id)
-			http.Error(w, "authorization failed", http.StatusUnauthorized)
+			writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
 			return
 		}
 
 		// verify OTP
 		if result, ok, err := yubiAuth.Verify(otpFromClient); ok {
 			// successfully verified the one time password
-			f(w, r)
+			f(w, r.WithContext(context.WithValue(r.Context(), yubikeyIDKey{}, id)))
 		} else {
 			if err != nil {
 				// something really bad! probably best to abort
 				fmt.Println("Verification of yubikey failed with error: ", err)
 				log.Println("Unauthorized access by ", r.RemoteAddr)
-				http.Error(w, "authorization failed", http.StatusUnauthorized)
+				writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
 			} else {
 				log.Println("Verification of yubikey OTP failed: ", result)
 				log.Println("Unauthorized access by ", r.RemoteAddr)
-				http.Error(w, "authorization failed", http.StatusUnauthorized)
+				writeErrorResponse(w, types.ErrorCodeUnauthorized, "authorization failed", nil)
 			}
 		}
 	}
@@ -193,17 +255,13 @@ func MakeYubikeyHandler(id, key string, allowedIDs []string, f http.HandlerFunc)
 
 // NewProxyRouter creates a mux router for matching http requests to handlers.
 // When security is configured it adds neccessary closures around the functions.
+// The latency and the results of all handlers are recorded in the metrics
+// which are served at MetricsPath.
 func NewProxyRouter(impl ProxyImplementer, sc SecConfig, pi persistency.PersistencyImplementer) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
-	if sc.OTP == "" {
-		for _, route := range routes {
-			router.
-				Methods(route.Method).
-				Path(route.Pattern).
-				Name(route.Name).
-				Handler(route.MakeHandlerFunc(impl, pi))
-		}
-	} else if sc.OTP == "yubikey" {
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	protect := func(f http.HandlerFunc) http.HandlerFunc { return f }
+	if sc.OTP == "yubikey" {
 		// add yubikey one-time-password verifcation for each call
 		if sc.YubiID == "" || sc.YubiSecret == "" {
 			fmt.Println("yubikey is configured but ID or Secret not set!")
@@ -213,22 +271,36 @@ func NewProxyRouter(impl ProxyImplementer, sc SecConfig, pi persistency.Persiste
 			fmt.Println("yubikey is configured but no allowed keys set (first 12 chars of your OTP)!")
 			os.Exit(1)
 		}
-		for _, route := range routes {
-			router.
-				Methods(route.Method).
-				Path(route.Pattern).
-				Name(route.Name).
-				Handler(MakeYubikeyHandler(sc.YubiID, sc.YubiSecret, sc.YubiAllowedIDs, route.MakeHandlerFunc(impl, pi)))
+		protect = func(f http.HandlerFunc) http.HandlerFunc {
+			return MakeYubikeyHandler(sc.YubiID, sc.YubiSecret, sc.YubiAllowedIDs, f)
 		}
-	} else {
+	} else if sc.OTP != "" {
 		// fixed key
-		for _, route := range routes {
-			router.
-				Methods(route.Method).
-				Path(route.Pattern).
-				Name(route.Name).
-				Handler(MakeFixedSecretHandler(sc.OTP, route.MakeHandlerFunc(impl, pi)))
+		protect = func(f http.HandlerFunc) http.HandlerFunc {
+			return MakeFixedSecretHandler(sc.OTP, f)
 		}
 	}
+	metrics := getMetrics(impl)
+	for _, route := range routes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(metrics.instrument(route.Name, protect(MakeHopHandler(impl, route.MakeHandlerFunc(impl, pi)))))
+	}
+
+	metricsHandler := MakeHopHandler(impl, MakeMetricsHandler(impl, pi))
+	switch sc.MetricsAuth {
+	case "":
+		metricsHandler = protect(metricsHandler)
+	case MetricsAuthNone:
+	default:
+		metricsHandler = MakeMetricsSecretHandler(sc.MetricsAuth, metricsHandler)
+	}
+	router.
+		Methods("GET").
+		Path(MetricsPath).
+		Name(metricsRoute).
+		Handler(metrics.instrument(metricsRoute, metricsHandler))
 	return router
 }
@@ -1,12 +1,20 @@
 package proxy
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"os"
 )
 
+// Client certificate checks of a proxy serving TLS (SecConfig.ClientAuth).
+const (
+	ClientAuthRequire  = "require"  // clients need a trusted certificate (mutual TLS)
+	ClientAuthOptional = "optional" // certificates of clients are verified when they send one
+	ClientAuthNone     = "none"     // server-only TLS, client certificates are not requested
+)
+
 // SecConfig stores security related configuration settings for the ubercluster Proxy
 type SecConfig struct {
 	OTP                  string   // secret key or "yubikey"
@@ -14,8 +22,57 @@ type SecConfig struct {
 	YubiSecret           string   // Secret of yubiservice in case of yubikey https://upgrade.yubico.com/getapikey/
 	YubiAllowedIDs       []string // IDs of yubkeys which are allowed
 	TrustedClientCertDir string   // Directory which contains trusted certs for mutual TLS
+	// ClientAuth defines if clients need a certificate when TLS is used.
+	// By default it is ClientAuthRequire when a TrustedClientCertDir is
+	// given and ClientAuthNone otherwise.
+	ClientAuth string
+	// MetricsAuth protects the metrics (MetricsPath). When empty they
+	// are protected like all other routes, MetricsAuthNone serves them
+	// without authentication, and any other value is a shared secret
+	// which is sent as bearer token or as otp. Client certificates
+	// required by ClientAuth are required for the metrics as well.
+	MetricsAuth string
+}
+
+// ServerTLSConfig returns the TLS configuration for the client
+// certificate checks of the proxy. It fails when the directory with the
+// trusted client certificates can't be read or contains no certificate.
+func ServerTLSConfig(sc SecConfig) (*tls.Config, error) {
+	clientAuth := sc.ClientAuth
+	if clientAuth == "" {
+		clientAuth = ClientAuthNone
+		if sc.TrustedClientCertDir != "" {
+			clientAuth = ClientAuthRequire
+		}
+	}
+	config := &tls.Config{}
+	switch clientAuth {
+	case ClientAuthNone:
+		config.ClientAuth = tls.NoClientCert
+		return config, nil
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unknown client authentication %q (use %q, %q, or %q)",
+			clientAuth, ClientAuthRequire, ClientAuthOptional, ClientAuthNone)
+	}
+	if sc.TrustedClientCertDir == "" {
+		return nil, fmt.Errorf("client authentication %q requires a directory with trusted client certificates", clientAuth)
+	}
+	pool, err := ReadTrustedClientCertPool(sc.TrustedClientCertDir)
+	if err != nil {
+		return nil, fmt.Errorf("reading trusted client certificates: %s", err)
+	}
+	// Ensure that we only use our "CA" to validate certificates
+	config.ClientCAs = pool
+	return config, nil
 }
 
+// ReadTrustedClientCertPool reads the PEM encoded certificates in the
+// directory. Sub-directories are ignored; a directory without any
+// certificate is an error.
 func ReadTrustedClientCertPool(directory string) (*x509.CertPool, error) {
 	fileinfos, err := ioutil.ReadDir(directory)
 	if err != nil {
@@ -24,7 +81,11 @@ func ReadTrustedClientCertPool(directory string) (*x509.CertPool, error) {
 
 	clientCertPool := x509.NewCertPool()
 
+	certs := 0
 	for i := range fileinfos {
+		if fileinfos[i].IsDir() {
+			continue
+		}
 		file := directory + string(os.PathSeparator) + fileinfos[i].Name()
 
 		// added trusted client certs
@@ -36,6 +97,10 @@ func ReadTrustedClientCertPool(directory string) (*x509.CertPool, error) {
 		if ok := clientCertPool.AppendCertsFromPEM(certBytes); !ok {
 			return clientCertPool, fmt.Errorf("unable to add certificate %s to certificate pool", file)
 		}
+		certs++
+	}
+	if certs == 0 {
+		return nil, fmt.Errorf("no trusted client certificates found in %s", directory)
 	}
 
 	return clientCertPool, nil
@@ -5,6 +5,10 @@ import (
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"crypto/tls"
+	"io/ioutil"
+	"os"
 )
 
 var _ = Describe("ProxySecurity", func() {
@@ -17,6 +21,23 @@ var _ = Describe("ProxySecurity", func() {
 			Ω(pool).ShouldNot(BeNil())
 		})
 
+		It("should require client certificates when trusted certs are given", func() {
+			config, err := ServerTLSConfig(SecConfig{TrustedClientCertDir: "./testClientCerts"})
+			Ω(err).Should(BeNil())
+			Ω(config.ClientAuth).Should(Equal(tls.RequireAndVerifyClientCert))
+			Ω(config.ClientCAs).ShouldNot(BeNil())
+
+			config, err = ServerTLSConfig(SecConfig{TrustedClientCertDir: "./testClientCerts", ClientAuth: ClientAuthOptional})
+			Ω(err).Should(BeNil())
+			Ω(config.ClientAuth).Should(Equal(tls.VerifyClientCertIfGiven))
+		})
+
+		It("should not request client certificates for server-only TLS", func() {
+			config, err := ServerTLSConfig(SecConfig{})
+			Ω(err).Should(BeNil())
+			Ω(config.ClientAuth).Should(Equal(tls.NoClientCert))
+		})
+
 	})
 
 	Context("error cases", func() {
@@ -25,6 +46,23 @@ var _ = Describe("ProxySecurity", func() {
 			pool, err := ReadTrustedClientCertPool("./unknownDir")
 			Ω(err).ShouldNot(BeNil())
 			Ω(pool).Should(BeNil())
+			_, err = ServerTLSConfig(SecConfig{TrustedClientCertDir: "./unknownDir"})
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("fail when directory contains no certificate", func() {
+			dir, err := ioutil.TempDir("", "clientcerts")
+			Ω(err).Should(BeNil())
+			defer os.RemoveAll(dir)
+			_, err = ReadTrustedClientCertPool(dir)
+			Ω(err).ShouldNot(BeNil())
+		})
+
+		It("fail when client certificates are required without trusted certs", func() {
+			_, err := ServerTLSConfig(SecConfig{ClientAuth: ClientAuthRequire})
+			Ω(err).ShouldNot(BeNil())
+			_, err = ServerTLSConfig(SecConfig{TrustedClientCertDir: "./testClientCerts", ClientAuth: "maybe"})
+			Ω(err).ShouldNot(BeNil())
 		})
 
 	})
@@ -0,0 +1,543 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// Default settings of the staging area.
+const (
+	DefaultMaxFileSize   = 1024 * 1024 * 1024 // largest file which can be uploaded (1 GB)
+	DefaultSweepInterval = time.Minute        // how often expired files are removed
+
+	maxFormOverhead    = 1024 * 1024                    // multipart encoding around the uploaded file
+	internalFilePrefix = ".uc-"                         // files of the proxy in the staging area
+	uploadTmpPrefix    = internalFilePrefix + "upload-" // files of uploads which are not complete
+	sessionJobsFile    = internalFilePrefix + "jobs"    // jobs of the job session
+	stagingStateFile   = internalFilePrefix + "staging" // uploads and submitted jobs of the job session
+)
+
+// StagingConfig limits the space used in the staging area of a proxy
+// and defines when staged files are removed. Quotas of 0 are unlimited.
+type StagingConfig struct {
+	MaxFileSize   int64  // largest file which can be uploaded, DefaultMaxFileSize when 0
+	SessionQuota  int64  // bytes in the staging area of one job session
+	IdentityQuota int64  // bytes uploaded by one identity in all job sessions
+	FileTTL       string // files older than that are removed (like "72h"), kept when empty
+	// RemoveFinished removes files when all jobs which were submitted
+	// in the job session after the upload of the file are finished.
+	RemoveFinished bool
+	SweepInterval  string // duration like "1m", DefaultSweepInterval when empty
+}
+
+// ReadStagingConfig reads a JSON encoded StagingConfig.
+func ReadStagingConfig(path string) (StagingConfig, error) {
+	var config StagingConfig
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return config, fmt.Errorf("invalid staging config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// stagedFile contains who uploaded a file and when. Files which were
+// not uploaded through the proxy have no owner and their modification
+// time counts as upload time.
+type stagedFile struct {
+	Owner    string    `json:"owner"`
+	Uploaded time.Time `json:"uploaded"`
+}
+
+// submittedJob is a job submitted in a job session.
+type submittedJob struct {
+	JobID     string    `json:"jobId"`
+	Submitted time.Time `json:"submitted"`
+}
+
+// stagingState is stored in the stagingStateFile of the staging area of
+// each job session so that the owners of the files and the jobs which
+// use them are known after a restart of the proxy.
+type stagingState struct {
+	Files map[string]stagedFile `json:"files"` // name of the file -> upload
+	Jobs  []submittedJob        `json:"jobs"`
+}
+
+// StagingManager enforces the quotas of the staging area of a
+// ProxyImplementer and removes expired files and files left by
+// finished jobs.
+type StagingManager struct {
+	sync.Mutex
+	impl     ProxyImplementer
+	config   StagingConfig
+	ttl      time.Duration
+	interval time.Duration
+	files    map[string]stagedFile     // path of the file -> upload
+	jobs     map[string][]submittedJob // job session -> submitted jobs (with FileTTL or RemoveFinished)
+	cancel   context.CancelFunc
+}
+
+// stagingManagers contains the StagingManager of each ProxyImplementer.
+var stagingManagers = struct {
+	sync.Mutex
+	registries map[ProxyImplementer]*StagingManager
+}{registries: make(map[ProxyImplementer]*StagingManager)}
+
+// newStagingManager creates a StagingManager for the config.
+func newStagingManager(impl ProxyImplementer, config StagingConfig) (*StagingManager, error) {
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultMaxFileSize
+	}
+	if config.SessionQuota < 0 || config.IdentityQuota < 0 {
+		return nil, fmt.Errorf("quotas of the staging area can not be negative")
+	}
+	m := &StagingManager{
+		impl:     impl,
+		config:   config,
+		interval: DefaultSweepInterval,
+		files:    make(map[string]stagedFile),
+		jobs:     make(map[string][]submittedJob),
+	}
+	if config.FileTTL != "" {
+		ttl, err := time.ParseDuration(config.FileTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid file TTL %q", config.FileTTL)
+		}
+		m.ttl = ttl
+	}
+	if config.SweepInterval != "" {
+		interval, err := time.ParseDuration(config.SweepInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid sweep interval %q", config.SweepInterval)
+		}
+		m.interval = interval
+	}
+	for session, dir := range stagingSessionDirs() {
+		m.load(session, dir)
+	}
+	return m, nil
+}
+
+// stagingSessionDirs returns the staging areas of all job sessions.
+func stagingSessionDirs() map[string]string {
+	dirs := map[string]string{DefaultJobSession: stagingArea}
+	fis, err := ioutil.ReadDir(stagingArea)
+	if err != nil {
+		return dirs
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && jobSessionName.MatchString(fi.Name()) {
+			dirs[fi.Name()] = stagingDir(stagingArea, fi.Name())
+		}
+	}
+	return dirs
+}
+
+// load reads the stagingStateFile of the job session.
+func (m *StagingManager) load(session, dir string) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, stagingStateFile))
+	if os.IsNotExist(err) {
+		return
+	}
+	var state stagingState
+	if err == nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		log.Printf("(proxy) Can not read the staging state of job session %s: %s\n", session, err)
+		return
+	}
+	for name, f := range state.Files {
+		m.files[filepath.Join(dir, name)] = f
+	}
+	m.jobs[session] = state.Jobs
+}
+
+// save writes the stagingStateFile of the job session. The caller must
+// hold the lock.
+func (m *StagingManager) save(session string) {
+	dir := stagingDir(stagingArea, session)
+	state := stagingState{Files: make(map[string]stagedFile), Jobs: m.jobs[session]}
+	for path, f := range m.files {
+		if filepath.Dir(path) == dir {
+			state.Files[filepath.Base(path)] = f
+		}
+	}
+	data, err := json.Marshal(state)
+	if err == nil {
+		// replaced at once so that a crash does not leave a partial file
+		tmp := filepath.Join(dir, uploadTmpPrefix+"state")
+		if err = ioutil.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, filepath.Join(dir, stagingStateFile))
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("(proxy) Can not store the staging state of job session %s: %s\n", session, err)
+	}
+}
+
+// getStagingManager returns the StagingManager of the ProxyImplementer.
+// Without EnableStagingGovernance the uploads are only limited by the
+// DefaultMaxFileSize and files are never removed.
+func getStagingManager(impl ProxyImplementer) *StagingManager {
+	stagingManagers.Lock()
+	defer stagingManagers.Unlock()
+	m, exists := stagingManagers.registries[impl]
+	if !exists {
+		m, _ = newStagingManager(impl, StagingConfig{})
+		stagingManagers.registries[impl] = m
+	}
+	return m
+}
+
+// EnableStagingGovernance enforces the quotas of the config for the
+// staging area of the ProxyImplementer and periodically removes staged
+// files as configured until Stop is called. It must be called before
+// the http handlers of the proxy are created (like in
+// ProxyListenAndServe).
+func EnableStagingGovernance(impl ProxyImplementer, config StagingConfig) (*StagingManager, error) {
+	m, err := newStagingManager(impl, config)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	stagingManagers.Lock()
+	stagingManagers.registries[impl] = m
+	stagingManagers.Unlock()
+
+	if m.ttl > 0 || config.RemoveFinished {
+		go m.sweepLoop(ctx)
+	}
+	return m, nil
+}
+
+// Stop stops removing staged files and removes the StagingManager of
+// the ProxyImplementer.
+func (m *StagingManager) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	stagingManagers.Lock()
+	defer stagingManagers.Unlock()
+	if stagingManagers.registries[m.impl] == m {
+		delete(stagingManagers.registries, m.impl)
+	}
+}
+
+// requestIdentity returns who sends the request: the common name of
+// the TLS client certificate, the id of the yubikey (only when the
+// proxy verified its OTP), or the host the request comes from.
+func requestIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && r.TLS.PeerCertificates[0].Subject.CommonName != "" {
+		return "cert:" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if id, ok := r.Context().Value(yubikeyIDKey{}).(string); ok {
+		return "yubikey:" + id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "host:" + host
+}
+
+// isStagedFile returns true for the files in the staging area which
+// belong to the users (not the files of the proxy like the temporary
+// files of running uploads).
+func isStagedFile(fi os.FileInfo) bool {
+	return !fi.IsDir() && !strings.HasPrefix(fi.Name(), internalFilePrefix)
+}
+
+// usage returns the bytes used in the staging area of the job session
+// and by the identity. The file which is replaced by an upload is not
+// counted. The caller must hold the lock.
+func (m *StagingManager) usage(sessionDir, identity, replaced string) (sessionBytes, identityBytes int64) {
+	if fis, err := ioutil.ReadDir(sessionDir); err == nil {
+		for _, fi := range fis {
+			if isStagedFile(fi) && filepath.Join(sessionDir, fi.Name()) != replaced {
+				sessionBytes += fi.Size()
+			}
+		}
+	}
+	for path, f := range m.files {
+		if f.Owner != identity || path == replaced {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			identityBytes += fi.Size()
+		} else if os.IsNotExist(err) {
+			// removed with its job session
+			delete(m.files, path)
+		}
+	}
+	return sessionBytes, identityBytes
+}
+
+// uploadLimit returns how many bytes the identity can upload into the
+// file of the staging area of the job session.
+func (m *StagingManager) uploadLimit(sessionDir, identity, path string) int64 {
+	m.Lock()
+	defer m.Unlock()
+	limit := m.config.MaxFileSize
+	sessionBytes, identityBytes := m.usage(sessionDir, identity, path)
+	if m.config.SessionQuota > 0 && m.config.SessionQuota-sessionBytes < limit {
+		limit = m.config.SessionQuota - sessionBytes
+	}
+	if m.config.IdentityQuota > 0 && m.config.IdentityQuota-identityBytes < limit {
+		limit = m.config.IdentityQuota - identityBytes
+	}
+	return limit
+}
+
+// commitUpload moves the uploaded temporary file to its path in the
+// staging area of the job session when the quotas are still kept
+// (other uploads could have run at the same time).
+func (m *StagingManager) commitUpload(session, identity, tmp, path string, size int64) error {
+	m.Lock()
+	defer m.Unlock()
+	sessionBytes, identityBytes := m.usage(stagingDir(stagingArea, session), identity, path)
+	if m.config.SessionQuota > 0 && sessionBytes+size > m.config.SessionQuota {
+		return Errorf(types.ErrorCodeQuotaExceeded, "quota of the job session exceeded (%d of %d bytes used)",
+			sessionBytes, m.config.SessionQuota)
+	}
+	if m.config.IdentityQuota > 0 && identityBytes+size > m.config.IdentityQuota {
+		return Errorf(types.ErrorCodeQuotaExceeded, "quota of %s exceeded (%d of %d bytes used)",
+			identity, identityBytes, m.config.IdentityQuota)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return Errorf(types.ErrorCodeInternal, "can not store file: %s", err)
+	}
+	m.files[path] = stagedFile{Owner: identity, Uploaded: time.Now()}
+	m.save(session)
+	return nil
+}
+
+// quotaError returns the error for an upload which exceeds the limit.
+func (m *StagingManager) quotaError(limit int64) error {
+	if limit >= m.config.MaxFileSize {
+		return Errorf(types.ErrorCodeQuotaExceeded, "file too large (limit is %d bytes)", m.config.MaxFileSize)
+	}
+	if limit <= 0 {
+		return Errorf(types.ErrorCodeQuotaExceeded, "staging quota exceeded")
+	}
+	return Errorf(types.ErrorCodeQuotaExceeded, "staging quota exceeded (%d bytes left)", limit)
+}
+
+// jobSubmitted records a job submitted in the job session. The files
+// staged in the job session before can be used by the job.
+func (m *StagingManager) jobSubmitted(session, jobid string) {
+	if !m.config.RemoveFinished && m.ttl == 0 {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.jobs[session] = append(m.jobs[session], submittedJob{JobID: jobid, Submitted: time.Now()})
+	m.save(session)
+}
+
+// uploadTime returns when the file was uploaded. The caller must hold
+// the lock.
+func (m *StagingManager) uploadTime(path string, fi os.FileInfo) time.Time {
+	if f, exists := m.files[path]; exists {
+		return f.Uploaded
+	}
+	return fi.ModTime()
+}
+
+// expires returns when the file is removed because of its age.
+func (m *StagingManager) expires(path string, fi os.FileInfo) *time.Time {
+	if m.ttl == 0 {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	expires := m.uploadTime(path, fi).Add(m.ttl)
+	return &expires
+}
+
+// owner returns the identity which uploaded the file (if known).
+func (m *StagingManager) owner(path string) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.files[path].Owner
+}
+
+// isFinished returns true if the job or all tasks of the job array are
+// finished. Jobs which are not known anymore are finished.
+func (m *StagingManager) isFinished(jobid string) bool {
+	finished := func(state types.JobState) bool {
+		return state == types.Done || state == types.Failed
+	}
+	if aji := GetArrayJobInfo(m.impl, jobid); aji != nil {
+		for _, task := range aji.Tasks {
+			if task.JobInfo.Id == "" || !finished(task.JobInfo.State) {
+				return false
+			}
+		}
+		return true
+	}
+	ji, err := currentJobInfo(m.impl, jobid)
+	if err != nil {
+		return false
+	}
+	return ji == nil || finished(ji.State)
+}
+
+// sweepLoop removes staged files until the context is done.
+func (m *StagingManager) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Sweep()
+		}
+	}
+}
+
+// Sweep removes the files of all job sessions which are older than the
+// FileTTL and, with RemoveFinished, the files which were used by jobs
+// that are finished. Files used by unfinished jobs are not removed. It
+// returns the amount of removed files. Sweep is called periodically
+// when staging governance is enabled.
+func (m *StagingManager) Sweep() int {
+	removed := 0
+	for session, dir := range stagingSessionDirs() {
+		removed += m.sweepSession(session, dir)
+	}
+	return removed
+}
+
+// sweepSession removes the expired files of one job session.
+func (m *StagingManager) sweepSession(session, dir string) int {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	m.Lock()
+	jobs := append([]submittedJob(nil), m.jobs[session]...)
+	m.Unlock()
+	finished := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		finished[job.JobID] = m.isFinished(job.JobID)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	removed := 0
+	oldest := time.Now()
+	for _, fi := range fis {
+		if !isStagedFile(fi) {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		uploaded := m.uploadTime(path, fi)
+		reason := ""
+		if m.ttl > 0 && time.Since(uploaded) > m.ttl && !usedByUnfinishedJobs(jobs, finished, uploaded) {
+			reason = "expired"
+		} else if m.config.RemoveFinished && usedByFinishedJobs(jobs, finished, uploaded) {
+			reason = "jobs finished"
+		}
+		if reason == "" {
+			if uploaded.Before(oldest) {
+				oldest = uploaded
+			}
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("(proxy) Can not remove staged file %s: %s\n", path, err)
+			continue
+		}
+		log.Printf("(proxy) Removed staged file %s (%s)\n", path, reason)
+		delete(m.files, path)
+		removed++
+	}
+	// finished jobs submitted before the oldest remaining file are
+	// not relevant anymore
+	remaining := m.jobs[session][:0]
+	for _, job := range m.jobs[session] {
+		if known, checked := finished[job.JobID]; !checked || !known || !job.Submitted.Before(oldest) {
+			remaining = append(remaining, job)
+		}
+	}
+	m.jobs[session] = remaining
+	if removed > 0 || len(remaining) < len(jobs) {
+		m.save(session)
+	}
+	return removed
+}
+
+// usedByFinishedJobs returns true if jobs were submitted after the
+// upload of the file and all of them are finished.
+func usedByFinishedJobs(jobs []submittedJob, finished map[string]bool, uploaded time.Time) bool {
+	used := false
+	for _, job := range jobs {
+		if job.Submitted.Before(uploaded) {
+			continue
+		}
+		if !finished[job.JobID] {
+			return false
+		}
+		used = true
+	}
+	return used
+}
+
+// usedByUnfinishedJobs returns true if a job which was submitted after
+// the upload of the file is not finished.
+func usedByUnfinishedJobs(jobs []submittedJob, finished map[string]bool, uploaded time.Time) bool {
+	for _, job := range jobs {
+		if !job.Submitted.Before(uploaded) && !finished[job.JobID] {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeStagingUsageHandler returns an http handler function which
+// returns the used space in the staging area of the job session and by
+// the requesting identity together with the quotas.
+func MakeStagingUsageHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	sessions := getJobSessions(impl)
+	manager := getStagingManager(impl)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, ok := jobSession(w, r, sessions)
+		if !ok {
+			return
+		}
+		identity := requestIdentity(r)
+		manager.Lock()
+		sessionBytes, identityBytes := manager.usage(stagingDir(stagingArea, session), identity, "")
+		manager.Unlock()
+		json.NewEncoder(w).Encode(types.StagingUsage{
+			Session:       session,
+			SessionBytes:  sessionBytes,
+			SessionQuota:  manager.config.SessionQuota,
+			Identity:      identity,
+			IdentityBytes: identityBytes,
+			IdentityQuota: manager.config.IdentityQuota,
+			MaxFileSize:   manager.config.MaxFileSize,
+			FileTTL:       manager.config.FileTTL,
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+var _ = Describe("ProxyStaging", func() {
+
+	var (
+		rp      *runProxy
+		manager *StagingManager
+		server  *httptest.Server
+		c       *client.Client
+		ctx     context.Context
+		dir     string
+	)
+
+	start := func(config StagingConfig) {
+		var err error
+		manager, err = EnableStagingGovernance(rp, config)
+		Ω(err).Should(BeNil())
+		server = httptest.NewServer(NewProxyRouter(rp, SecConfig{}, nil))
+		c = client.New(server.URL+"/v1", nil)
+	}
+
+	// upload stores a file with the given size in the job session.
+	upload := func(session, name string, size int) error {
+		path := filepath.Join(dir, name)
+		Ω(ioutil.WriteFile(path, []byte(strings.Repeat("x", size)), 0600)).Should(BeNil())
+		return c.UploadFile(ctx, session, path, false)
+	}
+
+	isQuotaExceeded := func(err error) bool {
+		cerr, ok := err.(*client.Error)
+		return ok && cerr.Code == types.ErrorCodeQuotaExceeded
+	}
+
+	BeforeEach(func() {
+		rp = &runProxy{stateProxy: &stateProxy{states: map[string]types.JobState{}}}
+		ctx = context.Background()
+		var err error
+		dir, err = ioutil.TempDir("", "staging")
+		Ω(err).Should(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		manager.Stop()
+		os.RemoveAll(dir)
+		os.RemoveAll("uploads")
+	})
+
+	It("should reject uploads exceeding the quota of the job session", func() {
+		start(StagingConfig{SessionQuota: 100})
+		Ω(upload(DefaultJobSession, "a", 60)).Should(BeNil())
+		err := upload(DefaultJobSession, "b", 60)
+		Ω(isQuotaExceeded(err)).Should(BeTrue())
+		// replacing a file only counts the new size
+		Ω(upload(DefaultJobSession, "a", 90)).Should(BeNil())
+
+		files, err := c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Bytes).Should(BeNumerically("==", 90))
+		Ω(files[0].Owner).Should(Equal("host:127.0.0.1"))
+	})
+
+	It("should not identify users by unverified one time passwords", func() {
+		start(StagingConfig{IdentityQuota: 100})
+		c.SetOTP(strings.Repeat("c", 44))
+		Ω(upload(DefaultJobSession, "a", 60)).Should(BeNil())
+		c.SetOTP(strings.Repeat("d", 44))
+		Ω(isQuotaExceeded(upload(DefaultJobSession, "b", 60))).Should(BeTrue())
+
+		files, err := c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Owner).Should(Equal("host:127.0.0.1"))
+	})
+
+	It("should reject uploads exceeding the quota of the identity in all job sessions", func() {
+		start(StagingConfig{IdentityQuota: 100})
+		Ω(c.CreateJobSession(ctx, "projectA")).Should(BeNil())
+		Ω(upload(DefaultJobSession, "a", 60)).Should(BeNil())
+		Ω(isQuotaExceeded(upload("projectA", "b", 60))).Should(BeTrue())
+		Ω(upload("projectA", "b", 40)).Should(BeNil())
+
+		usage, err := c.GetStagingUsage(ctx, "projectA")
+		Ω(err).Should(BeNil())
+		Ω(usage.SessionBytes).Should(BeNumerically("==", 40))
+		Ω(usage.IdentityBytes).Should(BeNumerically("==", 100))
+		Ω(usage.IdentityQuota).Should(BeNumerically("==", 100))
+		Ω(usage.SessionQuota).Should(BeNumerically("==", 0))
+	})
+
+	It("should reject files larger than the maximum file size without leaving parts", func() {
+		start(StagingConfig{MaxFileSize: 10})
+		Ω(isQuotaExceeded(upload(DefaultJobSession, "big", 20))).Should(BeTrue())
+		fis, err := ioutil.ReadDir("uploads")
+		Ω(err).Should(BeNil())
+		for _, fi := range fis {
+			Ω(fi.IsDir()).Should(BeTrue())
+		}
+	})
+
+	It("should remove expired files", func() {
+		start(StagingConfig{FileTTL: "50ms", SweepInterval: "1h"})
+		Ω(upload(DefaultJobSession, "a", 10)).Should(BeNil())
+		files, err := c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Expires).ShouldNot(BeNil())
+
+		Ω(manager.Sweep()).Should(Equal(0))
+		time.Sleep(100 * time.Millisecond)
+		Ω(manager.Sweep()).Should(Equal(1))
+		files, err = c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(BeEmpty())
+	})
+
+	It("should remove files when the jobs using them are finished", func() {
+		start(StagingConfig{RemoveFinished: true, SweepInterval: "1h"})
+		Ω(upload(DefaultJobSession, "a", 10)).Should(BeNil())
+		// no job used the file yet
+		Ω(manager.Sweep()).Should(Equal(0))
+
+		jobid, err := c.RunJob(ctx, DefaultJobSession, types.JobTemplate{RemoteCommand: "a"})
+		Ω(err).Should(BeNil())
+		Ω(manager.Sweep()).Should(Equal(0))
+		rp.setState(jobid, types.Done)
+		Ω(manager.Sweep()).Should(Equal(1))
+	})
+
+	It("should not remove expired files used by unfinished jobs", func() {
+		start(StagingConfig{FileTTL: "50ms", SweepInterval: "1h"})
+		Ω(upload(DefaultJobSession, "a", 10)).Should(BeNil())
+		jobid, err := c.RunJob(ctx, DefaultJobSession, types.JobTemplate{RemoteCommand: "a"})
+		Ω(err).Should(BeNil())
+		time.Sleep(100 * time.Millisecond)
+		Ω(manager.Sweep()).Should(Equal(0))
+		rp.setState(jobid, types.Done)
+		Ω(manager.Sweep()).Should(Equal(1))
+	})
+
+	It("should keep the owners of files after a restart", func() {
+		start(StagingConfig{IdentityQuota: 100})
+		Ω(upload(DefaultJobSession, "a", 60)).Should(BeNil())
+		manager.Stop()
+		var err error
+		manager, err = EnableStagingGovernance(rp, StagingConfig{IdentityQuota: 100})
+		Ω(err).Should(BeNil())
+		Ω(isQuotaExceeded(upload(DefaultJobSession, "b", 60))).Should(BeTrue())
+
+		files, err := c.ListFiles(ctx, DefaultJobSession)
+		Ω(err).Should(BeNil())
+		Ω(files).Should(HaveLen(1))
+		Ω(files[0].Owner).Should(Equal("host:127.0.0.1"))
+	})
+
+	It("should reject invalid configurations", func() {
+		_, err := EnableStagingGovernance(rp, StagingConfig{FileTTL: "tomorrow"})
+		Ω(err).ShouldNot(BeNil())
+		_, err = EnableStagingGovernance(rp, StagingConfig{SessionQuota: -1})
+		Ω(err).ShouldNot(BeNil())
+		start(StagingConfig{})
+	})
+
+})
@@ -1,13 +1,22 @@
 package proxy_test
 
 import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"testing"
+	"time"
 )
 
 func TestProxy(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Proxy Suite")
 }
+
+var _ = BeforeSuite(func() {
+	// set once since the background tasks of the specs read it
+	WatchPollInterval = 10 * time.Millisecond
+	HistoryPollInterval = 10 * time.Millisecond
+})
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/persistency"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// WatchPollInterval is the interval in which the job infos of a
+// ProxyImplementer are compared for detecting job state changes.
+var WatchPollInterval = time.Second
+
+// jobStates remembers the last seen state of each job.
+type jobStates map[string]types.JobState
+
+// diffJobInfos returns all job infos of jobs which are new or which
+// changed their state since the last call. The known states are
+// updated.
+func (js jobStates) diffJobInfos(current []types.JobInfo) []types.JobInfo {
+	changed := make([]types.JobInfo, 0, 0)
+	for _, ji := range current {
+		if ji.Id == "" {
+			continue
+		}
+		if state, exists := js[ji.Id]; exists && state == ji.State {
+			continue
+		}
+		js[ji.Id] = ji.State
+		changed = append(changed, ji)
+	}
+	return changed
+}
+
+// pollJobInfos returns the job infos which are compared. If a job id
+// is given only the job info of that job is requested.
+func pollJobInfos(impl ProxyImplementer, jobid string) []types.JobInfo {
+	if jobid == "" {
+		return impl.GetJobInfosByFilter(false, types.JobInfo{})
+	}
+	if ji := impl.GetJobInfo(jobid); ji != nil {
+		return []types.JobInfo{*ji}
+	}
+	return nil
+}
+
+// writeJobInfoEvent writes a job info as Server-Sent Event.
+func writeJobInfoEvent(w http.ResponseWriter, ji types.JobInfo) error {
+	data, err := json.Marshal(ji)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("event: jobinfo\ndata: ")); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("\n\n"))
+	return err
+}
+
+// MakeMSessionJobInfosWatchHandler returns an http handler function which
+// streams JSON encoded DRMAA2 job info objects as Server-Sent Events each
+// time a job changes its state. The stream starts with the current state
+// of all jobs. When the "jobid" form value is set only this job is watched.
+// If the ProxyImplementer implements the JobInfoWatcher interface the
+// changes are taken from there, otherwise the job infos are compared in
+// intervals.
+func MakeMSessionJobInfosWatchHandler(impl ProxyImplementer, pi persistency.PersistencyImplementer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		impl := forRequest(r, impl)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeErrorResponse(w, types.ErrorCodeInternal, "streaming not supported", nil)
+			return
+		}
+		jobid := r.FormValue("jobid")
+		ctx := r.Context()
+
+		var events <-chan types.JobInfo
+		if watcher, isWatcher := impl.(JobInfoWatcher); isWatcher {
+			var err error
+			if events, err = watcher.WatchJobInfos(ctx, jobid); err != nil {
+				log.Printf("(proxy) Error during WatchJobInfos(): %s\n", err)
+				writeError(w, err, map[string]string{"jobid": jobid})
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		if events != nil {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case ji, open := <-events:
+					if !open {
+						return
+					}
+					if err := writeJobInfoEvent(w, ji); err != nil {
+						log.Printf("(proxy) Watch connection closed: %s\n", err)
+						return
+					}
+					flusher.Flush()
+				}
+			}
+		}
+
+		known := make(jobStates)
+		ticker := time.NewTicker(WatchPollInterval)
+		defer ticker.Stop()
+		for {
+			for _, ji := range known.diffJobInfos(pollJobInfos(impl, jobid)) {
+				if err := writeJobInfoEvent(w, ji); err != nil {
+					log.Printf("(proxy) Watch connection closed: %s\n", err)
+					return
+				}
+			}
+			flusher.Flush()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package proxy_test
+
+import (
+	. "github.com/dgruber/ubercluster/pkg/proxy"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/dgruber/ubercluster/pkg/client"
+	"github.com/dgruber/ubercluster/pkg/types"
+)
+
+// stateProxy is a ProxyImplementer which only knows job states.
+type stateProxy struct {
+	sync.Mutex
+	states map[string]types.JobState
+}
+
+func (sp *stateProxy) setState(jobid string, state types.JobState) {
+	sp.Lock()
+	defer sp.Unlock()
+	sp.states[jobid] = state
+}
+
+func (sp *stateProxy) GetJobInfosByFilter(filtered bool, filter types.JobInfo) []types.JobInfo {
+	sp.Lock()
+	defer sp.Unlock()
+	jis := make([]types.JobInfo, 0, len(sp.states))
+	for id, state := range sp.states {
+		jis = append(jis, types.JobInfo{Id: id, State: state})
+	}
+	return jis
+}
+
+func (sp *stateProxy) GetJobInfo(jobid string) *types.JobInfo {
+	sp.Lock()
+	defer sp.Unlock()
+	if state, exists := sp.states[jobid]; exists {
+		return &types.JobInfo{Id: jobid, State: state}
+	}
+	return nil
+}
+
+func (sp *stateProxy) GetAllMachines(machines []string) ([]types.Machine, error) { return nil, nil }
+func (sp *stateProxy) GetAllQueues(queues []string) ([]types.Queue, error)       { return nil, nil }
+func (sp *stateProxy) GetAllCategories() ([]string, error)                       { return nil, nil }
+func (sp *stateProxy) GetAllSessions(session []string) ([]string, error)         { return nil, nil }
+func (sp *stateProxy) DRMSVersion() string                                       { return "" }
+func (sp *stateProxy) DRMSName() string                                          { return "" }
+func (sp *stateProxy) DRMSLoad() float64                                         { return 0.0 }
+func (sp *stateProxy) RunJob(template types.JobTemplate) (string, error)         { return "", nil }
+func (sp *stateProxy) JobOperation(jobsessionname, operation, jobid string) (string, error) {
+	return "", nil
+}
+
+var errStop = errors.New("stop")
+
+var _ = Describe("ProxyWatch", func() {
+
+	var (
+		sp     *stateProxy
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		sp = &stateProxy{states: map[string]types.JobState{"1": types.Queued}}
+		server = httptest.NewServer(MakeMSessionJobInfosWatchHandler(sp, nil))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should stream the current state and all state changes of a job", func() {
+		states := make([]types.JobState, 0, 3)
+		c := client.New(server.URL, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.WatchJobInfos(ctx, "1", func(ji types.JobInfo) error {
+			Ω(ji.Id).Should(Equal("1"))
+			states = append(states, ji.State)
+			switch ji.State {
+			case types.Queued:
+				sp.setState("1", types.Running)
+			case types.Running:
+				sp.setState("1", types.Done)
+			case types.Done:
+				return errStop
+			}
+			return nil
+		})
+		Ω(err).Should(Equal(errStop))
+		Ω(states).Should(Equal([]types.JobState{types.Queued, types.Running, types.Done}))
+	})
+
+	It("should stream new jobs when watching all jobs", func() {
+		seen := make(map[string]bool)
+		c := client.New(server.URL, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := c.WatchJobInfos(ctx, "", func(ji types.JobInfo) error {
+			seen[ji.Id] = true
+			if ji.Id == "1" {
+				sp.setState("2", types.Running)
+				return nil
+			}
+			return errStop
+		})
+		Ω(err).Should(Equal(errStop))
+		Ω(seen).Should(HaveKey("1"))
+		Ω(seen).Should(HaveKey("2"))
+	})
+
+})
@@ -17,19 +17,15 @@
 package staging
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/dgruber/ubercluster/pkg/http_helper"
+	"github.com/dgruber/ubercluster/pkg/client"
 	"github.com/dgruber/ubercluster/pkg/output"
 	"github.com/dgruber/ubercluster/pkg/types"
-	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
 )
 
 type Filesystem struct {
@@ -64,42 +60,11 @@ func CheckUploadFilesystem(dirname string) error {
 
 // Client functionality
 
-func fileUpload(url string, params map[string]string, paramName, filePath string) (*http.Request, error) {
-	var err error
-	var file *os.File
-
-	if file, err = os.Open(filePath); err != nil {
-		log.Println("Error when opening local file: ", nil)
-		return nil, err
-	}
-	defer file.Close()
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile(paramName, filepath.Base(filePath))
-	if err != nil {
-		return nil, err
-	}
-
-	if _, err = io.Copy(part, file); err != nil {
-		log.Println("fileUpload copy error", err)
-		return nil, err
-	} else {
-		for key, val := range params {
-			_ = writer.WriteField(key, val)
-		}
-		if err = writer.Close(); err != nil {
-			log.Println("fileUpload writer close error", err)
-			return nil, err
-		}
-	}
-
-	if req, reqErr := http.NewRequest("POST", url, body); reqErr == nil {
-		req.Header.Add("Content-Type", writer.FormDataContentType())
-		return req, nil
-	} else {
-		return req, reqErr
-	}
+// proxyClient creates a client for the proxy at the given cluster address.
+func (fs *Filesystem) proxyClient(otp, clusteraddress string) *client.Client {
+	c := client.New(clusteraddress, fs.client)
+	c.SetOTP(otp)
+	return c
 }
 
 // FsUploadFile uploads a file given by the path to a given
@@ -109,62 +74,34 @@ func (fs *Filesystem) FsUploadFile(otp, clusteraddress, jsName, filename string)
 		fmt.Println("No filename given.")
 		return // nothing to do
 	}
-	url := fmt.Sprintf("%s/jsession/%s/staging/upload", clusteraddress, jsName)
-	log.Println("Created url: ", url)
-	params := make(map[string]string)
-	params["permission"] = "exec"
-	// set otp
-	if otp != "" {
-		params["otp"] = otp
-	}
-
-	if req, err := fileUpload(url, params, "file", filename); err != nil {
-		fmt.Println("Error during filupload: ", err)
+	err := fs.proxyClient(otp, clusteraddress).UploadFile(context.Background(), jsName, filename, true)
+	if err != nil {
+		fmt.Println("Error during file upload: ", err)
 		os.Exit(2)
-	} else {
-		log.Println("Request: ", req)
-		if r, err := fs.client.Do(req); err == nil {
-			r.Body.Close()
-			fmt.Println("Uploaded file ", filename, r.Status)
-		} else {
-			fmt.Println("Error during file upload: ", err)
-		}
 	}
 }
 
 // UC fs interface
 
-// fsListFiles requests a list of files from the given
-// cluster and displays it
-func getFiles(client *http.Client, otp, clusteraddress, jsName string) ([]types.FileInfo, error) {
-	request := fmt.Sprintf("%s/jsession/%s/staging/files", clusteraddress, jsName)
-	log.Println("Requesting:" + request)
-	resp, err := http_helper.UberGet(client, otp, request)
-	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
-	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	var fileinfo []types.FileInfo
-	if err := decoder.Decode(&fileinfo); err != nil {
-		return fileinfo, err
-	}
-	return fileinfo, nil
-}
-
 // FsListFiles lists all files on the remote staging area,
 // theirs sizes, and if they are executable (i.e. can run
-// as remote jobs).
+// as remote jobs), followed by the used space and the quotas.
 func (fs *Filesystem) FsListFiles(otp, clusteraddress, jsName string, of output.OutputFormater) {
-	if fi, err := getFiles(fs.client, otp, clusteraddress, jsName); err != nil {
+	c := fs.proxyClient(otp, clusteraddress)
+	fi, err := c.ListFiles(context.Background(), jsName)
+	if err != nil {
 		fmt.Println("Error during fetching files in staging area: ", err)
 		os.Exit(1)
+	}
+	area := types.StagingArea{Files: fi}
+	// older proxies don't report the usage
+	if usage, err := c.GetStagingUsage(context.Background(), jsName); err != nil {
+		log.Println("Can't get usage of staging area: ", err)
 	} else {
-		// output the files in the given interface
-		of.PrintFiles(fi)
+		area.Usage = &usage
 	}
+	// output the files in the given interface
+	of.PrintStagingArea(area)
 }
 
 // fsUploadFiles uploads a given list of files to the
@@ -173,31 +110,28 @@ func (fs *Filesystem) FsUploadFiles(otp, clusteraddress, jsName string, files []
 	log.Println("Uploading following files: ", files)
 	for _, file := range files {
 		fs.FsUploadFile(otp, clusteraddress, jsName, file)
+		if file == "" {
+			continue
+		}
+		of.PrintOperation(types.OperationResult{
+			Operation: "upload",
+			Object:    "file",
+			Id:        file,
+			Message:   fmt.Sprintf("Uploaded file  %s", file),
+		})
 	}
 }
 
-func (fs *Filesystem) DownloadFile(otp, clusteraddress, jsName, file string) {
-	url := fmt.Sprintf("%s/jsession/%s/staging/file/%s", clusteraddress, jsName, file)
-	log.Println("Using url: ", url)
-	if f, err := os.Create(file); err != nil {
+// DownloadFile stores a file of the staging area in the current
+// directory and returns its size.
+func (fs *Filesystem) DownloadFile(otp, clusteraddress, jsName, file string) (int64, error) {
+	f, err := os.Create(file)
+	if err != nil {
 		fmt.Println("Error during creation of file: ", err)
 		os.Exit(1)
-	} else {
-		defer f.Close()
-		if response, err := fs.client.Get(url); err != nil {
-			fmt.Println("Error during fetching file: ", err)
-			os.Exit(1)
-		} else {
-			defer response.Body.Close()
-			fmt.Println("Copy file now...")
-			size, err := io.Copy(f, response.Body)
-			if err != nil {
-				fmt.Println("Error while downloading", url, "-", err)
-				return
-			}
-			fmt.Printf("Downloaded file %s (%d bytes)\n", file, size)
-		}
 	}
+	defer f.Close()
+	return fs.proxyClient(otp, clusteraddress).DownloadFile(context.Background(), jsName, file, f)
 }
 
 // FsDownloadFiles downloads a list list of files from a
@@ -205,6 +139,16 @@ func (fs *Filesystem) DownloadFile(otp, clusteraddress, jsName, file string) {
 func (fs *Filesystem) FsDownloadFiles(otp, clusteraddress, jsName string, files []string, of output.OutputFormater) {
 	log.Println("Downloading following files: ", files)
 	for _, file := range files {
-		fs.DownloadFile(otp, clusteraddress, jsName, file)
+		size, err := fs.DownloadFile(otp, clusteraddress, jsName, file)
+		if err != nil {
+			fmt.Println("Error while downloading", file, "-", err)
+			continue
+		}
+		of.PrintOperation(types.OperationResult{
+			Operation: "download",
+			Object:    "file",
+			Id:        file,
+			Message:   fmt.Sprintf("Downloaded file %s (%d bytes)", file, size),
+		})
 	}
 }
@@ -131,6 +131,37 @@ type JobTemplate struct {
 	AccountingId      string            `json:"accountingString"`
 }
 
+// ReservationTemplate is an extensible struct which specifies the
+// resources requested by an advance reservation.
+type ReservationTemplate struct {
+	Extension         `xml:"-" json:"-"`
+	Name              string        `json:"name"`
+	StartTime         time.Time     `json:"startTime"`
+	EndTime           time.Time     `json:"endTime"`
+	Duration          time.Duration `json:"duration"`
+	MinSlots          int64         `json:"minSlots"`
+	MaxSlots          int64         `json:"maxSlots"`
+	JobCategory       string        `json:"jobCategory"`
+	UsersACL          []string      `json:"userACL"`
+	CandidateMachines []string      `json:"candidateMachines"`
+	MinPhysMemory     int64         `json:"minPhysMemory"`
+	MachineOs         string        `json:"machineOs"`
+	MachineArch       string        `json:"machineArch"`
+}
+
+// ReservationInfo is an extensible struct which represents an
+// advance reservation granted by the DRM.
+type ReservationInfo struct {
+	Extension            `xml:"-" json:"-"`
+	ReservationId        string    `json:"reservationId"`
+	ReservationName      string    `json:"reservationName"`
+	ReservationStartTime time.Time `json:"reservationStartTime"`
+	ReservationEndTime   time.Time `json:"reservationEndTime"`
+	ACL                  []string  `json:"acl"`
+	ReservedSlots        int64     `json:"reservedSlots"`
+	ReservedMachines     []string  `json:"reservedMachines"`
+}
+
 // CPU architecture types
 type CPU int
 
@@ -259,8 +290,8 @@ type Machine struct {
 	CoresPerSocket int64   `json:"coresPerSocket"`
 	ThreadsPerCore int64   `json:"threadsPerCore"`
 	Load           float64 `json:"load"`
-	PhysicalMemory int64   `json:"physicalMemory"`
-	VirtualMemory  int64   `json:"virtualMemory"`
+	PhysicalMemory int64   `json:"physicalMemory"` // KiB
+	VirtualMemory  int64   `json:"virtualMemory"`  // KiB
 	Architecture   CPU     `json:"architecture"`
 	OSVersion      Version `json:"osVersion"`
 	OS             OS      `json:"os"`
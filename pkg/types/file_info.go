@@ -16,9 +16,27 @@
 
 package types
 
+import "time"
+
 // FileInfo describes a file in the staging area
 type FileInfo struct {
-	Filename   string `json:"filename"`
-	Bytes      int64  `json:"bytes"`
-	Executable bool   `json:"executable"`
+	Filename   string     `json:"filename"`
+	Bytes      int64      `json:"bytes"`
+	Executable bool       `json:"executable"`
+	Owner      string     `json:"owner,omitempty"`   // identity which uploaded the file
+	Expires    *time.Time `json:"expires,omitempty"` // when the file is removed from the staging area
+}
+
+// StagingUsage is the space used in the staging area of a job session
+// and by the requesting identity in all job sessions. Quotas of 0 are
+// unlimited.
+type StagingUsage struct {
+	Session       string `json:"session"`
+	SessionBytes  int64  `json:"sessionBytes"`
+	SessionQuota  int64  `json:"sessionQuota"`
+	Identity      string `json:"identity"`
+	IdentityBytes int64  `json:"identityBytes"`
+	IdentityQuota int64  `json:"identityQuota"`
+	MaxFileSize   int64  `json:"maxFileSize"`
+	FileTTL       string `json:"fileTTL,omitempty"` // files are removed after that duration
 }
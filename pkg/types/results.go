@@ -0,0 +1,69 @@
+/*
+   Copyright 2018 Daniel Gruber, My blog: www.gridengine.eu
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+// RunJobResult is the answer of the proxy when a job was submitted.
+// uc adds the cluster the job runs in and, for job arrays, the amount
+// of tasks.
+type RunJobResult struct {
+	JobId   string `json:"jobid" xml:"jobid"`
+	Cluster string `json:"cluster,omitempty" xml:"cluster,omitempty"`
+	Tasks   int    `json:"tasks,omitempty" xml:"tasks,omitempty"`
+}
+
+// OperationResult is the result of an operation on a job, a job
+// session, an advance reservation, or a file of the staging area.
+type OperationResult struct {
+	Operation string `json:"operation" xml:"operation"` // like "terminate", "create", or "upload"
+	Object    string `json:"object" xml:"object"`       // "job", "session", "reservation", or "file"
+	Id        string `json:"id" xml:"id"`               // job id, name of the job session, ...
+	Message   string `json:"message" xml:"message"`     // answer of the proxy or description of the result
+}
+
+// StagingArea contains the files in the staging area of a job session
+// and the used space (not reported by older proxies).
+type StagingArea struct {
+	Files []FileInfo    `json:"files" xml:"file"`
+	Usage *StagingUsage `json:"usage,omitempty" xml:"usage,omitempty"`
+}
+
+// ClusterInfo is a cluster of the uc configuration. Shared secrets
+// given in the configuration are not included.
+type ClusterInfo struct {
+	Name            string   `json:"name" xml:"name"`
+	Address         string   `json:"address" xml:"address"`
+	ProtocolVersion string   `json:"protocolVersion" xml:"protocolVersion"`
+	Default         bool     `json:"default" xml:"default"`
+	Description     string   `json:"description,omitempty" xml:"description,omitempty"`
+	Tags            []string `json:"tags,omitempty" xml:"tag,omitempty"`
+	DefaultQueue    string   `json:"defaultQueue,omitempty" xml:"defaultQueue,omitempty"`
+	DefaultCategory string   `json:"defaultCategory,omitempty" xml:"defaultCategory,omitempty"`
+	Timeout         string   `json:"timeout,omitempty" xml:"timeout,omitempty"`
+	Credential      string   `json:"credential,omitempty" xml:"credential,omitempty"`
+	CertFile        string   `json:"certFile,omitempty" xml:"certFile,omitempty"`
+	KeyFile         string   `json:"keyFile,omitempty" xml:"keyFile,omitempty"`
+	CAFile          string   `json:"caFile,omitempty" xml:"caFile,omitempty"`
+	ServerName      string   `json:"serverName,omitempty" xml:"serverName,omitempty"`
+	Verify          string   `json:"verify,omitempty" xml:"verify,omitempty"`
+}
+
+// ConfigInfo is the uc configuration file with its clusters.
+type ConfigInfo struct {
+	File     string        `json:"file" xml:"file"`
+	Default  string        `json:"default" xml:"default"`
+	Clusters []ClusterInfo `json:"clusters" xml:"cluster"`
+}
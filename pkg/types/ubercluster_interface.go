@@ -16,6 +16,10 @@
 
 package types
 
+import (
+	"time"
+)
+
 // Session describes a DRMAA2 job session.
 type Session struct {
 	Name string
@@ -25,3 +29,126 @@ type RunLocalRequest struct {
 	Command string
 	Arg     string
 }
+
+// BulkJobRequest describes the submission of a job array like DRMAA2
+// RunBulkJobs. The job template is submitted once for each task index
+// from Begin to End (including) in steps of Step. MaxParallel limits
+// the amount of tasks running at the same time (0 is unlimited).
+type BulkJobRequest struct {
+	JobTemplate JobTemplate `json:"jobTemplate"`
+	Begin       int         `json:"begin"`
+	End         int         `json:"end"`
+	Step        int         `json:"step"`
+	MaxParallel int         `json:"maxParallel"`
+}
+
+// JobSessionRequest creates a job session with the given name.
+type JobSessionRequest struct {
+	Name string `json:"name"`
+}
+
+// ArrayJobInfo describes a job array and the current state of
+// all of its tasks.
+type ArrayJobInfo struct {
+	Id          string          `json:"id"`
+	Begin       int             `json:"begin"`
+	End         int             `json:"end"`
+	Step        int             `json:"step"`
+	MaxParallel int             `json:"maxParallel"`
+	Tasks       []ArrayTaskInfo `json:"tasks"`
+}
+
+// ArrayTaskInfo contains the job info of one task of a job array.
+// The job info of a task which is not yet submitted has no job id.
+type ArrayTaskInfo struct {
+	Index   int     `json:"index"`
+	JobInfo JobInfo `json:"jobInfo"`
+}
+
+// Error codes of an ErrorResponse. Each code is sent with
+// one particular http status code.
+const (
+	ErrorCodeInvalidRequest = "InvalidRequest" // 400
+	ErrorCodeUnauthorized   = "Unauthorized"   // 401
+	ErrorCodeForbidden      = "Forbidden"      // 403
+	ErrorCodeNotFound       = "NotFound"       // 404
+	ErrorCodeConflict       = "Conflict"       // 409
+	ErrorCodeQuotaExceeded  = "QuotaExceeded"  // 413
+	ErrorCodeInternal       = "InternalError"  // 500
+	ErrorCodeNotImplemented = "NotImplemented" // 501
+	ErrorCodeLoopDetected   = "LoopDetected"   // 508
+)
+
+// ErrorResponse is the JSON encoded body the proxy sends when a
+// request fails. Details contain additional information about the
+// failure like the job id.
+type ErrorResponse struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Headers of requests which are forwarded from one proxy to another
+// (like by uc in inception mode).
+const (
+	RequestIDHeader = "X-Ubercluster-Request-Id" // id of the original request
+	VisitedHeader   = "X-Ubercluster-Visited"    // comma separated ids of the forwarding proxies
+	// UnreachableHeader is set in answers which contain the results of
+	// the reachable proxies only. It contains the comma separated names
+	// of the proxies which did not answer.
+	UnreachableHeader = "X-Ubercluster-Unreachable"
+)
+
+// Hops describes the way of a request through a tree of proxies. The
+// request id is assigned by the first proxy and kept when the request
+// is forwarded. Visited contains the ids of all proxies which forwarded
+// the request in that order.
+type Hops struct {
+	RequestID string
+	Visited   []string
+}
+
+// PeerHeader contains the id of a proxy which exchanges jobs with
+// another proxy (job distribution) and PeerSecretHeader the secret
+// shared by both proxies which authenticates the id. Proxies which
+// authenticate with a client certificate are identified by its common
+// name instead.
+const (
+	PeerHeader       = "X-Ubercluster-Peer"
+	PeerSecretHeader = "X-Ubercluster-Peer-Secret"
+)
+
+// DistributedJob is a job which is passed from one proxy to another
+// when jobs are exchanged between clusters. JobId is the id of the job
+// in the proxy which passes the job. It is only set for fetched jobs.
+type DistributedJob struct {
+	JobId       string      `json:"jobId,omitempty"`
+	JobSession  string      `json:"jobSession"`
+	JobTemplate JobTemplate `json:"jobTemplate"`
+}
+
+// FetchConfirmation is sent by a proxy after it submitted a fetched
+// job. JobId is the id of the job in the fetching proxy.
+type FetchConfirmation struct {
+	JobId string `json:"jobId"`
+}
+
+// JobHistoryEntry is a job which was submitted through the proxy and
+// is stored in its job history. The job info is only available after
+// the job finished.
+type JobHistoryEntry struct {
+	JobId        string      `json:"jobId"`
+	JobTemplate  JobTemplate `json:"jobTemplate"`
+	JobInfo      *JobInfo    `json:"jobInfo,omitempty"`
+	SubmittedAt  time.Time   `json:"submittedAt"`
+	FinishedAt   time.Time   `json:"finishedAt"`
+	MigratedFrom string      `json:"migratedFrom,omitempty"` // job id (jobid@cluster) before a migration
+	MigratedTo   string      `json:"migratedTo,omitempty"`   // job id (jobid@cluster) after a migration
+}
+
+// JobMigration records that a job was moved from one cluster to
+// another. The job ids contain the cluster name (jobid@cluster).
+type JobMigration struct {
+	MigratedFrom string `json:"migratedFrom,omitempty"`
+	MigratedTo   string `json:"migratedTo,omitempty"`
+}